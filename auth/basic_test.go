@@ -0,0 +1,35 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestParseBasicToken(t *testing.T) {
+	user, pass, ok := ParseBasicToken(base64.StdEncoding.EncodeToString([]byte("user1:12345")))
+	if !ok {
+		t.Error("Expected: parsing successful, got parsing unsuccessful")
+	}
+	if user != "user1" {
+		t.Error("Expected: user: user1, got user:", user)
+	}
+	if pass != "12345" {
+		t.Error("Expected: password: 12345, got password:", pass)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/allegro/bigcache"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_cache_hits_total",
+		Help: "Total number of token review cache hits",
+	}, []string{"provider", "result"})
+	cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_cache_misses_total",
+		Help: "Total number of token review cache misses",
+	}, []string{"provider"})
+	cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guard_authn_cache_entries",
+		Help: "Current number of entries in the token review cache",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(cacheHits, cacheMisses, cacheEntries)
+}
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+
+	totalShards     = 128
+	maxEntrySize    = 512
+	maxEntriesInWin = 10 * 60 * 10
+)
+
+// Cache holds the results of token reviews. Tokens are never stored, entries
+// are keyed by an HMAC of the token with a random per process salt.
+// Successes and failures are kept in separate caches, so a flood of invalid
+// tokens can not evict valid ones.
+type Cache struct {
+	opts    Options
+	salt    []byte
+	success *bigcache.BigCache
+	failure *bigcache.BigCache
+	now     func() time.Time
+}
+
+type entry struct {
+	User      *authv1.UserInfo `json:"user,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Code      int              `json:"code,omitempty"`
+	Rejected  bool             `json:"rejected,omitempty"`
+	ExpiresAt int64            `json:"expiresAt"`
+}
+
+func New(opts Options) (*Cache, error) {
+	c := &Cache{
+		opts: opts,
+		salt: make([]byte, 32),
+		now:  time.Now,
+	}
+	if _, err := rand.Read(c.salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt for authn cache")
+	}
+
+	var err error
+	if opts.SuccessTTL > 0 {
+		if c.success, err = newBigCache(opts.SuccessTTL, opts.SizeMB); err != nil {
+			return nil, err
+		}
+	}
+	if opts.FailureTTL > 0 {
+		if c.failure, err = newBigCache(opts.FailureTTL, opts.SizeMB); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func newBigCache(ttl time.Duration, sizeMB int) (*bigcache.BigCache, error) {
+	cleanWindow := time.Minute
+	if ttl < cleanWindow {
+		cleanWindow = ttl
+	}
+	c, err := bigcache.NewBigCache(bigcache.Config{
+		Shards:             totalShards,
+		LifeWindow:         ttl,
+		CleanWindow:        cleanWindow,
+		MaxEntriesInWindow: maxEntriesInWin,
+		MaxEntrySize:       maxEntrySize,
+		HardMaxCacheSize:   sizeMB,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create authn cache")
+	}
+	return c, nil
+}
+
+// Wrap returns an auth.Interface that answers from the cache and stores the
+// results of client. scope must identify everything the result depends on
+// besides the token, e.g. the provider and the client cert common name.
+func (c *Cache) Wrap(client auth.Interface, scope string) auth.Interface {
+	return &cachedClient{Interface: client, cache: c, scope: scope}
+}
+
+type cachedClient struct {
+	auth.Interface
+	cache *Cache
+	scope string
+}
+
+func (p *cachedClient) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	key := p.cache.key(p.scope, token)
+	if e, ok := p.cache.get(p.UID(), key); ok {
+		return e.result()
+	}
+	cacheMisses.WithLabelValues(p.UID()).Inc()
+
+	user, err := p.Interface.Check(ctx, token)
+	p.cache.set(key, token, user, err)
+	return user, err
+}
+
+func (c *Cache) key(scope, token string) string {
+	mac := hmac.New(sha256.New, c.salt)
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Cache) get(provider, key string) (*entry, bool) {
+	for _, store := range []struct {
+		cache  *bigcache.BigCache
+		result string
+	}{{c.success, resultSuccess}, {c.failure, resultFailure}} {
+		if store.cache == nil {
+			continue
+		}
+		data, err := store.cache.Get(key)
+		if err != nil {
+			if !errors.Is(err, bigcache.ErrEntryNotFound) {
+				klog.Errorf("failed to read authn cache: %v", err)
+			}
+			continue
+		}
+		var e entry
+		if err = json.Unmarshal(data, &e); err != nil {
+			klog.Errorf("failed to decode authn cache entry: %v", err)
+			continue
+		}
+		if c.now().Unix() >= e.ExpiresAt {
+			continue
+		}
+
+		cacheHits.WithLabelValues(provider, store.result).Inc()
+		return &e, true
+	}
+	return nil, false
+}
+
+// result restores the outcome of the token review, including the HTTP
+// status code and the definitive rejection marker of failures
+func (e *entry) result() (*authv1.UserInfo, error) {
+	if e.User != nil {
+		return e.User, nil
+	}
+	err := errors.New(e.Error)
+	if e.Rejected {
+		err = auth.Reject(err)
+	}
+	if e.Code != 0 {
+		err = errutils.WithCode(err, e.Code)
+	}
+	return nil, err
+}
+
+func (c *Cache) set(key, token string, user *authv1.UserInfo, err error) {
+	store, ttl := c.success, c.opts.SuccessTTL
+	e := entry{User: user}
+	if err != nil {
+		if !cacheable(err) {
+			return
+		}
+		store, ttl = c.failure, c.opts.FailureTTL
+		e = entry{Error: err.Error(), Rejected: auth.IsRejected(err)}
+		var v errutils.HttpStatusCode
+		if errors.As(err, &v) {
+			e.Code = v.Code()
+		}
+	} else if user == nil {
+		return
+	}
+	if store == nil {
+		return
+	}
+
+	now := c.now()
+	expiresAt := now.Add(ttl)
+	if exp, ok := jwtExpiry(token); ok && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+	if !expiresAt.After(now) {
+		return
+	}
+	e.ExpiresAt = expiresAt.Unix()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		klog.Errorf("failed to encode authn cache entry: %v", err)
+		return
+	}
+	if err = store.Set(key, data); err != nil {
+		klog.Errorf("failed to write authn cache: %v", err)
+		return
+	}
+	cacheEntries.WithLabelValues(resultSuccess).Set(float64(c.len(c.success)))
+	cacheEntries.WithLabelValues(resultFailure).Set(float64(c.len(c.failure)))
+}
+
+func (c *Cache) len(store *bigcache.BigCache) int {
+	if store == nil {
+		return 0
+	}
+	return store.Len()
+}
+
+// cacheable reports whether a failure may be cached. Failures caused by the
+// provider being unavailable, e.g. rate limited, are retried on the next
+// request.
+func cacheable(err error) bool {
+	if auth.OutcomeOf(err) == auth.OutcomeUpstreamError {
+		return false
+	}
+	var coded errutils.HttpStatusCode
+	if errors.As(err, &coded) && coded.Code() >= http.StatusInternalServerError {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return !errors.As(err, &netErr)
+}
+
+// jwtExpiry returns the exp claim of token if it is a JWT. The signature is
+// not verified, the expiry is only used to shorten the cache lifetime.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
@@ -0,0 +1,230 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/auth/providers/github"
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+type fakeProvider struct {
+	calls int
+	user  *authv1.UserInfo
+	err   error
+}
+
+func (f *fakeProvider) UID() string {
+	return "fake"
+}
+
+func (f *fakeProvider) Check(_ context.Context, _ string) (*authv1.UserInfo, error) {
+	f.calls++
+	return f.user, f.err
+}
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestCache(t *testing.T, opts Options) (*Cache, *clock) {
+	c, err := New(opts)
+	if err != nil {
+		t.Fatalf("Error when creating cache. reason: %v", err)
+	}
+	clk := &clock{t: time.Now()}
+	c.now = clk.now
+	return c, clk
+}
+
+func jwtWithExpiry(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"nahid","exp":%d}`, exp.Unix())))
+	return "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2lnbmF0dXJl"
+}
+
+func TestCacheSuccess(t *testing.T) {
+	c, clk := newTestCache(t, Options{SuccessTTL: time.Minute, FailureTTL: 10 * time.Second, SizeMB: 1})
+	p := &fakeProvider{user: &authv1.UserInfo{Username: "nahid", Groups: []string{"dev"}}}
+	client := c.Wrap(p, "github/appscode")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Check(ctx, "token")
+		if assert.Nil(t, err) {
+			assert.Equal(t, p.user, resp)
+		}
+	}
+	assert.Equal(t, 1, p.calls, "provider must be called once")
+
+	// entries expire after the success ttl
+	clk.t = clk.t.Add(time.Minute + time.Second)
+	_, _ = client.Check(ctx, "token")
+	assert.Equal(t, 2, p.calls)
+}
+
+func TestCacheFailure(t *testing.T) {
+	c, clk := newTestCache(t, Options{SuccessTTL: time.Minute, FailureTTL: 10 * time.Second, SizeMB: 1})
+	p := &fakeProvider{err: errors.New("invalid token")}
+	client := c.Wrap(p, "gitlab/")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Check(ctx, "token")
+		assert.Nil(t, resp)
+		assert.EqualError(t, err, "invalid token")
+	}
+	assert.Equal(t, 1, p.calls, "provider must be called once")
+
+	// failures use their own ttl
+	clk.t = clk.t.Add(11 * time.Second)
+	_, _ = client.Check(ctx, "token")
+	assert.Equal(t, 2, p.calls)
+}
+
+func TestCacheFailureKeepsCodeAndRejection(t *testing.T) {
+	c, _ := newTestCache(t, Options{FailureTTL: time.Minute, SizeMB: 1})
+	p := &fakeProvider{err: errutils.WithCode(auth.Reject(errors.New("too many groups")), http.StatusOK)}
+	client := c.Wrap(p, "azure/")
+
+	_, _ = client.Check(context.Background(), "token")
+	_, err := client.Check(context.Background(), "token")
+	assert.Equal(t, 1, p.calls)
+	if assert.NotNil(t, err) {
+		assert.True(t, auth.IsRejected(err))
+		assert.EqualError(t, err, "too many groups")
+	}
+}
+
+func TestCacheFailureKeepsWrappedCode(t *testing.T) {
+	c, _ := newTestCache(t, Options{FailureTTL: time.Minute, SizeMB: 1})
+	p := &fakeProvider{err: errors.Wrap(errutils.WithCode(errors.New("bad request"), http.StatusBadRequest), "failed to get user")}
+	client := c.Wrap(p, "github/")
+
+	_, _ = client.Check(context.Background(), "token")
+	_, err := client.Check(context.Background(), "token")
+	assert.Equal(t, 1, p.calls)
+	var coded errutils.HttpStatusCode
+	if assert.True(t, errors.As(err, &coded)) {
+		assert.Equal(t, http.StatusBadRequest, coded.Code())
+	}
+}
+
+func TestCacheScope(t *testing.T) {
+	c, _ := newTestCache(t, Options{SuccessTTL: time.Minute, SizeMB: 1})
+	p := &fakeProvider{user: &authv1.UserInfo{Username: "nahid"}}
+
+	_, _ = c.Wrap(p, "github/appscode").Check(context.Background(), "token")
+	_, _ = c.Wrap(p, "github/kubeguard").Check(context.Background(), "token")
+	_, _ = c.Wrap(p, "github/appscode").Check(context.Background(), "other-token")
+	assert.Equal(t, 3, p.calls, "entries must not be shared across scopes or tokens")
+}
+
+func TestCacheDisabledResult(t *testing.T) {
+	// only failures are cached
+	c, _ := newTestCache(t, Options{FailureTTL: time.Minute, SizeMB: 1})
+	p := &fakeProvider{user: &authv1.UserInfo{Username: "nahid"}}
+	client := c.Wrap(p, "ldap/")
+
+	_, _ = client.Check(context.Background(), "token")
+	_, _ = client.Check(context.Background(), "token")
+	assert.Equal(t, 2, p.calls)
+}
+
+func TestCacheJWTExpiry(t *testing.T) {
+	c, clk := newTestCache(t, Options{SuccessTTL: time.Hour, SizeMB: 1})
+	p := &fakeProvider{user: &authv1.UserInfo{Username: "nahid"}}
+	client := c.Wrap(p, "oidc/")
+	ctx := context.Background()
+
+	token := jwtWithExpiry(clk.t.Add(time.Minute))
+	_, _ = client.Check(ctx, token)
+	_, _ = client.Check(ctx, token)
+	assert.Equal(t, 1, p.calls)
+
+	// the token expired before the cache ttl
+	clk.t = clk.t.Add(time.Minute + time.Second)
+	_, _ = client.Check(ctx, token)
+	assert.Equal(t, 2, p.calls)
+
+	// expired tokens are not cached
+	expired := jwtWithExpiry(clk.t.Add(-time.Second))
+	_, _ = client.Check(ctx, expired)
+	_, _ = client.Check(ctx, expired)
+	assert.Equal(t, 4, p.calls)
+}
+
+func TestCacheableErrors(t *testing.T) {
+	testData := []struct {
+		testName  string
+		err       error
+		cacheable bool
+	}{
+		{"plain error", errors.New("invalid token"), true},
+		{"4xx code", errutils.WithCode(errors.New("bad request"), http.StatusBadRequest), true},
+		{"5xx code", errutils.WithCode(errors.New("graph is down"), http.StatusInternalServerError), false},
+		{"wrapped 5xx code", errors.Wrap(errutils.WithCode(errors.New("graph is down"), http.StatusServiceUnavailable), "failed to get groups"), false},
+		{"rate limited", auth.WithOutcome(errors.Wrap(&github.RateLimitError{Reset: time.Now().Add(time.Minute)}, "failed to check user's membership"), auth.OutcomeUpstreamError), false},
+		{"not member", auth.WithOutcome(errors.New("user is not a member"), auth.OutcomeNotMember), true},
+		{"deadline exceeded", errors.Wrap(context.DeadlineExceeded, "failed to get groups"), false},
+		{"network error", errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "failed to connect"), false},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			assert.Equal(t, test.cacheable, cacheable(test.err))
+		})
+	}
+}
+
+func TestJWTExpiry(t *testing.T) {
+	exp := time.Unix(1893456000, 0)
+	testData := []struct {
+		testName string
+		token    string
+		expected time.Time
+		ok       bool
+	}{
+		{"jwt", jwtWithExpiry(exp), exp, true},
+		{"jwt without exp", "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"nahid"}`)) + ".c2ln", time.Time{}, false},
+		{"opaque token", "ghp_0123456789", time.Time{}, false},
+		{"invalid payload", "a.!!!.c", time.Time{}, false},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			got, ok := jwtExpiry(test.token)
+			assert.Equal(t, test.ok, ok)
+			assert.True(t, test.expected.Equal(got))
+		})
+	}
+}
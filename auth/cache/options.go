@@ -0,0 +1,97 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	defaultCacheSizeInMB = 50
+)
+
+type Options struct {
+	// How long a successful token review is cached, 0 disables caching of successes
+	SuccessTTL time.Duration
+
+	// How long a failed token review is cached, 0 disables caching of failures
+	FailureTTL time.Duration
+
+	// Limit for the memory used by each of the success and failure caches in MB,
+	// the oldest entries are overridden once the limit is reached
+	SizeMB int
+}
+
+func NewOptions() Options {
+	return Options{
+		SizeMB: defaultCacheSizeInMB,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&o.SuccessTTL, "authn-cache-success-ttl", o.SuccessTTL, "Duration to cache successful token reviews, set to 0 to disable. For JWT tokens the duration is capped by the token expiry")
+	fs.DurationVar(&o.FailureTTL, "authn-cache-failure-ttl", o.FailureTTL, "Duration to cache failed token reviews, set to 0 to disable")
+	fs.IntVar(&o.SizeMB, "authn-cache-size-mb", o.SizeMB, "Max size of the token review cache in MB, applies to successful and failed reviews separately")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if o.SuccessTTL < 0 {
+		errs = append(errs, errors.New("authn-cache-success-ttl must be non-negative"))
+	} else if o.SuccessTTL > 0 && o.SuccessTTL < time.Second {
+		errs = append(errs, errors.New("authn-cache-success-ttl must be at least 1s"))
+	}
+	if o.FailureTTL < 0 {
+		errs = append(errs, errors.New("authn-cache-failure-ttl must be non-negative"))
+	} else if o.FailureTTL > 0 && o.FailureTTL < time.Second {
+		errs = append(errs, errors.New("authn-cache-failure-ttl must be at least 1s"))
+	}
+	if o.Enabled() && o.SizeMB <= 0 {
+		errs = append(errs, errors.New("authn-cache-size-mb must be positive"))
+	}
+	return errs
+}
+
+func (o *Options) Enabled() bool {
+	return o.SuccessTTL > 0 || o.FailureTTL > 0
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	container := d.Spec.Template.Spec.Containers[0]
+
+	args := container.Args
+	if o.SuccessTTL > 0 {
+		args = append(args, fmt.Sprintf("--authn-cache-success-ttl=%v", o.SuccessTTL))
+	}
+	if o.FailureTTL > 0 {
+		args = append(args, fmt.Sprintf("--authn-cache-failure-ttl=%v", o.FailureTTL))
+	}
+	if o.Enabled() && o.SizeMB != defaultCacheSizeInMB {
+		args = append(args, fmt.Sprintf("--authn-cache-size-mb=%d", o.SizeMB))
+	}
+
+	container.Args = args
+	d.Spec.Template.Spec.Containers[0] = container
+
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        Options
+		expectedErr []error
+	}{
+		{
+			"disabled by default",
+			NewOptions(),
+			nil,
+		},
+		{
+			"enabled",
+			Options{SuccessTTL: time.Minute, FailureTTL: 10 * time.Second, SizeMB: 10},
+			nil,
+		},
+		{
+			"negative ttl",
+			Options{SuccessTTL: -time.Minute, FailureTTL: -time.Minute, SizeMB: 10},
+			[]error{
+				errors.New("authn-cache-success-ttl must be non-negative"),
+				errors.New("authn-cache-failure-ttl must be non-negative"),
+			},
+		},
+		{
+			"ttl below bigcache resolution",
+			Options{SuccessTTL: 500 * time.Millisecond, FailureTTL: time.Millisecond, SizeMB: 10},
+			[]error{
+				errors.New("authn-cache-success-ttl must be at least 1s"),
+				errors.New("authn-cache-failure-ttl must be at least 1s"),
+			},
+		},
+		{
+			"no size",
+			Options{SuccessTTL: time.Minute},
+			[]error{errors.New("authn-cache-size-mb must be positive")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
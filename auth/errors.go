@@ -0,0 +1,113 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+)
+
+// Reject marks err as a definitive rejection. Providers return it when the
+// token was recognized as theirs, e.g. its signature was verified, but the
+// user must not be authenticated. An authentication chain stops at a
+// definitive rejection instead of trying the remaining providers.
+// If err is nil, Reject returns nil.
+func Reject(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &rejected{cause: err}
+}
+
+// IsRejected reports whether any error in err's chain is a definitive rejection.
+func IsRejected(err error) bool {
+	var r *rejected
+	return errors.As(err, &r)
+}
+
+type rejected struct {
+	cause error
+}
+
+func (r *rejected) Error() string { return r.cause.Error() }
+func (r *rejected) Cause() error  { return r.cause }
+func (r *rejected) Unwrap() error { return r.cause }
+
+// Outcome classifies the result of a token review for the provider metrics
+type Outcome string
+
+const (
+	OutcomeSuccess       Outcome = "success"
+	OutcomeInvalidToken  Outcome = "invalid_token"
+	OutcomeNotMember     Outcome = "not_member"
+	OutcomeUpstreamError Outcome = "upstream_error"
+	OutcomeTimeout       Outcome = "timeout"
+)
+
+// WithOutcome annotates err with the outcome of the token review. Providers
+// use it where the outcome can not be derived from the error, e.g. a valid
+// token of a user outside of the organization.
+// If err is nil, WithOutcome returns nil.
+func WithOutcome(err error, outcome Outcome) error {
+	if err == nil {
+		return nil
+	}
+	return &withOutcome{cause: err, outcome: outcome}
+}
+
+// OutcomeOf returns the outcome of a token review that failed with err.
+// Errors without an annotated outcome are classified as timeout for deadline
+// and network timeouts, as upstream error for other network errors and 5xx
+// codes, and as invalid token otherwise.
+func OutcomeOf(err error) Outcome {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	var o *withOutcome
+	if errors.As(err, &o) {
+		return o.outcome
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return OutcomeTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return OutcomeTimeout
+		}
+		return OutcomeUpstreamError
+	}
+	var coded errutils.HttpStatusCode
+	if errors.As(err, &coded) && coded.Code() >= http.StatusInternalServerError {
+		return OutcomeUpstreamError
+	}
+	return OutcomeInvalidToken
+}
+
+type withOutcome struct {
+	cause   error
+	outcome Outcome
+}
+
+func (w *withOutcome) Error() string { return w.cause.Error() }
+func (w *withOutcome) Cause() error  { return w.cause }
+func (w *withOutcome) Unwrap() error { return w.cause }
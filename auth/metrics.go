@@ -0,0 +1,80 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+var (
+	providerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_provider_requests_total",
+		Help: "Total number of token reviews by provider and outcome",
+	}, []string{"provider", "outcome"})
+	providerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "guard_authn_provider_duration_seconds",
+		Help:    "Latency of token reviews by provider and outcome",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"provider", "outcome"})
+	providerGroups = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "guard_authn_provider_groups",
+		Help:    "Number of groups of authenticated users by provider",
+		Buckets: []float64{0, 1, 5, 10, 25, 50, 100, 200, 500},
+	}, []string{"provider"})
+	rateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guard_authn_provider_rate_limit_remaining",
+		Help: "Requests remaining in the current rate limit window of the upstream API, as last reported by the provider",
+	}, []string{"provider"})
+)
+
+func init() {
+	prometheus.MustRegister(providerRequests, providerDuration, providerGroups, rateLimitRemaining)
+}
+
+// SetRateLimitRemaining records the remaining requests reported by the
+// rate limit headers of the upstream API of a provider
+func SetRateLimitRemaining(provider string, remaining int) {
+	rateLimitRemaining.WithLabelValues(provider).Set(float64(remaining))
+}
+
+type instrumented struct {
+	Interface
+	provider string
+}
+
+// Instrument records the latency, outcome and group count of every token
+// review of client
+func Instrument(client Interface, provider string) Interface {
+	return instrumented{Interface: client, provider: provider}
+}
+
+func (c instrumented) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	start := time.Now()
+	resp, err := c.Interface.Check(ctx, token)
+
+	outcome := string(OutcomeOf(err))
+	providerRequests.WithLabelValues(c.provider, outcome).Inc()
+	providerDuration.WithLabelValues(c.provider, outcome).Observe(time.Since(start).Seconds())
+	if err == nil && resp != nil {
+		providerGroups.WithLabelValues(c.provider).Observe(float64(len(resp.Groups)))
+	}
+	return resp, err
+}
@@ -0,0 +1,114 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestOutcomeOf(t *testing.T) {
+	testData := []struct {
+		testName string
+		err      error
+		outcome  Outcome
+	}{
+		{"success", nil, OutcomeSuccess},
+		{"plain error", errors.New("invalid token"), OutcomeInvalidToken},
+		{"4xx code", errutils.WithCode(errors.New("bad request"), http.StatusBadRequest), OutcomeInvalidToken},
+		{"5xx code", errutils.WithCode(errors.New("graph is down"), http.StatusBadGateway), OutcomeUpstreamError},
+		{"deadline exceeded", errors.Wrap(context.DeadlineExceeded, "failed to get groups"), OutcomeTimeout},
+		{"network timeout", errors.Wrap(&net.OpError{Op: "read", Err: timeoutError{}}, "failed to read"), OutcomeTimeout},
+		{"network error", errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "failed to connect"), OutcomeUpstreamError},
+		{"annotated", errors.Wrap(WithOutcome(errors.New("not in domain"), OutcomeNotMember), "failed"), OutcomeNotMember},
+		{"annotated wins over code", WithOutcome(errutils.WithCode(errors.New("not found"), http.StatusInternalServerError), OutcomeNotMember), OutcomeNotMember},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			assert.Equal(t, test.outcome, OutcomeOf(test.err))
+		})
+	}
+}
+
+func TestWithOutcomeKeepsError(t *testing.T) {
+	assert.Nil(t, WithOutcome(nil, OutcomeNotMember))
+
+	err := WithOutcome(errutils.WithCode(Reject(errors.New("not in domain")), http.StatusOK), OutcomeNotMember)
+	assert.EqualError(t, err, "not in domain")
+	assert.True(t, IsRejected(err))
+	var coded errutils.HttpStatusCode
+	if assert.True(t, errors.As(err, &coded)) {
+		assert.Equal(t, http.StatusOK, coded.Code())
+	}
+}
+
+type fakeProvider struct {
+	user *authv1.UserInfo
+	err  error
+}
+
+func (f fakeProvider) UID() string { return "fake" }
+
+func (f fakeProvider) Check(_ context.Context, _ string) (*authv1.UserInfo, error) {
+	return f.user, f.err
+}
+
+func TestInstrument(t *testing.T) {
+	ok := Instrument(fakeProvider{user: &authv1.UserInfo{Username: "nahid", Groups: []string{"dev", "ops"}}}, "fake-ok")
+	failed := Instrument(fakeProvider{err: WithOutcome(errors.New("not a member"), OutcomeNotMember)}, "fake-failed")
+
+	assert.Equal(t, "fake", ok.UID())
+	_, _ = ok.Check(context.Background(), "token")
+	_, _ = ok.Check(context.Background(), "token")
+	_, err := failed.Check(context.Background(), "token")
+	assert.EqualError(t, err, "not a member")
+
+	assert.Equal(t, float64(2), metricValue(t, providerRequests.WithLabelValues("fake-ok", "success")).GetCounter().GetValue())
+	assert.Equal(t, float64(1), metricValue(t, providerRequests.WithLabelValues("fake-failed", "not_member")).GetCounter().GetValue())
+	groups := metricValue(t, providerGroups.WithLabelValues("fake-ok").(prometheus.Metric)).GetHistogram()
+	assert.Equal(t, uint64(2), groups.GetSampleCount())
+	assert.Equal(t, float64(4), groups.GetSampleSum())
+	assert.Equal(t, uint64(0), metricValue(t, providerGroups.WithLabelValues("fake-failed").(prometheus.Metric)).GetHistogram().GetSampleCount())
+
+	SetRateLimitRemaining("fake-ok", 4999)
+	assert.Equal(t, float64(4999), metricValue(t, rateLimitRemaining.WithLabelValues("fake-ok")).GetGauge().GetValue())
+}
+
+func metricValue(t *testing.T, m prometheus.Metric) *dto.Metric {
+	out := &dto.Metric{}
+	if err := m.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -29,6 +29,7 @@ import (
 	"go.kubeguard.dev/guard/auth/providers/azure/graph"
 	azureutils "go.kubeguard.dev/guard/util/azure"
 	errutils "go.kubeguard.dev/guard/util/error"
+	"go.kubeguard.dev/guard/util/httpclient"
 
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/coreos/go-oidc"
@@ -222,6 +223,20 @@ func (s Authenticator) UID() string {
 	return OrgType
 }
 
+// Ready checks the Azure AD metadata and the key set used to verify tokens
+// are reachable
+func (o Options) Ready(ctx context.Context) error {
+	env := azure.PublicCloud
+	if o.Environment != "" {
+		var err error
+		env, err = azure.EnvironmentFromName(o.Environment)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse environment for azure")
+		}
+	}
+	return auth.CheckOIDCMetadata(ctx, httpclient.DefaultHTTPClient, env.ActiveDirectoryEndpoint+o.TenantID+"/.well-known/openid-configuration")
+}
+
 func (s Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
 	var err error
 
@@ -0,0 +1,274 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/httpclient"
+
+	gooidc "github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	OrgType = "ci"
+
+	PlatformGitHubActions = "github-actions"
+	PlatformGitLab        = "gitlab"
+)
+
+var SupportedPlatforms = []string{PlatformGitHubActions, PlatformGitLab}
+
+func init() {
+	auth.SupportedOrgs = append(auth.SupportedOrgs, OrgType)
+}
+
+// preset maps the claims of a CI platform's job tokens to the user info
+type preset struct {
+	issuer string
+	// jwksPath is the path of the key set relative to the issuer
+	jwksPath string
+
+	// repositoryClaim holds the path of the repository running the job,
+	// it is used as user name
+	repositoryClaim string
+	// ownerClaim holds the org, user or group owning the repository
+	ownerClaim string
+	// workflowClaim holds the ref of the workflow or pipeline definition
+	workflowClaim string
+	// uidClaim holds the immutable id of the repository
+	uidClaim string
+	// extraClaims are copied into the user's extra
+	extraClaims []string
+}
+
+var presets = map[string]preset{
+	PlatformGitHubActions: {
+		issuer:          "https://token.actions.githubusercontent.com",
+		jwksPath:        "/.well-known/jwks",
+		repositoryClaim: "repository",
+		ownerClaim:      "repository_owner",
+		workflowClaim:   "job_workflow_ref",
+		uidClaim:        "repository_id",
+		extraClaims:     []string{"repository", "ref", "environment", "job_workflow_ref", "sha", "actor", "event_name", "run_id"},
+	},
+	PlatformGitLab: {
+		issuer:          "https://gitlab.com",
+		jwksPath:        "/oauth/discovery/keys",
+		repositoryClaim: "project_path",
+		ownerClaim:      "namespace_path",
+		workflowClaim:   "ci_config_ref_uri",
+		uidClaim:        "project_id",
+		extraClaims:     []string{"project_path", "ref", "environment", "ci_config_ref_uri", "sha", "user_login", "pipeline_source", "pipeline_id"},
+	},
+}
+
+// cachedKeySets holds the key sets keyed by url, the keys are cached by the
+// key set and refreshed when a token is signed with an unknown key
+var (
+	cachedKeySets      = map[string]gooidc.KeySet{}
+	cachedKeySetsMutex = &sync.Mutex{}
+)
+
+type Authenticator struct {
+	opts     Options
+	preset   preset
+	rules    []rule
+	verifier *gooidc.IDTokenVerifier
+}
+
+// New is called per authentication request
+func New(opts Options) (auth.Interface, error) {
+	return newAuthenticator(opts, getKeySet(opts.jwksURL()))
+}
+
+func newAuthenticator(opts Options, keySet gooidc.KeySet) (*Authenticator, error) {
+	p, ok := presets[opts.Platform]
+	if !ok {
+		return nil, errors.Errorf("unknown ci platform %s", opts.Platform)
+	}
+	rules := make([]rule, 0, len(opts.AllowRules))
+	for _, s := range opts.AllowRules {
+		r, err := parseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	return &Authenticator{
+		opts:   opts,
+		preset: p,
+		rules:  rules,
+		verifier: gooidc.NewVerifier(opts.issuer(), keySet, &gooidc.Config{
+			// audiences are matched against the list in Check
+			SkipClientIDCheck: true,
+		}),
+	}, nil
+}
+
+func getKeySet(jwksURL string) gooidc.KeySet {
+	cachedKeySetsMutex.Lock()
+	defer cachedKeySetsMutex.Unlock()
+
+	if ks, ok := cachedKeySets[jwksURL]; ok {
+		return ks
+	}
+	// NOTE: we use a root context here to allow background remote key set refresh
+	ks := gooidc.NewRemoteKeySet(gooidc.ClientContext(context.Background(), httpclient.DefaultHTTPClient), jwksURL)
+	cachedKeySets[jwksURL] = ks
+	return ks
+}
+
+func (a Authenticator) UID() string {
+	return OrgType
+}
+
+// Ready checks the key set of the issuer is reachable
+func (o Options) Ready(ctx context.Context) error {
+	return auth.CheckKeySet(ctx, httpclient.DefaultHTTPClient, o.jwksURL())
+}
+
+func (a *Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	idToken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify token for ci")
+	}
+
+	// the token is signed by the issuer, it must not be tried by other providers
+	resp, err := a.userInfo(idToken)
+	if err != nil {
+		return nil, auth.Reject(err)
+	}
+
+	klog.V(7).Infof("ci job of %s authenticated with %d groups", resp.Username, len(resp.Groups))
+	return resp, nil
+}
+
+// userInfo maps the claims of a verified token to the user info. The user
+// name is <platform>:<repository>, the groups are
+//
+//	<platform>:<owner>
+//	<platform>:<repository>:ref:<ref>
+//	<platform>:<repository>:environment:<environment>
+//	<platform>:workflow:<workflow ref>
+//
+// the last two only if the job has an environment or a workflow ref.
+func (a *Authenticator) userInfo(idToken *gooidc.IDToken) (*authv1.UserInfo, error) {
+	if !hasAudience(idToken.Audience, a.opts.Audiences) {
+		return nil, errors.Errorf("token audience %q does not match any of %q", idToken.Audience, a.opts.Audiences)
+	}
+
+	c := claims{}
+	if err := idToken.Claims(&c); err != nil {
+		return nil, errors.Wrap(err, "failed to get claims from token")
+	}
+
+	repository := c.str(a.preset.repositoryClaim)
+	if repository == "" {
+		return nil, errors.Errorf("claim %s is empty", a.preset.repositoryClaim)
+	}
+	ref := c.ref()
+	if ref == "" {
+		return nil, errors.New("claim ref is empty")
+	}
+	if !a.allowed(repository, ref) {
+		return nil, errors.Errorf("repository %s is not allowed to authenticate from ref %s", repository, ref)
+	}
+
+	prefix := a.opts.Platform + ":"
+	resp := &authv1.UserInfo{
+		Username: prefix + repository,
+		UID:      c.str(a.preset.uidClaim),
+	}
+	if owner := c.str(a.preset.ownerClaim); owner != "" {
+		resp.Groups = append(resp.Groups, prefix+owner)
+	}
+	resp.Groups = append(resp.Groups, fmt.Sprintf("%s%s:ref:%s", prefix, repository, ref))
+	if env := c.str("environment"); env != "" {
+		resp.Groups = append(resp.Groups, fmt.Sprintf("%s%s:environment:%s", prefix, repository, env))
+	}
+	if workflow := c.str(a.preset.workflowClaim); workflow != "" {
+		resp.Groups = append(resp.Groups, prefix+"workflow:"+workflow)
+	}
+
+	for _, name := range a.preset.extraClaims {
+		if v := c.str(name); v != "" {
+			if resp.Extra == nil {
+				resp.Extra = map[string]authv1.ExtraValue{}
+			}
+			resp.Extra[name] = authv1.ExtraValue{v}
+		}
+	}
+	return resp, nil
+}
+
+func (a *Authenticator) allowed(repository, ref string) bool {
+	for _, r := range a.rules {
+		if r.matches(repository, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAudience(tokenAud, accepted []string) bool {
+	for _, aud := range tokenAud {
+		for _, a := range accepted {
+			if aud == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type claims map[string]interface{}
+
+// str returns the claim as string, numeric ids are formatted as integers
+func (c claims) str(name string) string {
+	switch v := c[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// ref returns the fully qualified git ref of the job. GitHub issues fully
+// qualified refs, GitLab issues the branch or tag name with a ref_type claim.
+func (c claims) ref() string {
+	ref := c.str("ref")
+	if ref == "" || strings.HasPrefix(ref, "refs/") {
+		return ref
+	}
+	switch c.str("ref_type") {
+	case "branch":
+		return "refs/heads/" + ref
+	case "tag":
+		return "refs/tags/" + ref
+	}
+	return ref
+}
@@ -0,0 +1,320 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const audience = "https://kubernetes.example.com"
+
+type signingKey struct {
+	priv *rsa.PrivateKey
+}
+
+func newSigningKey(t *testing.T) *signingKey {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error when creating signing key. reason : %v", err)
+	}
+	return &signingKey{priv: priv}
+}
+
+func (s *signingKey) sign(t *testing.T, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: s.priv}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// jwksServerSetup serves the public part of key as key set, the same way the
+// CI platforms publish their keys
+func jwksServerSetup(t *testing.T, key *signingKey) *httptest.Server {
+	keySet := jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: key.priv.Public(), Use: "sig", Algorithm: string(jose.RS256)}},
+	}
+	resp, err := json.Marshal(keySet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(resp)
+	}))
+}
+
+func githubClaims(issuer string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":              issuer,
+		"aud":              audience,
+		"exp":              time.Now().Add(time.Hour).Unix(),
+		"sub":              "repo:appscode/guard:ref:refs/heads/main",
+		"repository":       "appscode/guard",
+		"repository_owner": "appscode",
+		"repository_id":    "93845734",
+		"ref":              "refs/heads/main",
+		"ref_type":         "branch",
+		"job_workflow_ref": "appscode/guard/.github/workflows/deploy.yml@refs/heads/main",
+		"actor":            "nahid",
+		"event_name":       "push",
+	}
+}
+
+func gitlabClaims(issuer string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":               issuer,
+		"aud":               audience,
+		"exp":               time.Now().Add(time.Hour).Unix(),
+		"sub":               "project_path:appscode/infra/guard:ref_type:tag:ref:v1.0.0",
+		"project_path":      "appscode/infra/guard",
+		"project_id":        "42",
+		"namespace_path":    "appscode/infra",
+		"ref":               "v1.0.0",
+		"ref_type":          "tag",
+		"environment":       "production",
+		"ci_config_ref_uri": "gitlab.com/appscode/infra/guard//.gitlab-ci.yml@refs/tags/v1.0.0",
+		"user_login":        "nahid",
+	}
+}
+
+func TestCheckCI(t *testing.T) {
+	key := newSigningKey(t)
+	srv := jwksServerSetup(t, key)
+	defer srv.Close()
+
+	other := newSigningKey(t)
+
+	dataset := []struct {
+		testName     string
+		platform     string
+		allow        []string
+		claims       func(issuer string) map[string]interface{}
+		signer       *signingKey
+		expectedUser *authv1.UserInfo
+	}{
+		{
+			"github actions branch",
+			PlatformGitHubActions,
+			[]string{"appscode/*:refs/heads/main"},
+			githubClaims,
+			key,
+			&authv1.UserInfo{
+				Username: "github-actions:appscode/guard",
+				UID:      "93845734",
+				Groups: []string{
+					"github-actions:appscode",
+					"github-actions:appscode/guard:ref:refs/heads/main",
+					"github-actions:workflow:appscode/guard/.github/workflows/deploy.yml@refs/heads/main",
+				},
+				Extra: map[string]authv1.ExtraValue{
+					"repository":       {"appscode/guard"},
+					"ref":              {"refs/heads/main"},
+					"job_workflow_ref": {"appscode/guard/.github/workflows/deploy.yml@refs/heads/main"},
+					"actor":            {"nahid"},
+					"event_name":       {"push"},
+				},
+			},
+		},
+		{
+			"gitlab tag with environment",
+			PlatformGitLab,
+			[]string{"appscode/infra/guard:refs/tags/v*"},
+			gitlabClaims,
+			key,
+			&authv1.UserInfo{
+				Username: "gitlab:appscode/infra/guard",
+				UID:      "42",
+				Groups: []string{
+					"gitlab:appscode/infra",
+					"gitlab:appscode/infra/guard:ref:refs/tags/v1.0.0",
+					"gitlab:appscode/infra/guard:environment:production",
+					"gitlab:workflow:gitlab.com/appscode/infra/guard//.gitlab-ci.yml@refs/tags/v1.0.0",
+				},
+				Extra: map[string]authv1.ExtraValue{
+					"project_path":      {"appscode/infra/guard"},
+					"ref":               {"v1.0.0"},
+					"environment":       {"production"},
+					"ci_config_ref_uri": {"gitlab.com/appscode/infra/guard//.gitlab-ci.yml@refs/tags/v1.0.0"},
+					"user_login":        {"nahid"},
+				},
+			},
+		},
+		{
+			"rule without ref",
+			PlatformGitHubActions,
+			[]string{"appscode/guard"},
+			func(issuer string) map[string]interface{} {
+				c := githubClaims(issuer)
+				c["ref"] = "refs/pull/1/merge"
+				return c
+			},
+			key,
+			&authv1.UserInfo{
+				Username: "github-actions:appscode/guard",
+				UID:      "93845734",
+				Groups: []string{
+					"github-actions:appscode",
+					"github-actions:appscode/guard:ref:refs/pull/1/merge",
+					"github-actions:workflow:appscode/guard/.github/workflows/deploy.yml@refs/heads/main",
+				},
+				Extra: map[string]authv1.ExtraValue{
+					"repository":       {"appscode/guard"},
+					"ref":              {"refs/pull/1/merge"},
+					"job_workflow_ref": {"appscode/guard/.github/workflows/deploy.yml@refs/heads/main"},
+					"actor":            {"nahid"},
+					"event_name":       {"push"},
+				},
+			},
+		},
+		{
+			"ref not allowed",
+			PlatformGitHubActions,
+			[]string{"appscode/guard:refs/heads/release"},
+			githubClaims,
+			key,
+			nil,
+		},
+		{
+			"repository not allowed",
+			PlatformGitHubActions,
+			[]string{"kubeguard/*"},
+			githubClaims,
+			key,
+			nil,
+		},
+		{
+			"gitlab subgroup does not match single level pattern",
+			PlatformGitLab,
+			[]string{"appscode/*"},
+			gitlabClaims,
+			key,
+			nil,
+		},
+		{
+			"audience mismatch",
+			PlatformGitHubActions,
+			[]string{"appscode/*"},
+			func(issuer string) map[string]interface{} {
+				c := githubClaims(issuer)
+				c["aud"] = "sts.amazonaws.com"
+				return c
+			},
+			key,
+			nil,
+		},
+		{
+			"bad issuer",
+			PlatformGitHubActions,
+			[]string{"appscode/*"},
+			func(issuer string) map[string]interface{} {
+				return githubClaims("https://token.actions.githubusercontent.com")
+			},
+			key,
+			nil,
+		},
+		{
+			"expired token",
+			PlatformGitHubActions,
+			[]string{"appscode/*"},
+			func(issuer string) map[string]interface{} {
+				c := githubClaims(issuer)
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+				return c
+			},
+			key,
+			nil,
+		},
+		{
+			"unknown signing key",
+			PlatformGitHubActions,
+			[]string{"appscode/*"},
+			githubClaims,
+			other,
+			nil,
+		},
+	}
+
+	for _, test := range dataset {
+		t.Run(test.testName, func(t *testing.T) {
+			opts := Options{
+				Platform:   test.platform,
+				IssuerURL:  srv.URL,
+				JWKSURL:    srv.URL + "/.well-known/jwks",
+				Audiences:  []string{audience},
+				AllowRules: test.allow,
+			}
+			a, err := newAuthenticator(opts, gooidc.NewRemoteKeySet(context.Background(), opts.JWKSURL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := a.Check(context.Background(), test.signer.sign(t, test.claims(srv.URL)))
+			if test.expectedUser == nil {
+				assert.NotNil(t, err)
+				assert.Nil(t, resp)
+			} else {
+				if assert.Nil(t, err) {
+					assert.Equal(t, test.expectedUser, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestReady(t *testing.T) {
+	key := newSigningKey(t)
+	srv := jwksServerSetup(t, key)
+	defer srv.Close()
+
+	opts := Options{Platform: PlatformGitHubActions, IssuerURL: srv.URL}
+	assert.Nil(t, opts.Ready(context.Background()))
+
+	// the default key set of gitlab is not served
+	opts = Options{Platform: PlatformGitLab, IssuerURL: srv.URL}
+	if err := opts.Ready(context.Background()); assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "/oauth/discovery/keys"))
+	}
+}
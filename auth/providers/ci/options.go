@@ -0,0 +1,172 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type Options struct {
+	// Platform selects the preset claim mapping, one of github-actions or
+	// gitlab
+	Platform string
+
+	// IssuerURL must match the token's iss claim, defaults to the issuer
+	// of the platform, e.g. https://token.actions.githubusercontent.com
+	IssuerURL string
+
+	// JWKSURL is the key set used to verify token signatures, defaults to
+	// the key set published by the issuer
+	JWKSURL string
+
+	// Audiences accepted in the token's aud claim, at least one must match
+	Audiences []string
+
+	// AllowRules restricts the repositories and refs that may authenticate,
+	// see parseRule for the format
+	AllowRules []string
+}
+
+func NewOptions() Options {
+	return Options{
+		Platform: PlatformGitHubActions,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Platform, "ci.platform", o.Platform, fmt.Sprintf("CI platform issuing the tokens, one of %s", strings.Join(SupportedPlatforms, ", ")))
+	fs.StringVar(&o.IssuerURL, "ci.issuer-url", o.IssuerURL, "Issuer that must match the token's iss claim, defaults to the issuer of the platform")
+	fs.StringVar(&o.JWKSURL, "ci.jwks-url", o.JWKSURL, "URL of the key set used to verify token signatures, defaults to the key set of the issuer")
+	fs.StringSliceVar(&o.Audiences, "ci.audiences", o.Audiences, "List of audiences accepted in the token's aud claim")
+	fs.StringSliceVar(&o.AllowRules, "ci.allow", o.AllowRules, "List of <repository>[:<ref>] glob patterns, e.g. my-org/*:refs/heads/main. Only tokens of a matching repository and ref are authenticated")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if !slices.Contains(SupportedPlatforms, o.Platform) {
+		errs = append(errs, errors.Errorf("ci.platform must be one of %s", strings.Join(SupportedPlatforms, ", ")))
+	}
+	if o.IssuerURL != "" && !isHTTPSURL(o.IssuerURL) {
+		errs = append(errs, errors.New("ci.issuer-url must be a valid https url"))
+	}
+	if o.JWKSURL != "" && !isHTTPSURL(o.JWKSURL) {
+		errs = append(errs, errors.New("ci.jwks-url must be a valid https url"))
+	}
+	if len(o.Audiences) == 0 {
+		errs = append(errs, errors.New("ci.audiences must be non-empty"))
+	}
+	// without rules every repository hosted on the platform could authenticate
+	if len(o.AllowRules) == 0 {
+		errs = append(errs, errors.New("ci.allow must be non-empty"))
+	}
+	for _, r := range o.AllowRules {
+		if _, err := parseRule(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func isHTTPSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	container := d.Spec.Template.Spec.Containers[0]
+
+	args := container.Args
+	if o.Platform != "" {
+		args = append(args, fmt.Sprintf("--ci.platform=%s", o.Platform))
+	}
+	if o.IssuerURL != "" {
+		args = append(args, fmt.Sprintf("--ci.issuer-url=%s", o.IssuerURL))
+	}
+	if o.JWKSURL != "" {
+		args = append(args, fmt.Sprintf("--ci.jwks-url=%s", o.JWKSURL))
+	}
+	if len(o.Audiences) > 0 {
+		args = append(args, fmt.Sprintf("--ci.audiences=%s", strings.Join(o.Audiences, ",")))
+	}
+	if len(o.AllowRules) > 0 {
+		args = append(args, fmt.Sprintf("--ci.allow=%s", strings.Join(o.AllowRules, ",")))
+	}
+
+	container.Args = args
+	d.Spec.Template.Spec.Containers[0] = container
+
+	return extraObjs, nil
+}
+
+// issuer returns the configured issuer or the issuer of the platform
+func (o Options) issuer() string {
+	if o.IssuerURL != "" {
+		return o.IssuerURL
+	}
+	return presets[o.Platform].issuer
+}
+
+// jwksURL returns the configured key set or the key set of the issuer
+func (o Options) jwksURL() string {
+	if o.JWKSURL != "" {
+		return o.JWKSURL
+	}
+	return strings.TrimSuffix(o.issuer(), "/") + presets[o.Platform].jwksPath
+}
+
+// rule allows the repositories matching repository to authenticate from the
+// refs matching ref, an empty ref matches any ref
+type rule struct {
+	repository string
+	ref        string
+}
+
+// parseRule parses a <repository>[:<ref>] allow rule. Both parts are
+// path.Match patterns, so * does not match a /. Refs are fully qualified,
+// e.g. refs/heads/main or refs/tags/v*.
+func parseRule(s string) (rule, error) {
+	repo, ref, _ := strings.Cut(strings.TrimSpace(s), ":")
+	if repo == "" {
+		return rule{}, errors.Errorf("ci.allow rule %q has no repository", s)
+	}
+	for _, p := range []string{repo, ref} {
+		if _, err := path.Match(p, ""); err != nil {
+			return rule{}, errors.Errorf("ci.allow rule %q has a malformed pattern %s", s, p)
+		}
+	}
+	return rule{repository: repo, ref: ref}, nil
+}
+
+func (r rule) matches(repository, ref string) bool {
+	if ok, _ := path.Match(r.repository, repository); !ok {
+		return false
+	}
+	if r.ref == "" {
+		return true
+	}
+	ok, _ := path.Match(r.ref, ref)
+	return ok
+}
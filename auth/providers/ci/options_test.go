@@ -0,0 +1,95 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        Options
+		expectedErr []error
+	}{
+		{
+			"github actions defaults",
+			Options{Platform: PlatformGitHubActions, Audiences: []string{"kubernetes"}, AllowRules: []string{"appscode/*:refs/heads/main"}},
+			nil,
+		},
+		{
+			"self-managed gitlab",
+			Options{
+				Platform:   PlatformGitLab,
+				IssuerURL:  "https://gitlab.example.com",
+				JWKSURL:    "https://gitlab.example.com/oauth/discovery/keys",
+				Audiences:  []string{"kubernetes"},
+				AllowRules: []string{"infra/*/*", "infra/guard:refs/tags/v*"},
+			},
+			nil,
+		},
+		{
+			"empty",
+			Options{},
+			[]error{
+				errors.New("ci.platform must be one of github-actions, gitlab"),
+				errors.New("ci.audiences must be non-empty"),
+				errors.New("ci.allow must be non-empty"),
+			},
+		},
+		{
+			"invalid urls and rules",
+			Options{
+				Platform:   "jenkins",
+				IssuerURL:  "http://gitlab.example.com",
+				JWKSURL:    "gitlab.example.com/keys",
+				Audiences:  []string{"kubernetes"},
+				AllowRules: []string{":refs/heads/main", "appscode/[guard"},
+			},
+			[]error{
+				errors.New("ci.platform must be one of github-actions, gitlab"),
+				errors.New("ci.issuer-url must be a valid https url"),
+				errors.New("ci.jwks-url must be a valid https url"),
+				errors.New(`ci.allow rule ":refs/heads/main" has no repository`),
+				errors.New(`ci.allow rule "appscode/[guard" has a malformed pattern appscode/[guard`),
+			},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
+
+func TestJWKSURL(t *testing.T) {
+	assert.Equal(t, "https://token.actions.githubusercontent.com/.well-known/jwks", Options{Platform: PlatformGitHubActions}.jwksURL())
+	assert.Equal(t, "https://gitlab.example.com/oauth/discovery/keys", Options{Platform: PlatformGitLab, IssuerURL: "https://gitlab.example.com/"}.jwksURL())
+	assert.Equal(t, "https://keys.example.com", Options{Platform: PlatformGitLab, JWKSURL: "https://keys.example.com"}.jwksURL())
+}
@@ -0,0 +1,300 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eks
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/httpclient"
+
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// presigned urls are accepted for at most 15 minutes after signing,
+	// same as aws-iam-authenticator, regardless of X-Amz-Expires
+	presignedURLExpiration = 15 * time.Minute
+	maxClockSkew           = 5 * time.Minute
+	amzDateFormat          = "20060102T150405Z"
+)
+
+// sts.amazonaws.com, sts.<region>.amazonaws.com, sts-fips.<region>.amazonaws.com
+// and sts.<region>.amazonaws.com.cn
+var stsHostPattern = regexp.MustCompile(`^sts(-fips)?(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+type Authenticator struct {
+	opts   Options
+	client *http.Client
+	now    func() time.Time
+}
+
+// identity of the caller as returned by STS GetCallerIdentity
+type identity struct {
+	ARN          string
+	CanonicalARN string
+	AccountID    string
+	UserID       string
+	SessionName  string
+	AccessKeyID  string
+}
+
+type getCallerIdentityResponse struct {
+	GetCallerIdentityResponse struct {
+		GetCallerIdentityResult struct {
+			Account string `json:"Account"`
+			Arn     string `json:"Arn"`
+			UserID  string `json:"UserId"`
+		} `json:"GetCallerIdentityResult"`
+	} `json:"GetCallerIdentityResponse"`
+}
+
+// stsClient calls STS with the presigned url of the token. The url is the
+// bearer token itself, it must not be recorded in traces.
+var stsClient = &http.Client{Transport: httpclient.InstrumentWithoutQuery(httpclient.DefaultTransport)}
+
+func New(opts Options) (auth.Interface, error) {
+	if opts.mapper == nil {
+		return nil, errors.New("eks mapping file is not loaded")
+	}
+	return &Authenticator{
+		opts:   opts,
+		client: stsClient,
+		now:    time.Now,
+	}, nil
+}
+
+func (a Authenticator) UID() string {
+	return OrgType
+}
+
+func (a *Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	stsURL, err := a.verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := a.getCallerIdentity(ctx, stsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// STS has vouched for the caller, other providers must not be tried
+	username, groups, err := a.opts.mapper.Map(id)
+	if err != nil {
+		return nil, auth.Reject(err)
+	}
+
+	resp := &authv1.UserInfo{
+		Username: username,
+		UID:      "aws-iam-authenticator:" + id.AccountID + ":" + id.UserID,
+		Groups:   groups,
+		Extra: map[string]authv1.ExtraValue{
+			"arn":          {id.ARN},
+			"canonicalArn": {id.CanonicalARN},
+			"accessKeyId":  {id.AccessKeyID},
+		},
+	}
+	if id.SessionName != "" {
+		resp.Extra["sessionName"] = authv1.ExtraValue{id.SessionName}
+	}
+
+	klog.V(7).Infof("eks user %s authenticated as %s", id.ARN, resp.Username)
+	return resp, nil
+}
+
+// verifyToken decodes the presigned GetCallerIdentity url carried by the
+// token and checks everything that can be checked without calling STS
+func (a *Authenticator) verifyToken(token string) (*url.URL, error) {
+	if !strings.HasPrefix(token, v1Prefix) {
+		return nil, errors.Errorf("token is missing expected %q prefix", v1Prefix)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, v1Prefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode token")
+	}
+	u, err := url.Parse(string(decoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse presigned url")
+	}
+	if u.Scheme != "https" {
+		return nil, errors.Errorf("unexpected scheme %q in presigned url", u.Scheme)
+	}
+	if !stsHostPattern.MatchString(u.Host) {
+		return nil, errors.Errorf("unexpected host %q in presigned url", u.Host)
+	}
+	if u.Path != "/" && u.Path != "" {
+		return nil, errors.Errorf("unexpected path %q in presigned url", u.Path)
+	}
+
+	q := u.Query()
+	for key, values := range q {
+		if len(values) != 1 {
+			return nil, errors.Errorf("query parameter %s must be set exactly once", key)
+		}
+	}
+	if q.Get("Action") != "GetCallerIdentity" {
+		return nil, errors.Errorf("unexpected action %q in presigned url", q.Get("Action"))
+	}
+
+	signed := false
+	for _, h := range strings.Split(q.Get("X-Amz-SignedHeaders"), ";") {
+		if strings.EqualFold(h, clusterIDHeader) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, errors.Errorf("%s header is not signed", clusterIDHeader)
+	}
+
+	date, err := time.Parse(amzDateFormat, q.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse X-Amz-Date")
+	}
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || expires <= 0 {
+		return nil, errors.Errorf("invalid X-Amz-Expires %q", q.Get("X-Amz-Expires"))
+	}
+	validity := min(time.Duration(expires)*time.Second, presignedURLExpiration)
+	now := a.now()
+	if now.Before(date.Add(-maxClockSkew)) {
+		return nil, errors.Errorf("token is not valid before %s", date.Format(time.RFC3339))
+	}
+	if now.After(date.Add(validity)) {
+		return nil, errors.Errorf("token expired at %s", date.Add(validity).Format(time.RFC3339))
+	}
+	return u, nil
+}
+
+func (a *Authenticator) getCallerIdentity(ctx context.Context, stsURL *url.URL) (*identity, error) {
+	reqURL := *stsURL
+	if a.opts.STSEndpoint != "" {
+		ep, err := url.Parse(a.opts.STSEndpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse sts endpoint")
+		}
+		reqURL.Scheme = ep.Scheme
+		reqURL.Host = ep.Host
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create sts request")
+	}
+	// the signature covers the host, keep it when talking to an overridden endpoint
+	req.Host = stsURL.Host
+	req.Header.Set(clusterIDHeader, a.opts.ClusterID)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call sts GetCallerIdentity")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read sts response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = errors.Errorf("sts GetCallerIdentity failed with status code %d: %s", resp.StatusCode, string(body))
+		// a throttled or failing sts says nothing about the token
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, auth.WithOutcome(err, auth.OutcomeUpstreamError)
+		}
+		return nil, err
+	}
+
+	var out getCallerIdentityResponse
+	if err = json.Unmarshal(body, &out); err != nil {
+		return nil, errors.Wrap(err, "failed to decode sts response")
+	}
+	result := out.GetCallerIdentityResponse.GetCallerIdentityResult
+
+	id, err := parseIdentity(result.Arn)
+	if err != nil {
+		return nil, err
+	}
+	if id.AccountID != result.Account {
+		return nil, errors.Errorf("account %s does not match ARN %s", result.Account, result.Arn)
+	}
+	id.UserID = result.UserID
+	id.AccessKeyID = strings.SplitN(stsURL.Query().Get("X-Amz-Credential"), "/", 2)[0]
+	return id, nil
+}
+
+func parseIdentity(arn string) (*identity, error) {
+	canonical, err := canonicalizeARN(arn)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(arn, ":", 6)
+	id := &identity{
+		ARN:          arn,
+		CanonicalARN: canonical,
+		AccountID:    parts[4],
+	}
+	if resource := strings.Split(parts[5], "/"); resource[0] == "assumed-role" && len(resource) == 3 {
+		id.SessionName = resource[2]
+	}
+	return id, nil
+}
+
+// canonicalizeARN converts an assumed role ARN returned by STS into the ARN
+// of the IAM role, and strips the path from role ARNs, since the assumed
+// role ARN does not carry it. Other ARNs are returned unchanged.
+func canonicalizeARN(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return "", errors.Errorf("invalid ARN %q", arn)
+	}
+	switch parts[1] {
+	case "aws", "aws-cn", "aws-us-gov":
+	default:
+		return "", errors.Errorf("unsupported partition %q in ARN %q", parts[1], arn)
+	}
+	partition, service, account, resource := parts[1], parts[2], parts[4], parts[5]
+
+	segments := strings.Split(resource, "/")
+	switch {
+	case service == "sts" && segments[0] == "assumed-role":
+		if len(segments) != 3 {
+			return "", errors.Errorf("invalid assumed role ARN %q", arn)
+		}
+		return "arn:" + partition + ":iam::" + account + ":role/" + segments[1], nil
+	case service == "iam" && segments[0] == "role":
+		if len(segments) < 2 {
+			return "", errors.Errorf("invalid role ARN %q", arn)
+		}
+		return "arn:" + partition + ":iam::" + account + ":role/" + segments[len(segments)-1], nil
+	case service == "iam" || service == "sts":
+		return arn, nil
+	}
+	return "", errors.Errorf("unsupported service %q in ARN %q", service, arn)
+}
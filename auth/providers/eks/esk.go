@@ -22,6 +22,8 @@ import (
 	"os"
 	"time"
 
+	"go.kubeguard.dev/guard/auth"
+
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/pkg/errors"
@@ -33,10 +35,9 @@ const (
 	clusterIDHeader = "x-k8s-aws-id"
 )
 
-// "EKS" provider is not supported like other ones.
-//func init() {
-//	auth.SupportedOrgs = append(auth.SupportedOrgs, OrgType)
-//}
+func init() {
+	auth.SupportedOrgs = append(auth.SupportedOrgs, OrgType)
+}
 
 // https://github.com/heptio/aws-iam-authenticator/blob/master/pkg/token/token.go#L196
 func Get(clusterID string) (string, error) {
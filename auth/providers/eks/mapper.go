@@ -0,0 +1,151 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eks
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// RoleMapping maps an IAM role to a kubernetes user name and groups
+type RoleMapping struct {
+	RoleARN  string   `json:"rolearn"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// UserMapping maps an IAM user to a kubernetes user name and groups
+type UserMapping struct {
+	UserARN  string   `json:"userarn"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// MapperConfig follows the layout of the aws-auth ConfigMap used by
+// aws-iam-authenticator, so existing mappings can be reused as is.
+//
+//	mapRoles:
+//	- rolearn: arn:aws:iam::000000000000:role/KubernetesAdmin
+//	  username: kubernetes-admin:{{SessionName}}
+//	  groups:
+//	  - system:masters
+//	mapUsers:
+//	- userarn: arn:aws:iam::000000000000:user/Alice
+//	  username: alice
+//	mapAccounts:
+//	- "000000000000"
+type MapperConfig struct {
+	MapRoles    []RoleMapping `json:"mapRoles,omitempty"`
+	MapUsers    []UserMapping `json:"mapUsers,omitempty"`
+	MapAccounts []string      `json:"mapAccounts,omitempty"`
+}
+
+// Mapper resolves a canonical IAM ARN to a kubernetes identity
+type Mapper struct {
+	roles    map[string]RoleMapping
+	users    map[string]UserMapping
+	accounts map[string]bool
+}
+
+func LoadMapperFile(file string) (*Mapper, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read eks mapping file %s", file)
+	}
+	return ParseMapperConfig(data)
+}
+
+func ParseMapperConfig(data []byte) (*Mapper, error) {
+	var cfg MapperConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "failed to parse eks mapping file")
+	}
+	return NewMapper(cfg)
+}
+
+func NewMapper(cfg MapperConfig) (*Mapper, error) {
+	m := &Mapper{
+		roles:    map[string]RoleMapping{},
+		users:    map[string]UserMapping{},
+		accounts: map[string]bool{},
+	}
+	for i, r := range cfg.MapRoles {
+		if r.Username == "" {
+			return nil, errors.Errorf("mapRoles[%d]: username must be non-empty", i)
+		}
+		arn, err := canonicalizeARN(r.RoleARN)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mapRoles[%d]", i)
+		}
+		m.roles[strings.ToLower(arn)] = r
+	}
+	for i, u := range cfg.MapUsers {
+		if u.Username == "" {
+			return nil, errors.Errorf("mapUsers[%d]: username must be non-empty", i)
+		}
+		arn, err := canonicalizeARN(u.UserARN)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mapUsers[%d]", i)
+		}
+		m.users[strings.ToLower(arn)] = u
+	}
+	for _, a := range cfg.MapAccounts {
+		m.accounts[a] = true
+	}
+	return m, nil
+}
+
+// Map returns the user name and groups for the caller. Explicit role and
+// user mappings take precedence over account mappings, which use the
+// canonical ARN as user name and grant no groups.
+func (m *Mapper) Map(id *identity) (string, []string, error) {
+	key := strings.ToLower(id.CanonicalARN)
+	if r, ok := m.roles[key]; ok {
+		return renderTemplate(r.Username, id), renderGroups(r.Groups, id), nil
+	}
+	if u, ok := m.users[key]; ok {
+		return renderTemplate(u.Username, id), renderGroups(u.Groups, id), nil
+	}
+	if m.accounts[id.AccountID] {
+		return id.CanonicalARN, nil, nil
+	}
+	return "", nil, errors.Errorf("ARN %s is not mapped", id.CanonicalARN)
+}
+
+func renderGroups(groups []string, id *identity) []string {
+	if len(groups) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, renderTemplate(g, id))
+	}
+	return out
+}
+
+// renderTemplate replaces the template variables supported by
+// aws-iam-authenticator in user names and groups.
+func renderTemplate(s string, id *identity) string {
+	return strings.NewReplacer(
+		"{{AccountID}}", id.AccountID,
+		"{{SessionName}}", id.SessionName,
+		"{{AccessKeyID}}", id.AccessKeyID,
+	).Replace(s)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eks
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gomodules.xyz/pointer"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type Options struct {
+	// ClusterID must match the x-k8s-aws-id header signed into the token,
+	// it is the cluster name passed to `guard login -k`
+	ClusterID string
+
+	// STSEndpoint overrides the STS endpoint the presigned request is sent to,
+	// e.g. a VPC endpoint. The Host header is kept as signed by the client.
+	STSEndpoint string
+
+	// MappingFile holds the mapRoles/mapUsers/mapAccounts configuration
+	MappingFile string
+
+	mapper *Mapper
+}
+
+func NewOptions() Options {
+	return Options{}
+}
+
+// load the ARN mapping file
+func (o *Options) Configure() error {
+	if o.MappingFile == "" {
+		return nil
+	}
+	m, err := LoadMapperFile(o.MappingFile)
+	if err != nil {
+		return err
+	}
+	o.mapper = m
+	return nil
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ClusterID, "eks.cluster-id", o.ClusterID, "Cluster ID that must be signed into the token as x-k8s-aws-id header")
+	fs.StringVar(&o.STSEndpoint, "eks.sts-endpoint", o.STSEndpoint, "Override the STS endpoint used to verify tokens, e.g. a VPC endpoint")
+	fs.StringVar(&o.MappingFile, "eks.mapping-file", o.MappingFile, "Path to the file mapping IAM roles, users and accounts to kubernetes users and groups")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if o.ClusterID == "" {
+		errs = append(errs, errors.New("eks.cluster-id must be non-empty"))
+	}
+	if o.MappingFile == "" {
+		errs = append(errs, errors.New("eks.mapping-file must be non-empty"))
+	}
+	if o.STSEndpoint != "" {
+		if u, err := url.Parse(o.STSEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, errors.New("eks.sts-endpoint must be a valid url"))
+		}
+	}
+	return errs
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	container := d.Spec.Template.Spec.Containers[0]
+
+	// create auth secret
+	_, err = LoadMapperFile(o.MappingFile)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := os.ReadFile(o.MappingFile)
+	if err != nil {
+		return nil, err
+	}
+	authSecret := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "guard-eks-auth",
+			Namespace: d.Namespace,
+			Labels:    d.Labels,
+		},
+		Data: map[string][]byte{
+			"mapping.yaml": mapping,
+		},
+	}
+	extraObjs = append(extraObjs, authSecret)
+
+	// mount auth secret into deployment
+	volMount := core.VolumeMount{
+		Name:      authSecret.Name,
+		MountPath: "/etc/guard/auth/eks",
+	}
+	container.VolumeMounts = append(container.VolumeMounts, volMount)
+
+	vol := core.Volume{
+		Name: authSecret.Name,
+		VolumeSource: core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName:  authSecret.Name,
+				DefaultMode: pointer.Int32P(0o444),
+			},
+		},
+	}
+	d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, vol)
+
+	args := container.Args
+	if o.ClusterID != "" {
+		args = append(args, fmt.Sprintf("--eks.cluster-id=%s", o.ClusterID))
+	}
+	if o.STSEndpoint != "" {
+		args = append(args, fmt.Sprintf("--eks.sts-endpoint=%s", o.STSEndpoint))
+	}
+	args = append(args, "--eks.mapping-file=/etc/guard/auth/eks/mapping.yaml")
+
+	container.Args = args
+	d.Spec.Template.Spec.Containers[0] = container
+
+	return extraObjs, nil
+}
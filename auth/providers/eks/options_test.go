@@ -0,0 +1,88 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eks
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func getNonEmptyOptions() Options {
+	return Options{
+		ClusterID:   "guard-cluster",
+		MappingFile: "/etc/guard/auth/eks/mapping.yaml",
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		optsFunc    func(o Options) Options
+		expectedErr []error
+	}{
+		{
+			"validation passed",
+			func(o Options) Options {
+				return o
+			},
+			nil,
+		},
+		{
+			"validation failed, all empty",
+			func(o Options) Options {
+				return Options{}
+			},
+			[]error{
+				errors.New("eks.cluster-id must be non-empty"),
+				errors.New("eks.mapping-file must be non-empty"),
+			},
+		},
+		{
+			"eks.sts-endpoint is valid",
+			func(o Options) Options {
+				o.STSEndpoint = "https://vpce-1234.sts.us-east-1.vpce.amazonaws.com"
+				return o
+			},
+			nil,
+		},
+		{
+			"eks.sts-endpoint is invalid",
+			func(o Options) Options {
+				o.STSEndpoint = "vpce-1234"
+				return o
+			},
+			[]error{errors.New("eks.sts-endpoint must be a valid url")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			opts := test.optsFunc(getNonEmptyOptions())
+			errs := opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
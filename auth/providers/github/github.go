@@ -19,8 +19,12 @@ package github
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/httpclient"
 
 	"github.com/google/go-github/v50/github"
 	"github.com/pkg/errors"
@@ -30,6 +34,17 @@ import (
 
 const (
 	OrgType = "github"
+
+	membershipStatePending = "pending"
+
+	DefaultPageSize    = 100
+	DefaultCacheSizeMB = 16
+	// DefaultCacheMaxStale is how long after its last validation a cached
+	// response is served while the rate limit of the token is exceeded
+	DefaultCacheMaxStale = time.Minute
+
+	// maxPageSize is the largest page size supported by the GitHub API
+	maxPageSize = 100
 )
 
 func init() {
@@ -60,47 +75,170 @@ func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserIn
 		err    error
 	)
 
+	// oauth2 takes the underlying http client from the context
+	httpClient := httpclient.DefaultHTTPClient
+	if g.opts.transport != nil {
+		httpClient = &http.Client{Transport: g.opts.transport, Timeout: httpclient.DefaultHTTPClient.Timeout}
+	}
+	oauthCtx := context.WithValue(ctx, oauth2.HTTPClient, httpClient)
 	if g.opts.BaseUrl != "" {
-		client, err = github.NewEnterpriseClient(g.opts.BaseUrl, "", oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+		client, err = github.NewEnterpriseClient(g.opts.BaseUrl, "", oauth2.NewClient(oauthCtx, oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: token},
 		)))
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create Github enterprise client")
 		}
 	} else {
-		client = github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+		client = github.NewClient(oauth2.NewClient(oauthCtx, oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: token},
 		)))
 	}
 
-	mem, _, err := client.Organizations.GetOrgMembership(ctx, "", g.OrgName)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to check user's membership in Org %s", g.OrgName)
+	orgs := g.orgs()
+	var (
+		user       *github.User
+		memberOrgs = map[string]string{}
+		roleGroups []string
+	)
+	for _, org := range orgs {
+		mem, ghResp, err := client.Organizations.GetOrgMembership(ctx, "", org)
+		observeRateLimit(ghResp)
+		if err != nil {
+			if outcome(err) == auth.OutcomeNotMember {
+				continue
+			}
+			return nil, auth.WithOutcome(errors.Wrapf(err, "failed to check user's membership in Org %s", org), outcome(err))
+		}
+		// invitations that are not accepted yet are pending memberships
+		if mem.GetState() == membershipStatePending {
+			continue
+		}
+		if user == nil {
+			user = mem.User
+		}
+		memberOrgs[strings.ToLower(org)] = org
+		if g.opts.OrgRoleGroups && mem.GetRole() != "" {
+			roleGroups = append(roleGroups, fmt.Sprintf("%s:%s", org, mem.GetRole()))
+		}
+	}
+	if user == nil {
+		return nil, auth.WithOutcome(errors.Errorf("user is not a member of Org %s", strings.Join(orgs, ", ")), auth.OutcomeNotMember)
 	}
 
 	resp := &authv1.UserInfo{
-		Username: mem.User.GetLogin(),
-		UID:      fmt.Sprintf("%d", mem.User.GetID()),
+		Username: user.GetLogin(),
+		UID:      fmt.Sprintf("%d", user.GetID()),
 	}
 
-	var groups []string
+	var teams []*github.Team
 	page := 1
-	pageSize := 25
+	pageSize := g.opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
 	for {
-		teams, _, err := client.Teams.ListUserTeams(ctx, &github.ListOptions{Page: page, PerPage: pageSize})
+		list, ghResp, err := client.Teams.ListUserTeams(ctx, &github.ListOptions{Page: page, PerPage: pageSize})
+		observeRateLimit(ghResp)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to load user's teams for Org %s", g.OrgName)
+			return nil, auth.WithOutcome(errors.Wrapf(err, "failed to load user's teams for Org %s", strings.Join(orgs, ", ")), outcome(err))
 		}
-		for _, team := range teams {
-			if team.Organization.GetLogin() == g.OrgName {
-				groups = append(groups, team.GetName())
+		for _, team := range list {
+			if org, ok := memberOrgs[strings.ToLower(team.Organization.GetLogin())]; ok {
+				team.Organization.Login = github.String(org)
+				teams = append(teams, team)
 			}
 		}
-		if len(teams) < pageSize {
+		if len(list) < pageSize {
 			break
 		}
 		page++
 	}
-	resp.Groups = groups
+
+	teams, err = g.withParentTeams(ctx, client, teams)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		resp.Groups = append(resp.Groups, g.teamGroup(team))
+	}
+	resp.Groups = append(resp.Groups, roleGroups...)
 	return resp, nil
 }
+
+// orgs returns the organizations the user must be a member of, the org in
+// the client cert if none are configured
+func (g Authenticator) orgs() []string {
+	if len(g.opts.Orgs) > 0 {
+		return g.opts.Orgs
+	}
+	return []string{g.OrgName}
+}
+
+// withParentTeams adds the parent teams of the teams, up to the root team.
+// The user is a member of the parent teams through the child teams.
+func (g Authenticator) withParentTeams(ctx context.Context, client *github.Client, teams []*github.Team) ([]*github.Team, error) {
+	seen := map[int64]bool{}
+	for _, team := range teams {
+		seen[team.GetID()] = true
+	}
+
+	result := teams
+	for i := 0; i < len(result); i++ {
+		parent := result[i].Parent
+		if parent == nil || seen[parent.GetID()] {
+			continue
+		}
+		seen[parent.GetID()] = true
+
+		org := result[i].Organization.GetLogin()
+		// the parent in the team list does not include its own parent
+		team, ghResp, err := client.Teams.GetTeamBySlug(ctx, org, parent.GetSlug())
+		observeRateLimit(ghResp)
+		if err != nil {
+			return nil, auth.WithOutcome(errors.Wrapf(err, "failed to load parent team %s of team %s in Org %s", parent.GetSlug(), result[i].GetSlug(), org), outcome(err))
+		}
+		team.Organization = &github.Organization{Login: github.String(org)}
+		result = append(result, team)
+	}
+	return result, nil
+}
+
+// teamGroup returns the group of the team as set by Options.TeamFormat
+func (g Authenticator) teamGroup(team *github.Team) string {
+	switch g.opts.TeamFormat {
+	case TeamFormatSlug:
+		return team.GetSlug()
+	case TeamFormatOrgName:
+		return team.Organization.GetLogin() + "/" + team.GetName()
+	case TeamFormatOrgSlug:
+		return team.Organization.GetLogin() + "/" + team.GetSlug()
+	}
+	return team.GetName()
+}
+
+// outcome classifies errors of the GitHub API. GitHub responds with 404 if
+// the user is not a member of the organization.
+func outcome(err error) auth.Outcome {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var limitErr *RateLimitError
+	if errors.As(err, &rateErr) || errors.As(err, &abuseErr) || errors.As(err, &limitErr) {
+		return auth.OutcomeUpstreamError
+	}
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		switch code := respErr.Response.StatusCode; {
+		case code == http.StatusNotFound:
+			return auth.OutcomeNotMember
+		case code >= http.StatusInternalServerError:
+			return auth.OutcomeUpstreamError
+		}
+	}
+	return auth.OutcomeOf(err)
+}
+
+func observeRateLimit(resp *github.Response) {
+	if resp != nil && resp.Rate.Limit > 0 {
+		auth.SetRateLimitRemaining(OrgType, resp.Rate.Remaining)
+	}
+}
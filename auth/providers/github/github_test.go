@@ -26,15 +26,14 @@ import (
 	"strconv"
 	"testing"
 
+	"go.kubeguard.dev/guard/auth"
+
 	"github.com/go-chi/chi/v5"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/authentication/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
-
 const (
 	githubOrganization = "appscode"
 	githubGoodToken    = "secret"
@@ -242,7 +241,8 @@ func githubServerSetup(githubOrg string, memberResp string, memberStatusCode int
 func githubClientSetup(serverUrl, githubOrg string) *Authenticator {
 	g := &Authenticator{
 		opts: Options{
-			BaseUrl: serverUrl,
+			BaseUrl:  serverUrl,
+			PageSize: 25,
 		},
 		OrgName: githubOrg,
 	}
@@ -258,6 +258,7 @@ func TestCheckGithub(t *testing.T) {
 		reqOrg        string
 		accessToken   string
 		expectedErr   string
+		outcome       auth.Outcome
 	}{
 		{
 			"authentication unsuccessful, error: invalid token",
@@ -267,6 +268,7 @@ func TestCheckGithub(t *testing.T) {
 			githubOrganization,
 			githubBadToken,
 			"{{{Authorization: invalid token}}}",
+			auth.OutcomeInvalidToken,
 		},
 		{
 			"authentication unsuccessful, error: invalid token, org used: code",
@@ -276,6 +278,7 @@ func TestCheckGithub(t *testing.T) {
 			"code",
 			githubGoodToken,
 			"{{{Authorization: invalid token}}}",
+			auth.OutcomeNotMember,
 		},
 		{
 			"error when getting user organization membership",
@@ -285,6 +288,7 @@ func TestCheckGithub(t *testing.T) {
 			githubOrganization,
 			githubGoodToken,
 			"{{{error when checking organization membership}}}",
+			auth.OutcomeInvalidToken,
 		},
 	}
 	ctx := context.Background()
@@ -301,6 +305,7 @@ func TestCheckGithub(t *testing.T) {
 			resp, err := client.Check(ctx, test.accessToken)
 			assert.NotNil(t, err)
 			assert.Nil(t, resp)
+			assert.Equal(t, test.outcome, auth.OutcomeOf(err))
 		})
 	}
 }
@@ -371,6 +376,144 @@ func TestTeamListErrorAtDifferentPage(t *testing.T) {
 			resp, err := client.Check(ctx, githubGoodToken)
 			assert.NotNil(t, err)
 			assert.Nil(t, resp)
+			assert.Equal(t, auth.OutcomeUpstreamError, auth.OutcomeOf(err))
+		})
+	}
+}
+
+// githubOrgsServerSetup serves the memberships of the user in the orgs, the
+// teams of the user and the teams by slug
+func githubOrgsServerSetup(memberships map[string]string, teams string, teamsBySlug map[string]string) *httptest.Server {
+	m := chi.NewRouter()
+	m.Route("/api/v3", func(m chi.Router) {
+		m.Get("/user/memberships/orgs/{org}", func(w http.ResponseWriter, r *http.Request) {
+			mem, ok := memberships[chi.URLParam(r, "org")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write(getErrorMessage(errors.New("Not Found")))
+				return
+			}
+			_, _ = w.Write([]byte(mem))
+		})
+		m.Get("/user/teams", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(teams))
+		})
+		m.Get("/orgs/{org}/teams/{slug}", func(w http.ResponseWriter, r *http.Request) {
+			team, ok := teamsBySlug[chi.URLParam(r, "org")+"/"+chi.URLParam(r, "slug")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write(getErrorMessage(errors.New("Not Found")))
+				return
+			}
+			_, _ = w.Write([]byte(team))
+		})
+	})
+	return httptest.NewServer(m)
+}
+
+func TestCheckGithubOrgs(t *testing.T) {
+	memberships := map[string]string{
+		"appscode":  `{"state":"active","role":"admin","user":{"login":"nahid","id":1204}}`,
+		"kubeguard": `{"state":"active","role":"member","user":{"login":"nahid","id":1204}}`,
+		"pending":   `{"state":"pending","role":"member","user":{"login":"nahid","id":1204}}`,
+	}
+	teams := `[
+		{"id":1,"name":"Platform SRE","slug":"platform-sre","organization":{"login":"appscode"},"parent":{"id":2,"name":"Platform","slug":"platform"}},
+		{"id":3,"name":"Developers","slug":"developers","organization":{"login":"kubeguard"}},
+		{"id":4,"name":"Invited","slug":"invited","organization":{"login":"pending"}},
+		{"id":5,"name":"Other","slug":"other","organization":{"login":"other"}}
+	]`
+	teamsBySlug := map[string]string{
+		"appscode/platform":    `{"id":2,"name":"Platform","slug":"platform","parent":{"id":6,"name":"Engineering","slug":"engineering"}}`,
+		"appscode/engineering": `{"id":6,"name":"Engineering","slug":"engineering"}`,
+	}
+	srv := githubOrgsServerSetup(memberships, teams, teamsBySlug)
+	defer srv.Close()
+
+	dataset := []struct {
+		testName   string
+		orgs       []string
+		format     string
+		roleGroups bool
+		groups     []string
+		outcome    auth.Outcome
+	}{
+		{
+			"org of the client cert",
+			nil,
+			TeamFormatName,
+			false,
+			[]string{"Platform SRE", "Platform", "Engineering"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"org role groups",
+			nil,
+			TeamFormatName,
+			true,
+			[]string{"Platform SRE", "Platform", "Engineering", "appscode:admin"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"multiple orgs",
+			[]string{"appscode", "kubeguard", "pending", "missing"},
+			TeamFormatOrgSlug,
+			true,
+			[]string{"appscode/platform-sre", "kubeguard/developers", "appscode/platform", "appscode/engineering", "appscode:admin", "kubeguard:member"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"team names with org",
+			[]string{"kubeguard"},
+			TeamFormatOrgName,
+			false,
+			[]string{"kubeguard/Developers"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"team slugs",
+			[]string{"kubeguard"},
+			TeamFormatSlug,
+			true,
+			[]string{"developers", "kubeguard:member"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"pending membership",
+			[]string{"pending"},
+			TeamFormatOrgSlug,
+			false,
+			nil,
+			auth.OutcomeNotMember,
+		},
+		{
+			"not a member of any org",
+			[]string{"missing", "other"},
+			TeamFormatOrgSlug,
+			false,
+			nil,
+			auth.OutcomeNotMember,
+		},
+	}
+
+	for _, test := range dataset {
+		t.Run(test.testName, func(t *testing.T) {
+			client := githubClientSetup(srv.URL, githubOrganization)
+			client.opts.Orgs = test.orgs
+			client.opts.TeamFormat = test.format
+			client.opts.OrgRoleGroups = test.roleGroups
+
+			resp, err := client.Check(context.Background(), githubGoodToken)
+			if test.outcome != auth.OutcomeSuccess {
+				assert.Nil(t, resp)
+				assert.Equal(t, test.outcome, auth.OutcomeOf(err))
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, githubUsername, resp.Username)
+				assert.Equal(t, githubUID, resp.UID)
+				assert.Equal(t, test.groups, resp.Groups)
+			}
 		})
 	}
 }
@@ -0,0 +1,42 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	cacheResultHit   = "hit"
+	cacheResultMiss  = "miss"
+	cacheResultStale = "stale"
+)
+
+var (
+	githubCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_github_cache_requests_total",
+		Help: "Total number of GitHub API requests by cache result, hit if the cached response was not modified, stale if it was served without a request while the token is rate limited",
+	}, []string{"result"})
+	githubRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "guard_authn_github_rate_limited_requests_total",
+		Help: "Total number of GitHub API requests refused without a call while the rate limit of the token is exceeded",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(githubCacheRequests, githubRateLimited)
+}
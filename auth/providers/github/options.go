@@ -18,30 +18,105 @@ package github
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"go.kubeguard.dev/guard/util/httpclient"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 	apps "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// Supported formats of the groups of GitHub teams
+const (
+	TeamFormatName    = "name"
+	TeamFormatSlug    = "slug"
+	TeamFormatOrgName = "org/name"
+	TeamFormatOrgSlug = "org/slug"
+)
+
+var SupportedTeamFormats = []string{TeamFormatName, TeamFormatSlug, TeamFormatOrgName, TeamFormatOrgSlug}
+
 type Options struct {
 	BaseUrl string
+
+	// organizations the user must be a member of, at least one. If empty,
+	// the organization in the client cert is used.
+	Orgs []string
+
+	// format of the groups of the teams of the user
+	// default : name
+	TeamFormat string
+
+	// add the groups <org>:<role> of the role of the user in each
+	// organization, admin or member
+	// default : false
+	OrgRoleGroups bool
+
+	// number of teams requested per page
+	// default : 100
+	PageSize int
+
+	// size of the cache of GitHub API responses, 0 disables the cache
+	// default : 16
+	CacheSizeMB int
+
+	// how long after its last validation a cached response is served while
+	// the rate limit of the token is exceeded, 0 never serves stale responses
+	// default : 1m
+	CacheMaxStale time.Duration
+
+	// transport is shared by the token reviews to reuse cached responses and
+	// the rate limit state of tokens
+	transport *cachingTransport
 }
 
 func NewOptions() Options {
-	return Options{}
+	return Options{
+		TeamFormat:    TeamFormatName,
+		PageSize:      DefaultPageSize,
+		CacheSizeMB:   DefaultCacheSizeMB,
+		CacheMaxStale: DefaultCacheMaxStale,
+	}
 }
 
 func (o *Options) Configure() error {
-	return nil
+	var err error
+	o.transport, err = newCachingTransport(httpclient.DefaultHTTPClient.Transport, o.CacheSizeMB, o.CacheMaxStale)
+	return err
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.BaseUrl, "github.base-url", o.BaseUrl, "Base url for enterprise, keep empty to use default github base url")
+	fs.StringSliceVar(&o.Orgs, "github.orgs", o.Orgs, "Organizations the user must be a member of, at least one. If empty, the organization in the client cert is used")
+	fs.IntVar(&o.PageSize, "github.page-size", o.PageSize, "Number of teams requested per page, at most 100")
+	fs.IntVar(&o.CacheSizeMB, "github.cache-size-mb", o.CacheSizeMB, "Size of the cache of GitHub API responses that are revalidated with their ETag, 0 disables the cache")
+	fs.DurationVar(&o.CacheMaxStale, "github.cache-max-stale", o.CacheMaxStale, "How long after its last validation a cached GitHub API response is served while the rate limit of the token is exceeded, 0 never serves stale responses")
+	fs.StringVar(&o.TeamFormat, "github.team-format", o.TeamFormat, fmt.Sprintf("Format of the groups of the teams of the user, one of %s", strings.Join(SupportedTeamFormats, ", ")))
+	fs.BoolVar(&o.OrgRoleGroups, "github.org-role-groups", o.OrgRoleGroups, "If true, the user gets the group <org>:<role> of the role in each organization, admin or member")
 }
 
 func (o *Options) Validate() []error {
-	return nil
+	var errs []error
+	if o.TeamFormat != "" && !slices.Contains(SupportedTeamFormats, o.TeamFormat) {
+		errs = append(errs, errors.Errorf("github.team-format must be one of %s", strings.Join(SupportedTeamFormats, ", ")))
+	}
+	if len(o.Orgs) > 1 && (o.TeamFormat == "" || o.TeamFormat == TeamFormatName || o.TeamFormat == TeamFormatSlug) {
+		errs = append(errs, errors.New("github.team-format must be org/name or org/slug when more than one org is set"))
+	}
+	if o.PageSize < 1 || o.PageSize > maxPageSize {
+		errs = append(errs, errors.Errorf("github.page-size must be between 1 and %d", maxPageSize))
+	}
+	if o.CacheSizeMB < 0 {
+		errs = append(errs, errors.New("github.cache-size-mb must be non-negative"))
+	}
+	if o.CacheMaxStale < 0 {
+		errs = append(errs, errors.New("github.cache-max-stale must be non-negative"))
+	}
+	return errs
 }
 
 func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
@@ -49,6 +124,24 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 	if o.BaseUrl != "" {
 		args = append(args, fmt.Sprintf("--github.base-url=%s", o.BaseUrl))
 	}
+	if len(o.Orgs) > 0 {
+		args = append(args, fmt.Sprintf("--github.orgs=%s", strings.Join(o.Orgs, ",")))
+	}
+	if o.PageSize != DefaultPageSize {
+		args = append(args, fmt.Sprintf("--github.page-size=%d", o.PageSize))
+	}
+	if o.CacheSizeMB != DefaultCacheSizeMB {
+		args = append(args, fmt.Sprintf("--github.cache-size-mb=%d", o.CacheSizeMB))
+	}
+	if o.CacheMaxStale != DefaultCacheMaxStale {
+		args = append(args, fmt.Sprintf("--github.cache-max-stale=%s", o.CacheMaxStale))
+	}
+	if o.TeamFormat != "" && o.TeamFormat != TeamFormatName {
+		args = append(args, fmt.Sprintf("--github.team-format=%s", o.TeamFormat))
+	}
+	if o.OrgRoleGroups {
+		args = append(args, "--github.org-role-groups")
+	}
 
 	d.Spec.Template.Spec.Containers[0].Args = args
 	return extraObjs, nil
@@ -0,0 +1,77 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        Options
+		expectedErr []error
+	}{
+		{
+			"org of the client cert",
+			NewOptions(),
+			nil,
+		},
+		{
+			"multiple orgs",
+			Options{Orgs: []string{"appscode", "kubeguard"}, TeamFormat: TeamFormatOrgSlug, PageSize: DefaultPageSize},
+			nil,
+		},
+		{
+			"unsupported team format",
+			Options{TeamFormat: "id", PageSize: DefaultPageSize},
+			[]error{errors.New("github.team-format must be one of name, slug, org/name, org/slug")},
+		},
+		{
+			"multiple orgs without org in team format",
+			Options{Orgs: []string{"appscode", "kubeguard"}, TeamFormat: TeamFormatSlug, PageSize: DefaultPageSize},
+			[]error{errors.New("github.team-format must be org/name or org/slug when more than one org is set")},
+		},
+		{
+			"invalid page and cache size",
+			Options{PageSize: 101, CacheSizeMB: -1, CacheMaxStale: -time.Second},
+			[]error{
+				errors.New("github.page-size must be between 1 and 100"),
+				errors.New("github.cache-size-mb must be non-negative"),
+				errors.New("github.cache-max-stale must be non-negative"),
+			},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
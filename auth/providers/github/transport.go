@@ -0,0 +1,257 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	// cacheLifeWindow is how long a cached response is kept, it is
+	// revalidated with its ETag on every use
+	cacheLifeWindow = time.Hour
+
+	cacheShards       = 64
+	cacheMaxEntrySize = 4096
+)
+
+// RateLimitError is returned without calling the GitHub API while the rate
+// limit of the token is exceeded
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("GitHub API rate limit of the token is exceeded, retry after %s", e.Reset.Format(time.RFC3339))
+}
+
+type cachedResponse struct {
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// Validated is the time GitHub last confirmed the response
+	Validated time.Time `json:"validated"`
+}
+
+// cachingTransport makes conditional requests to the GitHub API with the
+// ETag of cached responses, GitHub does not count 304 Not Modified responses
+// against the rate limit. Responses are cached per token, keyed by an HMAC of
+// the token with a random per process salt.
+//
+// When a response reports that the rate limit of the token is exceeded,
+// further requests with the token are not sent until the limit resets. They
+// are served from the cache if the response was validated at most maxStale
+// ago, otherwise they fail with a RateLimitError. So a user removed from an
+// organization or team is not authenticated with stale responses for longer.
+type cachingTransport struct {
+	base http.RoundTripper
+	salt []byte
+	// cache is nil if caching is disabled
+	cache    *bigcache.BigCache
+	maxStale time.Duration
+	now      func() time.Time
+
+	lock sync.Mutex
+	// limited holds the time the rate limit resets by token key
+	limited map[string]time.Time
+}
+
+func newCachingTransport(base http.RoundTripper, sizeMB int, maxStale time.Duration) (*cachingTransport, error) {
+	t := &cachingTransport{
+		base:     base,
+		salt:     make([]byte, 32),
+		maxStale: maxStale,
+		now:      time.Now,
+		limited:  map[string]time.Time{},
+	}
+	if _, err := rand.Read(t.salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate GitHub cache key salt")
+	}
+	if sizeMB > 0 {
+		var err error
+		t.cache, err = bigcache.NewBigCache(bigcache.Config{
+			Shards:           cacheShards,
+			LifeWindow:       cacheLifeWindow,
+			CleanWindow:      cacheLifeWindow / 6,
+			MaxEntrySize:     cacheMaxEntrySize,
+			HardMaxCacheSize: sizeMB,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create GitHub response cache")
+		}
+	}
+	return t, nil
+}
+
+func (t *cachingTransport) tokenKey(req *http.Request) string {
+	mac := hmac.New(sha256.New, t.salt)
+	mac.Write([]byte(req.Header.Get("Authorization")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tokenKey := t.tokenKey(req)
+	cacheable := t.cache != nil && req.Method == http.MethodGet
+	key := tokenKey + " " + req.URL.String()
+
+	var cached *cachedResponse
+	if cacheable {
+		cached = t.get(key)
+	}
+
+	if reset, limited := t.limitedUntil(tokenKey); limited {
+		if cached != nil && t.now().Sub(cached.Validated) <= t.maxStale {
+			githubCacheRequests.WithLabelValues(cacheResultStale).Inc()
+			return cached.response(req, nil), nil
+		}
+		githubRateLimited.Inc()
+		return nil, &RateLimitError{Reset: reset}
+	}
+
+	outReq := req
+	if cached != nil {
+		outReq = req.Clone(req.Context())
+		outReq.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := t.base.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	t.observe(tokenKey, resp)
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		githubCacheRequests.WithLabelValues(cacheResultHit).Inc()
+		cached.Validated = t.now()
+		t.set(key, cached)
+		return cached.response(req, resp.Header), nil
+	}
+	if cacheable {
+		githubCacheRequests.WithLabelValues(cacheResultMiss).Inc()
+	}
+	if cacheable && resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" {
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		t.set(key, &cachedResponse{ETag: resp.Header.Get("ETag"), Header: resp.Header, Body: body, Validated: t.now()})
+	}
+	return resp, nil
+}
+
+func (t *cachingTransport) get(key string) *cachedResponse {
+	data, err := t.cache.Get(key)
+	if err != nil {
+		return nil
+	}
+	cached := &cachedResponse{}
+	if err = json.Unmarshal(data, cached); err != nil {
+		return nil
+	}
+	return cached
+}
+
+func (t *cachingTransport) set(key string, cached *cachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err = t.cache.Set(key, data); err != nil {
+		klog.V(5).Infof("failed to cache GitHub response: %v", err)
+	}
+}
+
+// response returns the cached response for req. The rate limit headers are
+// taken from header, if set, so they report the current state.
+func (c *cachedResponse) response(req *http.Request, header http.Header) *http.Response {
+	h := c.Header.Clone()
+	for k, v := range header {
+		if strings.HasPrefix(k, "X-Ratelimit-") {
+			h[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// observe records when the rate limit of the token resets, if the response
+// reports it is exceeded with Retry-After or X-RateLimit-Remaining
+func (t *cachingTransport) observe(tokenKey string, resp *http.Response) {
+	now := t.now()
+	var reset time.Time
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			reset = now.Add(time.Duration(secs) * time.Second)
+		} else if at, err := http.ParseTime(v); err == nil {
+			reset = at
+		}
+	} else if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if secs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			reset = time.Unix(secs, 0)
+		}
+	}
+	if !reset.After(now) {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for k, v := range t.limited {
+		if !v.After(now) {
+			delete(t.limited, k)
+		}
+	}
+	t.limited[tokenKey] = reset
+	klog.Warningf("GitHub API rate limit of a token is exceeded, recently validated responses are served from cache until %s", reset.Format(time.RFC3339))
+}
+
+func (t *cachingTransport) limitedUntil(tokenKey string) (time.Time, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	reset, ok := t.limited[tokenKey]
+	return reset, ok && reset.After(t.now())
+}
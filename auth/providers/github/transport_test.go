@@ -0,0 +1,263 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// etagServer responds with the ETag of the path and 304 if it matches
+type etagServer struct {
+	requests    int
+	conditional int
+	header      http.Header
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	for k, v := range s.header {
+		w.Header()[k] = v
+	}
+	etag := `"` + r.URL.Path + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		s.conditional++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write([]byte(r.Header.Get("Authorization") + " " + r.URL.Path))
+}
+
+func doGet(t *testing.T, rt http.RoundTripper, url, token string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), nil
+}
+
+func cacheRequestsValue(t *testing.T, result string) float64 {
+	out := &dto.Metric{}
+	if err := githubCacheRequests.WithLabelValues(result).Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out.GetCounter().GetValue()
+}
+
+func TestCachingTransportETag(t *testing.T) {
+	s := &etagServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	rt, err := newCachingTransport(http.DefaultTransport, 1, DefaultCacheMaxStale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := cacheRequestsValue(t, cacheResultHit)
+
+	for i := 0; i < 3; i++ {
+		body, err := doGet(t, rt, srv.URL+"/user/teams", "secret")
+		if assert.Nil(t, err) {
+			assert.Equal(t, "Bearer secret /user/teams", body)
+		}
+	}
+	assert.Equal(t, 3, s.requests)
+	assert.Equal(t, 2, s.conditional, "cached responses must be revalidated")
+	assert.Equal(t, float64(2), cacheRequestsValue(t, cacheResultHit)-hits)
+
+	// responses are not shared across tokens
+	body, err := doGet(t, rt, srv.URL+"/user/teams", "other")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "Bearer other /user/teams", body)
+	}
+	assert.Equal(t, 2, s.conditional)
+}
+
+func TestCachingTransportRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	testData := []struct {
+		testName string
+		header   http.Header
+		reset    time.Time
+	}{
+		{
+			"rate limit exceeded",
+			http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+			},
+			reset,
+		},
+		{
+			"retry after",
+			http.Header{"Retry-After": {"60"}},
+			time.Now().Add(time.Minute),
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			s := &etagServer{}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			rt, err := newCachingTransport(http.DefaultTransport, 1, DefaultCacheMaxStale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			rt.now = func() time.Time { return now }
+
+			_, err = doGet(t, rt, srv.URL+"/user/teams", "secret")
+			assert.Nil(t, err)
+			s.header = test.header
+			_, err = doGet(t, rt, srv.URL+"/user/memberships/orgs/appscode", "secret")
+			assert.Nil(t, err)
+			assert.Equal(t, 2, s.requests)
+
+			// cached responses are served without a request
+			body, err := doGet(t, rt, srv.URL+"/user/teams", "secret")
+			if assert.Nil(t, err) {
+				assert.Equal(t, "Bearer secret /user/teams", body)
+			}
+			_, err = doGet(t, rt, srv.URL+"/user/teams?page=2", "secret")
+			var limitErr *RateLimitError
+			if assert.True(t, errors.As(err, &limitErr)) {
+				assert.WithinDuration(t, test.reset, limitErr.Reset, time.Second)
+			}
+			assert.Equal(t, 2, s.requests)
+
+			// other tokens are not limited
+			s.header = nil
+			_, err = doGet(t, rt, srv.URL+"/user/teams?page=2", "other")
+			assert.Nil(t, err)
+
+			// requests are sent again after the reset
+			now = test.reset.Add(time.Second)
+			_, err = doGet(t, rt, srv.URL+"/user/teams?page=2", "secret")
+			assert.Nil(t, err)
+			assert.Equal(t, 4, s.requests)
+		})
+	}
+}
+
+func TestCachingTransportDisabled(t *testing.T) {
+	s := &etagServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	rt, err := newCachingTransport(http.DefaultTransport, 0, DefaultCacheMaxStale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = doGet(t, rt, srv.URL+"/user/teams", "secret")
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 0, s.conditional)
+}
+
+func TestCachingTransportMaxStale(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	state := "active"
+	limited := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			w.Header().Set("X-Ratelimit-Remaining", "0")
+			w.Header().Set("X-Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		}
+		etag := `"` + state + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(state))
+	}))
+	defer srv.Close()
+
+	rt, err := newCachingTransport(http.DefaultTransport, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rt.now = func() time.Time { return now }
+	membership := srv.URL + "/user/memberships/orgs/appscode"
+
+	body, err := doGet(t, rt, membership, "secret")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "active", body)
+	}
+
+	// the membership is revalidated and the token is limited by the response,
+	// then the user leaves the organization
+	now = now.Add(time.Minute)
+	limited = true
+	_, err = doGet(t, rt, membership, "secret")
+	assert.Nil(t, err)
+	state = "removed"
+
+	// the response validated a moment ago is served
+	now = now.Add(30 * time.Second)
+	body, err = doGet(t, rt, membership, "secret")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "active", body)
+	}
+
+	// but not once it is older than max stale
+	now = now.Add(time.Minute)
+	_, err = doGet(t, rt, membership, "secret")
+	var limitErr *RateLimitError
+	assert.True(t, errors.As(err, &limitErr))
+
+	// after the reset the change is seen
+	now = reset.Add(time.Second)
+	limited = false
+	body, err = doGet(t, rt, membership, "secret")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "removed", body)
+	}
+
+	// 0 never serves stale responses
+	rt.maxStale = 0
+	reset = now.Add(time.Hour)
+	limited = true
+	_, err = doGet(t, rt, membership, "secret")
+	assert.Nil(t, err)
+	now = now.Add(time.Second)
+	_, err = doGet(t, rt, membership, "secret")
+	assert.True(t, errors.As(err, &limitErr))
+}
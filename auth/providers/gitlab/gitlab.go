@@ -18,9 +18,12 @@ package gitlab
 
 import (
 	"context"
+	"net/http"
 	"strconv"
+	"strings"
 
 	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/httpclient"
 
 	"github.com/pkg/errors"
 	"github.com/xanzy/go-gitlab"
@@ -29,6 +32,9 @@ import (
 
 const (
 	OrgType = "gitlab"
+
+	projectGroupPrefix = "project:"
+	memberStateActive  = "active"
 )
 
 func init() {
@@ -50,7 +56,7 @@ func (g Authenticator) UID() string {
 }
 
 func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
-	var opts []gitlab.ClientOptionFunc
+	opts := []gitlab.ClientOptionFunc{gitlab.WithHTTPClient(httpclient.DefaultHTTPClient)}
 	if g.opts.BaseUrl != "" {
 		opts = append(opts, gitlab.WithBaseURL(g.opts.BaseUrl))
 	}
@@ -60,9 +66,10 @@ func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserIn
 		return nil, err
 	}
 
-	user, _, err := client.Users.CurrentUser(gitlab.WithContext(ctx))
+	user, glResp, err := client.Users.CurrentUser(gitlab.WithContext(ctx))
+	observeRateLimit(glResp)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, auth.WithOutcome(errors.WithStack(err), outcome(err))
 	}
 
 	resp := &authv1.UserInfo{
@@ -70,30 +77,203 @@ func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserIn
 		UID:      strconv.Itoa(user.ID),
 	}
 
-	var groups []string
-	// https://docs.gitlab.com/ee/api/README.html#pagination
-	page := 1
-	pageSize := 20
-	for {
-		list, _, err := client.Groups.ListGroups(&gitlab.ListGroupsOptions{
-			ListOptions: gitlab.ListOptions{Page: page, PerPage: pageSize},
+	if len(g.opts.RequiredGroups) > 0 {
+		member, err := g.isMember(ctx, client, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !member {
+			return nil, auth.WithOutcome(errors.Errorf("user %s is not a member of group %s", user.Username, strings.Join(g.opts.RequiredGroups, ", ")), auth.OutcomeNotMember)
+		}
+	}
+
+	groups, err := g.listMemberships(func(opts gitlab.ListOptions, level *gitlab.AccessLevelValue) ([]membership, *gitlab.Response, error) {
+		list, glResp, err := client.Groups.ListGroups(&gitlab.ListGroupsOptions{
+			ListOptions:    opts,
+			MinAccessLevel: level,
 		}, gitlab.WithContext(ctx))
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to load groups")
+			return nil, glResp, errors.Wrap(err, "failed to load groups")
 		}
+		result := make([]membership, 0, len(list))
 		for _, entry := range list {
-			if g.opts.UseGroupID {
-				groups = append(groups, strconv.Itoa(entry.ID))
-			} else {
-				groups = append(groups, entry.FullPath)
+			result = append(result, membership{id: entry.ID, path: entry.FullPath})
+		}
+		return result, glResp, nil
+	}, g.minAccessLevel(gitlab.MinimalAccessPermissions))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range groups {
+		resp.Groups = append(resp.Groups, g.groupNames("", m)...)
+	}
+
+	if g.opts.IncludeProjects {
+		projects, err := g.listMemberships(func(opts gitlab.ListOptions, level *gitlab.AccessLevelValue) ([]membership, *gitlab.Response, error) {
+			list, glResp, err := client.Projects.ListProjects(&gitlab.ListProjectsOptions{
+				ListOptions:    opts,
+				Membership:     gitlab.Bool(true),
+				MinAccessLevel: level,
+				Simple:         gitlab.Bool(true),
+			}, gitlab.WithContext(ctx))
+			if err != nil {
+				return nil, glResp, errors.Wrap(err, "failed to load projects")
 			}
+			result := make([]membership, 0, len(list))
+			for _, entry := range list {
+				result = append(result, membership{id: entry.ID, path: entry.PathWithNamespace})
+			}
+			return result, glResp, nil
+		}, g.minAccessLevel(gitlab.GuestPermissions))
+		if err != nil {
+			return nil, err
 		}
-		if len(list) < pageSize {
-			break
+		for _, m := range projects {
+			resp.Groups = append(resp.Groups, g.groupNames(projectGroupPrefix, m)...)
 		}
-		page++
 	}
-
-	resp.Groups = groups
 	return resp, nil
 }
+
+// isMember checks the user is a member of at least one of the required groups
+func (g Authenticator) isMember(ctx context.Context, client *gitlab.Client, userID int) (bool, error) {
+	for _, group := range g.opts.RequiredGroups {
+		mem, glResp, err := client.GroupMembers.GetGroupMember(group, userID, gitlab.WithContext(ctx))
+		observeRateLimit(glResp)
+		if err != nil {
+			if glResp != nil && glResp.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return false, auth.WithOutcome(errors.Wrapf(err, "failed to check user's membership in group %s", group), outcome(err))
+		}
+		if mem.State == "" || mem.State == memberStateActive {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// membership is a group or project of the user
+type membership struct {
+	id    int
+	path  string
+	level gitlab.AccessLevelValue
+}
+
+type listFunc func(opts gitlab.ListOptions, level *gitlab.AccessLevelValue) ([]membership, *gitlab.Response, error)
+
+// minAccessLevel returns the minimum access level of the memberships, nil
+// to list every visible group or project. The access level suffix needs
+// memberships, so at least the lowest level supported by the API is used.
+func (g Authenticator) minAccessLevel(lowest gitlab.AccessLevelValue) *gitlab.AccessLevelValue {
+	level := accessLevels[g.opts.MinAccessLevel]
+	if (g.opts.AccessLevelSuffix || level != gitlab.NoPermissions) && level < lowest {
+		level = lowest
+	}
+	if level == gitlab.NoPermissions {
+		return nil
+	}
+	return gitlab.AccessLevel(level)
+}
+
+// listMemberships lists the memberships of the user within the required
+// groups. The API does not return the access level of the user, so for the
+// access level suffix the memberships are listed once per access level from
+// the minimum up, and the highest level a membership is listed with is the
+// access level of the user.
+func (g Authenticator) listMemberships(list listFunc, minLevel *gitlab.AccessLevelValue) ([]membership, error) {
+	levels := []*gitlab.AccessLevelValue{minLevel}
+	if g.opts.AccessLevelSuffix {
+		levels = nil
+		for _, level := range suffixAccessLevels {
+			if level >= *minLevel {
+				levels = append(levels, gitlab.AccessLevel(level))
+			}
+		}
+	}
+
+	var result []membership
+	index := map[int]int{}
+	for _, level := range levels {
+		// https://docs.gitlab.com/ee/api/README.html#pagination
+		page := 1
+		pageSize := 20
+		for {
+			entries, glResp, err := list(gitlab.ListOptions{Page: page, PerPage: pageSize}, level)
+			observeRateLimit(glResp)
+			if err != nil {
+				return nil, auth.WithOutcome(err, outcome(err))
+			}
+			for _, m := range entries {
+				if !g.inRequiredGroups(m.path) {
+					continue
+				}
+				if level != nil {
+					m.level = *level
+				}
+				if i, ok := index[m.id]; ok {
+					result[i].level = m.level
+					continue
+				}
+				index[m.id] = len(result)
+				result = append(result, m)
+			}
+			if len(entries) < pageSize {
+				break
+			}
+			page++
+		}
+	}
+	return result, nil
+}
+
+// inRequiredGroups checks the group or project path is within one of the
+// required groups, if set
+func (g Authenticator) inRequiredGroups(path string) bool {
+	if len(g.opts.RequiredGroups) == 0 {
+		return true
+	}
+	path = strings.ToLower(path)
+	for _, group := range g.opts.RequiredGroups {
+		group = strings.ToLower(group)
+		if path == group || strings.HasPrefix(path, group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// groupNames returns the groups of a membership, the path or ID and with the
+// access level suffix if set
+func (g Authenticator) groupNames(prefix string, m membership) []string {
+	name := prefix + m.path
+	if g.opts.UseGroupID {
+		name = prefix + strconv.Itoa(m.id)
+	}
+	if !g.opts.AccessLevelSuffix {
+		return []string{name}
+	}
+	return []string{name, name + ":" + accessLevelNames[m.level]}
+}
+
+// outcome classifies errors of the GitLab API
+func outcome(err error) auth.Outcome {
+	var respErr *gitlab.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		if respErr.Response.StatusCode >= http.StatusInternalServerError || respErr.Response.StatusCode == http.StatusTooManyRequests {
+			return auth.OutcomeUpstreamError
+		}
+	}
+	return auth.OutcomeOf(err)
+}
+
+// observeRateLimit records the RateLimit-Remaining header, GitLab omits it
+// if rate limiting is disabled
+func observeRateLimit(resp *gitlab.Response) {
+	if resp == nil || resp.Response == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining")); err == nil {
+		auth.SetRateLimitRemaining(OrgType, remaining)
+	}
+}
@@ -23,8 +23,11 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 
+	"go.kubeguard.dev/guard/auth"
+
 	"github.com/go-chi/chi/v5"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
@@ -229,6 +232,7 @@ func TestGitlab(t *testing.T) {
 		userStatusCode int
 		token          string
 		expectedErr    string
+		outcome        auth.Outcome
 	}{
 		{
 			"authentication unsuccessful, reason invalid token",
@@ -236,6 +240,7 @@ func TestGitlab(t *testing.T) {
 			http.StatusOK,
 			gitlabBadToken,
 			"{{{PRIVATE-TOKEN: invalid token}}}",
+			auth.OutcomeInvalidToken,
 		},
 		{
 			"authentication unsuccessful, reason empty token",
@@ -243,6 +248,7 @@ func TestGitlab(t *testing.T) {
 			http.StatusOK,
 			gitlabEmptyToken,
 			"{{{Header PRIVATE-TOKEN: expected not empty}}}",
+			auth.OutcomeInvalidToken,
 		},
 		{
 			"error when getting user",
@@ -250,6 +256,7 @@ func TestGitlab(t *testing.T) {
 			http.StatusInternalServerError,
 			gitlabGoodToken,
 			"{{{error when getting user}}}",
+			auth.OutcomeUpstreamError,
 		},
 	}
 	ctx := context.Background()
@@ -266,6 +273,7 @@ func TestGitlab(t *testing.T) {
 				resp, err := client.Check(ctx, test.token)
 				if assert.NotNil(t, err) {
 					assert.Nil(t, resp)
+					assert.Equal(t, test.outcome, auth.OutcomeOf(err))
 				}
 			})
 		}
@@ -326,7 +334,157 @@ func TestGroupListErrorInDifferentPage(t *testing.T) {
 				resp, err := client.Check(ctx, gitlabGoodToken)
 				assert.NotNil(t, err)
 				assert.Nil(t, resp)
+				assert.Equal(t, auth.OutcomeUpstreamError, auth.OutcomeOf(err))
 			})
 		}
 	}
 }
+
+type gitlabTestGroup struct {
+	ID       int    `json:"id"`
+	FullPath string `json:"full_path"`
+	// access level of the user, 0 if the group is only visible
+	level int
+}
+
+type gitlabTestProject struct {
+	ID                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	level             int
+}
+
+// gitlabMembershipServerSetup serves the groups and projects of the user
+// filtered by min_access_level, and the state of the user in the groups
+func gitlabMembershipServerSetup(groups []gitlabTestGroup, projects []gitlabTestProject, members map[string]string) *httptest.Server {
+	minLevel := func(r *http.Request) int {
+		level, _ := strconv.Atoi(r.URL.Query().Get("min_access_level"))
+		return level
+	}
+	m := chi.NewRouter()
+	m.Get("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(gitlabUserRespBody))
+	})
+	m.Get("/api/v4/groups/{group}/members/{user}", func(w http.ResponseWriter, r *http.Request) {
+		// paths are case insensitive
+		state, ok := members[strings.ToLower(chi.URLParam(r, "group"))]
+		if !ok || chi.URLParam(r, "user") != gitlabUID {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(gitlabGetErrorMsg(errors.New("404 Not found")))
+			return
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"id":1204,"username":"nahid","state":%q,"access_level":30}`, state)))
+	})
+	m.Get("/api/v4/groups", func(w http.ResponseWriter, r *http.Request) {
+		result := []gitlabTestGroup{}
+		for _, g := range groups {
+			if level := minLevel(r); level == 0 || (g.level > 0 && g.level >= level) {
+				result = append(result, g)
+			}
+		}
+		data, _ := json.Marshal(result)
+		_, _ = w.Write(data)
+	})
+	m.Get("/api/v4/projects", func(w http.ResponseWriter, r *http.Request) {
+		result := []gitlabTestProject{}
+		for _, p := range projects {
+			if r.URL.Query().Get("membership") == "true" && p.level >= minLevel(r) {
+				result = append(result, p)
+			}
+		}
+		data, _ := json.Marshal(result)
+		_, _ = w.Write(data)
+	})
+	return httptest.NewServer(m)
+}
+
+func TestGitlabMemberships(t *testing.T) {
+	srv := gitlabMembershipServerSetup(
+		[]gitlabTestGroup{
+			{1, "appscode", 50},
+			{2, "appscode/dev", 30},
+			{3, "appscode/ops", 10},
+			{4, "other", 20},
+			{5, "public", 0},
+		},
+		[]gitlabTestProject{
+			{11, "appscode/dev/api", 40},
+			{12, "other/site", 30},
+		},
+		map[string]string{"appscode": "active", "blocked": "blocked"},
+	)
+	defer srv.Close()
+
+	dataset := []struct {
+		testName string
+		opts     Options
+		groups   []string
+		outcome  auth.Outcome
+	}{
+		{
+			"every visible group",
+			Options{},
+			[]string{"appscode", "appscode/dev", "appscode/ops", "other", "public"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"minimum access level",
+			Options{MinAccessLevel: "developer"},
+			[]string{"appscode", "appscode/dev"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"required group",
+			Options{RequiredGroups: []string{"missing", "AppsCode"}},
+			[]string{"appscode", "appscode/dev", "appscode/ops"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"projects with access level suffix",
+			Options{RequiredGroups: []string{"appscode"}, IncludeProjects: true, AccessLevelSuffix: true},
+			[]string{
+				"appscode", "appscode:owner",
+				"appscode/dev", "appscode/dev:developer",
+				"appscode/ops", "appscode/ops:guest",
+				"project:appscode/dev/api", "project:appscode/dev/api:maintainer",
+			},
+			auth.OutcomeSuccess,
+		},
+		{
+			"group ids with access level suffix",
+			Options{UseGroupID: true, MinAccessLevel: "reporter", IncludeProjects: true, AccessLevelSuffix: true},
+			[]string{"1", "1:owner", "2", "2:developer", "4", "4:reporter", "project:11", "project:11:maintainer", "project:12", "project:12:developer"},
+			auth.OutcomeSuccess,
+		},
+		{
+			"not a member of the required groups",
+			Options{RequiredGroups: []string{"missing"}},
+			nil,
+			auth.OutcomeNotMember,
+		},
+		{
+			"blocked in the required group",
+			Options{RequiredGroups: []string{"blocked"}},
+			nil,
+			auth.OutcomeNotMember,
+		},
+	}
+
+	for _, test := range dataset {
+		t.Run(test.testName, func(t *testing.T) {
+			opts := test.opts
+			opts.BaseUrl = srv.URL
+			client := &Authenticator{opts: opts}
+
+			resp, err := client.Check(context.Background(), gitlabGoodToken)
+			if test.outcome != auth.OutcomeSuccess {
+				assert.Nil(t, resp)
+				assert.Equal(t, test.outcome, auth.OutcomeOf(err))
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, gitlabUsername, resp.Username)
+				assert.Equal(t, test.groups, resp.Groups)
+			}
+		})
+	}
+}
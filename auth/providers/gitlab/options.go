@@ -18,15 +18,57 @@ package gitlab
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	"github.com/xanzy/go-gitlab"
 	apps "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+var (
+	// accessLevels maps the names of GitLab access levels to their values
+	accessLevels = map[string]gitlab.AccessLevelValue{
+		"minimal":    gitlab.MinimalAccessPermissions,
+		"guest":      gitlab.GuestPermissions,
+		"reporter":   gitlab.ReporterPermissions,
+		"developer":  gitlab.DeveloperPermissions,
+		"maintainer": gitlab.MaintainerPermissions,
+		"owner":      gitlab.OwnerPermissions,
+	}
+	accessLevelNames = map[gitlab.AccessLevelValue]string{}
+	// suffixAccessLevels are the access levels in ascending order
+	suffixAccessLevels []gitlab.AccessLevelValue
+)
+
+func init() {
+	for name, level := range accessLevels {
+		accessLevelNames[level] = name
+		suffixAccessLevels = append(suffixAccessLevels, level)
+	}
+	sort.Slice(suffixAccessLevels, func(i, j int) bool { return suffixAccessLevels[i] < suffixAccessLevels[j] })
+}
+
 type Options struct {
 	BaseUrl    string
 	UseGroupID bool
+
+	// full paths of top-level groups, the user must be a member of at least
+	// one of them. Only groups and projects within them are returned.
+	RequiredGroups []string
+
+	// minimum access level of the user in the returned groups and projects,
+	// if empty every group visible to the user is returned
+	MinAccessLevel string
+
+	// returns the projects the user is a member of as project:<path> groups
+	IncludeProjects bool
+
+	// returns every group and project also with the access level of the user
+	// as suffix, <path>:<access level>
+	AccessLevelSuffix bool
 }
 
 func NewOptions() Options {
@@ -42,10 +84,31 @@ func (o *Options) Configure() error {
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.BaseUrl, "gitlab.base-url", o.BaseUrl, "Base url for GitLab, including the API path, keep empty to use default gitlab base url.")
 	fs.BoolVar(&o.UseGroupID, "gitlab.use-group-id", o.UseGroupID, "Use group ID for authentication instead of group full path")
+	fs.StringSliceVar(&o.RequiredGroups, "gitlab.required-groups", o.RequiredGroups, "Full paths of top-level groups, the user must be a member of at least one of them. Only groups and projects within them are returned")
+	fs.StringVar(&o.MinAccessLevel, "gitlab.min-access-level", o.MinAccessLevel, fmt.Sprintf("Minimum access level of the user in the returned groups and projects, one of %s. If empty, every group visible to the user is returned", strings.Join(accessLevelList(), ", ")))
+	fs.BoolVar(&o.IncludeProjects, "gitlab.include-projects", o.IncludeProjects, "Return the projects the user is a member of as project:<path> groups")
+	fs.BoolVar(&o.AccessLevelSuffix, "gitlab.access-level-suffix", o.AccessLevelSuffix, "Return every group and project also with the access level of the user as suffix, <path>:<access level>")
+}
+
+func accessLevelList() []string {
+	names := make([]string, 0, len(suffixAccessLevels))
+	for _, level := range suffixAccessLevels {
+		names = append(names, accessLevelNames[level])
+	}
+	return names
 }
 
 func (o *Options) Validate() []error {
-	return nil
+	var errs []error
+	for _, group := range o.RequiredGroups {
+		if group == "" || strings.Contains(group, "/") {
+			errs = append(errs, errors.Errorf("gitlab.required-groups must be full paths of top-level groups, found %q", group))
+		}
+	}
+	if _, ok := accessLevels[o.MinAccessLevel]; o.MinAccessLevel != "" && !ok {
+		errs = append(errs, errors.Errorf("gitlab.min-access-level must be one of %s", strings.Join(accessLevelList(), ", ")))
+	}
+	return errs
 }
 
 func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
@@ -54,6 +117,18 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 		args = append(args, fmt.Sprintf("--gitlab.base-url=%s", o.BaseUrl))
 	}
 	args = append(args, fmt.Sprintf("--gitlab.use-group-id=%t", o.UseGroupID))
+	if len(o.RequiredGroups) > 0 {
+		args = append(args, fmt.Sprintf("--gitlab.required-groups=%s", strings.Join(o.RequiredGroups, ",")))
+	}
+	if o.MinAccessLevel != "" {
+		args = append(args, fmt.Sprintf("--gitlab.min-access-level=%s", o.MinAccessLevel))
+	}
+	if o.IncludeProjects {
+		args = append(args, "--gitlab.include-projects")
+	}
+	if o.AccessLevelSuffix {
+		args = append(args, "--gitlab.access-level-suffix")
+	}
 
 	d.Spec.Template.Spec.Containers[0].Args = args
 
@@ -0,0 +1,66 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        Options
+		expectedErr []error
+	}{
+		{
+			"every visible group",
+			NewOptions(),
+			nil,
+		},
+		{
+			"required groups and access level",
+			Options{RequiredGroups: []string{"appscode", "kubeguard"}, MinAccessLevel: "developer", IncludeProjects: true, AccessLevelSuffix: true},
+			nil,
+		},
+		{
+			"invalid required groups and access level",
+			Options{RequiredGroups: []string{"appscode/dev", ""}, MinAccessLevel: "admin"},
+			[]error{
+				errors.New(`gitlab.required-groups must be full paths of top-level groups, found "appscode/dev"`),
+				errors.New(`gitlab.required-groups must be full paths of top-level groups, found ""`),
+				errors.New("gitlab.min-access-level must be one of minimal, guest, reporter, developer, maintainer, owner"),
+			},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
@@ -18,8 +18,10 @@ package google
 
 import (
 	"context"
+	"sync"
 
 	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/httpclient"
 
 	"github.com/coreos/go-oidc"
 	"github.com/pkg/errors"
@@ -47,6 +49,9 @@ type Authenticator struct {
 	verifier   *oidc.IDTokenVerifier
 	service    *gdir.Service
 	domainName string
+	// groups caches the groups of users, if nil every token review lists
+	// the groups
+	groups *groupCache
 }
 
 type TokenInfo struct {
@@ -54,6 +59,115 @@ type TokenInfo struct {
 	HD string `json:"hd"`
 }
 
+// Provider builds a long-lived Authenticator per domain. The discovered
+// issuer, its signing keys, the Directory API client and the group cache are
+// shared by every domain. It is safe for concurrent use and must be closed
+// when no longer used.
+type Provider struct {
+	opts   Options
+	issuer string
+
+	service *gdir.Service
+	groups  *groupCache
+	stopCh  chan struct{}
+
+	lock           sync.RWMutex
+	verifier       *oidc.IDTokenVerifier
+	authenticators map[string]*Authenticator
+}
+
+func NewProvider(opts Options) (*Provider, error) {
+	p := &Provider{
+		opts:           opts,
+		issuer:         googleIssuerUrl,
+		stopCh:         make(chan struct{}),
+		authenticators: map[string]*Authenticator{},
+	}
+
+	if opts.ServiceAccountJsonFile != "" {
+		// the token source is kept across token reviews, it reuses the
+		// access token of the service account until it expires
+		var err error
+		p.service, err = gdir.NewService(context.Background(), option.WithTokenSource(opts.jwtConfig.TokenSource(context.Background())))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create admin/directory/v1 client")
+		}
+	}
+	if opts.GroupCacheTTL > 0 {
+		var err error
+		p.groups, err = newGroupCache(opts.GroupCacheTTL, opts.GroupCacheSizeMB)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Authenticator returns the Authenticator of domain. The issuer is
+// discovered by the first call, a failed discovery is retried by the next.
+func (p *Provider) Authenticator(ctx context.Context, domain string) (*Authenticator, error) {
+	p.lock.RLock()
+	// fast path: read from cache
+	if a, ok := p.authenticators[domain]; ok {
+		p.lock.RUnlock()
+		return a, nil
+	}
+	p.lock.RUnlock()
+
+	// slow path: hold the lock during discovery to avoid sending multiple requests
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if a, ok := p.authenticators[domain]; ok {
+		return a, nil
+	}
+	if p.verifier == nil {
+		if err := p.discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	a := &Authenticator{
+		Options:    p.opts,
+		verifier:   p.verifier,
+		service:    p.service,
+		domainName: domain,
+		groups:     p.groups,
+	}
+	p.authenticators[domain] = a
+	return a, nil
+}
+
+func (p *Provider) discover(ctx context.Context) error {
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, httpclient.DefaultHTTPClient), p.issuer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create oidc provider for google")
+	}
+	var metadata struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err = provider.Claims(&metadata); err != nil {
+		return errors.Wrap(err, "failed to decode discovery document of google")
+	}
+
+	keys := newKeySet(metadata.JWKSURI, httpclient.DefaultHTTPClient)
+	keys.Run(keySetRefreshInterval, p.stopCh)
+	p.verifier = oidc.NewVerifier(p.issuer, keys, &oidc.Config{
+		ClientID: GoogleOauth2ClientID,
+	})
+	return nil
+}
+
+// Close stops the key refresh and releases the group cache
+func (p *Provider) Close() {
+	close(p.stopCh)
+	if p.groups != nil {
+		p.groups.Close()
+	}
+}
+
+// New builds an Authenticator for a single token review, servers should
+// reuse the authenticators of a Provider
 func New(ctx context.Context, opts Options, domain string) (auth.Interface, error) {
 	g := &Authenticator{
 		Options:    opts,
@@ -82,6 +196,11 @@ func (g Authenticator) UID() string {
 	return OrgType
 }
 
+// Ready checks the discovery document and the key set of Google are reachable
+func (o Options) Ready(ctx context.Context) error {
+	return auth.CheckOIDCDiscovery(ctx, httpclient.DefaultHTTPClient, googleIssuerUrl)
+}
+
 // https://developers.google.com/identity/protocols/OpenIDConnect#validatinganidtoken
 func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
 	idToken, err := g.verifier.Verify(ctx, token)
@@ -97,7 +216,7 @@ func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserIn
 	}
 
 	if info.HD != g.domainName {
-		return nil, errors.Errorf("user is not a member of domain %s", g.domainName)
+		return nil, auth.WithOutcome(errors.Errorf("user is not a member of domain %s", g.domainName), auth.OutcomeNotMember)
 	}
 
 	resp := &authv1.UserInfo{
@@ -106,11 +225,26 @@ func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserIn
 	}
 
 	if g.ServiceAccountJsonFile != "" {
+		if g.groups != nil {
+			resp.Groups, err = g.groups.Get(ctx, g.domainName, info.Email, g.listGroups(info.Email))
+		} else {
+			resp.Groups, err = g.listGroups(info.Email)(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (g *Authenticator) listGroups(email string) func(ctx context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
 		var groups []string
 		var pageToken string
 
 		for {
-			r2, err := g.service.Groups.List().UserKey(info.Email).Domain(g.domainName).PageToken(pageToken).Context(ctx).Do()
+			r2, err := g.service.Groups.List().UserKey(email).Domain(g.domainName).PageToken(pageToken).Context(ctx).Do()
 			if err != nil {
 				return nil, errors.Wrapf(err, "failed to load user's groups for domain %s", g.domainName)
 			}
@@ -122,8 +256,6 @@ func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserIn
 			}
 			pageToken = r2.NextPageToken
 		}
-		resp.Groups = groups
+		return groups, nil
 	}
-
-	return resp, nil
 }
@@ -29,7 +29,10 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"go.kubeguard.dev/guard/util/httpclient"
 
@@ -77,6 +80,21 @@ func (s *signingKey) sign(payload []byte) (string, error) {
 	return data, nil
 }
 
+// signWithKeyID signs payload with the kid header set to the key id
+func (s *signingKey) signWithKeyID(payload []byte) (string, error) {
+	privKey := &jose.JSONWebKey{Key: s.priv, Algorithm: string(s.alg), KeyID: s.keyID}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: s.alg, Key: privKey}, nil)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
 // jwk returns the public part of the signing key.
 func (s *signingKey) jwk() jose.JSONWebKeySet {
 	k := jose.JSONWebKey{Key: s.pub, Use: "sig", Algorithm: string(s.alg), KeyID: s.keyID}
@@ -419,3 +437,96 @@ func TestCheckGoogleAuthenticationFailed(t *testing.T) {
 		})
 	}
 }
+
+func TestProvider(t *testing.T) {
+	signKey, err := newRSAKey()
+	if err != nil {
+		t.Fatalf("Error when creating signing key. reason : %v", err)
+	}
+	jwkResp, err := json.Marshal(signKey.jwk())
+	if err != nil {
+		t.Fatalf("Error when generating JSONWebKeySet. reason: %v", err)
+	}
+
+	var discoveries, groupLists int32
+	groupResp := googleGetGroupResp(7, 5, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			atomic.AddInt32(&discoveries, 1)
+			_, _ = fmt.Fprintf(w, `{"issuer" : "http://%v", "jwks_uri" : "http://%v/jwk"}`, r.Host, r.Host)
+		case "/jwk":
+			_, _ = w.Write(jwkResp)
+		case "/admin/directory/v1/groups":
+			if r.URL.Query().Get("pageToken") == "" {
+				atomic.AddInt32(&groupLists, 1)
+			}
+			status, resp := groupResp(r.URL)
+			w.WriteHeader(status)
+			_, _ = w.Write(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewProvider(Options{
+		AdminEmail:       adminEmail,
+		GroupCacheTTL:    time.Minute,
+		GroupCacheSizeMB: 1,
+	})
+	if err != nil {
+		t.Fatalf("Error when creating google provider. reason : %v", err)
+	}
+	defer p.Close()
+	p.issuer = srv.URL
+	p.opts.ServiceAccountJsonFile = "sa.json"
+	p.service, err = gdir.NewService(context.Background(), option.WithHTTPClient(httpclient.DefaultHTTPClient))
+	if err != nil {
+		t.Fatalf("Error when creating google service. reason : %v", err)
+	}
+	p.service.BasePath = srv.URL
+
+	ctx := context.Background()
+	a, err := p.Authenticator(ctx, domain)
+	if !assert.Nil(t, err) {
+		return
+	}
+	again, err := p.Authenticator(ctx, domain)
+	assert.Nil(t, err)
+	assert.Same(t, a, again, "authenticator of a domain must be reused")
+	other, err := p.Authenticator(ctx, "other")
+	assert.Nil(t, err)
+	assert.NotSame(t, a, other)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&discoveries), "issuer must be discovered once")
+
+	claims := fmt.Sprintf(`{"iss":"%s", "email":"%s", "aud":"%s", "hd":"%s", "exp":%d}`, srv.URL, userEmail, GoogleOauth2ClientID, domain, time.Now().Add(time.Hour).Unix())
+	token, err := signKey.sign([]byte(claims))
+	if err != nil {
+		t.Fatalf("Error when signing token. reason: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := a.Check(ctx, token)
+			if assert.Nil(t, err) {
+				assertUserInfo(t, resp, 7)
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp, err := a.Check(ctx, token)
+	if assert.Nil(t, err) {
+		assertUserInfo(t, resp, 7)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&groupLists), "groups of the user must be cached")
+
+	// the other domain rejects the user without listing groups
+	_, err = other.Check(ctx, token)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&groupLists))
+}
@@ -0,0 +1,90 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/allegro/bigcache"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/klog/v2"
+)
+
+const (
+	groupCacheShards       = 64
+	groupCacheMaxEntrySize = 1024
+)
+
+// groupCache caches the groups of users by domain and email. Concurrent
+// lookups of the same user share a single Directory API call.
+type groupCache struct {
+	cache *bigcache.BigCache
+	calls singleflight.Group
+}
+
+func newGroupCache(ttl time.Duration, sizeMB int) (*groupCache, error) {
+	cache, err := bigcache.NewBigCache(bigcache.Config{
+		Shards:           groupCacheShards,
+		LifeWindow:       ttl,
+		CleanWindow:      ttl,
+		MaxEntrySize:     groupCacheMaxEntrySize,
+		HardMaxCacheSize: sizeMB,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create google group cache")
+	}
+	return &groupCache{cache: cache}, nil
+}
+
+// Get returns the cached groups of the user, or loads and caches them. Errors
+// are not cached.
+func (c *groupCache) Get(ctx context.Context, domain, email string, load func(ctx context.Context) ([]string, error)) ([]string, error) {
+	key := domain + "/" + email
+	if data, err := c.cache.Get(key); err == nil {
+		var groups []string
+		if err = json.Unmarshal(data, &groups); err == nil {
+			googleGroupCacheRequests.WithLabelValues(cacheResultHit).Inc()
+			return groups, nil
+		}
+	}
+	googleGroupCacheRequests.WithLabelValues(cacheResultMiss).Inc()
+
+	v, err, _ := c.calls.Do(key, func() (interface{}, error) {
+		groups, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if data, err := json.Marshal(groups); err == nil {
+			if err = c.cache.Set(key, data); err != nil {
+				klog.V(5).Infof("failed to cache groups of %s: %v", email, err)
+			}
+		}
+		return groups, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the result is shared by the concurrent lookups
+	return append([]string(nil), v.([]string)...), nil
+}
+
+func (c *groupCache) Close() {
+	_ = c.cache.Close()
+}
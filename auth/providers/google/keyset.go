@@ -0,0 +1,173 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// keySetRefreshInterval is how often the keys are refreshed in the
+	// background, Google publishes new keys well before signing with them
+	keySetRefreshInterval = time.Hour
+	// keySetMinRefreshInterval limits the refreshes caused by tokens signed
+	// with an unknown key
+	keySetMinRefreshInterval = time.Minute
+	keySetRefreshTimeout     = 10 * time.Second
+)
+
+// keySet holds the signing keys of Google. It implements oidc.KeySet and,
+// unlike the key set of a discovered oidc.Provider, refreshes the keys in the
+// background so rotated keys do not delay token reviews.
+type keySet struct {
+	jwksURL string
+	client  *http.Client
+	now     func() time.Time
+
+	// refreshLock serializes refreshes, concurrent token reviews signed with
+	// an unknown key wait for a single refresh
+	refreshLock sync.Mutex
+
+	lock      sync.RWMutex
+	keys      []jose.JSONWebKey
+	refreshed time.Time
+}
+
+func newKeySet(jwksURL string, client *http.Client) *keySet {
+	return &keySet{
+		jwksURL: jwksURL,
+		client:  client,
+		now:     time.Now,
+	}
+}
+
+// Run refreshes the keys every interval until stopCh is closed, the first
+// refresh starts immediately
+func (k *keySet) Run(interval time.Duration, stopCh <-chan struct{}) {
+	go wait.Until(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), keySetRefreshTimeout)
+		defer cancel()
+		if err := k.Refresh(ctx); err != nil {
+			klog.Errorf("failed to refresh google signing keys: %v", err)
+		}
+	}, interval, stopCh)
+}
+
+// VerifySignature verifies the signature of jwt and returns its payload. If
+// the key is not known the keys are refreshed once.
+func (k *keySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed jwt")
+	}
+	if payload, ok := k.verify(jws); ok {
+		return payload, nil
+	}
+
+	// the token may be signed with a key published after the last refresh
+	if err = k.refreshIfStale(ctx); err != nil {
+		return nil, err
+	}
+	if payload, ok := k.verify(jws); ok {
+		return payload, nil
+	}
+	return nil, errors.New("failed to verify id token signature")
+}
+
+func (k *keySet) verify(jws *jose.JSONWebSignature) ([]byte, bool) {
+	var keyID string
+	for _, sig := range jws.Signatures {
+		keyID = sig.Header.KeyID
+		break
+	}
+
+	k.lock.RLock()
+	keys := k.keys
+	k.lock.RUnlock()
+
+	for i := range keys {
+		if keyID != "" && keys[i].KeyID != keyID {
+			continue
+		}
+		if payload, err := jws.Verify(&keys[i]); err == nil {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+// refreshIfStale refreshes the keys unless they were refreshed within
+// keySetMinRefreshInterval
+func (k *keySet) refreshIfStale(ctx context.Context) error {
+	k.refreshLock.Lock()
+	defer k.refreshLock.Unlock()
+
+	k.lock.RLock()
+	fresh := !k.refreshed.IsZero() && k.now().Sub(k.refreshed) < keySetMinRefreshInterval
+	k.lock.RUnlock()
+	if fresh {
+		return nil
+	}
+	return k.fetch(ctx)
+}
+
+// Refresh fetches the keys, on error the previous keys are kept
+func (k *keySet) Refresh(ctx context.Context) error {
+	k.refreshLock.Lock()
+	defer k.refreshLock.Unlock()
+	return k.fetch(ctx)
+}
+
+func (k *keySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.jwksURL, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch google signing keys")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("GET %s failed with status code: %d", k.jwksURL, resp.StatusCode)
+	}
+
+	var set jose.JSONWebKeySet
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return errors.Wrap(err, "failed to decode google signing keys")
+	}
+	if len(set.Keys) == 0 {
+		return errors.Errorf("key set %s is empty", k.jwksURL)
+	}
+
+	k.lock.Lock()
+	k.keys = set.Keys
+	k.refreshed = k.now()
+	k.lock.Unlock()
+	return nil
+}
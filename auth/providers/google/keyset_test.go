@@ -0,0 +1,103 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, err := newRSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey.keyID = "old"
+	newKey, err := newRSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey.keyID = "new"
+
+	var (
+		lock     sync.Mutex
+		current  = oldKey
+		requests int32
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		lock.Lock()
+		defer lock.Unlock()
+		_ = json.NewEncoder(w).Encode(current.jwk())
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	k := newKeySet(srv.URL, http.DefaultClient)
+	k.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	sign := func(key *signingKey) string {
+		token, err := key.signWithKeyID([]byte(`{"sub":"1234"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// the keys are fetched by the first token
+	payload, err := k.VerifySignature(ctx, sign(oldKey))
+	if assert.Nil(t, err) {
+		assert.JSONEq(t, `{"sub":"1234"}`, string(payload))
+	}
+	assert.Nil(t, k.Refresh(ctx))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	lock.Lock()
+	current = newKey
+	lock.Unlock()
+
+	// the keys were refreshed within keySetMinRefreshInterval
+	_, err = k.VerifySignature(ctx, sign(newKey))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// a token signed with the new key triggers a refresh
+	now = now.Add(keySetMinRefreshInterval)
+	_, err = k.VerifySignature(ctx, sign(newKey))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// the old key is no longer published
+	now = now.Add(keySetMinRefreshInterval)
+	_, err = k.VerifySignature(ctx, sign(oldKey))
+	assert.NotNil(t, err)
+
+	// a failed refresh keeps the keys
+	srv.Close()
+	assert.NotNil(t, k.Refresh(ctx))
+	_, err = k.VerifySignature(ctx, sign(newKey))
+	assert.Nil(t, err)
+}
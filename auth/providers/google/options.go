@@ -19,6 +19,7 @@ package google
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -32,14 +33,29 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+const (
+	DefaultGroupCacheTTL    = 5 * time.Minute
+	DefaultGroupCacheSizeMB = 8
+)
+
 type Options struct {
 	ServiceAccountJsonFile string
 	AdminEmail             string
 	jwtConfig              *jwt.Config
+
+	// GroupCacheTTL is how long the groups of a user are cached, 0 disables
+	// the cache
+	GroupCacheTTL time.Duration
+
+	// GroupCacheSizeMB is the maximum size of the group cache
+	GroupCacheSizeMB int
 }
 
 func NewOptions() Options {
-	return Options{}
+	return Options{
+		GroupCacheTTL:    DefaultGroupCacheTTL,
+		GroupCacheSizeMB: DefaultGroupCacheSizeMB,
+	}
 }
 
 func (o *Options) Configure() error {
@@ -66,6 +82,8 @@ func (o *Options) Configure() error {
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.ServiceAccountJsonFile, "google.sa-json-file", o.ServiceAccountJsonFile, "Path to Google service account json file")
 	fs.StringVar(&o.AdminEmail, "google.admin-email", o.AdminEmail, "Email of G Suite administrator")
+	fs.DurationVar(&o.GroupCacheTTL, "google.group-cache-ttl", o.GroupCacheTTL, "Duration the groups of a user are cached, 0 disables the cache")
+	fs.IntVar(&o.GroupCacheSizeMB, "google.group-cache-size-mb", o.GroupCacheSizeMB, "Maximum size of the group cache in MB")
 }
 
 func (o *Options) Validate() []error {
@@ -76,6 +94,17 @@ func (o *Options) Validate() []error {
 	if o.AdminEmail == "" {
 		errs = append(errs, errors.New("google.admin-email must be non-empty"))
 	}
+	if o.GroupCacheTTL < 0 {
+		errs = append(errs, errors.New("google.group-cache-ttl must be non-negative"))
+	} else if o.GroupCacheTTL > 0 {
+		// the cache expires entries with a resolution of one second
+		if o.GroupCacheTTL < time.Second {
+			errs = append(errs, errors.New("google.group-cache-ttl must be at least 1s"))
+		}
+		if o.GroupCacheSizeMB <= 0 {
+			errs = append(errs, errors.New("google.group-cache-size-mb must be positive"))
+		}
+	}
 	return errs
 }
 
@@ -125,6 +154,12 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 	if o.AdminEmail != "" {
 		args = append(args, fmt.Sprintf("--google.admin-email=%s", o.AdminEmail))
 	}
+	if o.GroupCacheTTL != DefaultGroupCacheTTL {
+		args = append(args, fmt.Sprintf("--google.group-cache-ttl=%v", o.GroupCacheTTL))
+	}
+	if o.GroupCacheSizeMB != DefaultGroupCacheSizeMB {
+		args = append(args, fmt.Sprintf("--google.group-cache-size-mb=%d", o.GroupCacheSizeMB))
+	}
 
 	container.Args = args
 	d.Spec.Template.Spec.Containers[0] = container
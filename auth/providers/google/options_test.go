@@ -18,6 +18,7 @@ package google
 
 import (
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -64,6 +65,8 @@ func getNonEmptyOptions() Options {
 	return Options{
 		ServiceAccountJsonFile: nonempty,
 		AdminEmail:             nonempty,
+		GroupCacheTTL:          DefaultGroupCacheTTL,
+		GroupCacheSizeMB:       DefaultGroupCacheSizeMB,
 	}
 }
 
@@ -104,6 +107,26 @@ func TestOptionsValidate(t *testing.T) {
 			getNonEmptyOptions(),
 			nil,
 		},
+		{
+			"group cache disabled",
+			Options{ServiceAccountJsonFile: nonempty, AdminEmail: nonempty},
+			nil,
+		},
+		{
+			"negative group cache ttl",
+			Options{ServiceAccountJsonFile: nonempty, AdminEmail: nonempty, GroupCacheTTL: -time.Minute},
+			[]error{errors.New("google.group-cache-ttl must be non-negative")},
+		},
+		{
+			"group cache ttl below cache resolution",
+			Options{ServiceAccountJsonFile: nonempty, AdminEmail: nonempty, GroupCacheTTL: time.Millisecond, GroupCacheSizeMB: DefaultGroupCacheSizeMB},
+			[]error{errors.New("google.group-cache-ttl must be at least 1s")},
+		},
+		{
+			"no group cache size",
+			Options{ServiceAccountJsonFile: nonempty, AdminEmail: nonempty, GroupCacheTTL: time.Minute},
+			[]error{errors.New("google.group-cache-size-mb must be positive")},
+		},
 	}
 
 	testData = append(testData, getTestDataForIndivitualError()...)
@@ -0,0 +1,219 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AddUser adds a user to the htpasswd file, the file is created if it does
+// not exist
+func AddUser(file, name, password string) error {
+	if err := validateUser(name, password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash password")
+	}
+	return editFile(file, validateHtpasswd, func(lines []string) ([]string, error) {
+		if findUser(lines, name) >= 0 {
+			return nil, errors.Errorf("user %s already exists", name)
+		}
+		return append(lines, name+":"+string(hash)), nil
+	})
+}
+
+// SetPassword replaces the password of a user of the htpasswd file
+func SetPassword(file, name, password string) error {
+	if err := validateUser(name, password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash password")
+	}
+	return editFile(file, validateHtpasswd, func(lines []string) ([]string, error) {
+		i := findUser(lines, name)
+		if i < 0 {
+			return nil, errors.Errorf("user %s not found", name)
+		}
+		lines[i] = name + ":" + string(hash)
+		return lines, nil
+	})
+}
+
+// DeleteUser removes a user from the htpasswd file
+func DeleteUser(file, name string) error {
+	return editFile(file, validateHtpasswd, func(lines []string) ([]string, error) {
+		i := findUser(lines, name)
+		if i < 0 {
+			return nil, errors.Errorf("user %s not found", name)
+		}
+		return append(lines[:i], lines[i+1:]...), nil
+	})
+}
+
+// SetGroups makes the user a member of exactly the given groups of the groups
+// file. Groups without members are removed, missing groups are appended.
+func SetGroups(file, name string, groups []string) error {
+	want := map[string]bool{}
+	for _, g := range groups {
+		if g = strings.TrimSpace(g); g != "" {
+			want[g] = true
+		}
+	}
+	return editFile(file, validateGroups, func(lines []string) ([]string, error) {
+		out := make([]string, 0, len(lines)+len(want))
+		for _, line := range lines {
+			group, members, found := strings.Cut(line, ":")
+			group = strings.TrimSpace(group)
+			if !found || strings.HasPrefix(group, "#") {
+				out = append(out, line)
+				continue
+			}
+			var keep []string
+			for _, m := range strings.Fields(members) {
+				if m != name {
+					keep = append(keep, m)
+				}
+			}
+			if want[group] {
+				keep = append(keep, name)
+				delete(want, group)
+			}
+			if len(keep) > 0 {
+				out = append(out, group+": "+strings.Join(keep, " "))
+			}
+		}
+		for _, g := range groups {
+			if g = strings.TrimSpace(g); want[g] {
+				out = append(out, g+": "+name)
+				delete(want, g)
+			}
+		}
+		return out, nil
+	})
+}
+
+func validateUser(name, password string) error {
+	switch {
+	case name == "":
+		return errors.New("user name must be non-empty")
+	case strings.ContainsAny(name, ": \t\r\n"), strings.HasPrefix(name, "#"):
+		return errors.Errorf("user name %q must not start with # or contain a colon or whitespace", name)
+	case password == "":
+		return errors.New("password must be non-empty")
+	case len(password) > 72:
+		return errors.New("password must be at most 72 bytes long")
+	}
+	return nil
+}
+
+func validateHtpasswd(data []byte) error {
+	_, err := ParseHtpasswd(data)
+	return err
+}
+
+func validateGroups(data []byte) error {
+	_, err := ParseGroups(data)
+	return err
+}
+
+func findUser(lines []string, name string) int {
+	for i, line := range lines {
+		if n, _, found := strings.Cut(line, ":"); found && strings.TrimSpace(n) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// editFile replaces the lines of file with the edited lines. The new content
+// is validated and written to a temporary file first, which is renamed over
+// the file, so readers never see a partially written file. A lock file keeps
+// concurrent edits from overwriting each other.
+func editFile(file string, validate func([]byte) error, edit func([]string) ([]string, error)) error {
+	lock := file + ".lock"
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if os.IsExist(err) {
+			return errors.Errorf("%s is being edited, remove %s if no other edit is running", file, lock)
+		}
+		return errors.Wrapf(err, "failed to lock %s", file)
+	}
+	_ = f.Close()
+	defer func() {
+		_ = os.Remove(lock)
+	}()
+
+	mode := os.FileMode(0o600)
+	var lines []string
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err = validate(data); err != nil {
+			return err
+		}
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(data) == 0 {
+			lines = nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if lines, err = edit(lines); err != nil {
+		return err
+	}
+	data := []byte(strings.Join(lines, "\n"))
+	if len(lines) > 0 {
+		data = append(data, '\n')
+	}
+	if err = validate(data); err != nil {
+		return errors.Wrapf(err, "edited %s is invalid", file)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file for %s", file)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write temporary file for %s", file)
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditUsers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "htpasswd")
+	groupsFile := filepath.Join(dir, "groups")
+	writeFile(t, file, "# lab users\n")
+
+	assert.Nil(t, AddUser(file, "alice", "secret"))
+	assert.Nil(t, AddUser(file, "bob", "hunter2"))
+	assert.EqualError(t, AddUser(file, "alice", "other"), "user alice already exists")
+	assert.NotNil(t, AddUser(file, "carol:x", "secret"))
+	assert.NotNil(t, AddUser(file, "carol", ""))
+	assert.Nil(t, SetGroups(groupsFile, "alice", []string{"dev", "admin"}))
+	assert.Nil(t, SetGroups(groupsFile, "bob", []string{"dev"}))
+
+	a := New(Options{File: file, GroupsFile: groupsFile})
+	if !assert.Nil(t, a.Configure()) {
+		return
+	}
+	resp, err := a.Check(context.Background(), basicToken("alice", "secret"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"dev", "admin"}, resp.Groups)
+	}
+
+	assert.Nil(t, SetPassword(file, "alice", "changed"))
+	assert.EqualError(t, SetPassword(file, "carol", "secret"), "user carol not found")
+	assert.Nil(t, DeleteUser(file, "bob"))
+	assert.EqualError(t, DeleteUser(file, "bob"), "user bob not found")
+	assert.Nil(t, SetGroups(groupsFile, "alice", []string{"ops"}))
+
+	data, err := os.ReadFile(file)
+	if assert.Nil(t, err) {
+		users, err := ParseHtpasswd(data)
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Contains(t, string(data), "# lab users\n", "comments must be kept")
+	}
+	data, err = os.ReadFile(groupsFile)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "dev: bob\nops: alice\n", string(data))
+	}
+
+	if assert.Nil(t, a.Configure()) {
+		_, err = a.Check(context.Background(), basicToken("alice", "changed"))
+		assert.Nil(t, err)
+	}
+	_, err = os.Stat(file + ".lock")
+	assert.True(t, os.IsNotExist(err), "lock file must be removed")
+}
+
+func TestEditLocked(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	writeFile(t, file+".lock", "")
+	assert.NotNil(t, AddUser(file, "alice", "secret"))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,226 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/reload"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const (
+	OrgType = "htpasswd"
+)
+
+// dummyHash is compared against the password of unknown users, so the time of
+// a review does not tell whether the user exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("guard"), bcrypt.DefaultCost)
+
+func init() {
+	auth.SupportedOrgs = append(auth.SupportedOrgs, OrgType)
+}
+
+type Authenticator struct {
+	options  Options
+	lockout  *lockout
+	accounts *reload.File[accounts]
+}
+
+// accounts are the users and groups loaded from the htpasswd and groups files
+type accounts struct {
+	users  map[string][]byte
+	groups map[string][]string
+}
+
+var _ auth.Interface = &Authenticator{}
+
+func New(opts Options) *Authenticator {
+	a := &Authenticator{
+		options: opts,
+		lockout: newLockout(opts.MaxFailures, opts.LockoutDuration),
+	}
+	a.accounts = reload.NewFile("htpasswd file", a.load, opts.File, opts.GroupsFile)
+	return a
+}
+
+// Configure loads the htpasswd and groups files. On error the previously
+// loaded users are kept.
+func (a *Authenticator) Configure() error {
+	return a.accounts.Load()
+}
+
+// Watch reloads the htpasswd and groups files when they change, until stopCh
+// is closed
+func (a *Authenticator) Watch(stopCh <-chan struct{}) error {
+	return a.accounts.Watch(stopCh)
+}
+
+func (a *Authenticator) load() (accounts, error) {
+	users, err := LoadHtpasswdFile(a.options.File)
+	if err != nil {
+		return accounts{}, err
+	}
+	groups := map[string][]string{}
+	if a.options.GroupsFile != "" {
+		if groups, err = LoadGroupsFile(a.options.GroupsFile); err != nil {
+			return accounts{}, err
+		}
+	}
+
+	acc := accounts{users: make(map[string][]byte, len(users)), groups: groups}
+	for name, hash := range users {
+		acc.users[name] = []byte(hash)
+	}
+	a.lockout.Retain(func(name string) bool {
+		_, ok := acc.users[name]
+		return ok
+	})
+	return acc, nil
+}
+
+// Ready checks the htpasswd and groups files were loaded
+func (a *Authenticator) Ready(_ context.Context) error {
+	return a.accounts.Ready()
+}
+
+func (a *Authenticator) UID() string {
+	return OrgType
+}
+
+// Check verifies the base64 encoded user:password token. Users are locked out
+// for a while after too many failed attempts, see Options.MaxFailures.
+func (a *Authenticator) Check(_ context.Context, token string) (*authv1.UserInfo, error) {
+	username, password, ok := auth.ParseBasicToken(token)
+	if !ok {
+		return nil, errors.New("Invalid basic auth token")
+	}
+
+	if until, locked := a.lockout.Locked(username); locked {
+		return nil, auth.Reject(errors.Errorf("user %s is locked out until %s after too many failed attempts", username, until.Format(time.RFC3339)))
+	}
+
+	acc, _ := a.accounts.Get()
+	hash, found := acc.users[username]
+	groups := acc.groups[username]
+
+	if !found {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, errors.New("Invalid username or password")
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		a.lockout.Fail(username)
+		return nil, errors.New("Invalid username or password")
+	}
+	a.lockout.Succeed(username)
+
+	return &authv1.UserInfo{
+		Username: username,
+		Groups:   append([]string(nil), groups...),
+	}, nil
+}
+
+// LoadHtpasswdFile reads the bcrypt hashed passwords of an htpasswd file
+func LoadHtpasswdFile(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseHtpasswd(data)
+}
+
+// ParseHtpasswd parses user:hash lines as written by `htpasswd -B`. Empty lines
+// and lines starting with # are ignored. Only bcrypt hashes are supported.
+func ParseHtpasswd(data []byte) (map[string]string, error) {
+	users := map[string]string{}
+	err := scanLines(data, func(lineNum int, line string) error {
+		name, hash, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		hash = strings.TrimSpace(hash)
+		switch {
+		case !found || name == "":
+			return errors.Errorf("line #%d of htpasswd file is ill formatted", lineNum)
+		case users[name] != "":
+			return errors.Errorf("line #%d of htpasswd file redefines user %s", lineNum, name)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return errors.Errorf("line #%d of htpasswd file has unsupported password hash, only bcrypt is supported", lineNum)
+		}
+		users[name] = hash
+		return nil
+	})
+	return users, err
+}
+
+// LoadGroupsFile reads the groups of each user from a groups file
+func LoadGroupsFile(file string) (map[string][]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGroups(data)
+}
+
+// ParseGroups parses a group file in the format of the Apache AuthGroupFile,
+//
+//	group1: user1 user2
+//	group2: user2
+//
+// and returns the groups of each user in the order of the file
+func ParseGroups(data []byte) (map[string][]string, error) {
+	groups := map[string][]string{}
+	seen := map[string]bool{}
+	err := scanLines(data, func(lineNum int, line string) error {
+		group, members, found := strings.Cut(line, ":")
+		group = strings.TrimSpace(group)
+		switch {
+		case !found || group == "":
+			return errors.Errorf("line #%d of groups file is ill formatted", lineNum)
+		case seen[group]:
+			return errors.Errorf("line #%d of groups file redefines group %s", lineNum, group)
+		}
+		seen[group] = true
+		for _, name := range strings.Fields(members) {
+			groups[name] = append(groups[name], group)
+		}
+		return nil
+	})
+	return groups, err
+}
+
+func scanLines(data []byte, fn func(lineNum int, line string) error) error {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(lineNum, line); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
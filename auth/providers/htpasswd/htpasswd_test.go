@@ -0,0 +1,193 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func basicToken(user, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+}
+
+func hashPassword(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func writeFile(t *testing.T, file, data string) {
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestAuthenticator(t *testing.T, opts Options) (*Authenticator, Options) {
+	dir := t.TempDir()
+	opts.File = filepath.Join(dir, "htpasswd")
+	opts.GroupsFile = filepath.Join(dir, "groups")
+	writeFile(t, opts.File, "# lab users\nalice:"+hashPassword(t, "secret")+"\n\nbob:"+hashPassword(t, "hunter2")+"\n")
+	writeFile(t, opts.GroupsFile, "dev: alice bob\nadmin: alice\n")
+
+	a := New(opts)
+	if err := a.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	return a, opts
+}
+
+func TestCheck(t *testing.T) {
+	a, _ := newTestAuthenticator(t, Options{})
+
+	testData := []struct {
+		testName      string
+		token         string
+		expectedUser  string
+		expectedGroup []string
+		expectedErr   string
+	}{
+		{"valid password", basicToken("alice", "secret"), "alice", []string{"dev", "admin"}, ""},
+		{"user in one group", basicToken("bob", "hunter2"), "bob", []string{"dev"}, ""},
+		{"wrong password", basicToken("alice", "hunter2"), "", nil, "Invalid username or password"},
+		{"unknown user", basicToken("carol", "secret"), "", nil, "Invalid username or password"},
+		{"not base64", "alice:secret", "", nil, "Invalid basic auth token"},
+		{"missing colon", base64.StdEncoding.EncodeToString([]byte("alice")), "", nil, "Invalid basic auth token"},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			resp, err := a.Check(context.Background(), test.token)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Nil(t, resp)
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, test.expectedUser, resp.Username)
+				assert.Equal(t, test.expectedGroup, resp.Groups)
+			}
+		})
+	}
+}
+
+func TestLockout(t *testing.T) {
+	a, _ := newTestAuthenticator(t, Options{MaxFailures: 3, LockoutDuration: time.Minute})
+	now := time.Now()
+	a.lockout.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// a successful login resets the failed attempts
+	for i := 0; i < 2; i++ {
+		_, _ = a.Check(ctx, basicToken("alice", "wrong"))
+	}
+	_, err := a.Check(ctx, basicToken("alice", "secret"))
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = a.Check(ctx, basicToken("alice", "wrong"))
+		assert.False(t, auth.IsRejected(err))
+	}
+	_, err = a.Check(ctx, basicToken("alice", "secret"))
+	if assert.NotNil(t, err, "user must be locked out") {
+		assert.True(t, auth.IsRejected(err))
+	}
+
+	// other users are not affected
+	_, err = a.Check(ctx, basicToken("bob", "hunter2"))
+	assert.Nil(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = a.Check(ctx, basicToken("alice", "secret"))
+	assert.Nil(t, err, "lockout must expire")
+}
+
+func TestReload(t *testing.T) {
+	a, opts := newTestAuthenticator(t, Options{})
+	ctx := context.Background()
+	assert.Nil(t, a.Ready(ctx))
+
+	writeFile(t, opts.File, "alice:"+hashPassword(t, "changed")+"\n")
+	writeFile(t, opts.GroupsFile, "ops: alice\n")
+	if assert.Nil(t, a.Configure()) {
+		resp, err := a.Check(ctx, basicToken("alice", "changed"))
+		if assert.Nil(t, err) {
+			assert.Equal(t, []string{"ops"}, resp.Groups)
+		}
+		_, err = a.Check(ctx, basicToken("bob", "hunter2"))
+		assert.NotNil(t, err)
+	}
+
+	// a broken file keeps the loaded users, but is reported
+	writeFile(t, opts.File, "alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n")
+	assert.NotNil(t, a.Configure())
+	assert.NotNil(t, a.Ready(ctx))
+	_, err := a.Check(ctx, basicToken("alice", "changed"))
+	assert.Nil(t, err)
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	hash := hashPassword(t, "secret")
+	testData := []struct {
+		testName    string
+		data        string
+		expectedErr string
+	}{
+		{"valid", "alice:" + hash + "\n# comment\n\nbob:" + hash, ""},
+		{"missing hash", "alice", "line #1 of htpasswd file is ill formatted"},
+		{"empty user", ":" + hash, "line #1 of htpasswd file is ill formatted"},
+		{"duplicate user", "alice:" + hash + "\nalice:" + hash, "line #2 of htpasswd file redefines user alice"},
+		{"md5 hash", "\nalice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", "line #2 of htpasswd file has unsupported password hash, only bcrypt is supported"},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := ParseHtpasswd([]byte(test.data))
+			if test.expectedErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	groups, err := ParseGroups([]byte("# groups\ndev: alice bob\nadmin:alice\nempty:\n"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string][]string{
+			"alice": {"dev", "admin"},
+			"bob":   {"dev"},
+		}, groups)
+	}
+
+	_, err = ParseGroups([]byte("dev alice"))
+	assert.EqualError(t, err, "line #1 of groups file is ill formatted")
+	_, err = ParseGroups([]byte("dev: alice\ndev: bob"))
+	assert.EqualError(t, err, "line #2 of groups file redefines group dev")
+}
@@ -0,0 +1,113 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"sync"
+	"time"
+)
+
+// lockout counts the consecutive failed attempts of each user. A user
+// reaching maxFailures is locked out for duration, afterwards the count
+// starts again.
+type lockout struct {
+	maxFailures int
+	duration    time.Duration
+	now         func() time.Time
+
+	lock  sync.Mutex
+	users map[string]*failures
+}
+
+type failures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+func newLockout(maxFailures int, duration time.Duration) *lockout {
+	return &lockout{
+		maxFailures: maxFailures,
+		duration:    duration,
+		now:         time.Now,
+		users:       map[string]*failures{},
+	}
+}
+
+func (l *lockout) enabled() bool {
+	return l.maxFailures > 0 && l.duration > 0
+}
+
+// Locked returns whether the user is locked out and until when
+func (l *lockout) Locked(name string) (time.Time, bool) {
+	if !l.enabled() {
+		return time.Time{}, false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	f, ok := l.users[name]
+	if !ok || f.lockedUntil.IsZero() {
+		return time.Time{}, false
+	}
+	if !l.now().Before(f.lockedUntil) {
+		delete(l.users, name)
+		return time.Time{}, false
+	}
+	return f.lockedUntil, true
+}
+
+// Fail records a failed attempt of the user
+func (l *lockout) Fail(name string) {
+	if !l.enabled() {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	f, ok := l.users[name]
+	if !ok {
+		f = &failures{}
+		l.users[name] = f
+	}
+	f.count++
+	if f.count >= l.maxFailures {
+		f.lockedUntil = l.now().Add(l.duration)
+		lockouts.Inc()
+	}
+}
+
+// Succeed resets the failed attempts of the user
+func (l *lockout) Succeed(name string) {
+	if !l.enabled() {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.users, name)
+}
+
+// Retain forgets the failed attempts of users for which keep returns false,
+// e.g. users removed from the htpasswd file
+func (l *lockout) Retain(keep func(name string) bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for name := range l.users {
+		if !keep(name) {
+			delete(l.users, name)
+		}
+	}
+}
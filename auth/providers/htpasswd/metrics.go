@@ -0,0 +1,30 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var lockouts = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "guard_authn_htpasswd_lockouts_total",
+	Help: "Total number of users locked out of the htpasswd provider after too many failed attempts",
+})
+
+func init() {
+	prometheus.MustRegister(lockouts)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.kubeguard.dev/guard/util/volume"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	DefaultMaxFailures     = 5
+	DefaultLockoutDuration = 15 * time.Minute
+)
+
+type Options struct {
+	File            string
+	GroupsFile      string
+	MaxFailures     int
+	LockoutDuration time.Duration
+}
+
+func NewOptions() Options {
+	return Options{
+		MaxFailures:     DefaultMaxFailures,
+		LockoutDuration: DefaultLockoutDuration,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.File, "htpasswd.file", o.File, "Path to the htpasswd file with bcrypt hashed passwords")
+	fs.StringVar(&o.GroupsFile, "htpasswd.groups-file", o.GroupsFile, "Path to the groups file, each line lists the members of a group as group: user1 user2")
+	fs.IntVar(&o.MaxFailures, "htpasswd.max-failures", o.MaxFailures, "Number of consecutive failed attempts after which a user is locked out, 0 disables the lockout")
+	fs.DurationVar(&o.LockoutDuration, "htpasswd.lockout-duration", o.LockoutDuration, "Duration a user is locked out for")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if o.File == "" {
+		errs = append(errs, errors.New("htpasswd.file must be non-empty"))
+	}
+	if o.MaxFailures < 0 {
+		errs = append(errs, errors.New("htpasswd.max-failures must be non-negative"))
+	}
+	if o.MaxFailures > 0 && o.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("htpasswd.lockout-duration must be positive"))
+	}
+	return errs
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	// create auth secret
+	if _, err = LoadHtpasswdFile(o.File); err != nil {
+		return nil, err
+	}
+	users, err := os.ReadFile(o.File)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{
+		"htpasswd": users,
+	}
+	if o.GroupsFile != "" {
+		if _, err = LoadGroupsFile(o.GroupsFile); err != nil {
+			return nil, err
+		}
+		if data["groups"], err = os.ReadFile(o.GroupsFile); err != nil {
+			return nil, err
+		}
+	}
+	// mount auth secret into deployment
+	authSecret := volume.MountSecret(d, "guard-htpasswd-auth", "/etc/guard/auth/htpasswd", data)
+	extraObjs = append(extraObjs, authSecret)
+
+	// use auth secret in container[0] args
+	container := &d.Spec.Template.Spec.Containers[0]
+	container.Args = append(container.Args, "--htpasswd.file=/etc/guard/auth/htpasswd/htpasswd")
+	if o.GroupsFile != "" {
+		container.Args = append(container.Args, "--htpasswd.groups-file=/etc/guard/auth/htpasswd/groups")
+	}
+	if o.MaxFailures != DefaultMaxFailures {
+		container.Args = append(container.Args, fmt.Sprintf("--htpasswd.max-failures=%d", o.MaxFailures))
+	}
+	if o.LockoutDuration != DefaultLockoutDuration {
+		container.Args = append(container.Args, fmt.Sprintf("--htpasswd.lockout-duration=%v", o.LockoutDuration))
+	}
+	return extraObjs, nil
+}
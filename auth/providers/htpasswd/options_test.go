@@ -0,0 +1,73 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package htpasswd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        Options
+		expectedErr []error
+	}{
+		{
+			"valid",
+			Options{File: "htpasswd", MaxFailures: 5, LockoutDuration: time.Minute},
+			nil,
+		},
+		{
+			"lockout disabled",
+			Options{File: "htpasswd"},
+			nil,
+		},
+		{
+			"empty file",
+			NewOptions(),
+			[]error{errors.New("htpasswd.file must be non-empty")},
+		},
+		{
+			"invalid lockout",
+			Options{File: "htpasswd", MaxFailures: -1},
+			[]error{errors.New("htpasswd.max-failures must be non-negative")},
+		},
+		{
+			"lockout without duration",
+			Options{File: "htpasswd", MaxFailures: 3},
+			[]error{errors.New("htpasswd.lockout-duration must be positive")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// Supported modes to resolve the groups of a user
+const (
+	// GroupResolutionDirect finds the groups listing the user as member
+	GroupResolutionDirect = "direct"
+	// GroupResolutionRecursive also finds the groups listing those groups as
+	// member, level by level up to Options.GroupMaxDepth
+	GroupResolutionRecursive = "recursive"
+	// GroupResolutionInChain lets Active Directory resolve nested groups with
+	// the LDAP_MATCHING_RULE_IN_CHAIN matching rule
+	GroupResolutionInChain = "in-chain"
+	// GroupResolutionMemberOf reads the groups from the memberOf attribute of
+	// the user entry
+	GroupResolutionMemberOf = "member-of"
+
+	// matchingRuleInChain is the OID of LDAP_MATCHING_RULE_IN_CHAIN
+	matchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+	// maxDNsPerFilter limits the number of member DNs combined in one search
+	// of the recursive resolution
+	maxDNsPerFilter = 50
+)
+
+var SupportedGroupResolutions = []string{GroupResolutionDirect, GroupResolutionRecursive, GroupResolutionInChain, GroupResolutionMemberOf}
+
+type searchFunc func(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+
+// search runs req on conn, with the paged results control if a page size is
+// set
+func (s Authenticator) search(conn *ldap.Conn) searchFunc {
+	return func(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+		if s.opts.PageSize > 0 {
+			return conn.SearchWithPaging(req, uint32(s.opts.PageSize))
+		}
+		return conn.Search(req)
+	}
+}
+
+// getGroups returns the names of the groups of the user entry as set by
+// Options.GroupResolution
+func (s Authenticator) getGroups(search searchFunc, user *ldap.Entry) ([]string, error) {
+	switch s.opts.GroupResolution {
+	case GroupResolutionRecursive:
+		return s.getRecursiveGroups(search, user.DN)
+	case GroupResolutionInChain:
+		return s.searchGroups(search, s.opts.newInChainGroupSearchRequest(user.DN))
+	case GroupResolutionMemberOf:
+		return s.getMemberOfGroups(search, user)
+	}
+	return s.searchGroups(search, s.opts.newGroupSearchRequest(user.DN))
+}
+
+func (s Authenticator) searchGroups(search searchFunc, req *ldap.SearchRequest) ([]string, error) {
+	res, err := search(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error searching for user's group with filter %s", req.Filter)
+	}
+	var groups []string
+	for _, en := range res.Entries {
+		name, err := s.groupName(en)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// groupName returns the first value of the group name attribute, or empty if
+// the entry does not have the attribute
+func (s Authenticator) groupName(en *ldap.Entry) (string, error) {
+	// default use `cn` as group name
+	for _, g := range en.Attributes {
+		if g.Name == s.opts.GroupNameAttribute {
+			if len(g.Values) == 0 {
+				return "", errors.Errorf("%s not provided for %s", s.opts.GroupNameAttribute, en.DN)
+			}
+			return g.Values[0], nil
+		}
+	}
+	return "", nil
+}
+
+// getRecursiveGroups searches the groups of the user, then the groups of
+// these groups and so on. Groups already found are not searched again, so
+// cycles end the search. Groups nested deeper than the max depth are ignored.
+func (s Authenticator) getRecursiveGroups(search searchFunc, userDN string) ([]string, error) {
+	var groups []string
+	seen := map[string]bool{}
+	members := []string{userDN}
+	for depth := 1; len(members) > 0; depth++ {
+		if depth > s.opts.GroupMaxDepth {
+			klog.V(3).Infof("groups of %s nested deeper than %d levels are ignored", userDN, s.opts.GroupMaxDepth)
+			break
+		}
+
+		var next []string
+		for start := 0; start < len(members); start += maxDNsPerFilter {
+			end := start + maxDNsPerFilter
+			if end > len(members) {
+				end = len(members)
+			}
+			req := s.opts.newNestedGroupSearchRequest(members[start:end])
+			res, err := search(req)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error searching for user's group with filter %s", req.Filter)
+			}
+			for _, en := range res.Entries {
+				key := strings.ToLower(en.DN)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				name, err := s.groupName(en)
+				if err != nil {
+					return nil, err
+				}
+				if name != "" {
+					groups = append(groups, name)
+				}
+				next = append(next, en.DN)
+			}
+		}
+		members = next
+	}
+	return groups, nil
+}
+
+// getMemberOfGroups returns the groups listed in the memberOf attribute of
+// the user entry, that are below the group search DN. The name is taken from
+// the DN if its first attribute is the group name attribute, otherwise the
+// group entry is read.
+func (s Authenticator) getMemberOfGroups(search searchFunc, user *ldap.Entry) ([]string, error) {
+	baseDN, err := ldap.ParseDN(s.opts.GroupSearchDN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid group search DN %s", s.opts.GroupSearchDN)
+	}
+
+	var groups []string
+	for _, groupDN := range user.GetEqualFoldAttributeValues(s.opts.MemberOfAttribute) {
+		dn, err := ldap.ParseDN(groupDN)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s value of %s", s.opts.MemberOfAttribute, user.DN)
+		}
+		if len(baseDN.RDNs) > 0 && !baseDN.AncestorOfFold(dn) {
+			continue
+		}
+
+		if name, ok := rdnValue(dn, s.opts.GroupNameAttribute); ok {
+			groups = append(groups, name)
+			continue
+		}
+		names, err := s.searchGroups(search, s.opts.newGroupEntryRequest(groupDN))
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, names...)
+	}
+	return groups, nil
+}
+
+// rdnValue returns the value of attr, if it is the only attribute of the
+// first RDN of dn
+func rdnValue(dn *ldap.DN, attr string) (string, bool) {
+	if len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) != 1 {
+		return "", false
+	}
+	a := dn.RDNs[0].Attributes[0]
+	if !strings.EqualFold(a.Type, attr) {
+		return "", false
+	}
+	return a.Value, true
+}
+
+// request to get the groups of the user, including nested groups, with the
+// LDAP_MATCHING_RULE_IN_CHAIN of Active Directory
+func (o *Options) newInChainGroupSearchRequest(userDN string) *ldap.SearchRequest {
+	req := o.newGroupSearchRequest(userDN)
+	req.Filter = fmt.Sprintf("(&%s(%s:%s:=%s))", o.GroupSearchFilter, o.GroupMemberAttribute, matchingRuleInChain, ldap.EscapeFilter(userDN))
+	return req
+}
+
+// request to get the groups having any of the members
+func (o *Options) newNestedGroupSearchRequest(memberDNs []string) *ldap.SearchRequest {
+	req := o.newGroupSearchRequest("")
+	var filter strings.Builder
+	for _, dn := range memberDNs {
+		filter.WriteString(fmt.Sprintf("(%s=%s)", o.GroupMemberAttribute, ldap.EscapeFilter(dn)))
+	}
+	req.Filter = fmt.Sprintf("(&%s(|%s))", o.GroupSearchFilter, filter.String())
+	return req
+}
+
+// request to read the name of a group entry
+func (o *Options) newGroupEntryRequest(groupDN string) *ldap.SearchRequest {
+	return &ldap.SearchRequest{
+		BaseDN:       groupDN,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    1,
+		TimeLimit:    10,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{o.GroupNameAttribute},
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+var memberFilterRegexp = regexp.MustCompile(`member(:1\.2\.840\.113556\.1\.4\.1941:)?=([^)]*)`)
+
+// fakeDirectory answers the group searches from a map of group DN to its
+// member DNs, where every group is named by the value of its first RDN
+type fakeDirectory struct {
+	members  map[string][]string
+	searches int
+}
+
+func (d *fakeDirectory) entry(dn string) *ldap.Entry {
+	_, name, _ := strings.Cut(strings.Split(dn, ",")[0], "=")
+	return ldap.NewEntry(dn, map[string][]string{"cn": {name}})
+}
+
+func (d *fakeDirectory) search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.searches++
+	res := &ldap.SearchResult{}
+	if req.Scope == ldap.ScopeBaseObject {
+		if _, ok := d.members[req.BaseDN]; ok {
+			res.Entries = append(res.Entries, d.entry(req.BaseDN))
+		}
+		return res, nil
+	}
+
+	found := map[string]bool{}
+	for _, m := range memberFilterRegexp.FindAllStringSubmatch(req.Filter, -1) {
+		found[m[2]] = true
+		if m[1] == "" {
+			continue
+		}
+		// in chain, follow the members until no new group is found
+		for changed := true; changed; {
+			changed = false
+			for group, members := range d.members {
+				for _, member := range members {
+					if found[member] && !found[group] {
+						found[group] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	for group, members := range d.members {
+		for _, member := range members {
+			if found[member] {
+				res.Entries = append(res.Entries, d.entry(group))
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+const testUserDN = "uid=nahid,ou=users,o=Company"
+
+func newTestDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		members: map[string][]string{
+			"cn=dev,ou=groups,o=Company":   {testUserDN},
+			"cn=eng,ou=groups,o=Company":   {"cn=dev,ou=groups,o=Company"},
+			"cn=all,ou=groups,o=Company":   {"cn=eng,ou=groups,o=Company"},
+			"cn=admin,ou=groups,o=Company": {"cn=all,ou=groups,o=Company", testUserDN},
+			// cycle
+			"cn=ops,ou=groups,o=Company": {"cn=admin,ou=groups,o=Company"},
+			"cn=sre,ou=groups,o=Company": {"cn=ops,ou=groups,o=Company"},
+			"cn=hr,ou=groups,o=Company":  {"uid=shuvo,ou=users,o=Company"},
+		},
+	}
+}
+
+func newTestGroupAuthenticator(resolution string, maxDepth int) Authenticator {
+	return Authenticator{
+		opts: Options{
+			GroupSearchDN:        "ou=groups,o=Company",
+			GroupSearchFilter:    DefaultGroupSearchFilter,
+			GroupMemberAttribute: DefaultGroupMemberAttribute,
+			GroupNameAttribute:   DefaultGroupNameAttribute,
+			GroupResolution:      resolution,
+			GroupMaxDepth:        maxDepth,
+			MemberOfAttribute:    DefaultMemberOfAttribute,
+		},
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	dir := newTestDirectory()
+	dir.members["cn=dev,ou=groups,o=Company"] = append(dir.members["cn=dev,ou=groups,o=Company"], "cn=sre,ou=groups,o=Company")
+
+	testData := []struct {
+		testName   string
+		resolution string
+		maxDepth   int
+		groups     []string
+	}{
+		{"direct", GroupResolutionDirect, 0, []string{"dev", "admin"}},
+		{"empty defaults to direct", "", 0, []string{"dev", "admin"}},
+		{"recursive", GroupResolutionRecursive, 10, []string{"dev", "eng", "all", "admin", "ops", "sre"}},
+		{"recursive with depth limit", GroupResolutionRecursive, 2, []string{"dev", "eng", "admin", "ops"}},
+		{"in-chain", GroupResolutionInChain, 0, []string{"dev", "eng", "all", "admin", "ops", "sre"}},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			s := newTestGroupAuthenticator(test.resolution, test.maxDepth)
+			groups, err := s.getGroups(dir.search, ldap.NewEntry(testUserDN, nil))
+			if assert.Nil(t, err) {
+				assert.ElementsMatch(t, test.groups, groups)
+			}
+		})
+	}
+}
+
+func TestInChainGroupSearchRequest(t *testing.T) {
+	o := newTestGroupAuthenticator(GroupResolutionInChain, 0).opts
+	req := o.newInChainGroupSearchRequest(`cn=Doe\, John,ou=users,o=Company`)
+	assert.Equal(t, `(&(objectClass=groupOfNames)(member:1.2.840.113556.1.4.1941:=cn=Doe\5c, John,ou=users,o=Company))`, req.Filter)
+}
+
+func TestRecursiveGroupsBatchMembers(t *testing.T) {
+	dir := &fakeDirectory{members: map[string][]string{}}
+	var expected []string
+	for i := 0; i < 2*maxDNsPerFilter+1; i++ {
+		name := fmt.Sprintf("team-%d", i)
+		dir.members[fmt.Sprintf("cn=%s,ou=groups,o=Company", name)] = []string{testUserDN}
+		dir.members[fmt.Sprintf("cn=%s-all,ou=groups,o=Company", name)] = []string{fmt.Sprintf("cn=%s,ou=groups,o=Company", name)}
+		expected = append(expected, name, name+"-all")
+	}
+
+	s := newTestGroupAuthenticator(GroupResolutionRecursive, 10)
+	groups, err := s.getGroups(dir.search, ldap.NewEntry(testUserDN, nil))
+	if assert.Nil(t, err) {
+		assert.ElementsMatch(t, expected, groups)
+	}
+	// one search for the groups of the user, three for each of the next two
+	// levels, the last finding no more groups
+	assert.Equal(t, 7, dir.searches)
+}
+
+func TestMemberOfGroups(t *testing.T) {
+	dir := newTestDirectory()
+	s := newTestGroupAuthenticator(GroupResolutionMemberOf, 0)
+	s.opts.MemberOfAttribute = "isMemberOf"
+
+	user := ldap.NewEntry(testUserDN, map[string][]string{
+		"IsMemberOf": {
+			"cn=dev,ou=groups,o=Company",
+			"CN=Admin,OU=Groups,O=Company",
+			"cn=payroll,ou=finance,o=Company",
+		},
+	})
+	groups, err := s.getGroups(dir.search, user)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"dev", "Admin"}, groups)
+	}
+	assert.Equal(t, 0, dir.searches, "group names are taken from the DN")
+
+	// the group entry is read when the DN is not named by the group name attribute
+	s.opts.GroupNameAttribute = "cn"
+	user = ldap.NewEntry(testUserDN, map[string][]string{
+		"isMemberOf": {"cn=ops,ou=groups,o=Company", "uid=ops,ou=groups,o=Company"},
+	})
+	dir.members["uid=ops,ou=groups,o=Company"] = nil
+	groups, err = s.getGroups(dir.search, user)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"ops", "ops"}, groups)
+	}
+	assert.Equal(t, 1, dir.searches)
+
+	_, err = s.getGroups(dir.search, ldap.NewEntry(testUserDN, map[string][]string{"isMemberOf": {"invalid"}}))
+	assert.NotNil(t, err)
+}
@@ -20,8 +20,8 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/base64"
-	"fmt"
-	"strings"
+	"net"
+	"time"
 
 	"go.kubeguard.dev/guard/auth"
 
@@ -30,6 +30,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/service"
 	"github.com/pkg/errors"
 	authv1 "k8s.io/api/authentication/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 const (
@@ -40,6 +41,16 @@ const (
 	DefaultUserAttribute        = "uid"
 	DefaultGroupMemberAttribute = "member"
 	DefaultGroupNameAttribute   = "cn"
+	DefaultMemberOfAttribute    = "memberOf"
+
+	DefaultGroupMaxDepth = 10
+
+	DefaultPoolSize                = 10
+	DefaultPoolIdleTimeout         = 5 * time.Minute
+	DefaultPoolHealthCheckInterval = 30 * time.Second
+
+	DefaultServerBackoff    = 30 * time.Second
+	DefaultServerMaxBackoff = 5 * time.Minute
 )
 
 func init() {
@@ -48,63 +59,72 @@ func init() {
 
 type Authenticator struct {
 	opts Options
+	// servers selects the LDAP server of new connections and tracks their
+	// health
+	servers *serverList
+	// pool holds connections bound with the service account, if nil every
+	// token review dials a new connection
+	pool *pool
 }
 
 func New(opts Options) auth.Interface {
 	return &Authenticator{
-		opts: opts,
+		opts:    opts,
+		servers: newServerList(opts),
+	}
+}
+
+// NewPooled returns an Authenticator that reuses connections bound with the
+// service account across token reviews, see Options.PoolSize, and keeps the
+// health state of the LDAP servers. It must be closed when no longer used.
+func NewPooled(opts Options) *Authenticator {
+	s := &Authenticator{
+		opts:    opts,
+		servers: newServerList(opts),
 	}
+	if opts.PoolSize > 0 {
+		s.pool = newPool(opts.PoolSize, opts.PoolIdleTimeout, opts.PoolHealthCheckInterval, s.connect, s.healthCheck)
+	}
+	return s
 }
 
 func (g Authenticator) UID() string {
 	return OrgType
 }
 
-func (s Authenticator) Check(_ context.Context, token string) (*authv1.UserInfo, error) {
-	var (
-		err  error
-		conn *ldap.Conn
-	)
-
-	tlsConfig := &tls.Config{
-		ServerName:         s.opts.ServerAddress,
-		InsecureSkipVerify: s.opts.SkipTLSVerification,
-	}
-
-	if s.opts.CaCertFile != "" {
-		tlsConfig.RootCAs = s.opts.CaCertPool
+func (s Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	if s.pool == nil {
+		conn, err := s.connect()
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return s.check(conn, token)
 	}
 
-	if s.opts.IsSecureLDAP {
-		conn, err = ldap.DialTLS("tcp", fmt.Sprintf("%s:%s", s.opts.ServerAddress, s.opts.ServerPort), tlsConfig)
-	} else {
-		conn, err = ldap.Dial("tcp", fmt.Sprintf("%s:%s", s.opts.ServerAddress, s.opts.ServerPort))
-	}
+	conn, err := s.pool.Get(ctx)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to create ldap connector for %s:%s", s.opts.ServerAddress, s.opts.ServerPort)
-	}
-	defer conn.Close()
-
-	if s.opts.StartTLS {
-		err = conn.StartTLS(tlsConfig)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to setup TLS connection")
-		}
+		return nil, err
 	}
+	resp, err := s.check(conn, token)
+	s.pool.Put(conn, isNetworkError(err))
+	return resp, err
+}
 
-	if s.opts.BindDN != "" && s.opts.BindPassword != "" {
-		err = conn.Bind(s.opts.BindDN, s.opts.BindPassword)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+// Close closes the pooled connections
+func (s Authenticator) Close() {
+	if s.pool != nil {
+		s.pool.Close()
 	}
+}
 
+func (s Authenticator) check(conn *ldap.Conn, token string) (*authv1.UserInfo, error) {
 	username, err := s.authenticateUser(conn, token)
 	if err != nil {
 		return nil, errors.Wrap(err, "authentication failed")
 	}
 
-	if s.opts.AuthenticationChoice == AuthChoiceSimple {
+	if s.opts.AuthenticationChoice == AuthChoiceSimple && s.pool == nil {
 		// rebind, as in simple authentication we bind using username, password
 		if s.opts.BindDN != "" && s.opts.BindPassword != "" {
 			err = conn.Bind(s.opts.BindDN, s.opts.BindPassword)
@@ -114,30 +134,15 @@ func (s Authenticator) Check(_ context.Context, token string) (*authv1.UserInfo,
 		}
 	}
 
-	userDN, err := s.getUserDN(conn, username)
+	user, err := s.getUser(conn, username)
 	if err != nil {
 		return nil, errors.Wrap(err, "error when getting user DN")
 	}
 
 	// user group list
-	req := s.opts.newGroupSearchRequest(userDN)
-	res, err := conn.Search(req)
+	groups, err := s.getGroups(s.search(conn), user)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error searching for user's group for %s", userDN)
-	}
-
-	var groups []string
-	// default use `cn` as group name
-	for _, en := range res.Entries {
-		for _, g := range en.Attributes {
-			if g.Name == s.opts.GroupNameAttribute {
-				if len(g.Values) == 0 {
-					return nil, errors.Errorf("%s not provided for %s", s.opts.GroupNameAttribute, en.DN)
-				} else {
-					groups = append(groups, g.Values[0])
-				}
-			}
-		}
+		return nil, err
 	}
 
 	resp := &authv1.UserInfo{}
@@ -146,10 +151,118 @@ func (s Authenticator) Check(_ context.Context, token string) (*authv1.UserInfo,
 	return resp, nil
 }
 
+// dial opens a connection to the first LDAP server that responds, see
+// serverList for the order the servers are tried in
+func (s Authenticator) dial() (*ldap.Conn, error) {
+	servers := s.servers
+	if servers == nil {
+		servers = newServerList(s.opts)
+	}
+	candidates, err := servers.Candidates(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, ep := range candidates {
+		conn, err := s.dialServer(ep)
+		if err != nil {
+			servers.Fail(ep, err)
+			errs = append(errs, err)
+			continue
+		}
+		servers.Succeed(ep)
+		return conn, nil
+	}
+	return nil, utilerrors.NewAggregate(errs)
+}
+
+// dialServer opens a connection to the LDAP server, upgraded with StartTLS if
+// set
+func (s Authenticator) dialServer(ep *endpoint) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         ep.host,
+		InsecureSkipVerify: s.opts.SkipTLSVerification,
+	}
+
+	if s.opts.CaCertFile != "" {
+		tlsConfig.RootCAs = s.opts.CaCertPool
+	}
+
+	conn, err := ldap.DialURL(ep.url, ldap.DialWithTLSConfig(tlsConfig), ldap.DialWithDialer(&net.Dialer{Timeout: serverDialTimeout}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create ldap connector for %s", ep.url)
+	}
+
+	if s.opts.StartTLS && !ep.tls {
+		err = conn.StartTLS(tlsConfig)
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "unable to setup TLS connection with %s", ep.url)
+		}
+	}
+	return conn, nil
+}
+
+// connect dials the LDAP server and binds with the service account, if set
+func (s Authenticator) connect() (*ldap.Conn, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.opts.BindDN != "" && s.opts.BindPassword != "" {
+		err = conn.Bind(s.opts.BindDN, s.opts.BindPassword)
+		if err != nil {
+			conn.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return conn, nil
+}
+
+// healthCheck reads the root DSE to check an idle pooled connection still works
+func (s Authenticator) healthCheck(conn *ldap.Conn) error {
+	_, err := conn.Search(&ldap.SearchRequest{
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    1,
+		TimeLimit:    5,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{"1.1"},
+	})
+	return err
+}
+
+// bindUser verifies the password of the user. Pooled connections must stay
+// bound with the service account, so the user binds on a separate connection.
+func (s Authenticator) bindUser(conn *ldap.Conn, userDN, password string) error {
+	if s.pool == nil {
+		return conn.Bind(userDN, password)
+	}
+	userConn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer userConn.Close()
+	return userConn.Bind(userDN, password)
+}
+
+// Ready checks the LDAP server can be dialed and the service account can bind
+func (s Authenticator) Ready(_ context.Context) error {
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
 func (s Authenticator) authenticateUser(conn *ldap.Conn, token string) (string, error) {
 	if s.opts.AuthenticationChoice == AuthChoiceSimple {
 		// simple authentication
-		username, password, ok := parseEncodedToken(token)
+		username, password, ok := auth.ParseBasicToken(token)
 		if !ok {
 			return "", errors.New("Invalid basic auth token")
 		}
@@ -160,7 +273,7 @@ func (s Authenticator) authenticateUser(conn *ldap.Conn, token string) (string,
 		}
 
 		// authenticate user
-		err = conn.Bind(userDN, password)
+		err = s.bindUser(conn, userDN, password)
 		if err != nil {
 			return "", errors.WithStack(err)
 		}
@@ -192,35 +305,26 @@ func (s Authenticator) authenticateUser(conn *ldap.Conn, token string) (string,
 }
 
 func (s Authenticator) getUserDN(conn *ldap.Conn, username string) (string, error) {
+	user, err := s.getUser(conn, username)
+	if err != nil {
+		return "", err
+	}
+	return user.DN, nil
+}
+
+func (s Authenticator) getUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
 	req := s.opts.newUserSearchRequest(username)
 
-	res, err := conn.Search(req)
+	res, err := s.search(conn)(req)
 	if err != nil {
-		return "", errors.Wrapf(err, "error searching for user %s", username)
+		return nil, errors.Wrapf(err, "error searching for user %s", username)
 	}
 
 	if len(res.Entries) == 0 {
-		return "", errors.Errorf("No result for the user search filter '%s'", req.Filter)
+		return nil, errors.Errorf("No result for the user search filter '%s'", req.Filter)
 	} else if len(res.Entries) > 1 {
-		return "", errors.Errorf("Multiple entries found for the user search filter '%s'", req.Filter)
+		return nil, errors.Errorf("Multiple entries found for the user search filter '%s'", req.Filter)
 	}
 
-	userDN := res.Entries[0].DN
-
-	return userDN, nil
-}
-
-// parseEncodedToken parses base64 encode token
-// "dXNlcjE6MTIzNA==" returns ("user1", "1234", true).
-func parseEncodedToken(token string) (username, password string, ok bool) {
-	c, err := base64.StdEncoding.DecodeString(token)
-	if err != nil {
-		return
-	}
-	cs := string(c)
-	s := strings.IndexByte(cs, ':')
-	if s < 0 {
-		return
-	}
-	return cs[:s], cs[s+1:], true
+	return res.Entries[0], nil
 }
@@ -29,6 +29,8 @@ import (
 	"time"
 
 	ldapserver "github.com/nmcclain/ldap"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"gomodules.xyz/blobfs"
 	"gomodules.xyz/cert"
@@ -259,6 +261,14 @@ func runTest(t *testing.T, secureConn bool, s Authenticator, serverType string)
 		s.opts.CaCertPool = caCertPool
 	}
 
+	t.Run(serverType+": ready", func(t *testing.T) {
+		assert.Nil(t, s.Ready(context.Background()))
+
+		wrongBind := s
+		wrongBind.opts.BindPassword = "wrong"
+		assert.NotNil(t, wrongBind.Ready(context.Background()))
+	})
+
 	dataset := []struct {
 		testName      string
 		token         string
@@ -353,17 +363,62 @@ func runTest(t *testing.T, secureConn bool, s Authenticator, serverType string)
 			})
 		}
 	})
+	t.Run(serverType+": failover", func(t *testing.T) {
+		opts := s.opts
+		scheme := "ldap"
+		if secureConn {
+			scheme = "ldaps"
+		}
+		// nothing listens on the first server
+		down := fmt.Sprintf("%s://%s:1", scheme, serverAddr)
+		opts.ServerURLs = []string{down, fmt.Sprintf("%s://%s:%s", scheme, opts.ServerAddress, opts.ServerPort)}
+		opts.ServerBackoff = time.Minute
+		failover := New(opts)
+
+		resp, err := failover.Check(context.Background(), base64.StdEncoding.EncodeToString([]byte("nahid:secret")))
+		if assert.Nil(t, err) {
+			assert.Equal(t, "nahid", resp.Username)
+		}
+		assert.Equal(t, float64(1), counterValue(t, serverFailures.WithLabelValues(down)))
+
+		// the server that is down is not tried again during its backoff
+		_, err = failover.Check(context.Background(), base64.StdEncoding.EncodeToString([]byte("nahid:secret")))
+		assert.Nil(t, err)
+		assert.Equal(t, float64(1), counterValue(t, serverFailures.WithLabelValues(down)))
+	})
+	t.Run(serverType+": pooled", func(t *testing.T) {
+		opts := s.opts
+		opts.PoolSize = 1
+		opts.PoolIdleTimeout = time.Minute
+		opts.PoolHealthCheckInterval = time.Minute
+		pooled := NewPooled(opts)
+		defer pooled.Close()
+		dials := counterValue(t, poolDials.WithLabelValues(dialResultSuccess))
+
+		for _, tc := range dataset {
+			if tc.userAttribute != DefaultUserAttribute {
+				continue
+			}
+			resp, err := pooled.Check(context.Background(), base64.StdEncoding.EncodeToString([]byte(tc.token)))
+			if tc.authenticated {
+				if assert.Nil(t, err, tc.testName) {
+					assert.Equal(t, tc.username, resp.Username)
+					assert.Equal(t, len(tc.groups), len(resp.Groups))
+				}
+			} else {
+				assert.NotNil(t, err, tc.testName)
+			}
+		}
+		// failed user binds do not break the service account binding of the
+		// pooled connection
+		assert.Equal(t, float64(1), counterValue(t, poolDials.WithLabelValues(dialResultSuccess))-dials)
+	})
 }
 
-func TestParseEncodedToken(t *testing.T) {
-	user, pass, ok := parseEncodedToken(base64.StdEncoding.EncodeToString([]byte("user1:12345")))
-	if !ok {
-		t.Error("Expected: parsing successful, got parsing unsuccessful")
-	}
-	if user != "user1" {
-		t.Error("Expected: user: user1, got user:", user)
-	}
-	if pass != "12345" {
-		t.Error("Expected: password: 12345, got password:", pass)
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	out := &dto.Metric{}
+	if err := c.Write(out); err != nil {
+		t.Fatal(err)
 	}
+	return out.GetCounter().GetValue()
 }
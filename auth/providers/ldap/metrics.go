@@ -0,0 +1,65 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	connStateIdle  = "idle"
+	connStateInUse = "in_use"
+
+	dialResultSuccess = "success"
+	dialResultError   = "error"
+
+	closeReasonIdleTimeout = "idle_timeout"
+	closeReasonHealthCheck = "health_check"
+	closeReasonError       = "error"
+)
+
+var (
+	poolConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guard_authn_ldap_pool_connections",
+		Help: "Number of open connections of the ldap connection pool by state",
+	}, []string{"state"})
+	poolWaitDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "guard_authn_ldap_pool_wait_duration_seconds",
+		Help:    "Time token reviews waited for a free connection of the ldap connection pool",
+		Buckets: []float64{.0001, .001, .01, .05, .1, .5, 1, 5},
+	})
+	poolDials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_ldap_pool_dials_total",
+		Help: "Total number of connections dialed and bound by the ldap connection pool by result",
+	}, []string{"result"})
+	poolClosed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_ldap_pool_closed_total",
+		Help: "Total number of connections closed by the ldap connection pool by reason",
+	}, []string{"reason"})
+	serverUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guard_authn_ldap_server_up",
+		Help: "Whether the last connection to the ldap server succeeded, 1, or failed, 0",
+	}, []string{"server"})
+	serverFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authn_ldap_server_failures_total",
+		Help: "Total number of failed connections to the ldap server",
+	}, []string{"server"})
+)
+
+func init() {
+	prometheus.MustRegister(poolConnections, poolWaitDuration, poolDials, poolClosed, serverUp, serverFailures)
+}
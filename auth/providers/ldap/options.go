@@ -20,6 +20,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/jcmturner/gokrb5/v8/keytab"
@@ -37,6 +40,27 @@ type Options struct {
 
 	ServerPort string
 
+	// urls of the LDAP servers, ldap://host:port or ldaps://host:port, used
+	// instead of ServerAddress and ServerPort
+	ServerURLs []string
+
+	// domain to discover the LDAP servers from its _ldap._tcp SRV records, or
+	// _ldaps._tcp for secure LDAP
+	SRVDomain string
+
+	// how the LDAP server of a new connection is selected, failover or
+	// round-robin
+	// default : failover
+	ServerSelection string
+
+	// a server that failed to connect is not used for this duration, doubled
+	// with every consecutive failure up to ServerMaxBackoff
+	// default : 30s
+	ServerBackoff time.Duration
+
+	// default : 5m
+	ServerMaxBackoff time.Duration
+
 	// The connector uses this DN in credentials to search for users and groups.
 	// Not required if the LDAP server provides access for anonymous auth.
 	BindDN string
@@ -71,6 +95,25 @@ type Options struct {
 	// default: cn
 	GroupNameAttribute string
 
+	// how the groups of the user are resolved, one of direct, recursive,
+	// in-chain or member-of
+	// default: direct
+	GroupResolution string
+
+	// maximum nesting of groups followed by the recursive group resolution
+	// default: 10
+	GroupMaxDepth int
+
+	// user attribute listing the groups of the user, used by the member-of
+	// group resolution
+	// default: memberOf
+	MemberOfAttribute string
+
+	// page size of the paged results control used in searches, 0 disables
+	// paging
+	// default: 0
+	PageSize int
+
 	SkipTLSVerification bool
 
 	// for LDAP over SSL
@@ -103,12 +146,37 @@ type Options struct {
 	// should be set to an empty string ""
 	// default : ""
 	ServiceAccountName string
+
+	// maximum number of connections bound with the service account that are
+	// kept open and reused across token reviews, 0 disables pooling
+	// default : 10
+	PoolSize int
+
+	// idle pooled connections are closed after this duration
+	// default : 5m
+	PoolIdleTimeout time.Duration
+
+	// idle pooled connections are checked before reuse after this duration
+	// default : 30s
+	PoolHealthCheckInterval time.Duration
 }
 
 func NewOptions() Options {
 	return Options{
 		BindDN:       os.Getenv("LDAP_BIND_DN"),
 		BindPassword: os.Getenv("LDAP_BIND_PASSWORD"),
+
+		ServerSelection:  ServerSelectionFailover,
+		ServerBackoff:    DefaultServerBackoff,
+		ServerMaxBackoff: DefaultServerMaxBackoff,
+
+		GroupResolution:   GroupResolutionDirect,
+		GroupMaxDepth:     DefaultGroupMaxDepth,
+		MemberOfAttribute: DefaultMemberOfAttribute,
+
+		PoolSize:                DefaultPoolSize,
+		PoolIdleTimeout:         DefaultPoolIdleTimeout,
+		PoolHealthCheckInterval: DefaultPoolHealthCheckInterval,
 	}
 }
 
@@ -147,6 +215,11 @@ func (o *Options) Configure() error {
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.ServerAddress, "ldap.server-address", o.ServerAddress, "Host or IP of the LDAP server")
 	fs.StringVar(&o.ServerPort, "ldap.server-port", "389", "LDAP server port")
+	fs.StringSliceVar(&o.ServerURLs, "ldap.server-urls", o.ServerURLs, "Urls of the LDAP servers, ldap://host:port or ldaps://host:port, used instead of ldap.server-address and ldap.server-port")
+	fs.StringVar(&o.SRVDomain, "ldap.srv-domain", o.SRVDomain, "Domain to discover the LDAP servers from its _ldap._tcp SRV records, or _ldaps._tcp for secure LDAP")
+	fs.StringVar(&o.ServerSelection, "ldap.server-selection", o.ServerSelection, fmt.Sprintf("How the LDAP server of a new connection is selected, one of %s", strings.Join(SupportedServerSelections, ", ")))
+	fs.DurationVar(&o.ServerBackoff, "ldap.server-backoff", o.ServerBackoff, "A server that failed to connect is not used for this duration, doubled with every consecutive failure")
+	fs.DurationVar(&o.ServerMaxBackoff, "ldap.server-max-backoff", o.ServerMaxBackoff, "Maximum duration a server that failed to connect is not used")
 	fs.StringVar(&o.BindDN, "ldap.bind-dn", o.BindDN, "The connector uses this DN in credentials to search for users and groups. Not required if the LDAP server provides access for anonymous auth.")
 	fs.StringVar(&o.BindPassword, "ldap.bind-password", o.BindPassword, "The connector uses this password in credentials to search for users and groups. Not required if the LDAP server provides access for anonymous auth.")
 	fs.StringVar(&o.UserSearchDN, "ldap.user-search-dn", o.UserSearchDN, "BaseDN to start the search user")
@@ -156,6 +229,10 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.GroupSearchFilter, "ldap.group-search-filter", DefaultGroupSearchFilter, "Filter to apply when searching the groups that user is member of")
 	fs.StringVar(&o.GroupMemberAttribute, "ldap.group-member-attribute", DefaultGroupMemberAttribute, "Ldap group member attribute")
 	fs.StringVar(&o.GroupNameAttribute, "ldap.group-name-attribute", DefaultGroupNameAttribute, "Ldap group name attribute")
+	fs.StringVar(&o.GroupResolution, "ldap.group-resolution", o.GroupResolution, fmt.Sprintf("How the groups of the user are resolved, one of %s", strings.Join(SupportedGroupResolutions, ", ")))
+	fs.IntVar(&o.GroupMaxDepth, "ldap.group-max-depth", o.GroupMaxDepth, "Maximum nesting of groups followed by the recursive group resolution")
+	fs.StringVar(&o.MemberOfAttribute, "ldap.member-of-attribute", o.MemberOfAttribute, "User attribute listing the groups of the user, used by the member-of group resolution")
+	fs.IntVar(&o.PageSize, "ldap.page-size", o.PageSize, "Page size of the paged results control used in searches, 0 disables paging")
 	fs.BoolVar(&o.SkipTLSVerification, "ldap.skip-tls-verification", false, "Skip LDAP server TLS verification, default : false")
 	fs.BoolVar(&o.IsSecureLDAP, "ldap.is-secure-ldap", false, "Secure LDAP (LDAPS)")
 	fs.BoolVar(&o.StartTLS, "ldap.start-tls", false, "Start tls connection")
@@ -163,12 +240,15 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.Var(&o.AuthenticationChoice, "ldap.auth-choice", "LDAP user authentication mechanisms Simple/Kerberos(via GSSAPI)")
 	fs.StringVar(&o.KeytabFile, "ldap.keytab-file", "", "path to the keytab file, it's contain LDAP service principal keys")
 	fs.StringVar(&o.ServiceAccountName, "ldap.service-account", "", "service account name")
+	fs.IntVar(&o.PoolSize, "ldap.pool-size", o.PoolSize, "Maximum number of connections bound with the bind DN that are reused across token reviews, 0 disables pooling")
+	fs.DurationVar(&o.PoolIdleTimeout, "ldap.pool-idle-timeout", o.PoolIdleTimeout, "Idle pooled connections are closed after this duration")
+	fs.DurationVar(&o.PoolHealthCheckInterval, "ldap.pool-health-check-interval", o.PoolHealthCheckInterval, "Idle pooled connections are checked before reuse after this duration")
 }
 
 // request to search user
 func (o *Options) newUserSearchRequest(username string) *ldap.SearchRequest {
 	userFilter := fmt.Sprintf("(&%s(%s=%s))", o.UserSearchFilter, o.UserAttribute, username)
-	return &ldap.SearchRequest{
+	req := &ldap.SearchRequest{
 		BaseDN:       o.UserSearchDN,
 		Scope:        ldap.ScopeWholeSubtree,
 		DerefAliases: ldap.NeverDerefAliases,
@@ -177,6 +257,12 @@ func (o *Options) newUserSearchRequest(username string) *ldap.SearchRequest {
 		TypesOnly:    false,
 		Filter:       userFilter, // filter default format : (&(objectClass=person)(uid=%s))
 	}
+	if o.GroupResolution == GroupResolutionMemberOf {
+		// memberOf is an operational attribute in some servers, so it is not
+		// returned unless requested
+		req.Attributes = []string{o.MemberOfAttribute}
+	}
+	return req
 }
 
 // request to get user group list
@@ -196,11 +282,32 @@ func (o *Options) newGroupSearchRequest(userDN string) *ldap.SearchRequest {
 
 func (o *Options) Validate() []error {
 	var errs []error
-	if o.ServerAddress == "" {
-		errs = append(errs, errors.New("ldap.server-address must be non-empty"))
+	switch {
+	case len(o.ServerURLs) > 0 && o.SRVDomain != "":
+		errs = append(errs, errors.New("ldap.server-urls and ldap.srv-domain can not be set at the same time"))
+	case len(o.ServerURLs) > 0:
+		for _, u := range o.ServerURLs {
+			if _, err := parseServerURL(u); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case o.SRVDomain != "":
+	default:
+		if o.ServerAddress == "" {
+			errs = append(errs, errors.New("ldap.server-address, ldap.server-urls or ldap.srv-domain must be non-empty"))
+		}
+		if o.ServerPort == "" {
+			errs = append(errs, errors.New("ldap.server-port must be non-empty"))
+		}
+	}
+	if o.ServerSelection != "" && !slices.Contains(SupportedServerSelections, o.ServerSelection) {
+		errs = append(errs, errors.Errorf("ldap.server-selection must be one of %s", strings.Join(SupportedServerSelections, ", ")))
 	}
-	if o.ServerPort == "" {
-		errs = append(errs, errors.New("ldap.server-port must be non-empty"))
+	if o.ServerBackoff < 0 {
+		errs = append(errs, errors.New("ldap.server-backoff must be non-negative"))
+	}
+	if o.ServerMaxBackoff < 0 {
+		errs = append(errs, errors.New("ldap.server-max-backoff must be non-negative"))
 	}
 	if o.UserSearchDN == "" {
 		errs = append(errs, errors.New("ldap.user-search-dn must be non-empty"))
@@ -217,12 +324,33 @@ func (o *Options) Validate() []error {
 	if o.GroupNameAttribute == "" {
 		errs = append(errs, errors.New("ldap.group-name-attribute must be non-empty"))
 	}
+	if o.GroupResolution != "" && !slices.Contains(SupportedGroupResolutions, o.GroupResolution) {
+		errs = append(errs, errors.Errorf("ldap.group-resolution must be one of %s", strings.Join(SupportedGroupResolutions, ", ")))
+	}
+	if o.GroupResolution == GroupResolutionRecursive && o.GroupMaxDepth <= 0 {
+		errs = append(errs, errors.New("ldap.group-max-depth must be positive"))
+	}
+	if o.GroupResolution == GroupResolutionMemberOf && o.MemberOfAttribute == "" {
+		errs = append(errs, errors.New("ldap.member-of-attribute must be non-empty"))
+	}
+	if o.PageSize < 0 {
+		errs = append(errs, errors.New("ldap.page-size must be non-negative"))
+	}
 	if o.IsSecureLDAP && o.StartTLS {
 		errs = append(errs, errors.New("ldap.is-secure-ldap and ldap.start-tls both can not be true at the same time"))
 	}
 	if o.AuthenticationChoice == AuthChoiceKerberos && o.KeytabFile == "" {
 		errs = append(errs, errors.New("for kerberos ldap.keytab-file must be non-empty"))
 	}
+	if o.PoolSize < 0 {
+		errs = append(errs, errors.New("ldap.pool-size must be non-negative"))
+	}
+	if o.PoolIdleTimeout < 0 {
+		errs = append(errs, errors.New("ldap.pool-idle-timeout must be non-negative"))
+	}
+	if o.PoolHealthCheckInterval < 0 {
+		errs = append(errs, errors.New("ldap.pool-health-check-interval must be non-negative"))
+	}
 	return errs
 }
 
@@ -309,6 +437,21 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 	if o.ServerPort != "" {
 		args = append(args, fmt.Sprintf("--ldap.server-port=%s", o.ServerPort))
 	}
+	if len(o.ServerURLs) > 0 {
+		args = append(args, fmt.Sprintf("--ldap.server-urls=%s", strings.Join(o.ServerURLs, ",")))
+	}
+	if o.SRVDomain != "" {
+		args = append(args, fmt.Sprintf("--ldap.srv-domain=%s", o.SRVDomain))
+	}
+	if o.ServerSelection != "" && o.ServerSelection != ServerSelectionFailover {
+		args = append(args, fmt.Sprintf("--ldap.server-selection=%s", o.ServerSelection))
+	}
+	if o.ServerBackoff != DefaultServerBackoff {
+		args = append(args, fmt.Sprintf("--ldap.server-backoff=%v", o.ServerBackoff))
+	}
+	if o.ServerMaxBackoff != DefaultServerMaxBackoff {
+		args = append(args, fmt.Sprintf("--ldap.server-max-backoff=%v", o.ServerMaxBackoff))
+	}
 	if o.UserSearchDN != "" {
 		args = append(args, fmt.Sprintf("--ldap.user-search-dn=%s", o.UserSearchDN))
 	}
@@ -330,6 +473,18 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 	if o.GroupNameAttribute != "" {
 		args = append(args, fmt.Sprintf("--ldap.group-name-attribute=%s", o.GroupNameAttribute))
 	}
+	if o.GroupResolution != "" && o.GroupResolution != GroupResolutionDirect {
+		args = append(args, fmt.Sprintf("--ldap.group-resolution=%s", o.GroupResolution))
+	}
+	if o.GroupMaxDepth != DefaultGroupMaxDepth {
+		args = append(args, fmt.Sprintf("--ldap.group-max-depth=%d", o.GroupMaxDepth))
+	}
+	if o.MemberOfAttribute != DefaultMemberOfAttribute {
+		args = append(args, fmt.Sprintf("--ldap.member-of-attribute=%s", o.MemberOfAttribute))
+	}
+	if o.PageSize > 0 {
+		args = append(args, fmt.Sprintf("--ldap.page-size=%d", o.PageSize))
+	}
 	if o.SkipTLSVerification {
 		args = append(args, "--ldap.skip-tls-verification")
 	}
@@ -349,6 +504,15 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 		args = append(args, "--ldap.keytab-file=/etc/guard/auth/ldap/krb5.keytab")
 	}
 	args = append(args, fmt.Sprintf("--ldap.auth-choice=%v", o.AuthenticationChoice))
+	if o.PoolSize != DefaultPoolSize {
+		args = append(args, fmt.Sprintf("--ldap.pool-size=%d", o.PoolSize))
+	}
+	if o.PoolIdleTimeout != DefaultPoolIdleTimeout {
+		args = append(args, fmt.Sprintf("--ldap.pool-idle-timeout=%v", o.PoolIdleTimeout))
+	}
+	if o.PoolHealthCheckInterval != DefaultPoolHealthCheckInterval {
+		args = append(args, fmt.Sprintf("--ldap.pool-health-check-interval=%v", o.PoolHealthCheckInterval))
+	}
 
 	container.Args = args
 	d.Spec.Template.Spec.Containers[0] = container
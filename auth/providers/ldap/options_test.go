@@ -18,6 +18,7 @@ package ldap
 
 import (
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -48,7 +49,7 @@ var validationErrorData = []struct {
 			o.ServerAddress = empty
 			return o
 		},
-		errors.New("ldap.server-address must be non-empty"),
+		errors.New("ldap.server-address, ldap.server-urls or ldap.srv-domain must be non-empty"),
 	},
 	{
 		"ldap.server-port is empty",
@@ -58,6 +59,30 @@ var validationErrorData = []struct {
 		},
 		errors.New("ldap.server-port must be non-empty"),
 	},
+	{
+		"ldap.server-selection is unsupported",
+		func(o Options) Options {
+			o.ServerSelection = "random"
+			return o
+		},
+		errors.New("ldap.server-selection must be one of failover, round-robin"),
+	},
+	{
+		"ldap.server-backoff is negative",
+		func(o Options) Options {
+			o.ServerBackoff = -time.Second
+			return o
+		},
+		errors.New("ldap.server-backoff must be non-negative"),
+	},
+	{
+		"ldap.server-max-backoff is negative",
+		func(o Options) Options {
+			o.ServerMaxBackoff = -time.Second
+			return o
+		},
+		errors.New("ldap.server-max-backoff must be non-negative"),
+	},
 	{
 		"ldap.user-search-dn is empty",
 		func(o Options) Options {
@@ -98,6 +123,22 @@ var validationErrorData = []struct {
 		},
 		errors.New("ldap.group-name-attribute must be non-empty"),
 	},
+	{
+		"ldap.group-resolution is unsupported",
+		func(o Options) Options {
+			o.GroupResolution = "nested"
+			return o
+		},
+		errors.New("ldap.group-resolution must be one of direct, recursive, in-chain, member-of"),
+	},
+	{
+		"ldap.page-size is negative",
+		func(o Options) Options {
+			o.PageSize = -1
+			return o
+		},
+		errors.New("ldap.page-size must be non-negative"),
+	},
 	{
 		"ldap.is-secure-ldap and ldap.start-tls both are true",
 		func(o Options) Options {
@@ -116,6 +157,30 @@ var validationErrorData = []struct {
 		},
 		errors.New("for kerberos ldap.keytab-file must be non-empty"),
 	},
+	{
+		"ldap.pool-size is negative",
+		func(o Options) Options {
+			o.PoolSize = -1
+			return o
+		},
+		errors.New("ldap.pool-size must be non-negative"),
+	},
+	{
+		"ldap.pool-idle-timeout is negative",
+		func(o Options) Options {
+			o.PoolIdleTimeout = -time.Second
+			return o
+		},
+		errors.New("ldap.pool-idle-timeout must be non-negative"),
+	},
+	{
+		"ldap.pool-health-check-interval is negative",
+		func(o Options) Options {
+			o.PoolHealthCheckInterval = -time.Second
+			return o
+		},
+		errors.New("ldap.pool-health-check-interval must be non-negative"),
+	},
 }
 
 func getNonEmptyOptions() Options {
@@ -141,6 +206,15 @@ func getEmptyOptions() Options {
 		IsSecureLDAP:         true,
 		StartTLS:             true,
 		AuthenticationChoice: AuthChoiceKerberos,
+		ServerSelection:      "random",
+		ServerBackoff:        -time.Second,
+		ServerMaxBackoff:     -time.Second,
+		GroupResolution:      "nested",
+		PageSize:             -1,
+
+		PoolSize:                -1,
+		PoolIdleTimeout:         -time.Second,
+		PoolHealthCheckInterval: -time.Second,
 	}
 }
 
@@ -177,6 +251,57 @@ func TestOptionsValidate(t *testing.T) {
 			getNonEmptyOptions(),
 			nil,
 		},
+		{
+			"ldap.server-urls instead of ldap.server-address",
+			func() Options {
+				o := getNonEmptyOptions()
+				o.ServerAddress = empty
+				o.ServerPort = empty
+				o.ServerURLs = []string{"ldap://dc1.example.com", "ldaps://dc2.example.com:3269"}
+				return o
+			}(),
+			nil,
+		},
+		{
+			"ldap.server-urls is invalid",
+			func() Options {
+				o := getNonEmptyOptions()
+				o.ServerURLs = []string{"http://dc1.example.com", "ldap://:389"}
+				return o
+			}(),
+			[]error{
+				errors.New("ldap server url http://dc1.example.com must use the ldap or ldaps scheme"),
+				errors.New("ldap server url ldap://:389 has no host"),
+			},
+		},
+		{
+			"ldap.server-urls and ldap.srv-domain are both set",
+			func() Options {
+				o := getNonEmptyOptions()
+				o.ServerURLs = []string{"ldap://dc1.example.com"}
+				o.SRVDomain = "example.com"
+				return o
+			}(),
+			[]error{errors.New("ldap.server-urls and ldap.srv-domain can not be set at the same time")},
+		},
+		{
+			"ldap.group-max-depth is not positive for recursive group resolution",
+			func() Options {
+				o := getNonEmptyOptions()
+				o.GroupResolution = GroupResolutionRecursive
+				return o
+			}(),
+			[]error{errors.New("ldap.group-max-depth must be positive")},
+		},
+		{
+			"ldap.member-of-attribute is empty for member-of group resolution",
+			func() Options {
+				o := getNonEmptyOptions()
+				o.GroupResolution = GroupResolutionMemberOf
+				return o
+			}(),
+			[]error{errors.New("ldap.member-of-attribute must be non-empty")},
+		},
 	}
 
 	testData = append(testData, getTestDataForIndivitualError()...)
@@ -0,0 +1,168 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+// pool holds connections bound with the service account, so token reviews
+// do not dial and bind the LDAP server every time. At most size connections
+// are open at once, further reviews wait for a connection to be released.
+type pool struct {
+	dial  func() (*ldap.Conn, error)
+	check func(*ldap.Conn) error
+
+	idleTimeout         time.Duration
+	healthCheckInterval time.Duration
+	now                 func() time.Time
+
+	// sem holds a token for every open connection
+	sem    chan struct{}
+	lock   sync.Mutex
+	idle   []idleConn
+	closed bool
+}
+
+type idleConn struct {
+	conn  *ldap.Conn
+	since time.Time
+}
+
+func newPool(size int, idleTimeout, healthCheckInterval time.Duration, dial func() (*ldap.Conn, error), check func(*ldap.Conn) error) *pool {
+	return &pool{
+		dial:                dial,
+		check:               check,
+		idleTimeout:         idleTimeout,
+		healthCheckInterval: healthCheckInterval,
+		now:                 time.Now,
+		sem:                 make(chan struct{}, size),
+	}
+}
+
+// Get returns an idle connection or dials a new one. Idle connections past
+// the idle timeout are closed, connections idle for longer than the health
+// check interval are checked before they are returned.
+func (p *pool) Get(ctx context.Context) (*ldap.Conn, error) {
+	start := p.now()
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "timed out waiting for a pooled ldap connection")
+	}
+	poolWaitDuration.Observe(p.now().Sub(start).Seconds())
+
+	for {
+		c, ok := p.pop()
+		if !ok {
+			break
+		}
+		idle := p.now().Sub(c.since)
+		switch {
+		case c.conn.IsClosing():
+			p.discard(c.conn, closeReasonError)
+			continue
+		case p.idleTimeout > 0 && idle >= p.idleTimeout:
+			p.discard(c.conn, closeReasonIdleTimeout)
+			continue
+		case idle >= p.healthCheckInterval && p.check(c.conn) != nil:
+			p.discard(c.conn, closeReasonHealthCheck)
+			continue
+		}
+		poolConnections.WithLabelValues(connStateInUse).Inc()
+		return c.conn, nil
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		poolDials.WithLabelValues(dialResultError).Inc()
+		<-p.sem
+		return nil, err
+	}
+	poolDials.WithLabelValues(dialResultSuccess).Inc()
+	poolConnections.WithLabelValues(connStateInUse).Inc()
+	return conn, nil
+}
+
+// Put returns a connection to the pool. Broken connections are closed
+// instead, e.g. after a network error.
+func (p *pool) Put(conn *ldap.Conn, broken bool) {
+	poolConnections.WithLabelValues(connStateInUse).Dec()
+	if broken || conn.IsClosing() {
+		conn.Close()
+		poolClosed.WithLabelValues(closeReasonError).Inc()
+		<-p.sem
+		return
+	}
+
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		conn.Close()
+		<-p.sem
+		return
+	}
+	p.idle = append(p.idle, idleConn{conn: conn, since: p.now()})
+	p.lock.Unlock()
+	poolConnections.WithLabelValues(connStateIdle).Inc()
+	<-p.sem
+}
+
+// pop returns the most recently used idle connection
+func (p *pool) pop() (idleConn, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.idle) == 0 {
+		return idleConn{}, false
+	}
+	c := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	poolConnections.WithLabelValues(connStateIdle).Dec()
+	return c, true
+}
+
+func (p *pool) discard(conn *ldap.Conn, reason string) {
+	conn.Close()
+	poolClosed.WithLabelValues(reason).Inc()
+}
+
+// Close closes the idle connections, connections in use are closed when
+// they are returned
+func (p *pool) Close() {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+	for {
+		c, ok := p.pop()
+		if !ok {
+			return
+		}
+		c.conn.Close()
+	}
+}
+
+// isNetworkError reports whether err was caused by a broken connection
+func isNetworkError(err error) bool {
+	var lerr *ldap.Error
+	return errors.As(err, &lerr) && lerr.ResultCode == ldap.ErrorNetwork
+}
@@ -0,0 +1,164 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDialer struct {
+	dials int
+	peers []net.Conn
+}
+
+func (d *fakeDialer) dial() (*ldap.Conn, error) {
+	d.dials++
+	client, server := net.Pipe()
+	d.peers = append(d.peers, server)
+	conn := ldap.NewConn(client, false)
+	conn.Start()
+	return conn, nil
+}
+
+func (d *fakeDialer) close() {
+	for _, c := range d.peers {
+		_ = c.Close()
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	d := &fakeDialer{}
+	defer d.close()
+	p := newPool(2, time.Minute, time.Minute, d.dial, func(*ldap.Conn) error { return nil })
+	defer p.Close()
+	ctx := context.Background()
+
+	c1, err := p.Get(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+	p.Put(c1, false)
+	c2, err := p.Get(ctx)
+	if assert.Nil(t, err) {
+		assert.Same(t, c1, c2, "idle connection must be reused")
+	}
+	assert.Equal(t, 1, d.dials)
+
+	// broken connections are closed instead of reused
+	p.Put(c2, true)
+	assert.True(t, c2.IsClosing())
+	c3, err := p.Get(ctx)
+	if assert.Nil(t, err) {
+		assert.NotSame(t, c2, c3)
+	}
+	assert.Equal(t, 2, d.dials)
+	p.Put(c3, false)
+}
+
+func TestPoolBounded(t *testing.T) {
+	d := &fakeDialer{}
+	defer d.close()
+	p := newPool(1, time.Minute, time.Minute, d.dial, func(*ldap.Conn) error { return nil })
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(ctx)
+	assert.NotNil(t, err, "pool must not open more than size connections")
+	assert.Equal(t, 1, d.dials)
+
+	p.Put(c, false)
+	c, err = p.Get(context.Background())
+	if assert.Nil(t, err) {
+		p.Put(c, false)
+	}
+}
+
+func TestPoolIdleConnections(t *testing.T) {
+	d := &fakeDialer{}
+	defer d.close()
+	healthy := true
+	checks := 0
+	p := newPool(2, 5*time.Minute, 30*time.Second, d.dial, func(*ldap.Conn) error {
+		checks++
+		if !healthy {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	defer p.Close()
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	c, _ := p.Get(ctx)
+	p.Put(c, false)
+
+	// recently used connections are not checked
+	c, _ = p.Get(ctx)
+	assert.Equal(t, 0, checks)
+	p.Put(c, false)
+
+	now = now.Add(time.Minute)
+	c, _ = p.Get(ctx)
+	assert.Equal(t, 1, checks)
+	assert.Equal(t, 1, d.dials)
+	p.Put(c, false)
+
+	// connections failing the health check are replaced
+	healthy = false
+	now = now.Add(time.Minute)
+	c, _ = p.Get(ctx)
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, 2, d.dials)
+	p.Put(c, false)
+
+	// connections past the idle timeout are closed without a check
+	now = now.Add(5 * time.Minute)
+	c, _ = p.Get(ctx)
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, 3, d.dials)
+	p.Put(c, false)
+}
+
+func TestPoolClose(t *testing.T) {
+	d := &fakeDialer{}
+	defer d.close()
+	p := newPool(2, time.Minute, time.Minute, d.dial, func(*ldap.Conn) error { return nil })
+
+	idle, _ := p.Get(context.Background())
+	inUse, _ := p.Get(context.Background())
+	p.Put(idle, false)
+
+	p.Close()
+	assert.True(t, idle.IsClosing())
+	assert.False(t, inUse.IsClosing())
+	p.Put(inUse, false)
+	assert.True(t, inUse.IsClosing(), "connections returned after close must be closed")
+}
@@ -0,0 +1,264 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// Supported modes to select the LDAP server of a new connection
+const (
+	// ServerSelectionFailover uses the servers in the configured order, or by
+	// SRV priority and weight, and moves to the next one if a server fails
+	ServerSelectionFailover = "failover"
+	// ServerSelectionRoundRobin rotates the first server tried for every new
+	// connection
+	ServerSelectionRoundRobin = "round-robin"
+
+	// serverDialTimeout bounds the time spent on a server that does not
+	// respond before the next one is tried
+	serverDialTimeout = 10 * time.Second
+
+	// srvRefreshInterval is how long the servers discovered with SRV records
+	// are used before the records are looked up again
+	srvRefreshInterval = 5 * time.Minute
+)
+
+var SupportedServerSelections = []string{ServerSelectionFailover, ServerSelectionRoundRobin}
+
+// endpoint is an LDAP server and its health state
+type endpoint struct {
+	// url is the ldap:// or ldaps:// url of the server
+	url  string
+	host string
+	tls  bool
+
+	failures int
+	retryAt  time.Time
+}
+
+// parseServerURL parses an ldap:// or ldaps:// url, the port defaults to 389
+// or 636
+func parseServerURL(raw string) (*endpoint, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ldap server url %s", raw)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	switch scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, errors.Errorf("ldap server url %s must use the ldap or ldaps scheme", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf("ldap server url %s has no host", raw)
+	}
+	return newEndpoint(u.Hostname(), port, scheme == "ldaps"), nil
+}
+
+func newEndpoint(host, port string, secure bool) *endpoint {
+	scheme := "ldap"
+	if secure {
+		scheme = "ldaps"
+	}
+	return &endpoint{
+		url:  fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port)),
+		host: host,
+		tls:  secure,
+	}
+}
+
+// serverList selects the server of new connections and tracks the health of
+// the servers. A server that fails to connect is tried again after a backoff
+// that doubles with every consecutive failure. Servers in backoff are only
+// tried when no healthy server is left.
+type serverList struct {
+	selection  string
+	backoff    time.Duration
+	maxBackoff time.Duration
+	srvDomain  string
+	secure     bool
+
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	now       func() time.Time
+
+	lock    sync.Mutex
+	servers []*endpoint
+	// err is returned instead of servers if the configured urls are invalid
+	err        error
+	resolvedAt time.Time
+	next       int
+}
+
+func newServerList(opts Options) *serverList {
+	l := &serverList{
+		selection:  opts.ServerSelection,
+		backoff:    opts.ServerBackoff,
+		maxBackoff: opts.ServerMaxBackoff,
+		srvDomain:  opts.SRVDomain,
+		secure:     opts.IsSecureLDAP,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		now:        time.Now,
+	}
+	switch {
+	case opts.SRVDomain != "":
+		// resolved on first use
+	case len(opts.ServerURLs) > 0:
+		for _, raw := range opts.ServerURLs {
+			ep, err := parseServerURL(raw)
+			if err != nil {
+				l.err = err
+				return l
+			}
+			l.servers = append(l.servers, ep)
+		}
+	default:
+		l.servers = []*endpoint{newEndpoint(opts.ServerAddress, opts.ServerPort, opts.IsSecureLDAP)}
+	}
+	return l
+}
+
+// Candidates returns the servers in the order they should be tried for a new
+// connection
+func (l *serverList) Candidates(ctx context.Context) ([]*endpoint, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.err != nil {
+		return nil, l.err
+	}
+	if err := l.resolve(ctx); err != nil {
+		return nil, err
+	}
+
+	servers := make([]*endpoint, 0, len(l.servers))
+	if l.selection == ServerSelectionRoundRobin && len(l.servers) > 0 {
+		start := l.next % len(l.servers)
+		l.next++
+		servers = append(servers, l.servers[start:]...)
+		servers = append(servers, l.servers[:start]...)
+	} else {
+		servers = append(servers, l.servers...)
+	}
+
+	// healthy servers first, then the ones in backoff by their retry time
+	now := l.now()
+	sort.SliceStable(servers, func(i, j int) bool {
+		iHealthy, jHealthy := !servers[i].retryAt.After(now), !servers[j].retryAt.After(now)
+		if iHealthy != jHealthy {
+			return iHealthy
+		}
+		return !iHealthy && servers[i].retryAt.Before(servers[j].retryAt)
+	})
+	return servers, nil
+}
+
+// resolve looks up the SRV records of the domain, if set. The health state
+// of servers that are still listed is kept. If the lookup fails, the servers
+// found earlier are used until the next refresh.
+func (l *serverList) resolve(ctx context.Context) error {
+	if l.srvDomain == "" || (!l.resolvedAt.IsZero() && l.now().Sub(l.resolvedAt) < srvRefreshInterval) {
+		return nil
+	}
+
+	service := "ldap"
+	if l.secure {
+		service = "ldaps"
+	}
+	ctx, cancel := context.WithTimeout(ctx, serverDialTimeout)
+	defer cancel()
+	_, addrs, err := l.lookupSRV(ctx, service, "tcp", l.srvDomain)
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no records found")
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to discover ldap servers from _%s._tcp.%s", service, l.srvDomain)
+		if len(l.servers) == 0 {
+			return err
+		}
+		klog.Errorf("%v, using the previously discovered servers", err)
+		l.resolvedAt = l.now()
+		return nil
+	}
+
+	known := map[string]*endpoint{}
+	for _, ep := range l.servers {
+		known[ep.url] = ep
+	}
+	servers := make([]*endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		ep := newEndpoint(strings.TrimSuffix(addr.Target, "."), fmt.Sprint(addr.Port), l.secure)
+		if old, ok := known[ep.url]; ok {
+			ep = old
+		}
+		servers = append(servers, ep)
+	}
+	l.servers = servers
+	l.resolvedAt = l.now()
+	return nil
+}
+
+// Fail puts the server in backoff after it failed to connect
+func (l *serverList) Fail(ep *endpoint, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ep.failures++
+	backoff := l.backoff
+	for i := 1; i < ep.failures && backoff < l.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if l.maxBackoff > 0 && backoff > l.maxBackoff {
+		backoff = l.maxBackoff
+	}
+	ep.retryAt = l.now().Add(backoff)
+
+	serverUp.WithLabelValues(ep.url).Set(0)
+	serverFailures.WithLabelValues(ep.url).Inc()
+	klog.Warningf("ldap server %s failed %d times, retrying after %v: %v", ep.url, ep.failures, backoff, err)
+}
+
+// Succeed resets the health state of the server after it connected
+func (l *serverList) Succeed(ep *endpoint) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if ep.failures > 0 {
+		klog.Infof("ldap server %s recovered after %d failures", ep.url, ep.failures)
+	}
+	ep.failures = 0
+	ep.retryAt = time.Time{}
+	serverUp.WithLabelValues(ep.url).Set(1)
+}
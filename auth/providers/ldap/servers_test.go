@@ -0,0 +1,190 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServerURL(t *testing.T) {
+	testData := []struct {
+		raw         string
+		url         string
+		host        string
+		tls         bool
+		expectedErr string
+	}{
+		{"ldap://dc1.example.com", "ldap://dc1.example.com:389", "dc1.example.com", false, ""},
+		{"LDAPS://dc1.example.com", "ldaps://dc1.example.com:636", "dc1.example.com", true, ""},
+		{"ldaps://dc1.example.com:3269", "ldaps://dc1.example.com:3269", "dc1.example.com", true, ""},
+		{"ldap://[::1]:8089", "ldap://[::1]:8089", "::1", false, ""},
+		{"dc1.example.com:389", "", "", false, "ldap server url dc1.example.com:389 must use the ldap or ldaps scheme"},
+		{"ldap://", "", "", false, "ldap server url ldap:// has no host"},
+	}
+
+	for _, test := range testData {
+		t.Run(test.raw, func(t *testing.T) {
+			ep, err := parseServerURL(test.raw)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, test.url, ep.url)
+				assert.Equal(t, test.host, ep.host)
+				assert.Equal(t, test.tls, ep.tls)
+			}
+		})
+	}
+}
+
+func candidateURLs(t *testing.T, l *serverList) []string {
+	servers, err := l.Candidates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, ep := range servers {
+		urls = append(urls, ep.url)
+	}
+	return urls
+}
+
+func newTestServerList(selection string) (*serverList, *time.Time) {
+	now := time.Now()
+	l := newServerList(Options{
+		ServerURLs:       []string{"ldap://dc1:389", "ldap://dc2:389", "ldap://dc3:389"},
+		ServerSelection:  selection,
+		ServerBackoff:    time.Second,
+		ServerMaxBackoff: 4 * time.Second,
+	})
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestServerListFailover(t *testing.T) {
+	l, now := newTestServerList(ServerSelectionFailover)
+	assert.Equal(t, []string{"ldap://dc1:389", "ldap://dc2:389", "ldap://dc3:389"}, candidateURLs(t, l))
+
+	servers, _ := l.Candidates(context.Background())
+	dc1, dc2 := servers[0], servers[1]
+	l.Fail(dc1, errors.New("connection refused"))
+	assert.Equal(t, []string{"ldap://dc2:389", "ldap://dc3:389", "ldap://dc1:389"}, candidateURLs(t, l))
+
+	// servers in backoff are tried last, by their retry time
+	*now = now.Add(500 * time.Millisecond)
+	l.Fail(dc2, errors.New("connection refused"))
+	assert.Equal(t, []string{"ldap://dc3:389", "ldap://dc1:389", "ldap://dc2:389"}, candidateURLs(t, l))
+
+	// dc1 is retried after its backoff
+	*now = now.Add(600 * time.Millisecond)
+	assert.Equal(t, []string{"ldap://dc1:389", "ldap://dc3:389", "ldap://dc2:389"}, candidateURLs(t, l))
+
+	// the backoff doubles with every consecutive failure up to the maximum
+	for _, backoff := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		l.Fail(dc1, errors.New("connection refused"))
+		assert.Equal(t, now.Add(backoff), dc1.retryAt)
+	}
+	l.Succeed(dc1)
+	assert.Equal(t, 0, dc1.failures)
+	assert.Equal(t, "ldap://dc1:389", candidateURLs(t, l)[0])
+}
+
+func TestServerListRoundRobin(t *testing.T) {
+	l, _ := newTestServerList(ServerSelectionRoundRobin)
+	assert.Equal(t, []string{"ldap://dc1:389", "ldap://dc2:389", "ldap://dc3:389"}, candidateURLs(t, l))
+	assert.Equal(t, []string{"ldap://dc2:389", "ldap://dc3:389", "ldap://dc1:389"}, candidateURLs(t, l))
+
+	servers, _ := l.Candidates(context.Background())
+	assert.Equal(t, "ldap://dc3:389", servers[0].url)
+	l.Fail(servers[0], errors.New("connection refused"))
+	assert.Equal(t, []string{"ldap://dc1:389", "ldap://dc2:389", "ldap://dc3:389"}, candidateURLs(t, l))
+	assert.Equal(t, []string{"ldap://dc2:389", "ldap://dc1:389", "ldap://dc3:389"}, candidateURLs(t, l))
+}
+
+// resolverStub answers SRV lookups from a map of name to records
+type resolverStub struct {
+	records map[string][]*net.SRV
+	err     error
+	lookups int
+}
+
+func (r *resolverStub) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups++
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return "", r.records["_"+service+"._"+proto+"."+name], nil
+}
+
+func TestServerListSRV(t *testing.T) {
+	resolver := &resolverStub{
+		records: map[string][]*net.SRV{
+			"_ldap._tcp.example.com": {
+				{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 100},
+				{Target: "dc2.example.com.", Port: 389, Priority: 10, Weight: 100},
+			},
+			"_ldaps._tcp.example.com": {
+				{Target: "dc1.example.com.", Port: 636},
+			},
+		},
+	}
+	now := time.Now()
+	newList := func(secure bool) *serverList {
+		l := newServerList(Options{SRVDomain: "example.com", IsSecureLDAP: secure, ServerBackoff: time.Hour})
+		l.lookupSRV = resolver.LookupSRV
+		l.now = func() time.Time { return now }
+		return l
+	}
+
+	l := newList(false)
+	assert.Equal(t, []string{"ldap://dc1.example.com:389", "ldap://dc2.example.com:389"}, candidateURLs(t, l))
+	assert.Equal(t, []string{"ldaps://dc1.example.com:636"}, candidateURLs(t, newList(true)))
+
+	// records are cached until the refresh interval
+	servers, _ := l.Candidates(context.Background())
+	l.Fail(servers[0], errors.New("connection refused"))
+	assert.Equal(t, []string{"ldap://dc2.example.com:389", "ldap://dc1.example.com:389"}, candidateURLs(t, l))
+	assert.Equal(t, 2, resolver.lookups)
+
+	// the health state is kept across refreshes
+	now = now.Add(srvRefreshInterval)
+	resolver.records["_ldap._tcp.example.com"] = append(resolver.records["_ldap._tcp.example.com"], &net.SRV{Target: "dc3.example.com.", Port: 389})
+	assert.Equal(t, []string{"ldap://dc2.example.com:389", "ldap://dc3.example.com:389", "ldap://dc1.example.com:389"}, candidateURLs(t, l))
+	assert.Equal(t, 3, resolver.lookups)
+
+	// failed lookups keep the previously discovered servers
+	now = now.Add(srvRefreshInterval)
+	resolver.err = errors.New("no such host")
+	assert.Len(t, candidateURLs(t, l), 3)
+	assert.Equal(t, 4, resolver.lookups)
+
+	_, err := newList(false).Candidates(context.Background())
+	assert.EqualError(t, err, "failed to discover ldap servers from _ldap._tcp.example.com: no such host")
+
+	resolver.err = nil
+	l = newServerList(Options{SRVDomain: "example.org"})
+	l.lookupSRV = resolver.LookupSRV
+	_, err = l.Candidates(context.Background())
+	assert.EqualError(t, err, "failed to discover ldap servers from _ldap._tcp.example.org: no records found")
+}
@@ -0,0 +1,251 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.kubeguard.dev/guard/auth"
+
+	gooidc "github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	OrgType = "oidc"
+)
+
+func init() {
+	auth.SupportedOrgs = append(auth.SupportedOrgs, OrgType)
+}
+
+// cachedProviders holds the discovered issuers keyed by issuer url,
+// discovery is a network round trip and the issuer metadata does not
+// change between requests
+var (
+	cachedProviders      = map[string]*gooidc.Provider{}
+	cachedProvidersMutex = &sync.RWMutex{}
+)
+
+type Authenticator struct {
+	opts     Options
+	verifier *gooidc.IDTokenVerifier
+}
+
+// New is called per authentication request
+func New(ctx context.Context, opts Options) (auth.Interface, error) {
+	provider, err := getProvider(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthenticator(opts, provider), nil
+}
+
+func newAuthenticator(opts Options, provider *gooidc.Provider) *Authenticator {
+	return &Authenticator{
+		opts: opts,
+		verifier: provider.Verifier(&gooidc.Config{
+			// audiences are matched against the list in Check
+			SkipClientIDCheck:    true,
+			SupportedSigningAlgs: opts.SupportedSigningAlgs,
+		}),
+	}
+}
+
+func getProvider(opts Options) (*gooidc.Provider, error) {
+	cachedProvidersMutex.RLock()
+	// fast path: read from cache
+	if p, ok := cachedProviders[opts.IssuerURL]; ok {
+		cachedProvidersMutex.RUnlock()
+		return p, nil
+	}
+	cachedProvidersMutex.RUnlock()
+
+	// slow path: hold the lock during discovery to avoid sending multiple requests
+	cachedProvidersMutex.Lock()
+	defer cachedProvidersMutex.Unlock()
+
+	if p, ok := cachedProviders[opts.IssuerURL]; ok {
+		return p, nil
+	}
+
+	// NOTE: we start a root context here to allow background remote key set refresh
+	ctx := gooidc.ClientContext(context.Background(), opts.httpClient())
+	p, err := gooidc.NewProvider(ctx, opts.IssuerURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create oidc provider for issuer %s", opts.IssuerURL)
+	}
+	cachedProviders[opts.IssuerURL] = p
+	return p, nil
+}
+
+func (g Authenticator) UID() string {
+	return OrgType
+}
+
+// Ready checks the discovery document and the key set of the issuer are
+// reachable
+func (o Options) Ready(ctx context.Context) error {
+	return auth.CheckOIDCDiscovery(ctx, o.httpClient(), o.IssuerURL)
+}
+
+func (g *Authenticator) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	// the key set of the provider fetches keys with the client of the
+	// discovery, ctx only bounds the verification
+	idToken, err := g.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify token for oidc")
+	}
+
+	// the token is signed by the issuer, it must not be tried by other providers
+	resp, err := g.userInfo(idToken)
+	if err != nil {
+		return nil, auth.Reject(err)
+	}
+
+	klog.V(7).Infof("oidc user %s authenticated with %d groups", resp.Username, len(resp.Groups))
+	return resp, nil
+}
+
+func (g *Authenticator) userInfo(idToken *gooidc.IDToken) (*authv1.UserInfo, error) {
+	if !hasAudience(idToken.Audience, g.opts.Audiences) {
+		return nil, errors.Errorf("token audience %q does not match any of %q", idToken.Audience, g.opts.Audiences)
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, errors.Wrap(err, "failed to get claims from token")
+	}
+
+	username, err := getStringClaim(claims, g.opts.UsernameClaim)
+	if err != nil {
+		return nil, err
+	}
+	if username == "" {
+		return nil, errors.Errorf("claim %s is empty", g.opts.UsernameClaim)
+	}
+	if g.opts.UsernameClaim == "email" {
+		// follow the kube-apiserver oidc authenticator, an email is only
+		// acceptable as user name when the issuer has verified it
+		if verified, ok := lookupClaim(claims, "email_verified"); ok {
+			if v, ok := verified.(bool); !ok || !v {
+				return nil, errors.Errorf("email %s is not verified", username)
+			}
+		}
+	}
+
+	resp := &authv1.UserInfo{
+		Username: g.opts.UsernamePrefix + username,
+	}
+
+	if g.opts.UIDClaim != "" {
+		resp.UID, err = getStringClaim(claims, g.opts.UIDClaim)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if g.opts.GroupsClaim != "" {
+		groups, err := getStringSliceClaim(claims, g.opts.GroupsClaim)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			resp.Groups = append(resp.Groups, g.opts.GroupsPrefix+group)
+		}
+	}
+
+	return resp, nil
+}
+
+func hasAudience(tokenAud, accepted []string) bool {
+	for _, aud := range tokenAud {
+		for _, a := range accepted {
+			if aud == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupClaim returns the value of the claim addressed by path. A claim
+// named exactly as path takes precedence, since claim names such as
+// "https://example.com/groups" may contain dots; otherwise path is walked
+// as a dot separated list of nested claim names.
+func lookupClaim(claims map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := claims[path]; ok {
+		return v, true
+	}
+
+	var cur interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func getStringClaim(claims map[string]interface{}, path string) (string, error) {
+	v, ok := lookupClaim(claims, path)
+	if !ok {
+		return "", errors.Errorf("claim %s not found", path)
+	}
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case float64:
+		// json numbers are decoded as float64, ids are commonly numeric
+		return fmt.Sprintf("%.0f", val), nil
+	}
+	return "", errors.Errorf("claim %s is not a string", path)
+}
+
+func getStringSliceClaim(claims map[string]interface{}, path string) ([]string, error) {
+	v, ok := lookupClaim(claims, path)
+	if !ok {
+		// a user without groups is valid
+		return nil, nil
+	}
+	switch val := v.(type) {
+	case string:
+		return []string{val}, nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("claim %s contains a non string value", path)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, errors.Errorf("claim %s is neither a string nor an array of strings", path)
+}
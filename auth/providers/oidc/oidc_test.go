@@ -0,0 +1,284 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const (
+	clientID = "guard"
+)
+
+type signingKey struct {
+	priv interface{}
+	pub  interface{}
+	alg  jose.SignatureAlgorithm
+}
+
+func (s *signingKey) sign(payload []byte) (string, error) {
+	privKey := &jose.JSONWebKey{Key: s.priv, Algorithm: string(s.alg)}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: s.alg, Key: privKey}, nil)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// jwk returns the public part of the signing key.
+func (s *signingKey) jwk() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: s.pub, Use: "sig", Algorithm: string(s.alg)}},
+	}
+}
+
+func newRSAKey() (*signingKey, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{priv, priv.Public(), jose.RS256}, nil
+}
+
+func oidcServerSetup(jwkResp []byte) (*httptest.Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		return nil, err
+	}
+	addr := listener.Addr().String()
+
+	m := chi.NewRouter()
+	m.Get("/.well-known/openid-configuration", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		resp := `{"issuer" : "http://%v", "jwks_uri" : "http://%v/jwk"}`
+		_, _ = w.Write([]byte(fmt.Sprintf(resp, addr, addr)))
+	}))
+	m.Get("/jwk", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jwkResp)
+	}))
+
+	srv := &httptest.Server{
+		Listener: listener,
+		Config:   &http.Server{Handler: m},
+	}
+	srv.Start()
+	return srv, nil
+}
+
+func oidcClientSetup(serverUrl string, opts Options) (*Authenticator, error) {
+	p, err := gooidc.NewProvider(context.Background(), serverUrl)
+	if err != nil {
+		return nil, err
+	}
+	opts.IssuerURL = serverUrl
+	return newAuthenticator(opts, p), nil
+}
+
+func TestCheckOIDC(t *testing.T) {
+	signKey, err := newRSAKey()
+	if err != nil {
+		t.Fatalf("Error when creating signing key. reason : %v", err)
+	}
+	jwkResp, err := json.Marshal(signKey.jwk())
+	if err != nil {
+		t.Fatalf("Error when generating JSONWebKeySet. reason: %v", err)
+	}
+
+	srv, err := oidcServerSetup(jwkResp)
+	if err != nil {
+		t.Fatalf("Error when creating server, reason: %v", err)
+	}
+	defer srv.Close()
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	dataset := []struct {
+		testName     string
+		opts         Options
+		claims       string
+		expectedUser *authv1.UserInfo
+	}{
+		{
+			"default username claim",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234"}`, clientID, exp),
+			&authv1.UserInfo{Username: "1234"},
+		},
+		{
+			"one of multiple audiences matches",
+			Options{Audiences: []string{"other", clientID}, UsernameClaim: "sub"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":["kubernetes", "%s"], "exp":%d, "sub":"1234"}`, clientID, exp),
+			&authv1.UserInfo{Username: "1234"},
+		},
+		{
+			"prefixed username, groups and uid",
+			Options{
+				Audiences:      []string{clientID},
+				UsernameClaim:  "preferred_username",
+				UsernamePrefix: "oidc:",
+				GroupsClaim:    "groups",
+				GroupsPrefix:   "oidc:",
+				UIDClaim:       "sub",
+			},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234", "preferred_username":"nahid", "groups":["dev","ops"]}`, clientID, exp),
+			&authv1.UserInfo{Username: "oidc:nahid", UID: "1234", Groups: []string{"oidc:dev", "oidc:ops"}},
+		},
+		{
+			"nested groups claim",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub", GroupsClaim: "realm_access.roles"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234", "realm_access":{"roles":["admin"]}}`, clientID, exp),
+			&authv1.UserInfo{Username: "1234", Groups: []string{"admin"}},
+		},
+		{
+			"claim name containing dots",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub", GroupsClaim: "https://example.com/groups"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234", "https://example.com/groups":"admin"}`, clientID, exp),
+			&authv1.UserInfo{Username: "1234", Groups: []string{"admin"}},
+		},
+		{
+			"numeric uid claim",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub", UIDClaim: "id"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234", "id":42}`, clientID, exp),
+			&authv1.UserInfo{Username: "1234", UID: "42"},
+		},
+		{
+			"verified email",
+			Options{Audiences: []string{clientID}, UsernameClaim: "email"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "email":"nahid@domain.com", "email_verified":true}`, clientID, exp),
+			&authv1.UserInfo{Username: "nahid@domain.com"},
+		},
+		{
+			"unverified email",
+			Options{Audiences: []string{clientID}, UsernameClaim: "email"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "email":"nahid@domain.com", "email_verified":false}`, clientID, exp),
+			nil,
+		},
+		{
+			"audience mismatch",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"other", "exp":%d, "sub":"1234"}`, exp),
+			nil,
+		},
+		{
+			"bad issuer",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub"},
+			fmt.Sprintf(`{"iss":"https://bad", "aud":"%s", "exp":%d, "sub":"1234"}`, clientID, exp),
+			nil,
+		},
+		{
+			"expired token",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234"}`, clientID, time.Now().Add(-time.Hour).Unix()),
+			nil,
+		},
+		{
+			"missing username claim",
+			Options{Audiences: []string{clientID}, UsernameClaim: "preferred_username"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234"}`, clientID, exp),
+			nil,
+		},
+		{
+			"groups claim is not a list of strings",
+			Options{Audiences: []string{clientID}, UsernameClaim: "sub", GroupsClaim: "groups"},
+			fmt.Sprintf(`{"iss":"_ISSUER_", "aud":"%s", "exp":%d, "sub":"1234", "groups":[1,2]}`, clientID, exp),
+			nil,
+		},
+	}
+	ctx := context.Background()
+
+	for _, test := range dataset {
+		t.Run(test.testName, func(t *testing.T) {
+			client, err := oidcClientSetup(srv.URL, test.opts)
+			if err != nil {
+				t.Fatalf("Error when creating oidc client. reason : %v", err)
+			}
+
+			token, err := signKey.sign([]byte(strings.Replace(test.claims, "_ISSUER_", srv.URL, -1)))
+			if err != nil {
+				t.Fatalf("Error when signing token. reason: %v", err)
+			}
+
+			resp, err := client.Check(ctx, token)
+			if test.expectedUser == nil {
+				assert.NotNil(t, err)
+				assert.Nil(t, resp)
+			} else {
+				if assert.Nil(t, err) {
+					assert.Equal(t, test.expectedUser, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckOIDCBadSignature(t *testing.T) {
+	signKey, err := newRSAKey()
+	if err != nil {
+		t.Fatalf("Error when creating signing key. reason : %v", err)
+	}
+	otherKey, err := newRSAKey()
+	if err != nil {
+		t.Fatalf("Error when creating signing key. reason : %v", err)
+	}
+	jwkResp, err := json.Marshal(signKey.jwk())
+	if err != nil {
+		t.Fatalf("Error when generating JSONWebKeySet. reason: %v", err)
+	}
+
+	srv, err := oidcServerSetup(jwkResp)
+	if err != nil {
+		t.Fatalf("Error when creating server, reason: %v", err)
+	}
+	defer srv.Close()
+
+	client, err := oidcClientSetup(srv.URL, Options{Audiences: []string{clientID}, UsernameClaim: "sub"})
+	if err != nil {
+		t.Fatalf("Error when creating oidc client. reason : %v", err)
+	}
+
+	claims := fmt.Sprintf(`{"iss":"%s", "aud":"%s", "exp":%d, "sub":"1234"}`, srv.URL, clientID, time.Now().Add(time.Hour).Unix())
+	token, err := otherKey.sign([]byte(claims))
+	if err != nil {
+		t.Fatalf("Error when signing token. reason: %v", err)
+	}
+
+	resp, err := client.Check(context.Background(), token)
+	assert.NotNil(t, err)
+	assert.Nil(t, resp)
+}
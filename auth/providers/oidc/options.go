@@ -0,0 +1,214 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.kubeguard.dev/guard/util/httpclient"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gomodules.xyz/pointer"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	DefaultUsernameClaim = "sub"
+)
+
+type Options struct {
+	// URL of the OpenID issuer, only HTTPS scheme will be accepted
+	IssuerURL string
+
+	// Audiences accepted in the token's aud claim, at least one must match
+	Audiences []string
+
+	// Claim to use as the user name. Nested claims can be addressed
+	// with a dot separated path, e.g. "profile.login"
+	// default : sub
+	UsernameClaim string
+
+	// Prefix prepended to the user name
+	UsernamePrefix string
+
+	// Claim to use as the user's groups, the claim value can be
+	// either a string or an array of strings
+	GroupsClaim string
+
+	// Prefix prepended to every group name
+	GroupsPrefix string
+
+	// Claim to use as the user's UID
+	UIDClaim string
+
+	// path to the caCert file, needed for issuers using self signed certificate
+	CACertFile string
+
+	// client trusts the CA cert, it is built once by Configure
+	client *http.Client
+
+	// Accepted signing algorithms, defaults to the algorithms
+	// advertised by the issuer's discovery document
+	SupportedSigningAlgs []string
+}
+
+func NewOptions() Options {
+	return Options{
+		UsernameClaim: DefaultUsernameClaim,
+	}
+}
+
+// if ca cert is provided then create the http client trusting it
+func (o *Options) Configure() error {
+	if o.CACertFile != "" {
+		caCert, err := os.ReadFile(o.CACertFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to read ca cert file")
+		}
+		caCertPool := x509.NewCertPool()
+		if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+			return errors.New("Failed to add CA cert in CertPool for OIDC")
+		}
+		transport := httpclient.DefaultTransport.Clone()
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    caCertPool,
+		}
+		o.client = &http.Client{Transport: httpclient.Instrument(transport)}
+	}
+	return nil
+}
+
+func (o Options) httpClient() *http.Client {
+	if o.client == nil {
+		return httpclient.DefaultHTTPClient
+	}
+	return o.client
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.IssuerURL, "oidc.issuer-url", o.IssuerURL, "URL of the OpenID issuer, only HTTPS scheme will be accepted")
+	fs.StringSliceVar(&o.Audiences, "oidc.audiences", o.Audiences, "List of audiences (client IDs) accepted in the token's aud claim")
+	fs.StringVar(&o.UsernameClaim, "oidc.username-claim", o.UsernameClaim, "Claim to use as the user name, nested claims can be addressed with a dot separated path")
+	fs.StringVar(&o.UsernamePrefix, "oidc.username-prefix", o.UsernamePrefix, "Prefix prepended to the user name")
+	fs.StringVar(&o.GroupsClaim, "oidc.groups-claim", o.GroupsClaim, "Claim to use as the user's groups, nested claims can be addressed with a dot separated path")
+	fs.StringVar(&o.GroupsPrefix, "oidc.groups-prefix", o.GroupsPrefix, "Prefix prepended to group names")
+	fs.StringVar(&o.UIDClaim, "oidc.uid-claim", o.UIDClaim, "Claim to use as the user's UID, nested claims can be addressed with a dot separated path")
+	fs.StringVar(&o.CACertFile, "oidc.ca-cert-file", o.CACertFile, "ca cert file used to verify the OpenID issuer's serving certificate")
+	fs.StringSliceVar(&o.SupportedSigningAlgs, "oidc.signing-algs", o.SupportedSigningAlgs, "List of accepted signing algorithms, defaults to the algorithms advertised by the issuer")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if o.IssuerURL == "" {
+		errs = append(errs, errors.New("oidc.issuer-url must be non-empty"))
+	} else if u, err := url.Parse(o.IssuerURL); err != nil || u.Scheme != "https" {
+		errs = append(errs, errors.New("oidc.issuer-url must be a valid https url"))
+	}
+	if len(o.Audiences) == 0 {
+		errs = append(errs, errors.New("oidc.audiences must be non-empty"))
+	}
+	if o.UsernameClaim == "" {
+		errs = append(errs, errors.New("oidc.username-claim must be non-empty"))
+	}
+	return errs
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	container := d.Spec.Template.Spec.Containers[0]
+
+	if o.CACertFile != "" {
+		// create auth secret
+		cert, err := os.ReadFile(o.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		authSecret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "guard-oidc-auth",
+				Namespace: d.Namespace,
+				Labels:    d.Labels,
+			},
+			Data: map[string][]byte{
+				"ca.crt": cert,
+			},
+		}
+		extraObjs = append(extraObjs, authSecret)
+
+		// mount auth secret into deployment
+		volMount := core.VolumeMount{
+			Name:      authSecret.Name,
+			MountPath: "/etc/guard/auth/oidc",
+		}
+		container.VolumeMounts = append(container.VolumeMounts, volMount)
+
+		vol := core.Volume{
+			Name: authSecret.Name,
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName:  authSecret.Name,
+					DefaultMode: pointer.Int32P(0o444),
+				},
+			},
+		}
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, vol)
+	}
+
+	args := container.Args
+	if o.IssuerURL != "" {
+		args = append(args, fmt.Sprintf("--oidc.issuer-url=%s", o.IssuerURL))
+	}
+	if len(o.Audiences) > 0 {
+		args = append(args, fmt.Sprintf("--oidc.audiences=%s", strings.Join(o.Audiences, ",")))
+	}
+	if o.UsernameClaim != "" {
+		args = append(args, fmt.Sprintf("--oidc.username-claim=%s", o.UsernameClaim))
+	}
+	if o.UsernamePrefix != "" {
+		args = append(args, fmt.Sprintf("--oidc.username-prefix=%s", o.UsernamePrefix))
+	}
+	if o.GroupsClaim != "" {
+		args = append(args, fmt.Sprintf("--oidc.groups-claim=%s", o.GroupsClaim))
+	}
+	if o.GroupsPrefix != "" {
+		args = append(args, fmt.Sprintf("--oidc.groups-prefix=%s", o.GroupsPrefix))
+	}
+	if o.UIDClaim != "" {
+		args = append(args, fmt.Sprintf("--oidc.uid-claim=%s", o.UIDClaim))
+	}
+	if o.CACertFile != "" {
+		args = append(args, "--oidc.ca-cert-file=/etc/guard/auth/oidc/ca.crt")
+	}
+	if len(o.SupportedSigningAlgs) > 0 {
+		args = append(args, fmt.Sprintf("--oidc.signing-algs=%s", strings.Join(o.SupportedSigningAlgs, ",")))
+	}
+
+	container.Args = args
+	d.Spec.Template.Spec.Containers[0] = container
+
+	return extraObjs, nil
+}
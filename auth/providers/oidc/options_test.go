@@ -0,0 +1,98 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func getNonEmptyOptions() Options {
+	return Options{
+		IssuerURL:     "https://issuer.example.com",
+		Audiences:     []string{"guard"},
+		UsernameClaim: DefaultUsernameClaim,
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		optsFunc    func(o Options) Options
+		expectedErr []error
+	}{
+		{
+			"validation passed",
+			func(o Options) Options {
+				return o
+			},
+			nil,
+		},
+		{
+			"validation failed, all empty",
+			func(o Options) Options {
+				return Options{}
+			},
+			[]error{
+				errors.New("oidc.issuer-url must be non-empty"),
+				errors.New("oidc.audiences must be non-empty"),
+				errors.New("oidc.username-claim must be non-empty"),
+			},
+		},
+		{
+			"oidc.issuer-url is not https",
+			func(o Options) Options {
+				o.IssuerURL = "http://issuer.example.com"
+				return o
+			},
+			[]error{errors.New("oidc.issuer-url must be a valid https url")},
+		},
+		{
+			"oidc.audiences is empty",
+			func(o Options) Options {
+				o.Audiences = nil
+				return o
+			},
+			[]error{errors.New("oidc.audiences must be non-empty")},
+		},
+		{
+			"oidc.username-claim is empty",
+			func(o Options) Options {
+				o.UsernameClaim = ""
+				return o
+			},
+			[]error{errors.New("oidc.username-claim must be non-empty")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			opts := test.optsFunc(getNonEmptyOptions())
+			errs := opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
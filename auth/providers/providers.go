@@ -22,10 +22,14 @@ import (
 
 	"go.kubeguard.dev/guard/auth"
 	_ "go.kubeguard.dev/guard/auth/providers/azure"
+	_ "go.kubeguard.dev/guard/auth/providers/ci"
+	_ "go.kubeguard.dev/guard/auth/providers/eks"
 	_ "go.kubeguard.dev/guard/auth/providers/github"
 	_ "go.kubeguard.dev/guard/auth/providers/gitlab"
 	_ "go.kubeguard.dev/guard/auth/providers/google"
+	_ "go.kubeguard.dev/guard/auth/providers/htpasswd"
 	_ "go.kubeguard.dev/guard/auth/providers/ldap"
+	_ "go.kubeguard.dev/guard/auth/providers/oidc"
 	_ "go.kubeguard.dev/guard/auth/providers/token"
 
 	"github.com/pkg/errors"
@@ -36,10 +40,12 @@ import (
 
 type AuthProviders struct {
 	Providers []string // contains providers name for which guard will provide service, required
+	Chain     []string // providers tried in order regardless of the client cert organization, optional
 }
 
 func (a *AuthProviders) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&a.Providers, "auth-providers", a.Providers, fmt.Sprintf("name of providers for which guard will provide authentication service (required), supported providers : %v", auth.SupportedOrgs.String()))
+	fs.StringSliceVar(&a.Chain, "auth-chain", a.Chain, "ordered list of providers tried for every token review until one succeeds or definitively rejects the token, each must be listed in auth-providers. If set, the client cert organization is not used to pick the provider")
 }
 
 func (a *AuthProviders) Validate() []error {
@@ -53,6 +59,18 @@ func (a *AuthProviders) Validate() []error {
 			errs = append(errs, errors.Errorf("provider %s not supported", p))
 		}
 	}
+
+	seen := map[string]bool{}
+	for _, p := range a.Chain {
+		name := strings.ToLower(strings.TrimSpace(p))
+		if !a.Has(name) {
+			errs = append(errs, errors.Errorf("auth-chain provider %s must be listed in auth-providers", p))
+		}
+		if seen[name] {
+			errs = append(errs, errors.Errorf("auth-chain provider %s is listed more than once", p))
+		}
+		seen[name] = true
+	}
 	return errs
 }
 
@@ -60,6 +78,9 @@ func (a *AuthProviders) Apply(d *apps.Deployment) (extraObjs []runtime.Object, e
 	if len(a.Providers) > 0 {
 		d.Spec.Template.Spec.Containers[0].Args = append(d.Spec.Template.Spec.Containers[0].Args, fmt.Sprintf("--auth-providers=%s", strings.Join(a.Providers, ",")))
 	}
+	if len(a.Chain) > 0 {
+		d.Spec.Template.Spec.Containers[0].Args = append(d.Spec.Template.Spec.Containers[0].Args, fmt.Sprintf("--auth-chain=%s", strings.Join(a.Chain, ",")))
+	}
 
 	return nil, nil
 }
@@ -20,12 +20,14 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 func TestAuthProvidersHas(t *testing.T) {
 	authCaseSensitive := AuthProviders{
-		[]string{
+		Providers: []string{
 			"azure",
 			"github",
 			"gitlab",
@@ -36,7 +38,7 @@ func TestAuthProvidersHas(t *testing.T) {
 	}
 
 	authCaseInSensitive := AuthProviders{
-		[]string{
+		Providers: []string{
 			"AzUre",
 			"GitHuB",
 			"GitLAb",
@@ -93,3 +95,49 @@ func TestAuthProvidersHas(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthProvidersValidateChain(t *testing.T) {
+	testData := []struct {
+		testName    string
+		chain       []string
+		expectedErr []error
+	}{
+		{
+			"no chain",
+			nil,
+			nil,
+		},
+		{
+			"chain is a subset of auth-providers",
+			[]string{"token-auth", "LDAP"},
+			nil,
+		},
+		{
+			"chain provider not in auth-providers",
+			[]string{"token-auth", "github"},
+			[]error{errors.New("auth-chain provider github must be listed in auth-providers")},
+		},
+		{
+			"chain provider listed twice",
+			[]string{"ldap", "token-auth", "ldap"},
+			[]error{errors.New("auth-chain provider ldap is listed more than once")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			a := AuthProviders{
+				Providers: []string{"token-auth", "ldap"},
+				Chain:     test.chain,
+			}
+			errs := a.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
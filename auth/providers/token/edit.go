@@ -0,0 +1,180 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Matches reports whether t is the token of the entry
+func (e Entry) Matches(t string) bool {
+	m, err := newMatcher(e.Token)
+	if err != nil {
+		return false
+	}
+	return m.match(t)
+}
+
+// AddToken appends an entry to the token file, the file is created if it does
+// not exist
+func AddToken(file string, e Entry) error {
+	return editTokenFile(file, func(entries []Entry) ([]Entry, error) {
+		return append(entries, e), nil
+	})
+}
+
+// RevokeTokens removes the entries of the token file for which revoke returns
+// true and returns the number of removed entries
+func RevokeTokens(file string, revoke func(Entry) bool) (int, error) {
+	removed := 0
+	err := editTokenFile(file, func(entries []Entry) ([]Entry, error) {
+		var out []Entry
+		for _, e := range entries {
+			if revoke(e) {
+				removed++
+				continue
+			}
+			out = append(out, e)
+		}
+		if removed == 0 {
+			return nil, errors.New("no matching token found")
+		}
+		return out, nil
+	})
+	return removed, err
+}
+
+// editTokenFile replaces the token file with the edited entries. The new file
+// is validated and written to a temporary file first, which is renamed over
+// the token file, so readers never see a partially written file. A lock file
+// keeps concurrent edits from overwriting each other.
+func editTokenFile(file string, edit func([]Entry) ([]Entry, error)) error {
+	lock := file + ".lock"
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if os.IsExist(err) {
+			return errors.Errorf("token file %s is being edited, remove %s if no other edit is running", file, lock)
+		}
+		return errors.Wrap(err, "failed to lock token file")
+	}
+	_ = f.Close()
+	defer func() {
+		_ = os.Remove(lock)
+	}()
+
+	mode := os.FileMode(0o600)
+	var entries []Entry
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+		if entries, err = LoadTokenFile(file); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if entries, err = edit(entries); err != nil {
+		return err
+	}
+	data, err := marshalTokenFile(file, entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary token file")
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write temporary token file")
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func marshalTokenFile(file string, entries []Entry) ([]byte, error) {
+	var data []byte
+	var err error
+	if IsStructured(file) {
+		f := TokenFile{APIVersion: FileAPIVersion, Kind: FileKind, Tokens: entries}
+		if strings.EqualFold(filepath.Ext(file), ".json") {
+			data, err = json.MarshalIndent(f, "", "  ")
+		} else {
+			data, err = yaml.Marshal(f)
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = ParseTokenFile(data)
+	} else {
+		buf := new(bytes.Buffer)
+		w := csv.NewWriter(buf)
+		for _, e := range entries {
+			if len(e.Extra) > 0 {
+				return nil, errors.Errorf("token of %s has extra attributes, which require a YAML or JSON token file", e.Username)
+			}
+			if err = w.Write(csvRecord(e)); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		if err = w.Error(); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+		_, err = ParseTokenCSV(data)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "edited token file is invalid")
+	}
+	return data, nil
+}
+
+func csvRecord(e Entry) []string {
+	row := []string{e.Token, e.Username, e.UID, strings.Join(e.Groups, ",")}
+	if e.NotBefore != nil || e.ExpiresAt != nil {
+		row = append(row, formatTime(e.NotBefore), formatTime(e.ExpiresAt))
+	}
+	return row
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditTokenFile(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{"token.csv", "token.yaml", "token.json"} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), name)
+
+			assert.Nil(t, AddToken(file, Entry{Token: "sha256:3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0", Username: "user1", UID: "1", Groups: []string{"group1", "group2"}}))
+			assert.Nil(t, AddToken(file, Entry{Token: "token2", Username: "user2", UID: "2", ExpiresAt: &expiresAt}))
+			assert.Nil(t, AddToken(file, Entry{Token: "token3", Username: "user1", UID: "1"}))
+			assert.NotNil(t, AddToken(file, Entry{Token: "token2", Username: "user3", UID: "3"}), "tokens must be unique")
+
+			info, err := os.Stat(file)
+			if assert.Nil(t, err) {
+				assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+			}
+			entries, err := LoadTokenFile(file)
+			if assert.Nil(t, err) && assert.Len(t, entries, 3) {
+				assert.Equal(t, []string{"group1", "group2"}, entries[0].Groups)
+				if assert.NotNil(t, entries[1].ExpiresAt) {
+					assert.True(t, expiresAt.Equal(*entries[1].ExpiresAt))
+				}
+			}
+
+			n, err := RevokeTokens(file, func(e Entry) bool { return e.Matches("token2") })
+			assert.Nil(t, err)
+			assert.Equal(t, 1, n)
+			n, err = RevokeTokens(file, func(e Entry) bool { return e.Username == "user1" })
+			assert.Nil(t, err)
+			assert.Equal(t, 2, n)
+			_, err = RevokeTokens(file, func(e Entry) bool { return e.Username == "user1" })
+			assert.EqualError(t, err, "no matching token found")
+
+			_, err = os.Stat(file + ".lock")
+			assert.True(t, os.IsNotExist(err), "lock file must be removed")
+		})
+	}
+}
+
+func TestEditTokenFileExtra(t *testing.T) {
+	e := Entry{Token: "token1", Username: "user1", UID: "1", Extra: map[string][]string{"team": {"platform"}}}
+
+	dir := t.TempDir()
+	assert.NotNil(t, AddToken(filepath.Join(dir, "token.csv"), e), "csv token file can not hold extra attributes")
+
+	file := filepath.Join(dir, "token.yaml")
+	if assert.Nil(t, AddToken(file, e)) {
+		entries, err := LoadTokenFile(file)
+		if assert.Nil(t, err) && assert.Len(t, entries, 1) {
+			assert.Equal(t, e.Extra, entries[0].Extra)
+		}
+	}
+}
+
+func TestEditTokenFileLocked(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token.csv")
+	if err := os.WriteFile(file+".lock", nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, AddToken(file, Entry{Token: "token1", Username: "user1", UID: "1"}))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
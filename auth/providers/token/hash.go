@@ -0,0 +1,251 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported hashes of tokens in the token file
+const (
+	HashNone   = "none"
+	HashSHA256 = "sha256"
+	HashBcrypt = "bcrypt"
+	HashArgon2 = "argon2id"
+
+	sha256Prefix = "sha256:"
+	argon2Prefix = "$argon2id$"
+
+	// argon2id parameters of new hashes, as recommended by RFC 9106
+	argon2Memory  = 64 * 1024
+	argon2Time    = 3
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	// limits of the argon2id parameters read from the token file, so a
+	// single entry cannot make each review arbitrarily expensive
+	argon2MaxMemory  = 256 * 1024
+	argon2MaxTime    = 10
+	argon2MaxThreads = 16
+	argon2MaxKeyLen  = 64
+
+	// tokenIDLen is the length of the public id of tokens hashed with bcrypt
+	// or argon2id, as in bootstrap tokens
+	tokenIDLen   = 6
+	tokenIDChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var SupportedHashes = []string{HashNone, HashSHA256, HashBcrypt, HashArgon2}
+
+// GenerateToken returns a random token with 256 bits of entropy. Tokens to be
+// hashed with bcrypt or argon2id get a random public id, <id>.<secret>.
+func GenerateToken(hash string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate token")
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	if !isSlowHash(hash) {
+		return secret, nil
+	}
+
+	id := make([]byte, tokenIDLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", errors.Wrap(err, "failed to generate token id")
+	}
+	for i := range id {
+		id[i] = tokenIDChars[int(id[i])%len(tokenIDChars)]
+	}
+	return string(id) + "." + secret, nil
+}
+
+func isSlowHash(hash string) bool {
+	return hash == HashBcrypt || hash == HashArgon2
+}
+
+// HashToken returns the token file entry of token hashed with hash. bcrypt
+// and argon2id require a token <id>.<secret>, only the secret is hashed and
+// the entry is <id>.<hash>, so a token is checked against a single entry.
+func HashToken(token, hash string) (string, error) {
+	if isSlowHash(hash) {
+		id, secret, ok := splitToken(token)
+		if !ok {
+			return "", errors.Errorf("%s hashed token must be <id>.<secret> with an id of %d characters a-z0-9", hash, tokenIDLen)
+		}
+		hashed, err := hashSecret(secret, hash)
+		if err != nil {
+			return "", err
+		}
+		return id + "." + hashed, nil
+	}
+	return hashSecret(token, hash)
+}
+
+// splitToken splits a token <id>.<secret> into its public id and secret
+func splitToken(token string) (id, secret string, ok bool) {
+	id, secret, ok = strings.Cut(token, ".")
+	if !ok || !validTokenID(id) || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+func validTokenID(id string) bool {
+	if len(id) != tokenIDLen {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(tokenIDChars, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func hashSecret(token, hash string) (string, error) {
+	switch hash {
+	case HashNone:
+		return token, nil
+	case HashSHA256:
+		sum := sha256.Sum256([]byte(token))
+		return sha256Prefix + hex.EncodeToString(sum[:]), nil
+	case HashBcrypt:
+		out, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to hash token with bcrypt")
+		}
+		return string(out), nil
+	case HashArgon2:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", errors.Wrap(err, "failed to generate salt")
+		}
+		key := argon2.IDKey([]byte(token), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", errors.Errorf("unsupported token hash %s, must be one of %s", hash, strings.Join(SupportedHashes, ", "))
+}
+
+// matcher checks a token against an entry of the token file. Plain and
+// sha256 entries are compared by the sha256 digest of the token, bcrypt and
+// argon2id entries are verified with their own hash against the secret of a
+// token with the same id.
+type matcher struct {
+	digest []byte
+	id     string
+	verify func(secret []byte) bool
+}
+
+// match reports whether t is the token of the entry
+func (m matcher) match(t string) bool {
+	if m.verify != nil {
+		id, secret, ok := splitToken(t)
+		return ok && id == m.id && m.verify([]byte(secret))
+	}
+	digest := sha256.Sum256([]byte(t))
+	return subtle.ConstantTimeCompare(m.digest, digest[:]) == 1
+}
+
+func newMatcher(token string) (matcher, error) {
+	if id, hash, ok := strings.Cut(token, "."); ok && isSlowHashEntry(hash) {
+		if !validTokenID(id) {
+			return matcher{}, errors.Errorf("invalid token id %q, must be %d characters a-z0-9", id, tokenIDLen)
+		}
+		m, err := newSlowMatcher(hash)
+		m.id = id
+		return m, err
+	}
+	if isSlowHashEntry(token) {
+		return matcher{}, errors.New("bcrypt and argon2id hashes must be prefixed with the token id, <id>.<hash>")
+	}
+	if strings.HasPrefix(token, sha256Prefix) {
+		digest, err := hex.DecodeString(strings.TrimPrefix(token, sha256Prefix))
+		if err != nil || len(digest) != sha256.Size {
+			return matcher{}, errors.New("invalid sha256 hash")
+		}
+		return matcher{digest: digest}, nil
+	}
+	sum := sha256.Sum256([]byte(token))
+	return matcher{digest: sum[:]}, nil
+}
+
+func isSlowHashEntry(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", argon2Prefix} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSlowMatcher(token string) (matcher, error) {
+	switch {
+	case strings.HasPrefix(token, "$2a$"), strings.HasPrefix(token, "$2b$"), strings.HasPrefix(token, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(token)); err != nil {
+			return matcher{}, errors.Wrap(err, "invalid bcrypt hash")
+		}
+		hash := []byte(token)
+		return matcher{verify: func(t []byte) bool {
+			return bcrypt.CompareHashAndPassword(hash, t) == nil
+		}}, nil
+	}
+	return newArgon2Matcher(token)
+}
+
+// newArgon2Matcher parses a hash in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func newArgon2Matcher(hash string) (matcher, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return matcher{}, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return matcher{}, errors.Errorf("unsupported argon2id version %s", parts[2])
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return matcher{}, errors.Wrap(err, "invalid argon2id parameters")
+	}
+	if memory == 0 || memory > argon2MaxMemory || time == 0 || time > argon2MaxTime || threads == 0 || threads > argon2MaxThreads {
+		return matcher{}, errors.Errorf("argon2id parameters %s out of range, must be at most m=%d,t=%d,p=%d", parts[3], argon2MaxMemory, argon2MaxTime, argon2MaxThreads)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return matcher{}, errors.Wrap(err, "invalid argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > argon2MaxKeyLen {
+		return matcher{}, errors.New("invalid argon2id key")
+	}
+	return matcher{verify: func(t []byte) bool {
+		return subtle.ConstantTimeCompare(argon2.IDKey(t, salt, time, memory, threads, uint32(len(key))), key) == 1
+	}}, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashToken(t *testing.T) {
+	for _, hash := range SupportedHashes {
+		t.Run(hash, func(t *testing.T) {
+			token, err := GenerateToken(hash)
+			if !assert.Nil(t, err) {
+				return
+			}
+			if isSlowHash(hash) {
+				_, _, ok := splitToken(token)
+				assert.True(t, ok, "token %s has no id", token)
+			}
+			hashed, err := HashToken(token, hash)
+			if !assert.Nil(t, err) {
+				return
+			}
+			if hash != HashNone {
+				assert.NotEqual(t, token, hashed)
+			}
+
+			e := Entry{Token: hashed}
+			assert.True(t, e.Matches(token))
+			assert.False(t, e.Matches(token+"x"))
+			assert.False(t, e.Matches(""))
+			if id, secret, ok := splitToken(token); ok {
+				assert.False(t, e.Matches(secret))
+				assert.False(t, e.Matches("zzzzzz."+secret), "id %s", id)
+			}
+		})
+	}
+
+	_, err := HashToken("token", "md5")
+	assert.NotNil(t, err)
+	_, err = HashToken("token", HashBcrypt)
+	assert.NotNil(t, err)
+}
+
+func TestNewMatcher(t *testing.T) {
+	testData := []struct {
+		testName string
+		token    string
+		valid    bool
+	}{
+		{"plain", "token1", true},
+		{"sha256", "sha256:3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0", true},
+		{"sha256 not hex", "sha256:zz", false},
+		{"sha256 too short", "sha256:3c469e9d", false},
+		{"bcrypt", "abc123.$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", true},
+		{"bcrypt without id", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false},
+		{"bcrypt invalid id", "ABC.$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false},
+		{"bcrypt broken", "abc123.$2a$xx$broken", false},
+		{"argon2id", "abc123.$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$a2V5", true},
+		{"argon2id without id", "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$a2V5", false},
+		{"argon2id broken", "abc123.$argon2id$v=19$m=65536", false},
+		{"argon2id wrong version", "abc123.$argon2id$v=16$m=65536,t=3,p=4$c2FsdA$a2V5", false},
+		{"argon2id bad salt", "abc123.$argon2id$v=19$m=65536,t=3,p=4$!!$a2V5", false},
+		{"argon2id memory too large", "abc123.$argon2id$v=19$m=4194304,t=3,p=4$c2FsdA$a2V5", false},
+		{"argon2id time too large", "abc123.$argon2id$v=19$m=65536,t=1000,p=4$c2FsdA$a2V5", false},
+		{"argon2id threads too large", "abc123.$argon2id$v=19$m=65536,t=3,p=255$c2FsdA$a2V5", false},
+		{"argon2id no threads", "abc123.$argon2id$v=19$m=65536,t=3,p=0$c2FsdA$a2V5", false},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := newMatcher(test.token)
+			assert.Equal(t, test.valid, err == nil, "error: %v", err)
+		})
+	}
+}
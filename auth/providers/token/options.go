@@ -18,6 +18,8 @@ package token
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -37,7 +39,7 @@ func NewOptions() Options {
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
-	fs.StringVar(&o.AuthFile, "token-auth-file", "", "To enable static token authentication")
+	fs.StringVar(&o.AuthFile, "token-auth-file", "", "To enable static token authentication, a csv file or a TokenFile in YAML or JSON format")
 }
 
 func (o *Options) Validate() []error {
@@ -60,6 +62,10 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 	if err != nil {
 		return nil, err
 	}
+	key := "token.csv"
+	if IsStructured(o.AuthFile) {
+		key = "token" + strings.ToLower(filepath.Ext(o.AuthFile))
+	}
 	authSecret := &core.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "guard-token-auth",
@@ -67,7 +73,7 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 			Labels:    d.Labels,
 		},
 		Data: map[string][]byte{
-			"token.csv": tokens,
+			key: tokens,
 		},
 	}
 	extraObjs = append(extraObjs, authSecret)
@@ -92,7 +98,7 @@ func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err erro
 
 	// use auth secret in container[0] args
 	if o.AuthFile != "" {
-		container.Args = append(container.Args, "--token-auth-file=/etc/guard/auth/token/token.csv")
+		container.Args = append(container.Args, "--token-auth-file=/etc/guard/auth/token/"+key)
 	}
 	d.Spec.Template.Spec.Containers[0] = container
 
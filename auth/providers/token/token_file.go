@@ -18,26 +18,46 @@ package token
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/csv"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
-	"sync"
+	"time"
 
 	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/reload"
 
 	"github.com/pkg/errors"
 	authv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/yaml"
 )
 
 const (
 	OrgType = "token-auth"
+
+	FileAPIVersion = "guard.kubeguard.dev/v1alpha1"
+	FileKind       = "TokenFile"
 )
 
 type Authenticator struct {
-	options  Options
-	tokenMap map[string]authv1.UserInfo
-	lock     sync.RWMutex
+	tokens *reload.File[tokenSet]
+}
+
+// tokenSet holds the entries of the token file ready to be matched
+type tokenSet struct {
+	tokens []token
+	// slow holds the bcrypt and argon2id entries by their token id
+	slow map[string]*token
+}
+
+// token is an entry of the token file ready to be matched
+type token struct {
+	matcher
+	entry Entry
 }
 
 func init() {
@@ -46,56 +66,203 @@ func init() {
 
 func New(opts Options) *Authenticator {
 	return &Authenticator{
-		options:  opts,
-		tokenMap: map[string]authv1.UserInfo{},
+		tokens: reload.NewFile("token file", func() (tokenSet, error) {
+			entries, err := LoadTokenFile(opts.AuthFile)
+			if err != nil {
+				return tokenSet{}, err
+			}
+			return newTokens(entries)
+		}, opts.AuthFile),
 	}
 }
 
+// Configure loads the token file. If the file is invalid, the previously
+// loaded tokens are kept.
 func (s *Authenticator) Configure() error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	return s.tokens.Load()
+}
 
-	data, err := LoadTokenFile(s.options.AuthFile)
-	if err != nil {
-		return err
+// Watch reloads the token file when it changes, until stopCh is closed
+func (s *Authenticator) Watch(stopCh <-chan struct{}) error {
+	return s.tokens.Watch(stopCh)
+}
+
+func newTokens(entries []Entry) (tokenSet, error) {
+	set := tokenSet{
+		tokens: make([]token, 0, len(entries)),
+		slow:   map[string]*token{},
 	}
-	s.tokenMap = data
-	return nil
+	for i, e := range entries {
+		m, err := newMatcher(e.Token)
+		if err != nil {
+			return tokenSet{}, errors.Wrapf(err, "entry #%d of token auth file", i+1)
+		}
+		set.tokens = append(set.tokens, token{matcher: m, entry: e})
+	}
+	for i := range set.tokens {
+		if set.tokens[i].verify != nil {
+			set.slow[set.tokens[i].id] = &set.tokens[i]
+		}
+	}
+	return set, nil
+}
+
+// Ready checks the token file was loaded. If a reload fails, the previous
+// tokens are kept but the authenticator is not ready until the file is fixed.
+func (s *Authenticator) Ready() error {
+	return s.tokens.Ready()
 }
 
 func (s *Authenticator) UID() string {
 	return OrgType
 }
 
-func (s *Authenticator) Check(token string) (*authv1.UserInfo, error) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+// Check looks up the token. Plain and sha256 entries are compared in constant
+// time, every entry is compared so the time does not depend on the matching
+// entry. Only if none of them matches, the bcrypt or argon2id entry with the id
+// of a token <id>.<secret> is verified, so a review runs at most one slow hash.
+func (s *Authenticator) Check(t string) (*authv1.UserInfo, error) {
+	if t == "" {
+		return nil, errors.New("Invalid token")
+	}
 
-	user, ok := s.tokenMap[token]
-	if !ok {
+	set, _ := s.tokens.Get()
+	digest := sha256.Sum256([]byte(t))
+	var found *Entry
+	for i := range set.tokens {
+		if set.tokens[i].digest != nil && subtle.ConstantTimeCompare(set.tokens[i].digest, digest[:]) == 1 {
+			found = &set.tokens[i].entry
+		}
+	}
+	if found == nil {
+		if id, secret, ok := splitToken(t); ok {
+			if slow, ok := set.slow[id]; ok && slow.verify([]byte(secret)) {
+				found = &slow.entry
+			}
+		}
+	}
+	if found == nil {
 		return nil, errors.New("Invalid token")
 	}
-	return &user, nil
+
+	now := time.Now()
+	if found.NotBefore != nil && now.Before(*found.NotBefore) {
+		return nil, auth.Reject(errors.Errorf("token is not valid before %s", found.NotBefore.Format(time.RFC3339)))
+	}
+	if found.ExpiresAt != nil && !now.Before(*found.ExpiresAt) {
+		return nil, auth.Reject(errors.Errorf("token expired at %s", found.ExpiresAt.Format(time.RFC3339)))
+	}
+	return found.UserInfo(), nil
 }
 
-// https://kubernetes.io/docs/admin/authentication/#static-token-file
-// csv token file:
-//   - four field required (format : token,user,uid,"group1,group2,group3")
-//   - groups can be empty, others cannot be empty
-//   - token should be unique
-//   - one user can have multiple token
-func LoadTokenFile(file string) (map[string]authv1.UserInfo, error) {
-	csvFile, err := os.Open(file)
+// TokenFile is the structured format of the token file, it can be written
+// in YAML or JSON,
+//
+//	apiVersion: guard.kubeguard.dev/v1alpha1
+//	kind: TokenFile
+//	tokens:
+//	- token: sha256:<hex>
+//	  username: alice
+//	  uid: "1001"
+//	  groups: [dev]
+//	  extra:
+//	    team: [platform]
+//	  expiresAt: "2027-01-01T00:00:00Z"
+type TokenFile struct {
+	APIVersion string  `json:"apiVersion"`
+	Kind       string  `json:"kind"`
+	Tokens     []Entry `json:"tokens"`
+}
+
+// Entry is a token of the token file. Token holds the plain token, its
+// sha256 hash as sha256:<hex>, or for a token <id>.<secret> the id followed by
+// a bcrypt hash or an argon2id hash in the PHC string format of the secret,
+// <id>.<hash>.
+type Entry struct {
+	Token     string              `json:"token"`
+	Username  string              `json:"username"`
+	UID       string              `json:"uid"`
+	Groups    []string            `json:"groups,omitempty"`
+	Extra     map[string][]string `json:"extra,omitempty"`
+	NotBefore *time.Time          `json:"notBefore,omitempty"`
+	ExpiresAt *time.Time          `json:"expiresAt,omitempty"`
+}
+
+func (e Entry) UserInfo() *authv1.UserInfo {
+	user := &authv1.UserInfo{
+		Username: e.Username,
+		UID:      e.UID,
+		Groups:   append([]string(nil), e.Groups...),
+	}
+	if len(e.Extra) > 0 {
+		user.Extra = map[string]authv1.ExtraValue{}
+		for k, v := range e.Extra {
+			user.Extra[k] = append(authv1.ExtraValue(nil), v...)
+		}
+	}
+	return user
+}
+
+// IsStructured returns true if the token file is in the YAML or JSON format
+// instead of csv
+func IsStructured(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// LoadTokenFile reads the entries of a csv, YAML or JSON token file, see
+// IsStructured
+func LoadTokenFile(file string) ([]Entry, error) {
+	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = csvFile.Close()
-	}()
+	if IsStructured(file) {
+		return ParseTokenFile(data)
+	}
+	return ParseTokenCSV(data)
+}
+
+func ParseTokenFile(data []byte) ([]Entry, error) {
+	f := TokenFile{}
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, errors.Wrap(err, "failed to parse token auth file")
+	}
+	if f.APIVersion != FileAPIVersion {
+		return nil, errors.Errorf("unsupported token auth file apiVersion %q, expected %s", f.APIVersion, FileAPIVersion)
+	}
+	if f.Kind != FileKind {
+		return nil, errors.Errorf("unsupported token auth file kind %q, expected %s", f.Kind, FileKind)
+	}
+
+	seen, ids := map[string]bool{}, map[string]bool{}
+	for i := range f.Tokens {
+		e := &f.Tokens[i]
+		e.Token = strings.TrimSpace(e.Token)
+		e.Username = strings.TrimSpace(e.Username)
+		e.UID = strings.TrimSpace(e.UID)
+		if err := validateEntry(*e, seen, ids); err != nil {
+			return nil, errors.Errorf("token #%d of token auth file %s", i+1, err)
+		}
+	}
+	return f.Tokens, nil
+}
 
-	reader := csv.NewReader(bufio.NewReader(csvFile))
+// https://kubernetes.io/docs/admin/authentication/#static-token-file
+// csv token file:
+//   - three to six fields (format : token,user,uid,"group1,group2,group3",notBefore,expiresAt)
+//   - groups, notBefore and expiresAt can be empty, others cannot be empty
+//   - notBefore and expiresAt are RFC 3339 timestamps
+//   - token should be unique, it can be hashed, see Entry
+//   - one user can have multiple token
+func ParseTokenCSV(data []byte) ([]Entry, error) {
+	reader := csv.NewReader(bufio.NewReader(bytes.NewReader(data)))
 	reader.FieldsPerRecord = -1
-	data := map[string]authv1.UserInfo{}
+	var entries []Entry
+	seen, ids := map[string]bool{}, map[string]bool{}
 	lineNum := 0
 	for {
 		row, err := reader.Read()
@@ -107,35 +274,73 @@ func LoadTokenFile(file string) (map[string]authv1.UserInfo, error) {
 		lineNum++
 		cols := len(row)
 
-		if cols < 3 || cols > 4 {
+		if cols < 3 || cols > 6 {
 			return nil, errors.Errorf("line #%d of token auth file is ill formatted", lineNum)
 		}
 
-		token := strings.TrimSpace(row[0])
-		if len(token) == 0 {
-			return nil, errors.Errorf("line #%d of token auth file has empty token", lineNum)
-		}
-		if _, found := data[token]; found {
-			return nil, errors.Errorf("line #%d of token auth file reuses token", lineNum)
-		}
-
-		user := authv1.UserInfo{
+		e := Entry{
+			Token:    strings.TrimSpace(row[0]),
 			Username: strings.TrimSpace(row[1]),
 			UID:      strings.TrimSpace(row[2]),
 		}
-		if user.Username == "" {
-			return nil, errors.Errorf("line #%d of token auth file has empty user name", lineNum)
+		if cols > 3 {
+			e.Groups = parseGroups(strings.TrimSpace(row[3]))
+		}
+		if cols > 4 {
+			if e.NotBefore, err = parseTime(row[4]); err != nil {
+				return nil, errors.Errorf("line #%d of token auth file has invalid notBefore: %v", lineNum, err)
+			}
+		}
+		if cols > 5 {
+			if e.ExpiresAt, err = parseTime(row[5]); err != nil {
+				return nil, errors.Errorf("line #%d of token auth file has invalid expiresAt: %v", lineNum, err)
+			}
 		}
-		if user.UID == "" {
-			return nil, errors.Errorf("line #%d of token auth file has empty uid", lineNum)
+		if err = validateEntry(e, seen, ids); err != nil {
+			return nil, errors.Errorf("line #%d of token auth file %s", lineNum, err)
 		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
 
-		if cols > 3 {
-			user.Groups = parseGroups(strings.TrimSpace(row[3]))
+func validateEntry(e Entry, seen, ids map[string]bool) error {
+	switch {
+	case e.Token == "":
+		return errors.New("has empty token")
+	case seen[e.Token]:
+		return errors.New("reuses token")
+	case e.Username == "":
+		return errors.New("has empty user name")
+	case e.UID == "":
+		return errors.New("has empty uid")
+	case e.NotBefore != nil && e.ExpiresAt != nil && !e.ExpiresAt.After(*e.NotBefore):
+		return errors.New("expires before it is valid")
+	}
+	m, err := newMatcher(e.Token)
+	if err != nil {
+		return errors.Wrap(err, "has invalid token hash")
+	}
+	if m.id != "" {
+		if ids[m.id] {
+			return errors.Errorf("reuses token id %s", m.id)
 		}
-		data[token] = user
+		ids[m.id] = true
+	}
+	seen[e.Token] = true
+	return nil
+}
+
+func parseTime(in string) (*time.Time, error) {
+	in = strings.TrimSpace(in)
+	if in == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, in)
+	if err != nil {
+		return nil, err
 	}
-	return data, nil
+	return &t, nil
 }
 
 // string format : "group1,group2,group3"
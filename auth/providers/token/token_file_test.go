@@ -18,11 +18,18 @@ package token
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	guardauth "go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/util/reload"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	auth "k8s.io/api/authentication/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
@@ -52,19 +59,41 @@ func assertUserInfo(t *testing.T, got, want auth.UserInfo) {
 	}
 }
 
-func assertLoadTokenResp(t *testing.T, got, want map[string]auth.UserInfo) {
+func assertLoadTokenResp(t *testing.T, got []Entry, want map[string]auth.UserInfo) {
 	if len(got) != len(want) {
 		t.Errorf("expected item size %v, got %v", len(want), len(got))
 	}
-	for token, user := range got {
-		if wantedUser, found := want[token]; found {
-			assertUserInfo(t, user, wantedUser)
+	for _, e := range got {
+		if wantedUser, found := want[e.Token]; found {
+			assertUserInfo(t, *e.UserInfo(), wantedUser)
 		} else {
-			t.Errorf("user not found for token %v", token)
+			t.Errorf("user not found for token %v", e.Token)
 		}
 	}
 }
 
+func newTestAuthenticator(t *testing.T, tokenMap map[string]auth.UserInfo) *Authenticator {
+	var entries []Entry
+	for token, user := range tokenMap {
+		entries = append(entries, Entry{Token: token, Username: user.Username, UID: user.UID, Groups: user.Groups})
+	}
+	tokens, err := newTokens(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newLoadedAuthenticator(t, tokens)
+}
+
+func newLoadedAuthenticator(t *testing.T, tokens tokenSet) *Authenticator {
+	srv := &Authenticator{tokens: reload.NewFile("token file", func() (tokenSet, error) {
+		return tokens, nil
+	})}
+	if err := srv.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
 func TestLoadTokenFile(t *testing.T) {
 	loadTokenTests := []struct {
 		tokens        []string
@@ -292,15 +321,13 @@ func TestCheckTokenAuth(t *testing.T) {
 		},
 	}
 
-	srv := Authenticator{
-		tokenMap: tokenMap,
-	}
+	srv := newTestAuthenticator(t, tokenMap)
 
 	for _, testData := range dataset {
 		t.Run(testData.testName, func(t *testing.T) {
 			resp, err := srv.Check(testData.token)
 
-			t.Log(srv.tokenMap)
+			t.Log(tokenMap)
 			t.Log("token :", testData.token)
 
 			if testData.authenticated {
@@ -316,3 +343,169 @@ func TestCheckTokenAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestReady(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token.csv")
+	if err := os.WriteFile(file, []byte("token1,user1,1,group1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(Options{AuthFile: file})
+	if assert.Nil(t, srv.Configure()) {
+		assert.Nil(t, srv.Ready())
+	}
+
+	// a broken file keeps the loaded tokens, but is reported
+	if err := os.WriteFile(file, []byte("token1,user1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, srv.Configure())
+	assert.NotNil(t, srv.Ready())
+	_, err := srv.Check("token1")
+	assert.Nil(t, err)
+}
+
+func TestCheckTokenValidity(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tokens, err := newTokens([]Entry{
+		{Token: "valid", Username: "user1", UID: "1", NotBefore: &past, ExpiresAt: &future},
+		{Token: "expired", Username: "user2", UID: "2", ExpiresAt: &past},
+		{Token: "future", Username: "user3", UID: "3", NotBefore: &future},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newLoadedAuthenticator(t, tokens)
+
+	resp, err := srv.Check("valid")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "user1", resp.Username)
+	}
+	for _, token := range []string{"expired", "future"} {
+		_, err = srv.Check(token)
+		if assert.NotNil(t, err) {
+			assert.True(t, guardauth.IsRejected(err))
+		}
+	}
+}
+
+// TestCheckHashedTokens checks a review runs at most one slow hash, however
+// many bcrypt and argon2id entries the file has.
+func TestCheckHashedTokens(t *testing.T) {
+	const n = 50
+	var entries []Entry
+	for i := 0; i < n; i++ {
+		hash, err := bcrypt.GenerateFromPassword([]byte(fmt.Sprintf("secret%d", i)), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, Entry{Token: fmt.Sprintf("id%04d.%s", i, hash), Username: fmt.Sprintf("user%d", i), UID: fmt.Sprint(i)})
+	}
+	entries = append(entries, Entry{Token: "plain", Username: "plain", UID: "plain"})
+	tokens, err := newTokens(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified := 0
+	for i := range tokens.tokens {
+		if verify := tokens.tokens[i].verify; verify != nil {
+			tokens.tokens[i].verify = func(secret []byte) bool {
+				verified++
+				return verify(secret)
+			}
+		}
+	}
+	srv := newLoadedAuthenticator(t, tokens)
+
+	dataset := []struct {
+		token    string
+		user     string
+		verified int
+	}{
+		{"id0042.secret42", "user42", 1},
+		{"id0042.secret41", "", 1},
+		{"id9999.secret42", "", 0},
+		{"secret42", "", 0},
+		{"plain", "plain", 0},
+	}
+	for _, testData := range dataset {
+		t.Run(testData.token, func(t *testing.T) {
+			verified = 0
+			resp, err := srv.Check(testData.token)
+			if testData.user != "" {
+				if assert.Nil(t, err) {
+					assert.Equal(t, testData.user, resp.Username)
+				}
+			} else {
+				assert.NotNil(t, err)
+			}
+			assert.Equal(t, testData.verified, verified)
+		})
+	}
+}
+
+func TestParseTokenFile(t *testing.T) {
+	data := `apiVersion: guard.kubeguard.dev/v1alpha1
+kind: TokenFile
+tokens:
+- token: token1
+  username: user1
+  uid: "1"
+  groups: [group1]
+  extra:
+    team: [platform]
+  notBefore: "2024-01-01T00:00:00Z"
+  expiresAt: "2030-01-01T00:00:00Z"
+- token: token2
+  username: user2
+  uid: "2"
+`
+	entries, err := ParseTokenFile([]byte(data))
+	if assert.Nil(t, err) && assert.Len(t, entries, 2) {
+		user := entries[0].UserInfo()
+		assert.Equal(t, auth.ExtraValue{"platform"}, user.Extra["team"])
+		assert.Equal(t, []string{"group1"}, user.Groups)
+		assert.NotNil(t, entries[0].NotBefore)
+		assert.NotNil(t, entries[0].ExpiresAt)
+		assert.Nil(t, entries[1].ExpiresAt)
+	}
+
+	testData := []struct {
+		testName string
+		data     string
+		err      string
+	}{
+		{"wrong kind", "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: Tokens\n", `unsupported token auth file kind "Tokens", expected TokenFile`},
+		{"unknown field", "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: TokenFile\ntokens:\n- token: t\n  user: u\n", ""},
+		{"empty uid", "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: TokenFile\ntokens:\n- token: t\n  username: u\n", "token #1 of token auth file has empty uid"},
+		{
+			"expires before valid",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: TokenFile\ntokens:\n- {token: t, username: u, uid: '1', notBefore: '2030-01-01T00:00:00Z', expiresAt: '2024-01-01T00:00:00Z'}\n",
+			"token #1 of token auth file expires before it is valid",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := ParseTokenFile([]byte(test.data))
+			if assert.NotNil(t, err) && test.err != "" {
+				assert.EqualError(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseTokenCSVValidity(t *testing.T) {
+	entries, err := ParseTokenCSV([]byte("token1,user1,1,group1,2024-01-01T00:00:00Z,2030-01-01T00:00:00Z\ntoken2,user2,2,,,2030-01-01T00:00:00Z\n"))
+	if assert.Nil(t, err) && assert.Len(t, entries, 2) {
+		assert.NotNil(t, entries[0].NotBefore)
+		assert.NotNil(t, entries[0].ExpiresAt)
+		assert.Nil(t, entries[1].NotBefore)
+		assert.NotNil(t, entries[1].ExpiresAt)
+	}
+
+	_, err = ParseTokenCSV([]byte("token1,user1,1,group1,yesterday"))
+	assert.NotNil(t, err)
+	_, err = ParseTokenCSV([]byte("token1,user1,1,group1,,,extra"))
+	assert.EqualError(t, err, "line #1 of token auth file is ill formatted")
+}
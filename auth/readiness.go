@@ -0,0 +1,87 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReadinessChecker is implemented by providers that can check the upstream
+// services they need to serve reviews, e.g. an LDAP server or the key set of
+// an OpenID provider
+type ReadinessChecker interface {
+	Ready(ctx context.Context) error
+}
+
+// CheckOIDCDiscovery fetches the OpenID discovery document of issuer and the
+// key set it points to
+func CheckOIDCDiscovery(ctx context.Context, client *http.Client, issuer string) error {
+	return CheckOIDCMetadata(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+}
+
+// CheckOIDCMetadata fetches an OpenID metadata document and the key set it
+// points to
+func CheckOIDCMetadata(ctx context.Context, client *http.Client, metadataURL string) error {
+	var metadata struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, client, metadataURL, &metadata); err != nil {
+		return errors.Wrap(err, "failed to get discovery document")
+	}
+	if metadata.JWKSURI == "" {
+		return errors.Errorf("discovery document %s has no jwks_uri", metadataURL)
+	}
+
+	return CheckKeySet(ctx, client, metadata.JWKSURI)
+}
+
+// CheckKeySet fetches a JSON Web Key Set and checks it holds at least one key
+func CheckKeySet(ctx context.Context, client *http.Client, jwksURL string) error {
+	var keySet struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURL, &keySet); err != nil {
+		return errors.Wrap(err, "failed to get key set")
+	}
+	if len(keySet.Keys) == 0 {
+		return errors.Errorf("key set %s is empty", jwksURL)
+	}
+	return nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("GET %s failed with status code: %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
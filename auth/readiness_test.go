@@ -0,0 +1,70 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckOIDCDiscovery(t *testing.T) {
+	testData := []struct {
+		testName    string
+		discovery   string
+		keys        string
+		keysCode    int
+		expectedErr string
+	}{
+		{"reachable", `{"jwks_uri":"%s/keys"}`, `{"keys":[{"kty":"RSA"}]}`, http.StatusOK, ""},
+		{"no jwks uri", `{}`, `{}`, http.StatusOK, "has no jwks_uri"},
+		{"keys unavailable", `{"jwks_uri":"%s/keys"}`, ``, http.StatusServiceUnavailable, "failed to get key set"},
+		{"empty key set", `{"jwks_uri":"%s/keys"}`, `{"keys":[]}`, http.StatusOK, "is empty"},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/.well-known/openid-configuration":
+					_, _ = fmt.Fprintf(w, test.discovery, srv.URL)
+				case "/keys":
+					w.WriteHeader(test.keysCode)
+					_, _ = w.Write([]byte(test.keys))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			err := CheckOIDCDiscovery(context.Background(), srv.Client(), srv.URL+"/")
+			if test.expectedErr == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), test.expectedErr)
+			}
+		})
+	}
+
+	err := CheckOIDCDiscovery(context.Background(), http.DefaultClient, "http://127.0.0.1:1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"os"
+
+	"go.kubeguard.dev/guard/util/volume"
+
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type Options struct {
+	// File holds the IdentityTransformation applied to the users returned
+	// by the authentication providers, optional
+	File string
+}
+
+func NewOptions() Options {
+	return Options{}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.File, "identity-transform-file", o.File, "Path to the IdentityTransformation file with the rules applied to usernames and groups returned by each authentication provider, it is reloaded when changed")
+}
+
+func (o Options) Enabled() bool {
+	return o.File != ""
+}
+
+func (o Options) load() (map[string]*providerRules, error) {
+	t, err := LoadFile(o.File)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(t)
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	if !o.Enabled() {
+		return nil, nil
+	}
+
+	if _, err = o.load(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(o.File)
+	if err != nil {
+		return nil, err
+	}
+	cm := volume.MountConfigMap(d, "guard-identity-transform", "/etc/guard/transform", map[string]string{
+		"transform.yaml": string(data),
+	})
+	extraObjs = append(extraObjs, cm)
+
+	container := &d.Spec.Template.Spec.Containers[0]
+	container.Args = append(container.Args, "--identity-transform-file=/etc/guard/transform/transform.yaml")
+	return extraObjs, nil
+}
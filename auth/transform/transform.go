@@ -0,0 +1,294 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.kubeguard.dev/guard/util/reload"
+
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	APIVersion = "guard.kubeguard.dev/v1alpha1"
+	Kind       = "IdentityTransformation"
+
+	// AnyProvider holds the rules of providers without rules of their own
+	AnyProvider = "*"
+)
+
+// IdentityTransformation holds the rules applied to the username and groups
+// returned by each authentication provider, keyed by provider name,
+//
+//	apiVersion: guard.kubeguard.dev/v1alpha1
+//	kind: IdentityTransformation
+//	providers:
+//	  github:
+//	    username:
+//	      prefix: "github:"
+//	    groups:
+//	      lowercase: true
+//	      drop: ["^everyone$"]
+//	      prefix: "github:"
+//	      add: [github-users]
+type IdentityTransformation struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Providers  map[string]ProviderRules `json:"providers"`
+}
+
+type ProviderRules struct {
+	Username NameRules  `json:"username,omitempty"`
+	Groups   GroupRules `json:"groups,omitempty"`
+}
+
+// NameRules are applied in the order lowercase, rewrite, prefix
+type NameRules struct {
+	Lowercase bool      `json:"lowercase,omitempty"`
+	Rewrite   []Rewrite `json:"rewrite,omitempty"`
+	Prefix    string    `json:"prefix,omitempty"`
+}
+
+// Rewrite replaces the matches of a regular expression, Replace can refer to
+// submatches as $1
+type Rewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// GroupRules filter the groups after they are lowercased and rewritten, but
+// before the prefix is added. A group is kept if it matches a regular
+// expression of Allow, or Allow is empty, and matches none of Drop. Groups
+// rewritten to an empty name are dropped. Add lists groups added as is.
+type GroupRules struct {
+	NameRules `json:",inline"`
+	Allow     []string `json:"allow,omitempty"`
+	Drop      []string `json:"drop,omitempty"`
+	Add       []string `json:"add,omitempty"`
+}
+
+func LoadFile(file string) (*IdentityTransformation, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read identity transformation file %s", file)
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*IdentityTransformation, error) {
+	t := &IdentityTransformation{}
+	if err := yaml.UnmarshalStrict(data, t); err != nil {
+		return nil, errors.Wrap(err, "failed to parse identity transformation")
+	}
+	if t.APIVersion != APIVersion {
+		return nil, errors.Errorf("unsupported identity transformation apiVersion %q, expected %s", t.APIVersion, APIVersion)
+	}
+	if t.Kind != Kind {
+		return nil, errors.Errorf("unsupported identity transformation kind %q, expected %s", t.Kind, Kind)
+	}
+	return t, nil
+}
+
+type rewrite struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+type nameRules struct {
+	lowercase bool
+	rewrite   []rewrite
+	prefix    string
+}
+
+type providerRules struct {
+	username nameRules
+	groups   nameRules
+	allow    []*regexp.Regexp
+	drop     []*regexp.Regexp
+	add      []string
+}
+
+// Compile checks the regular expressions of the rules
+func Compile(t *IdentityTransformation) (map[string]*providerRules, error) {
+	rules := map[string]*providerRules{}
+	for name, p := range t.Providers {
+		name = strings.ToLower(name)
+		if _, ok := rules[name]; ok {
+			return nil, errors.Errorf("identity transformation for provider %s is defined more than once", name)
+		}
+
+		r := &providerRules{add: p.Groups.Add}
+		var err error
+		if r.username, err = compileNameRules(p.Username); err != nil {
+			return nil, errors.Wrapf(err, "invalid username rule for provider %s", name)
+		}
+		if r.groups, err = compileNameRules(p.Groups.NameRules); err != nil {
+			return nil, errors.Wrapf(err, "invalid group rule for provider %s", name)
+		}
+		if r.allow, err = compileRegexps(p.Groups.Allow); err != nil {
+			return nil, errors.Wrapf(err, "invalid group allow rule for provider %s", name)
+		}
+		if r.drop, err = compileRegexps(p.Groups.Drop); err != nil {
+			return nil, errors.Wrapf(err, "invalid group drop rule for provider %s", name)
+		}
+		rules[name] = r
+	}
+	return rules, nil
+}
+
+func compileNameRules(in NameRules) (nameRules, error) {
+	out := nameRules{lowercase: in.Lowercase, prefix: in.Prefix}
+	for _, rw := range in.Rewrite {
+		re, err := regexp.Compile(rw.Match)
+		if err != nil {
+			return out, err
+		}
+		out.rewrite = append(out.rewrite, rewrite{re: re, replace: rw.Replace})
+	}
+	return out, nil
+}
+
+func compileRegexps(in []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(in))
+	for _, s := range in {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func (r nameRules) apply(name string) string {
+	if r.lowercase {
+		name = strings.ToLower(name)
+	}
+	for _, rw := range r.rewrite {
+		name = rw.re.ReplaceAllString(name, rw.replace)
+	}
+	return name
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// transform returns a copy of user with the rules applied
+func (r *providerRules) transform(user *authv1.UserInfo) (*authv1.UserInfo, error) {
+	out := user.DeepCopy()
+
+	name := r.username.apply(user.Username)
+	if name == "" {
+		return nil, errors.Errorf("username %s is empty after identity transformation", user.Username)
+	}
+	out.Username = r.username.prefix + name
+
+	seen := map[string]bool{}
+	out.Groups = nil
+	for _, g := range user.Groups {
+		g = r.groups.apply(g)
+		if g == "" {
+			continue
+		}
+		if len(r.allow) > 0 && !matchAny(r.allow, g) {
+			continue
+		}
+		if matchAny(r.drop, g) {
+			continue
+		}
+		g = r.groups.prefix + g
+		if !seen[g] {
+			seen[g] = true
+			out.Groups = append(out.Groups, g)
+		}
+	}
+	for _, g := range r.add {
+		if !seen[g] {
+			seen[g] = true
+			out.Groups = append(out.Groups, g)
+		}
+	}
+	return out, nil
+}
+
+// Transformer applies the rules of an identity transformation file to the
+// users returned by the authentication providers. The file is reloaded when
+// it changes.
+type Transformer struct {
+	rules *reload.File[map[string]*providerRules]
+}
+
+func New(opts Options) *Transformer {
+	return &Transformer{
+		rules: reload.NewFile("identity transformation file", opts.load, opts.File),
+	}
+}
+
+// Configure loads the identity transformation file. If the file is invalid,
+// the previously loaded rules are kept.
+func (t *Transformer) Configure() error {
+	return t.rules.Load()
+}
+
+// Watch reloads the identity transformation file when it changes, until
+// stopCh is closed
+func (t *Transformer) Watch(stopCh <-chan struct{}) error {
+	return t.rules.Watch(stopCh)
+}
+
+// Providers returns the names of the providers with rules, sorted
+func (t *Transformer) Providers() []string {
+	rules, _ := t.rules.Get()
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Transform applies the rules of provider to user. Users of providers
+// without rules are returned unchanged, unless rules for all providers are
+// defined.
+func (t *Transformer) Transform(provider string, user *authv1.UserInfo) (*authv1.UserInfo, error) {
+	if user == nil {
+		return nil, nil
+	}
+
+	rules, _ := t.rules.Get()
+	r, ok := rules[strings.ToLower(provider)]
+	if !ok {
+		r, ok = rules[AnyProvider]
+	}
+
+	if !ok {
+		return user, nil
+	}
+	return r.transform(user)
+}
@@ -0,0 +1,220 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.kubeguard.dev/guard/util/reload"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const testTransformation = `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: IdentityTransformation
+providers:
+  github:
+    username:
+      prefix: "github:"
+    groups:
+      prefix: "github:"
+      lowercase: true
+      drop: ["^everyone$"]
+      add: [github-users]
+  gitlab:
+    groups:
+      rewrite:
+      - match: "/"
+        replace: ":"
+      allow: ["^platform:"]
+  google:
+    username:
+      rewrite:
+      - match: "^(.+)@example\\.com$"
+        replace: "$1"
+    groups:
+      rewrite:
+      - match: "^(.+)@example\\.com$"
+        replace: "$1"
+      - match: "^.+@.+$"
+        replace: ""
+  ldap:
+    username:
+      lowercase: true
+      rewrite:
+      - match: "^.*$"
+        replace: ""
+  "*":
+    groups:
+      add: [authenticated-by-guard]
+`
+
+func newTestTransformer(t *testing.T, rules map[string]*providerRules) *Transformer {
+	tr := &Transformer{rules: reload.NewFile("identity transformation file", func() (map[string]*providerRules, error) {
+		return rules, nil
+	})}
+	if err := tr.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestTransform(t *testing.T) {
+	p, err := Parse([]byte(testTransformation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Compile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newTestTransformer(t, rules)
+
+	testData := []struct {
+		testName     string
+		provider     string
+		user         *authv1.UserInfo
+		expectedUser *authv1.UserInfo
+		expectedErr  string
+	}{
+		{
+			"prefix, lowercase, drop and add",
+			"github",
+			&authv1.UserInfo{Username: "nahid", UID: "1", Groups: []string{"Dev", "everyone", "dev"}},
+			&authv1.UserInfo{Username: "github:nahid", UID: "1", Groups: []string{"github:dev", "github-users"}},
+			"",
+		},
+		{
+			"provider name is case insensitive",
+			"GitHub",
+			&authv1.UserInfo{Username: "nahid"},
+			&authv1.UserInfo{Username: "github:nahid", Groups: []string{"github-users"}},
+			"",
+		},
+		{
+			"rewrite and allow list",
+			"gitlab",
+			&authv1.UserInfo{Username: "nahid", Groups: []string{"platform/infra", "platform/infra/oncall", "marketing"}},
+			&authv1.UserInfo{Username: "nahid", Groups: []string{"platform:infra", "platform:infra:oncall"}},
+			"",
+		},
+		{
+			"rewrite to empty drops group",
+			"google",
+			&authv1.UserInfo{Username: "nahid@example.com", Groups: []string{"dev@example.com", "dev@partner.com"}},
+			&authv1.UserInfo{Username: "nahid", Groups: []string{"dev"}},
+			"",
+		},
+		{
+			"rules for all providers",
+			"oidc",
+			&authv1.UserInfo{Username: "nahid", Groups: []string{"dev"}, Extra: map[string]authv1.ExtraValue{"iss": {"https://issuer"}}},
+			&authv1.UserInfo{Username: "nahid", Groups: []string{"dev", "authenticated-by-guard"}, Extra: map[string]authv1.ExtraValue{"iss": {"https://issuer"}}},
+			"",
+		},
+		{
+			"empty username",
+			"ldap",
+			&authv1.UserInfo{Username: "Nahid"},
+			nil,
+			"username Nahid is empty after identity transformation",
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			orig := test.user.DeepCopy()
+			resp, err := tr.Transform(test.provider, test.user)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Nil(t, resp)
+			} else if assert.Nil(t, err) {
+				assert.Equal(t, test.expectedUser, resp)
+			}
+			assert.Equal(t, orig, test.user, "user must not be modified")
+		})
+	}
+}
+
+func TestTransformWithoutRules(t *testing.T) {
+	tr := newTestTransformer(t, map[string]*providerRules{})
+	user := &authv1.UserInfo{Username: "nahid", Groups: []string{"Dev"}}
+	resp, err := tr.Transform("github", user)
+	if assert.Nil(t, err) {
+		assert.Equal(t, user, resp)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testData := []struct {
+		testName    string
+		data        string
+		expectedErr string
+	}{
+		{
+			"wrong kind",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuthorizationPolicy\n",
+			`unsupported identity transformation kind "AuthorizationPolicy", expected IdentityTransformation`,
+		},
+		{
+			"invalid regexp",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: IdentityTransformation\nproviders:\n  github:\n    groups:\n      drop: [\"(\"]\n",
+			"invalid group drop rule for provider github: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			"provider defined twice",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: IdentityTransformation\nproviders:\n  github: {}\n  GitHub: {}\n",
+			"identity transformation for provider github is defined more than once",
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			p, err := Parse([]byte(test.data))
+			if err == nil {
+				_, err = Compile(p)
+			}
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestTransformerReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transform.yaml")
+	if err := os.WriteFile(file, []byte(testTransformation), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tr := New(Options{File: file})
+	if !assert.Nil(t, tr.Configure()) {
+		return
+	}
+	assert.Equal(t, []string{"*", "github", "gitlab", "google", "ldap"}, tr.Providers())
+
+	// an invalid file keeps the previous rules
+	if err := os.WriteFile(file, []byte("kind: IdentityTransformation\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, tr.Configure())
+	resp, err := tr.Transform("github", &authv1.UserInfo{Username: "nahid"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "github:nahid", resp.Username)
+	}
+}
@@ -137,8 +137,20 @@ func newAuthzClient(opts authzOpts.Options, authopts auth.Options) (authz.Interf
 	return c, nil
 }
 
+// Ready checks a token for Azure RBAC can be acquired. The token is kept for
+// the following access checks.
+func (s Authorizer) Ready(ctx context.Context) error {
+	ctx = azureutils.WithRetryableHttpClient(ctx, s.httpClientRetryCount)
+	return s.rbacClient.RefreshToken(ctx)
+}
+
 func (s Authorizer) Check(ctx context.Context, request *authzv1.SubjectAccessReviewSpec, store authz.Store) (*authzv1.SubjectAccessReviewStatus, error) {
-	requestID := uuid.New().String()
+	// keep the request ID assigned by the server, so the decision can be
+	// correlated with the audit log
+	requestID := azureutils.GetRequestID(ctx)
+	if requestID == "unknown" {
+		requestID = uuid.New().String()
+	}
 
 	log := klog.FromContext(ctx).WithValues("requestID", requestID)
 	ctx = klog.NewContext(ctx, log)
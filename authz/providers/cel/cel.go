@@ -0,0 +1,278 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.kubeguard.dev/guard/authz"
+	"go.kubeguard.dev/guard/authz/providers/policy"
+	"go.kubeguard.dev/guard/util/reload"
+
+	"github.com/google/cel-go/cel"
+	"github.com/pkg/errors"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OrgType = "cel"
+
+	PolicyKind = "CELAuthorizationPolicy"
+)
+
+func init() {
+	authz.SupportedOrgs = append(authz.SupportedOrgs, OrgType)
+}
+
+// Policy decides a SubjectAccessReview with the first rule whose expression
+// evaluates to true, so rules listed earlier take precedence. Requests
+// matching no rule get no opinion.
+type Policy struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Rules      []Rule `json:"rules"`
+}
+
+// Rule is a CEL expression evaluating to a bool. The expression can use
+//
+//	request                map with user, uid, groups and extra of the subject
+//	user, groups, extra    shorthands for the fields of request
+//	resourceAttributes     map with namespace, verb, group, version, resource,
+//	                       subresource and name, null for non-resource requests
+//	nonResourceAttributes  map with path and verb, null for resource requests
+//	verb                   verb of the resource or non-resource request
+//
+// namespace is a reserved word in CEL, so the namespace is only available as
+// resourceAttributes.namespace.
+type Rule struct {
+	Name       string        `json:"name"`
+	Effect     policy.Effect `json:"effect"`
+	Expression string        `json:"expression"`
+}
+
+func LoadPolicyFile(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cel authorization policy file %s", file)
+	}
+	return ParsePolicy(data)
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, errors.Wrap(err, "failed to parse cel authorization policy")
+	}
+	if p.APIVersion != policy.PolicyAPIVersion {
+		return nil, errors.Errorf("unsupported cel authorization policy apiVersion %q, expected %s", p.APIVersion, policy.PolicyAPIVersion)
+	}
+	if p.Kind != PolicyKind {
+		return nil, errors.Errorf("unsupported cel authorization policy kind %q, expected %s", p.Kind, PolicyKind)
+	}
+	return p, nil
+}
+
+type compiledRule struct {
+	Rule
+	program cel.Program
+}
+
+// Compile type checks the expressions of the policy. Each expression is
+// aborted once its evaluation exceeds costLimit.
+func Compile(p *Policy, costLimit uint64) ([]compiledRule, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cel environment")
+	}
+
+	names := map[string]bool{}
+	rules := make([]compiledRule, 0, len(p.Rules))
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return nil, errors.Errorf("cel rule #%d must have a name", i+1)
+		}
+		if names[r.Name] {
+			return nil, errors.Errorf("cel rule %q is defined more than once", r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Effect {
+		case policy.EffectAllow, policy.EffectDeny, policy.EffectNoOpinion:
+		default:
+			return nil, errors.Errorf("cel rule %q has unknown effect %q, must be one of Allow, Deny or NoOpinion", r.Name, r.Effect)
+		}
+
+		ast, iss := env.Compile(r.Expression)
+		if iss.Err() != nil {
+			return nil, errors.Errorf("failed to compile cel rule %q: %v", r.Name, iss.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, errors.Errorf("cel rule %q must evaluate to bool, got %s", r.Name, ast.OutputType())
+		}
+		prg, err := env.Program(ast,
+			cel.CostLimit(costLimit),
+			cel.EvalOptions(cel.OptTrackCost),
+			cel.InterruptCheckFrequency(100),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create program for cel rule %q", r.Name)
+		}
+		rules = append(rules, compiledRule{Rule: r, program: prg})
+	}
+	return rules, nil
+}
+
+func newEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("user", cel.StringType),
+		cel.Variable("groups", cel.ListType(cel.StringType)),
+		cel.Variable("extra", cel.MapType(cel.StringType, cel.ListType(cel.StringType))),
+		cel.Variable("resourceAttributes", cel.DynType),
+		cel.Variable("nonResourceAttributes", cel.DynType),
+		cel.Variable("verb", cel.StringType),
+	)
+}
+
+func activation(req *authzv1.SubjectAccessReviewSpec) map[string]interface{} {
+	groups := []string{}
+	groups = append(groups, req.Groups...)
+	extra := map[string][]string{}
+	for k, v := range req.Extra {
+		extra[k] = v
+	}
+
+	vars := map[string]interface{}{
+		"request": map[string]interface{}{
+			"user":   req.User,
+			"uid":    req.UID,
+			"groups": groups,
+			"extra":  extra,
+		},
+		"user":                  req.User,
+		"groups":                groups,
+		"extra":                 extra,
+		"resourceAttributes":    nil,
+		"nonResourceAttributes": nil,
+		"verb":                  "",
+	}
+	if attrs := req.ResourceAttributes; attrs != nil {
+		vars["resourceAttributes"] = map[string]interface{}{
+			"namespace":   attrs.Namespace,
+			"verb":        attrs.Verb,
+			"group":       attrs.Group,
+			"version":     attrs.Version,
+			"resource":    attrs.Resource,
+			"subresource": attrs.Subresource,
+			"name":        attrs.Name,
+		}
+		vars["verb"] = attrs.Verb
+	}
+	if attrs := req.NonResourceAttributes; attrs != nil {
+		vars["nonResourceAttributes"] = map[string]interface{}{
+			"path": attrs.Path,
+			"verb": attrs.Verb,
+		}
+		vars["verb"] = attrs.Verb
+	}
+	return vars
+}
+
+// decide evaluates the rules in order. An expression failing to evaluate
+// fails the review, so a broken deny rule never falls through to an allow
+// rule.
+func decide(ctx context.Context, rules []compiledRule, req *authzv1.SubjectAccessReviewSpec) (*authzv1.SubjectAccessReviewStatus, error) {
+	vars := activation(req)
+	for _, r := range rules {
+		start := time.Now()
+		out, det, err := r.program.ContextEval(ctx, vars)
+		ruleDuration.WithLabelValues(r.Name).Observe(time.Since(start).Seconds())
+		if det != nil && det.ActualCost() != nil {
+			ruleCost.WithLabelValues(r.Name).Observe(float64(*det.ActualCost()))
+		}
+		if err != nil {
+			ruleEvaluations.WithLabelValues(r.Name, resultError).Inc()
+			return nil, errors.Wrapf(err, "failed to evaluate cel rule %q", r.Name)
+		}
+		matched, ok := out.Value().(bool)
+		if !ok {
+			ruleEvaluations.WithLabelValues(r.Name, resultError).Inc()
+			return nil, errors.Errorf("cel rule %q evaluated to %v instead of bool", r.Name, out)
+		}
+		if !matched {
+			ruleEvaluations.WithLabelValues(r.Name, resultNoMatch).Inc()
+			continue
+		}
+		ruleEvaluations.WithLabelValues(r.Name, resultMatch).Inc()
+
+		reason := fmt.Sprintf("%s by cel rule %q", strings.ToLower(string(r.Effect)), r.Name)
+		switch r.Effect {
+		case policy.EffectAllow:
+			return &authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: reason}, nil
+		case policy.EffectDeny:
+			return &authzv1.SubjectAccessReviewStatus{Denied: true, Reason: reason}, nil
+		default:
+			return &authzv1.SubjectAccessReviewStatus{Reason: fmt.Sprintf("no opinion by cel rule %q", r.Name)}, nil
+		}
+	}
+	return &authzv1.SubjectAccessReviewStatus{Reason: "no cel rule matched"}, nil
+}
+
+// Authorizer evaluates SubjectAccessReviews against the CEL rules of a policy
+// file, which is reloaded when the file changes
+type Authorizer struct {
+	rules *reload.File[[]compiledRule]
+}
+
+func New(opts Options) *Authorizer {
+	return &Authorizer{
+		rules: reload.NewFile("cel authorization policy file", opts.load, opts.PolicyFile),
+	}
+}
+
+// Configure loads and compiles the policy file. If the file is invalid, the
+// previously loaded rules are kept.
+func (a *Authorizer) Configure() error {
+	return a.rules.Load()
+}
+
+// Watch reloads the policy file when it changes, until stopCh is closed
+func (a *Authorizer) Watch(stopCh <-chan struct{}) error {
+	return a.rules.Watch(stopCh)
+}
+
+// Ready checks the policy file was loaded
+func (a *Authorizer) Ready(_ context.Context) error {
+	return a.rules.Ready()
+}
+
+func (a *Authorizer) Check(ctx context.Context, request *authzv1.SubjectAccessReviewSpec, _ authz.Store) (*authzv1.SubjectAccessReviewStatus, error) {
+	if request == nil {
+		return nil, errors.New("subject access review is nil")
+	}
+
+	rules, loaded := a.rules.Get()
+	if !loaded {
+		return nil, errors.New("cel authorization policy is not loaded")
+	}
+	return decide(ctx, rules, request)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cel
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	authzv1 "k8s.io/api/authorization/v1"
+)
+
+const testPolicy = `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: CELAuthorizationPolicy
+rules:
+- name: oncall-delete-pods
+  effect: Allow
+  expression: |
+    verb == 'delete' && resourceAttributes.resource == 'pods' &&
+    'oncall' in groups && resourceAttributes.namespace.startsWith('team-')
+- name: no-delete
+  effect: Deny
+  expression: verb == 'delete'
+- name: own-namespace
+  effect: Allow
+  expression: resourceAttributes != null && resourceAttributes.namespace == 'user-' + request.user
+- name: scoped-extra
+  effect: NoOpinion
+  expression: "'scopes' in extra && 'read' in extra['scopes']"
+- name: metrics
+  effect: Allow
+  expression: nonResourceAttributes != null && nonResourceAttributes.path == '/metrics'
+`
+
+func compileTestPolicy(t *testing.T, data string, costLimit uint64) []compiledRule {
+	p, err := ParsePolicy([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Compile(p, costLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func resourceRequest(user string, groups []string, attrs authzv1.ResourceAttributes) *authzv1.SubjectAccessReviewSpec {
+	return &authzv1.SubjectAccessReviewSpec{User: user, Groups: groups, ResourceAttributes: &attrs}
+}
+
+func TestDecide(t *testing.T) {
+	rules := compileTestPolicy(t, testPolicy, DefaultCostLimit)
+
+	testData := []struct {
+		testName string
+		request  *authzv1.SubjectAccessReviewSpec
+		expected authzv1.SubjectAccessReviewStatus
+	}{
+		{
+			"oncall deletes pods",
+			resourceRequest("nahid", []string{"oncall"}, authzv1.ResourceAttributes{Verb: "delete", Namespace: "team-a", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by cel rule "oncall-delete-pods"`},
+		},
+		{
+			"oncall outside team namespace",
+			resourceRequest("nahid", []string{"oncall"}, authzv1.ResourceAttributes{Verb: "delete", Namespace: "kube-system", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Denied: true, Reason: `deny by cel rule "no-delete"`},
+		},
+		{
+			"not oncall",
+			resourceRequest("nahid", []string{"dev"}, authzv1.ResourceAttributes{Verb: "delete", Namespace: "team-a", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Denied: true, Reason: `deny by cel rule "no-delete"`},
+		},
+		{
+			"own namespace",
+			resourceRequest("nahid", nil, authzv1.ResourceAttributes{Verb: "get", Namespace: "user-nahid", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by cel rule "own-namespace"`},
+		},
+		{
+			"extra",
+			&authzv1.SubjectAccessReviewSpec{
+				User:                  "nahid",
+				Extra:                 map[string]authzv1.ExtraValue{"scopes": {"read"}},
+				NonResourceAttributes: &authzv1.NonResourceAttributes{Verb: "get", Path: "/metrics"},
+			},
+			authzv1.SubjectAccessReviewStatus{Reason: `no opinion by cel rule "scoped-extra"`},
+		},
+		{
+			"non-resource url",
+			&authzv1.SubjectAccessReviewSpec{User: "nahid", NonResourceAttributes: &authzv1.NonResourceAttributes{Verb: "get", Path: "/metrics"}},
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by cel rule "metrics"`},
+		},
+		{
+			"no match",
+			resourceRequest("nahid", nil, authzv1.ResourceAttributes{Verb: "get", Namespace: "default", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Reason: "no cel rule matched"},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			resp, err := decide(context.Background(), rules, test.request)
+			if assert.Nil(t, err) {
+				assert.Equal(t, test.expected, *resp)
+			}
+		})
+	}
+}
+
+func TestDecideErrors(t *testing.T) {
+	// a rule failing to evaluate fails the review instead of falling through
+	rules := compileTestPolicy(t, `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: CELAuthorizationPolicy
+rules:
+- name: broken
+  effect: Deny
+  expression: resourceAttributes.resource == 'secrets'
+- name: allow-all
+  effect: Allow
+  expression: "true"
+`, DefaultCostLimit)
+	_, err := decide(context.Background(), rules, &authzv1.SubjectAccessReviewSpec{User: "nahid", NonResourceAttributes: &authzv1.NonResourceAttributes{Verb: "get", Path: "/"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, float64(1), evaluations(t, "broken", resultError))
+	assert.Equal(t, float64(0), evaluations(t, "allow-all", resultMatch))
+
+	// expressions exceeding the cost limit are aborted
+	rules = compileTestPolicy(t, `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: CELAuthorizationPolicy
+rules:
+- name: expensive
+  effect: Allow
+  expression: groups.all(a, groups.all(b, groups.all(c, a + b + c != '')))
+`, 100)
+	_, err = decide(context.Background(), rules, &authzv1.SubjectAccessReviewSpec{User: "nahid", Groups: []string{"a", "b", "c", "d", "e", "f", "g", "h"}})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "cost limit exceeded")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	testData := []struct {
+		testName    string
+		rules       string
+		expectedErr string
+	}{
+		{
+			"missing name",
+			"- effect: Allow\n  expression: 'true'\n",
+			"cel rule #1 must have a name",
+		},
+		{
+			"duplicate name",
+			"- name: a\n  effect: Allow\n  expression: 'true'\n- name: a\n  effect: Deny\n  expression: 'true'\n",
+			`cel rule "a" is defined more than once`,
+		},
+		{
+			"unknown effect",
+			"- name: a\n  effect: allow\n  expression: 'true'\n",
+			`cel rule "a" has unknown effect "allow", must be one of Allow, Deny or NoOpinion`,
+		},
+		{
+			"not bool",
+			"- name: a\n  effect: Allow\n  expression: user\n",
+			`cel rule "a" must evaluate to bool, got string`,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			p, err := ParsePolicy([]byte("apiVersion: guard.kubeguard.dev/v1alpha1\nkind: CELAuthorizationPolicy\nrules:\n" + test.rules))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Compile(p, DefaultCostLimit)
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+
+	p, err := ParsePolicy([]byte("apiVersion: guard.kubeguard.dev/v1alpha1\nkind: CELAuthorizationPolicy\nrules:\n- name: a\n  effect: Allow\n  expression: usr == 'nahid'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compile(p, DefaultCostLimit)
+	if assert.NotNil(t, err, "undeclared variables must be rejected") {
+		assert.Contains(t, err.Error(), `failed to compile cel rule "a"`)
+	}
+}
+
+func TestAuthorizerReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a := New(Options{PolicyFile: file, CostLimit: DefaultCostLimit})
+	if !assert.Nil(t, a.Configure()) {
+		return
+	}
+	assert.Nil(t, a.Ready(context.Background()))
+
+	req := resourceRequest("nahid", nil, authzv1.ResourceAttributes{Verb: "get", Namespace: "user-nahid", Resource: "pods"})
+	resp, err := a.Check(context.Background(), req, nil)
+	if assert.Nil(t, err) {
+		assert.True(t, resp.Allowed)
+	}
+
+	// a rule failing to compile keeps the previous rules
+	if err = os.WriteFile(file, []byte("apiVersion: guard.kubeguard.dev/v1alpha1\nkind: CELAuthorizationPolicy\nrules:\n- name: a\n  effect: Deny\n  expression: user ==\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, a.Configure())
+	assert.NotNil(t, a.Ready(context.Background()))
+	resp, err = a.Check(context.Background(), req, nil)
+	if assert.Nil(t, err) {
+		assert.True(t, resp.Allowed)
+	}
+
+	// an empty rule list is valid
+	if err = os.WriteFile(file, []byte("apiVersion: guard.kubeguard.dev/v1alpha1\nkind: CELAuthorizationPolicy\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a.Configure())
+	resp, err = a.Check(context.Background(), req, nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "no cel rule matched", resp.Reason)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	opts := NewOptions()
+	assert.NotNil(t, opts.Validate())
+	opts.PolicyFile = "/etc/guard/authz/cel/policy.yaml"
+	assert.Nil(t, opts.Validate())
+	opts.CostLimit = 0
+	assert.NotNil(t, opts.Validate())
+}
+
+func evaluations(t *testing.T, rule, result string) float64 {
+	out := &dto.Metric{}
+	if err := ruleEvaluations.WithLabelValues(rule, result).Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out.GetCounter().GetValue()
+}
@@ -0,0 +1,48 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cel
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	resultMatch   = "match"
+	resultNoMatch = "no_match"
+	resultError   = "error"
+)
+
+var (
+	ruleEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_authz_cel_rule_evaluations_total",
+		Help: "Total number of evaluations of cel authorization rules by rule and result",
+	}, []string{"rule", "result"})
+	ruleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "guard_authz_cel_rule_evaluation_duration_seconds",
+		Help:    "Latency of evaluating cel authorization rules by rule",
+		Buckets: []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05},
+	}, []string{"rule"})
+	ruleCost = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "guard_authz_cel_rule_cost",
+		Help:    "Cost of evaluating cel authorization rules by rule",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"rule"})
+)
+
+func init() {
+	prometheus.MustRegister(ruleEvaluations, ruleDuration, ruleCost)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cel
+
+import (
+	"fmt"
+	"os"
+
+	"go.kubeguard.dev/guard/util/volume"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultCostLimit is the cost limit per expression used by the Kubernetes
+// api server for CEL expressions
+const DefaultCostLimit = 1000000
+
+type Options struct {
+	PolicyFile string
+	CostLimit  uint64
+}
+
+func NewOptions() Options {
+	return Options{
+		CostLimit: DefaultCostLimit,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.PolicyFile, "cel.file", o.PolicyFile, "Path to the policy file with the CEL rules evaluated by the cel authorization provider, it is reloaded when changed")
+	fs.Uint64Var(&o.CostLimit, "cel.cost-limit", o.CostLimit, "Maximum cost of evaluating a single CEL rule, a rule exceeding it fails the review")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if o.PolicyFile == "" {
+		errs = append(errs, errors.New("cel.file must be non-empty"))
+	}
+	if o.CostLimit == 0 {
+		errs = append(errs, errors.New("cel.cost-limit must be positive"))
+	}
+	return errs
+}
+
+func (o Options) load() ([]compiledRule, error) {
+	p, err := LoadPolicyFile(o.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(p, o.CostLimit)
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	if _, err = o.load(); err != nil {
+		return nil, err
+	}
+	policy, err := os.ReadFile(o.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	cm := volume.MountConfigMap(d, "guard-authz-cel", "/etc/guard/authz/cel", map[string]string{
+		"policy.yaml": string(policy),
+	})
+	extraObjs = append(extraObjs, cm)
+
+	container := &d.Spec.Template.Spec.Containers[0]
+	container.Args = append(container.Args, "--cel.file=/etc/guard/authz/cel/policy.yaml")
+	if o.CostLimit != DefaultCostLimit {
+		container.Args = append(container.Args, fmt.Sprintf("--cel.cost-limit=%d", o.CostLimit))
+	}
+	return extraObjs, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"os"
+
+	"go.kubeguard.dev/guard/util/volume"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type Options struct {
+	PolicyFile string
+}
+
+func NewOptions() Options {
+	return Options{}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.PolicyFile, "policy.file", o.PolicyFile, "Path to the authorization policy file evaluated by the policy authorization provider, it is reloaded when changed")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if o.PolicyFile == "" {
+		errs = append(errs, errors.New("policy.file must be non-empty"))
+	}
+	return errs
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	if _, err = LoadPolicyFile(o.PolicyFile); err != nil {
+		return nil, err
+	}
+	policy, err := os.ReadFile(o.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	cm := volume.MountConfigMap(d, "guard-authz-policy", "/etc/guard/authz/policy", map[string]string{
+		"policy.yaml": string(policy),
+	})
+	extraObjs = append(extraObjs, cm)
+
+	container := &d.Spec.Template.Spec.Containers[0]
+	container.Args = append(container.Args, "--policy.file=/etc/guard/authz/policy/policy.yaml")
+	return extraObjs, nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.kubeguard.dev/guard/authz"
+	"go.kubeguard.dev/guard/util/reload"
+
+	"github.com/pkg/errors"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OrgType = "policy"
+
+	PolicyAPIVersion = "guard.kubeguard.dev/v1alpha1"
+	PolicyKind       = "AuthorizationPolicy"
+)
+
+func init() {
+	authz.SupportedOrgs = append(authz.SupportedOrgs, OrgType)
+}
+
+type Effect string
+
+const (
+	EffectAllow     Effect = "Allow"
+	EffectDeny      Effect = "Deny"
+	EffectNoOpinion Effect = "NoOpinion"
+)
+
+// Policy decides a SubjectAccessReview with the first matching rule, so
+// rules listed earlier take precedence. Requests matching no rule get no
+// opinion.
+type Policy struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Rules      []Rule `json:"rules"`
+}
+
+// Rule matches requests by all of its non-empty fields. A `*` entry matches
+// everything, users, groups and non-resource URLs ending with `*` match by
+// prefix. Rules with resource fields only match resource requests and rules
+// with non-resource URLs only match non-resource requests. Subresources must
+// be listed to be matched, an empty list only matches the resource itself.
+type Rule struct {
+	Name   string `json:"name,omitempty"`
+	Effect Effect `json:"effect"`
+
+	Users  []string `json:"users,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+
+	Namespaces   []string `json:"namespaces,omitempty"`
+	APIGroups    []string `json:"apiGroups,omitempty"`
+	Resources    []string `json:"resources,omitempty"`
+	Subresources []string `json:"subresources,omitempty"`
+	Verbs        []string `json:"verbs,omitempty"`
+
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+}
+
+func LoadPolicyFile(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read authorization policy file %s", file)
+	}
+	return ParsePolicy(data)
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, errors.Wrap(err, "failed to parse authorization policy")
+	}
+	if p.APIVersion != PolicyAPIVersion {
+		return nil, errors.Errorf("unsupported authorization policy apiVersion %q, expected %s", p.APIVersion, PolicyAPIVersion)
+	}
+	if p.Kind != PolicyKind {
+		return nil, errors.Errorf("unsupported authorization policy kind %q, expected %s", p.Kind, PolicyKind)
+	}
+	for i, r := range p.Rules {
+		switch r.Effect {
+		case EffectAllow, EffectDeny, EffectNoOpinion:
+		default:
+			return nil, errors.Errorf("authorization policy rule %s has unknown effect %q, must be one of Allow, Deny or NoOpinion", r.id(i), r.Effect)
+		}
+		if r.hasResourceFields() && len(r.NonResourceURLs) > 0 {
+			return nil, errors.Errorf("authorization policy rule %s can not match both resources and non-resource URLs", r.id(i))
+		}
+	}
+	return p, nil
+}
+
+// Decide returns the status of the first rule matching the request
+func (p *Policy) Decide(req *authzv1.SubjectAccessReviewSpec) *authzv1.SubjectAccessReviewStatus {
+	for i, r := range p.Rules {
+		if !r.matches(req) {
+			continue
+		}
+		reason := fmt.Sprintf("%s by policy rule %s", strings.ToLower(string(r.Effect)), r.id(i))
+		switch r.Effect {
+		case EffectAllow:
+			return &authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: reason}
+		case EffectDeny:
+			return &authzv1.SubjectAccessReviewStatus{Denied: true, Reason: reason}
+		default:
+			return &authzv1.SubjectAccessReviewStatus{Reason: "no opinion by policy rule " + r.id(i)}
+		}
+	}
+	return &authzv1.SubjectAccessReviewStatus{Reason: "no policy rule matched"}
+}
+
+// id names the rule in errors and reasons, rules are numbered from 1
+func (r Rule) id(i int) string {
+	if r.Name != "" {
+		return fmt.Sprintf("%q", r.Name)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func (r Rule) hasResourceFields() bool {
+	return len(r.Namespaces) > 0 || len(r.APIGroups) > 0 || len(r.Resources) > 0 || len(r.Subresources) > 0
+}
+
+func (r Rule) matches(req *authzv1.SubjectAccessReviewSpec) bool {
+	if len(r.Users) > 0 && !matchAny(r.Users, req.User) {
+		return false
+	}
+	if len(r.Groups) > 0 {
+		found := false
+		for _, g := range req.Groups {
+			if matchAny(r.Groups, g) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if attrs := req.ResourceAttributes; attrs != nil {
+		if len(r.NonResourceURLs) > 0 {
+			return false
+		}
+		return matchList(r.Verbs, attrs.Verb) &&
+			matchList(r.Namespaces, attrs.Namespace) &&
+			matchList(r.APIGroups, attrs.Group) &&
+			matchList(r.Resources, attrs.Resource) &&
+			r.matchesSubresource(attrs.Subresource)
+	}
+	if attrs := req.NonResourceAttributes; attrs != nil {
+		if r.hasResourceFields() {
+			return false
+		}
+		return matchList(r.Verbs, attrs.Verb) &&
+			(len(r.NonResourceURLs) == 0 || matchAny(r.NonResourceURLs, attrs.Path))
+	}
+	return false
+}
+
+func (r Rule) matchesSubresource(subresource string) bool {
+	if len(r.Subresources) == 0 {
+		return subresource == ""
+	}
+	for _, s := range r.Subresources {
+		if s == "*" || s == subresource {
+			return true
+		}
+	}
+	return false
+}
+
+// matchList matches v against a list of exact values, an empty list or a
+// `*` entry matches everything
+func matchList(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == "*" || item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, v string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(v, prefix) {
+				return true
+			}
+		} else if p == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer evaluates SubjectAccessReviews against a policy file, which is
+// reloaded when the file changes
+type Authorizer struct {
+	policy *reload.File[*Policy]
+}
+
+func New(opts Options) *Authorizer {
+	return &Authorizer{
+		policy: reload.NewFile("authorization policy file", func() (*Policy, error) {
+			return LoadPolicyFile(opts.PolicyFile)
+		}, opts.PolicyFile),
+	}
+}
+
+// Configure loads the policy file. If the file is invalid, the previously
+// loaded policy is kept.
+func (a *Authorizer) Configure() error {
+	return a.policy.Load()
+}
+
+// Watch reloads the policy file when it changes, until stopCh is closed
+func (a *Authorizer) Watch(stopCh <-chan struct{}) error {
+	return a.policy.Watch(stopCh)
+}
+
+// Ready checks the policy file was loaded
+func (a *Authorizer) Ready(_ context.Context) error {
+	return a.policy.Ready()
+}
+
+func (a *Authorizer) Check(_ context.Context, request *authzv1.SubjectAccessReviewSpec, _ authz.Store) (*authzv1.SubjectAccessReviewStatus, error) {
+	if request == nil {
+		return nil, errors.New("subject access review is nil")
+	}
+
+	p, loaded := a.policy.Get()
+	if !loaded {
+		return nil, errors.New("authorization policy is not loaded")
+	}
+	return p.Decide(request), nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authzv1 "k8s.io/api/authorization/v1"
+)
+
+const testPolicy = `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: AuthorizationPolicy
+rules:
+- name: no-secrets
+  effect: Deny
+  resources: [secrets]
+- name: admins
+  effect: Allow
+  groups: [admins]
+- effect: NoOpinion
+  users: ["system:*"]
+- name: dev-read
+  effect: Allow
+  groups: [dev]
+  namespaces: [dev]
+  apiGroups: ["", apps]
+  resources: [pods, deployments]
+  verbs: [get, list, watch]
+- name: dev-logs
+  effect: Allow
+  groups: [dev]
+  namespaces: [dev]
+  resources: [pods]
+  subresources: [log]
+  verbs: [get]
+- name: health
+  effect: Allow
+  nonResourceURLs: [/healthz, "/version*"]
+  verbs: [get]
+`
+
+func resourceRequest(user string, groups []string, attrs authzv1.ResourceAttributes) *authzv1.SubjectAccessReviewSpec {
+	return &authzv1.SubjectAccessReviewSpec{User: user, Groups: groups, ResourceAttributes: &attrs}
+}
+
+func TestDecide(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	testData := []struct {
+		testName string
+		request  *authzv1.SubjectAccessReviewSpec
+		expected authzv1.SubjectAccessReviewStatus
+	}{
+		{
+			"deny takes precedence over later allow",
+			resourceRequest("nahid", []string{"admins"}, authzv1.ResourceAttributes{Verb: "get", Resource: "secrets"}),
+			authzv1.SubjectAccessReviewStatus{Denied: true, Reason: `deny by policy rule "no-secrets"`},
+		},
+		{
+			"group allowed",
+			resourceRequest("nahid", []string{"admins"}, authzv1.ResourceAttributes{Verb: "delete", Resource: "nodes"}),
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by policy rule "admins"`},
+		},
+		{
+			"user prefix without name",
+			resourceRequest("system:kube-proxy", nil, authzv1.ResourceAttributes{Verb: "get", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Reason: "no opinion by policy rule #3"},
+		},
+		{
+			"resource rule",
+			resourceRequest("nahid", []string{"dev"}, authzv1.ResourceAttributes{Verb: "list", Namespace: "dev", Group: "apps", Resource: "deployments"}),
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by policy rule "dev-read"`},
+		},
+		{
+			"other namespace",
+			resourceRequest("nahid", []string{"dev"}, authzv1.ResourceAttributes{Verb: "list", Namespace: "prod", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Reason: "no policy rule matched"},
+		},
+		{
+			"verb not listed",
+			resourceRequest("nahid", []string{"dev"}, authzv1.ResourceAttributes{Verb: "delete", Namespace: "dev", Resource: "pods"}),
+			authzv1.SubjectAccessReviewStatus{Reason: "no policy rule matched"},
+		},
+		{
+			"subresource only matches when listed",
+			resourceRequest("nahid", []string{"dev"}, authzv1.ResourceAttributes{Verb: "get", Namespace: "dev", Resource: "pods", Subresource: "log"}),
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by policy rule "dev-logs"`},
+		},
+		{
+			"subresource not listed",
+			resourceRequest("nahid", []string{"dev"}, authzv1.ResourceAttributes{Verb: "get", Namespace: "dev", Resource: "pods", Subresource: "exec"}),
+			authzv1.SubjectAccessReviewStatus{Reason: "no policy rule matched"},
+		},
+		{
+			"non-resource url",
+			&authzv1.SubjectAccessReviewSpec{User: "nahid", NonResourceAttributes: &authzv1.NonResourceAttributes{Verb: "get", Path: "/version/"}},
+			authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by policy rule "health"`},
+		},
+		{
+			"resource rule does not match non-resource url",
+			&authzv1.SubjectAccessReviewSpec{User: "nahid", Groups: []string{"dev"}, NonResourceAttributes: &authzv1.NonResourceAttributes{Verb: "get", Path: "/metrics"}},
+			authzv1.SubjectAccessReviewStatus{Reason: "no policy rule matched"},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			assert.Equal(t, test.expected, *p.Decide(test.request))
+		})
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	testData := []struct {
+		testName    string
+		policy      string
+		expectedErr string
+	}{
+		{
+			"wrong kind",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: GuardConfiguration\n",
+			`unsupported authorization policy kind "GuardConfiguration", expected AuthorizationPolicy`,
+		},
+		{
+			"unknown effect",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuthorizationPolicy\nrules:\n- effect: allow\n",
+			`authorization policy rule #1 has unknown effect "allow", must be one of Allow, Deny or NoOpinion`,
+		},
+		{
+			"resources and non-resource urls",
+			"apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuthorizationPolicy\nrules:\n- name: mixed\n  effect: Allow\n  resources: [pods]\n  nonResourceURLs: [/healthz]\n",
+			`authorization policy rule "mixed" can not match both resources and non-resource URLs`,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(test.policy))
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+
+	_, err := ParsePolicy([]byte("apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuthorizationPolicy\nrule: []\n"))
+	assert.NotNil(t, err, "unknown fields must be rejected")
+}
+
+func TestAuthorizerReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a := New(Options{PolicyFile: file})
+	if !assert.Nil(t, a.Configure()) {
+		return
+	}
+	assert.Nil(t, a.Ready(context.Background()))
+
+	req := resourceRequest("nahid", []string{"admins"}, authzv1.ResourceAttributes{Verb: "get", Resource: "pods"})
+	resp, err := a.Check(context.Background(), req, nil)
+	if assert.Nil(t, err) {
+		assert.True(t, resp.Allowed)
+	}
+
+	// an invalid file keeps the previous policy
+	if err = os.WriteFile(file, []byte("kind: AuthorizationPolicy\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, a.Configure())
+	assert.NotNil(t, a.Ready(context.Background()))
+	resp, err = a.Check(context.Background(), req, nil)
+	if assert.Nil(t, err) {
+		assert.True(t, resp.Allowed)
+	}
+
+	if err = os.WriteFile(file, []byte("apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuthorizationPolicy\nrules:\n- effect: Deny\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a.Configure())
+	assert.Nil(t, a.Ready(context.Background()))
+	resp, err = a.Check(context.Background(), req, nil)
+	if assert.Nil(t, err) {
+		assert.True(t, resp.Denied)
+		assert.Equal(t, "deny by policy rule #1", resp.Reason)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	opts := NewOptions()
+	assert.NotNil(t, opts.Validate())
+	assert.Nil(t, (&Options{PolicyFile: "/etc/guard/authz/policy/policy.yaml"}).Validate())
+}
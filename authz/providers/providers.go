@@ -22,6 +22,8 @@ import (
 
 	"go.kubeguard.dev/guard/authz"
 	_ "go.kubeguard.dev/guard/authz/providers/azure"
+	_ "go.kubeguard.dev/guard/authz/providers/cel"
+	_ "go.kubeguard.dev/guard/authz/providers/policy"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -29,12 +31,29 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// How errors of providers in the authz chain are handled
+const (
+	ChainErrorSkip = "skip" // ask the next provider
+	ChainErrorDeny = "deny" // deny the request
+	ChainErrorFail = "fail" // fail the review, so the api server applies its failure policy
+)
+
 type AuthzProviders struct {
-	Providers []string // contains providers name for which guard will provide service, required
+	Providers        []string // contains providers name for which guard will provide service, required
+	Chain            []string // providers asked in order regardless of the client cert organization, optional
+	ChainErrorPolicy string   // one of skip, deny or fail
+}
+
+func NewAuthzProviders() AuthzProviders {
+	return AuthzProviders{
+		ChainErrorPolicy: ChainErrorFail,
+	}
 }
 
 func (a *AuthzProviders) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&a.Providers, "authz-providers", a.Providers, fmt.Sprintf("name of providers for which guard will provide authorization service, supported providers : %v", authz.SupportedOrgs.String()))
+	fs.StringSliceVar(&a.Chain, "authz-chain", a.Chain, "ordered list of providers asked for every subject access review until one allows or denies the request, each must be listed in authz-providers. If set, the client cert organization is not used to pick the provider")
+	fs.StringVar(&a.ChainErrorPolicy, "authz-chain-error-policy", a.ChainErrorPolicy, "how an error of a provider in authz-chain is handled, one of skip (ask the next provider), deny (deny the request) or fail (fail the review)")
 }
 
 func (a *AuthzProviders) Validate() []error {
@@ -45,6 +64,24 @@ func (a *AuthzProviders) Validate() []error {
 			errs = append(errs, errors.Errorf("provider %s not supported", p))
 		}
 	}
+
+	seen := map[string]bool{}
+	for _, p := range a.Chain {
+		name := strings.ToLower(strings.TrimSpace(p))
+		if !a.Has(name) {
+			errs = append(errs, errors.Errorf("authz-chain provider %s must be listed in authz-providers", p))
+		}
+		if seen[name] {
+			errs = append(errs, errors.Errorf("authz-chain provider %s is listed more than once", p))
+		}
+		seen[name] = true
+	}
+
+	switch a.ChainErrorPolicy {
+	case ChainErrorSkip, ChainErrorDeny, ChainErrorFail:
+	default:
+		errs = append(errs, errors.Errorf("authz-chain-error-policy must be one of %s, %s or %s", ChainErrorSkip, ChainErrorDeny, ChainErrorFail))
+	}
 	return errs
 }
 
@@ -52,6 +89,12 @@ func (a *AuthzProviders) Apply(d *apps.Deployment) (extraObjs []runtime.Object,
 	if len(a.Providers) > 0 {
 		d.Spec.Template.Spec.Containers[0].Args = append(d.Spec.Template.Spec.Containers[0].Args, fmt.Sprintf("--authz-providers=%s", strings.Join(a.Providers, ",")))
 	}
+	if len(a.Chain) > 0 {
+		d.Spec.Template.Spec.Containers[0].Args = append(d.Spec.Template.Spec.Containers[0].Args, fmt.Sprintf("--authz-chain=%s", strings.Join(a.Chain, ",")))
+		if a.ChainErrorPolicy != ChainErrorFail {
+			d.Spec.Template.Spec.Containers[0].Args = append(d.Spec.Template.Spec.Containers[0].Args, fmt.Sprintf("--authz-chain-error-policy=%s", a.ChainErrorPolicy))
+		}
+	}
 
 	return nil, nil
 }
@@ -0,0 +1,83 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providers
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestAuthzProvidersValidateChain(t *testing.T) {
+	testData := []struct {
+		testName    string
+		chain       []string
+		errorPolicy string
+		expectedErr []error
+	}{
+		{
+			"no chain",
+			nil,
+			ChainErrorFail,
+			nil,
+		},
+		{
+			"chain is a subset of authz-providers",
+			[]string{"Policy", "azure"},
+			ChainErrorSkip,
+			nil,
+		},
+		{
+			"chain provider not in authz-providers",
+			[]string{"policy", "cel"},
+			ChainErrorDeny,
+			[]error{errors.New("authz-chain provider cel must be listed in authz-providers")},
+		},
+		{
+			"chain provider listed twice",
+			[]string{"azure", "policy", "azure"},
+			ChainErrorFail,
+			[]error{errors.New("authz-chain provider azure is listed more than once")},
+		},
+		{
+			"unknown error policy",
+			[]string{"policy", "azure"},
+			"ignore",
+			[]error{errors.New("authz-chain-error-policy must be one of skip, deny or fail")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			a := AuthzProviders{
+				Providers:        []string{"policy", "azure"},
+				Chain:            test.chain,
+				ChainErrorPolicy: test.errorPolicy,
+			}
+			errs := a.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
@@ -46,8 +46,8 @@ func NewCmdInitClient() *cobra.Command {
 			org = strings.ToLower(org)
 			if len(args) == 0 {
 				switch org {
-				// for gitlab/azure/ldap client name not required
-				case "gitlab", "azure", "ldap":
+				// for gitlab/azure/ldap/oidc/eks client name not required
+				case "gitlab", "azure", "ldap", "oidc", "eks":
 					args = []string{org}
 				}
 			}
@@ -32,6 +32,8 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(NewCmdGet())
 	cmd.AddCommand(NewCmdRun())
 	cmd.AddCommand(NewCmdLogin())
+	cmd.AddCommand(NewCmdToken())
+	cmd.AddCommand(NewCmdUser())
 	cmd.AddCommand(v.NewCmdVersion())
 	return cmd
 }
@@ -31,11 +31,17 @@ func NewCmdRun() *cobra.Command {
 		AuthRecommendedOptions:  o,
 		AuthzRecommendedOptions: ao,
 	}
+	var configFile string
 	cmd := &cobra.Command{
 		Use:               "run",
 		Short:             "Run server",
 		DisableAutoGenTag: true,
 		PreRun: func(c *cobra.Command, args []string) {
+			if configFile != "" {
+				if err := srv.LoadConfig(c.Flags(), configFile); err != nil {
+					klog.Fatalln(err)
+				}
+			}
 			flags.PrintFlags(c.Flags())
 		},
 		Run: func(cmd *cobra.Command, args []string) {
@@ -46,5 +52,6 @@ func NewCmdRun() *cobra.Command {
 		},
 	}
 	srv.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&configFile, server.ConfigFlag, configFile, "Path to a GuardConfiguration file. Flags given on the command line take precedence over the file.")
 	return cmd
 }
@@ -0,0 +1,163 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.kubeguard.dev/guard/auth/providers/token"
+
+	"github.com/spf13/cobra"
+	"gomodules.xyz/x/term"
+	"k8s.io/klog/v2"
+)
+
+func NewCmdToken() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "token",
+		Short:             "Manage tokens of the static token file",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(NewCmdTokenCreate())
+	cmd.AddCommand(NewCmdTokenRevoke())
+	return cmd
+}
+
+func NewCmdTokenCreate() *cobra.Command {
+	var (
+		file      string
+		hash      = token.HashSHA256
+		entry     token.Entry
+		extra     []string
+		notBefore string
+		expiresAt string
+		expiresIn time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:               "create",
+		Short:             "Add a new token to the static token file and print it",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if file == "" {
+				klog.Fatalln("Missing token file. Set flag --token-auth-file.")
+			}
+			if entry.Username == "" || entry.UID == "" {
+				klog.Fatalln("Missing user. Set flags --user and --uid.")
+			}
+
+			for _, kv := range extra {
+				k, v, found := strings.Cut(kv, "=")
+				if !found || k == "" {
+					klog.Fatalf("Invalid extra attribute %s, must be key=value.", kv)
+				}
+				if entry.Extra == nil {
+					entry.Extra = map[string][]string{}
+				}
+				entry.Extra[k] = append(entry.Extra[k], v)
+			}
+
+			var err error
+			if entry.NotBefore, err = parseTimeFlag(notBefore); err != nil {
+				klog.Fatalf("Invalid --not-before. Reason: %v.", err)
+			}
+			if expiresAt != "" && expiresIn != 0 {
+				klog.Fatalln("Only one of --expires-at and --expires-in can be set.")
+			}
+			if entry.ExpiresAt, err = parseTimeFlag(expiresAt); err != nil {
+				klog.Fatalf("Invalid --expires-at. Reason: %v.", err)
+			}
+			if expiresIn != 0 {
+				t := time.Now().Add(expiresIn).UTC().Truncate(time.Second)
+				entry.ExpiresAt = &t
+			}
+
+			t, err := token.GenerateToken(hash)
+			if err != nil {
+				klog.Fatal(err)
+			}
+			if entry.Token, err = token.HashToken(t, hash); err != nil {
+				klog.Fatal(err)
+			}
+			if err = token.AddToken(file, entry); err != nil {
+				klog.Fatalf("Failed to add token. Reason: %v.", err)
+			}
+			term.Successln("Added token of ", entry.Username, " to ", file)
+			fmt.Println(t)
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "token-auth-file", file, "Path to the static token file, a csv file or a TokenFile in YAML or JSON format")
+	cmd.Flags().StringVar(&hash, "hash", hash, fmt.Sprintf("Hash of the token stored in the file (%s)", strings.Join(token.SupportedHashes, ", ")))
+	cmd.Flags().StringVar(&entry.Username, "user", entry.Username, "Name of the user")
+	cmd.Flags().StringVar(&entry.UID, "uid", entry.UID, "UID of the user")
+	cmd.Flags().StringSliceVar(&entry.Groups, "groups", entry.Groups, "Groups of the user")
+	cmd.Flags().StringArrayVar(&extra, "extra", extra, "Extra attribute of the user as key=value, can be repeated. Requires a YAML or JSON token file")
+	cmd.Flags().StringVar(&notBefore, "not-before", notBefore, "Time the token becomes valid, in RFC 3339 format")
+	cmd.Flags().StringVar(&expiresAt, "expires-at", expiresAt, "Time the token expires, in RFC 3339 format")
+	cmd.Flags().DurationVar(&expiresIn, "expires-in", expiresIn, "Duration after which the token expires")
+	return cmd
+}
+
+func NewCmdTokenRevoke() *cobra.Command {
+	var (
+		file string
+		user string
+		t    string
+	)
+	cmd := &cobra.Command{
+		Use:               "revoke",
+		Short:             "Remove tokens from the static token file",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if file == "" {
+				klog.Fatalln("Missing token file. Set flag --token-auth-file.")
+			}
+			if (user == "") == (t == "") {
+				klog.Fatalln("Set one of the flags --user or --token.")
+			}
+
+			n, err := token.RevokeTokens(file, func(e token.Entry) bool {
+				if user != "" {
+					return e.Username == user
+				}
+				return e.Matches(t)
+			})
+			if err != nil {
+				klog.Fatalf("Failed to revoke token. Reason: %v.", err)
+			}
+			term.Successln(fmt.Sprintf("Revoked %d token(s) in %s", n, file))
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "token-auth-file", file, "Path to the static token file, a csv file or a TokenFile in YAML or JSON format")
+	cmd.Flags().StringVar(&user, "user", user, "Revoke all tokens of the user")
+	cmd.Flags().StringVar(&t, "token", t, "Revoke the token")
+	return cmd
+}
+
+func parseTimeFlag(in string) (*time.Time, error) {
+	if in == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, in)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
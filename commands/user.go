@@ -0,0 +1,178 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	gterm "gomodules.xyz/x/term"
+	"k8s.io/klog/v2"
+)
+
+type userOptions struct {
+	File          string
+	GroupsFile    string
+	Username      string
+	PasswordStdin bool
+}
+
+func (o *userOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.File, "htpasswd-file", o.File, "Path to the htpasswd file")
+	fs.StringVar(&o.GroupsFile, "groups-file", o.GroupsFile, "Path to the groups file")
+	fs.StringVar(&o.Username, "user", o.Username, "Name of the user")
+}
+
+func (o *userOptions) validate() {
+	if o.File == "" {
+		klog.Fatalln("Missing htpasswd file. Set flag --htpasswd-file.")
+	}
+	if o.Username == "" {
+		klog.Fatalln("Missing user. Set flag --user.")
+	}
+}
+
+// readPassword reads the password from stdin or, on a terminal, prompts for
+// it twice
+func (o *userOptions) readPassword() (string, error) {
+	if o.PasswordStdin || !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.Wrap(err, "failed to read password from stdin")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(confirm) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(password), nil
+}
+
+func NewCmdUser() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "user",
+		Short:             "Manage users of the htpasswd file",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(NewCmdUserAdd())
+	cmd.AddCommand(NewCmdUserPasswd())
+	cmd.AddCommand(NewCmdUserDelete())
+	return cmd
+}
+
+func NewCmdUserAdd() *cobra.Command {
+	opts := userOptions{}
+	var groups []string
+	cmd := &cobra.Command{
+		Use:               "add",
+		Short:             "Add a user to the htpasswd file",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.validate()
+			if len(groups) > 0 && opts.GroupsFile == "" {
+				klog.Fatalln("Missing groups file. Set flag --groups-file to set groups.")
+			}
+
+			password, err := opts.readPassword()
+			if err != nil {
+				klog.Fatal(err)
+			}
+			if err = htpasswd.AddUser(opts.File, opts.Username, password); err != nil {
+				klog.Fatalf("Failed to add user. Reason: %v.", err)
+			}
+			if opts.GroupsFile != "" {
+				if err = htpasswd.SetGroups(opts.GroupsFile, opts.Username, groups); err != nil {
+					klog.Fatalf("Failed to set groups. Reason: %v.", err)
+				}
+			}
+			gterm.Successln("Added user ", opts.Username, " to ", opts.File)
+		},
+	}
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.PasswordStdin, "password-stdin", opts.PasswordStdin, "Read the password from stdin")
+	cmd.Flags().StringSliceVar(&groups, "groups", groups, "Groups of the user, requires --groups-file")
+	return cmd
+}
+
+func NewCmdUserPasswd() *cobra.Command {
+	opts := userOptions{}
+	cmd := &cobra.Command{
+		Use:               "passwd",
+		Short:             "Change the password of a user of the htpasswd file",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.validate()
+
+			password, err := opts.readPassword()
+			if err != nil {
+				klog.Fatal(err)
+			}
+			if err = htpasswd.SetPassword(opts.File, opts.Username, password); err != nil {
+				klog.Fatalf("Failed to change password. Reason: %v.", err)
+			}
+			gterm.Successln("Changed password of user ", opts.Username, " in ", opts.File)
+		},
+	}
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.PasswordStdin, "password-stdin", opts.PasswordStdin, "Read the password from stdin")
+	return cmd
+}
+
+func NewCmdUserDelete() *cobra.Command {
+	opts := userOptions{}
+	cmd := &cobra.Command{
+		Use:               "delete",
+		Short:             "Delete a user from the htpasswd file",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.validate()
+
+			if err := htpasswd.DeleteUser(opts.File, opts.Username); err != nil {
+				klog.Fatalf("Failed to delete user. Reason: %v.", err)
+			}
+			if opts.GroupsFile != "" {
+				if err := htpasswd.SetGroups(opts.GroupsFile, opts.Username, nil); err != nil {
+					klog.Fatalf("Failed to remove user from groups. Reason: %v.", err)
+				}
+			}
+			gterm.Successln("Deleted user ", opts.Username, " from ", opts.File)
+		},
+	}
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
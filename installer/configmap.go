@@ -0,0 +1,87 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package installer
+
+import (
+	"fmt"
+	"strings"
+
+	"go.kubeguard.dev/guard/server"
+
+	"gomodules.xyz/pointer"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	configDir  = "/etc/guard/config"
+	configFile = "config.yaml"
+)
+
+// newConfigMap moves the server flags of the guard container into a
+// GuardConfiguration stored in a ConfigMap and mounts it as --config
+func newConfigMap(d *apps.Deployment) (runtime.Object, error) {
+	container := &d.Spec.Template.Spec.Containers[0]
+
+	var args, flags []string
+	for _, arg := range container.Args {
+		if arg == "run" || strings.HasPrefix(arg, "--v=") {
+			args = append(args, arg)
+		} else {
+			flags = append(flags, arg)
+		}
+	}
+	data, err := server.NewConfigFromArgs(flags)
+	if err != nil {
+		return nil, err
+	}
+	container.Args = append(args, fmt.Sprintf("--%s=%s/%s", server.ConfigFlag, configDir, configFile))
+
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "guard-config",
+			Namespace: d.Namespace,
+			Labels:    labels,
+		},
+		Data: map[string]string{
+			configFile: string(data),
+		},
+	}
+
+	volMount := core.VolumeMount{
+		Name:      cm.Name,
+		MountPath: configDir,
+		ReadOnly:  true,
+	}
+	container.VolumeMounts = append(container.VolumeMounts, volMount)
+
+	vol := core.Volume{
+		Name: cm.Name,
+		VolumeSource: core.VolumeSource{
+			ConfigMap: &core.ConfigMapVolumeSource{
+				LocalObjectReference: core.LocalObjectReference{
+					Name: cm.Name,
+				},
+				DefaultMode: pointer.Int32P(0o444),
+			},
+		},
+	}
+	d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, vol)
+	return cm, nil
+}
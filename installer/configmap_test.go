@@ -0,0 +1,132 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.kubeguard.dev/guard/server"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gomodules.xyz/blobfs"
+	"gomodules.xyz/cert"
+	"gomodules.xyz/cert/certstore"
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	testPolicy = `apiVersion: guard.kubeguard.dev/v1alpha1
+kind: AuthorizationPolicy
+rules:
+- effect: Allow
+  nonResourceURLs: [/healthz]
+`
+	testCELPolicy = `apiVersion: guard.kubeguard.dev/v1alpha1
+kind: CELAuthorizationPolicy
+rules:
+- name: metrics
+  effect: Allow
+  expression: nonResourceAttributes != null && nonResourceAttributes.path == '/metrics'
+`
+)
+
+func writeTestFiles(t *testing.T, dir string) {
+	store, err := certstore.New(blobfs.NewOsFs(), filepath.Join(dir, "pki"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.NewCA(); err != nil {
+		t.Fatal(err)
+	}
+	crt, key, err := store.NewServerCertPairBytes(cert.AltNames{DNSNames: []string{"guard"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.WriteBytes("server", crt, key); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"htpasswd":    "nahid:" + string(hash) + "\n",
+		"policy.yaml": testPolicy,
+		"cel.yaml":    testCELPolicy,
+	}
+	for name, data := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestConfigMapRoundTrip checks the configuration file written by
+// --config-map is loaded by guard run with the same options as the args
+func TestConfigMapRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir)
+
+	authopts := NewAuthOptions()
+	authopts.PkiDir = dir
+	authopts.ConfigMap = true
+	authopts.AuthProvider.Providers = []string{"htpasswd"}
+	authopts.Htpasswd.File = filepath.Join(dir, "htpasswd")
+	authzopts := NewAuthzOptions()
+	authzopts.AuthzProvider.Providers = []string{"policy", "cel"}
+	authzopts.Policy.PolicyFile = filepath.Join(dir, "policy.yaml")
+	authzopts.CEL.PolicyFile = filepath.Join(dir, "cel.yaml")
+
+	objects, err := newDeployment(authopts, authzopts)
+	if err != nil {
+		t.Fatalf("Error when generating deployment. reason: %v", err)
+	}
+	var cm *core.ConfigMap
+	for _, obj := range objects {
+		if c, ok := obj.(*core.ConfigMap); ok && c.Name == "guard-config" {
+			cm = c
+		}
+	}
+	if !assert.NotNil(t, cm, "guard-config ConfigMap must be generated") {
+		return
+	}
+
+	cfg, err := server.ParseConfig([]byte(cm.Data[configFile]))
+	if !assert.Nil(t, err) {
+		return
+	}
+	s := &server.Server{
+		AuthRecommendedOptions:  server.NewAuthRecommendedOptions(),
+		AuthzRecommendedOptions: server.NewAuthzRecommendedOptions(),
+	}
+	fs := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	s.AddFlags(fs)
+	if !assert.Nil(t, cfg.Apply(fs)) {
+		return
+	}
+
+	assert.Equal(t, []string{"htpasswd"}, s.AuthRecommendedOptions.AuthProvider.Providers)
+	assert.Equal(t, "/etc/guard/auth/htpasswd/htpasswd", s.AuthRecommendedOptions.Htpasswd.File)
+	assert.Equal(t, []string{"policy", "cel"}, s.AuthzRecommendedOptions.AuthzProvider.Providers)
+	assert.Equal(t, "/etc/guard/authz/policy/policy.yaml", s.AuthzRecommendedOptions.Policy.PolicyFile)
+	assert.Equal(t, "/etc/guard/authz/cel/policy.yaml", s.AuthzRecommendedOptions.CEL.PolicyFile)
+}
@@ -20,12 +20,18 @@ import (
 	"fmt"
 
 	"go.kubeguard.dev/guard/auth/providers/azure"
+	"go.kubeguard.dev/guard/auth/providers/ci"
+	"go.kubeguard.dev/guard/auth/providers/eks"
 	"go.kubeguard.dev/guard/auth/providers/github"
 	"go.kubeguard.dev/guard/auth/providers/gitlab"
 	"go.kubeguard.dev/guard/auth/providers/google"
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
 	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/auth/providers/oidc"
 	"go.kubeguard.dev/guard/auth/providers/token"
 	azureauthz "go.kubeguard.dev/guard/authz/providers/azure"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
 	"go.kubeguard.dev/guard/server"
 
 	"gomodules.xyz/pointer"
@@ -204,6 +210,36 @@ func newDeployment(authopts AuthOptions, authzopts AuthzOptions) (objects []runt
 		objects = append(objects, extras...)
 	}
 
+	if extras, err := authopts.AuthnCache.Apply(d); err != nil {
+		return nil, err
+	} else {
+		objects = append(objects, extras...)
+	}
+
+	if extras, err := authopts.Audit.Apply(d); err != nil {
+		return nil, err
+	} else {
+		objects = append(objects, extras...)
+	}
+
+	if extras, err := authopts.Tracing.Apply(d); err != nil {
+		return nil, err
+	} else {
+		objects = append(objects, extras...)
+	}
+
+	if extras, err := authopts.RateLimit.Apply(d); err != nil {
+		return nil, err
+	} else {
+		objects = append(objects, extras...)
+	}
+
+	if extras, err := authopts.Transform.Apply(d); err != nil {
+		return nil, err
+	} else {
+		objects = append(objects, extras...)
+	}
+
 	if authopts.AuthProvider.Has(token.OrgType) {
 		if extras, err := authopts.Token.Apply(d); err != nil {
 			return nil, err
@@ -252,6 +288,38 @@ func newDeployment(authopts AuthOptions, authzopts AuthzOptions) (objects []runt
 		}
 	}
 
+	if authopts.AuthProvider.Has(oidc.OrgType) {
+		if extras, err := authopts.OIDC.Apply(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, extras...)
+		}
+	}
+
+	if authopts.AuthProvider.Has(ci.OrgType) {
+		if extras, err := authopts.CI.Apply(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, extras...)
+		}
+	}
+
+	if authopts.AuthProvider.Has(eks.OrgType) {
+		if extras, err := authopts.EKS.Apply(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, extras...)
+		}
+	}
+
+	if authopts.AuthProvider.Has(htpasswd.OrgType) {
+		if extras, err := authopts.Htpasswd.Apply(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, extras...)
+		}
+	}
+
 	if len(authzopts.AuthzProvider.Providers) > 0 {
 		if extras, err := authzopts.AuthzProvider.Apply(d); err != nil {
 			return nil, err
@@ -268,5 +336,29 @@ func newDeployment(authopts AuthOptions, authzopts AuthzOptions) (objects []runt
 		}
 	}
 
+	if authzopts.AuthzProvider.Has(policy.OrgType) {
+		if extras, err := authzopts.Policy.Apply(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, extras...)
+		}
+	}
+
+	if authzopts.AuthzProvider.Has(cel.OrgType) {
+		if extras, err := authzopts.CEL.Apply(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, extras...)
+		}
+	}
+
+	if authopts.ConfigMap {
+		if cm, err := newConfigMap(d); err != nil {
+			return nil, err
+		} else {
+			objects = append(objects, cm)
+		}
+	}
+
 	return
 }
@@ -18,16 +18,26 @@ package installer
 
 import (
 	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/auth/cache"
 	"go.kubeguard.dev/guard/auth/providers"
 	"go.kubeguard.dev/guard/auth/providers/azure"
+	"go.kubeguard.dev/guard/auth/providers/ci"
+	"go.kubeguard.dev/guard/auth/providers/eks"
 	"go.kubeguard.dev/guard/auth/providers/github"
 	"go.kubeguard.dev/guard/auth/providers/gitlab"
 	"go.kubeguard.dev/guard/auth/providers/google"
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
 	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/auth/providers/oidc"
 	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/auth/transform"
 	authz "go.kubeguard.dev/guard/authz/providers"
 	azureauthz "go.kubeguard.dev/guard/authz/providers/azure"
 	authzOpts "go.kubeguard.dev/guard/authz/providers/azure/options"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
+	"go.kubeguard.dev/guard/server"
+	"go.kubeguard.dev/guard/server/audit"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -46,19 +56,31 @@ type AuthOptions struct {
 	HttpProxy       string
 	NoProxy         string
 	ProxyCert       string
+	ConfigMap       bool
 
 	AuthProvider providers.AuthProviders
+	AuthnCache   cache.Options
+	Audit        audit.Options
+	Tracing      server.TracingOptions
+	RateLimit    server.RateLimitOptions
+	Transform    transform.Options
 	Token        token.Options
 	Google       google.Options
 	Azure        azure.Options
 	LDAP         ldap.Options
 	Github       github.Options
 	Gitlab       gitlab.Options
+	OIDC         oidc.Options
+	CI           ci.Options
+	EKS          eks.Options
+	Htpasswd     htpasswd.Options
 }
 
 type AuthzOptions struct {
 	AuthzProvider authz.AuthzProviders
 	Azure         authzOpts.Options
+	Policy        policy.Options
+	CEL           cel.Options
 }
 
 func NewAuthOptions() AuthOptions {
@@ -69,18 +91,30 @@ func NewAuthOptions() AuthOptions {
 		Addr:            "10.96.10.96:443",
 		PrivateRegistry: "ghcr.io/kubeguard",
 		RunOnMaster:     true,
+		AuthnCache:      cache.NewOptions(),
+		Audit:           audit.NewOptions(),
+		Tracing:         server.NewTracingOptions(),
+		RateLimit:       server.NewRateLimitOptions(),
+		Transform:       transform.NewOptions(),
 		Token:           token.NewOptions(),
 		Google:          google.NewOptions(),
 		Azure:           azure.NewOptions(),
 		LDAP:            ldap.NewOptions(),
 		Github:          github.NewOptions(),
 		Gitlab:          gitlab.NewOptions(),
+		OIDC:            oidc.NewOptions(),
+		CI:              ci.NewOptions(),
+		EKS:             eks.NewOptions(),
+		Htpasswd:        htpasswd.NewOptions(),
 	}
 }
 
 func NewAuthzOptions() AuthzOptions {
 	return AuthzOptions{
-		Azure: authzOpts.NewOptions(),
+		AuthzProvider: authz.NewAuthzProviders(),
+		Azure:         authzOpts.NewOptions(),
+		Policy:        policy.NewOptions(),
+		CEL:           cel.NewOptions(),
 	}
 }
 
@@ -96,23 +130,39 @@ func (o *AuthOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.HttpProxy, "proxy-http", o.HttpProxy, "Http proxy URL to be used")
 	fs.StringVar(&o.NoProxy, "proxy-skip-range", o.NoProxy, "List of URLs/CIDRs for which proxy should not to be used")
 	fs.StringVar(&o.ProxyCert, "proxy-cert", o.ProxyCert, "Path to the certificate file for proxy")
+	fs.BoolVar(&o.ConfigMap, "config-map", o.ConfigMap, "If true, server flags are stored as a configuration file in a ConfigMap instead of container args")
 	o.AuthProvider.AddFlags(fs)
+	o.AuthnCache.AddFlags(fs)
+	o.Audit.AddFlags(fs)
+	o.Tracing.AddFlags(fs)
+	o.RateLimit.AddFlags(fs)
+	o.Transform.AddFlags(fs)
 	o.Token.AddFlags(fs)
 	o.Google.AddFlags(fs)
 	o.Azure.AddFlags(fs)
 	o.LDAP.AddFlags(fs)
 	o.Github.AddFlags(fs)
 	o.Gitlab.AddFlags(fs)
+	o.OIDC.AddFlags(fs)
+	o.CI.AddFlags(fs)
+	o.EKS.AddFlags(fs)
+	o.Htpasswd.AddFlags(fs)
 }
 
 func (o *AuthzOptions) AddFlags(fs *pflag.FlagSet) {
 	o.AuthzProvider.AddFlags(fs)
 	o.Azure.AddFlags(fs)
+	o.Policy.AddFlags(fs)
+	o.CEL.AddFlags(fs)
 }
 
 func (o *AuthOptions) Validate() []error {
 	var errs []error
 	errs = append(errs, o.AuthProvider.Validate()...)
+	errs = append(errs, o.AuthnCache.Validate()...)
+	errs = append(errs, o.Audit.Validate()...)
+	errs = append(errs, o.Tracing.Validate()...)
+	errs = append(errs, o.RateLimit.Validate()...)
 
 	if o.AuthProvider.Has(token.OrgType) {
 		errs = append(errs, o.Token.Validate()...)
@@ -132,6 +182,18 @@ func (o *AuthOptions) Validate() []error {
 	if o.AuthProvider.Has(gitlab.OrgType) {
 		errs = append(errs, o.Gitlab.Validate()...)
 	}
+	if o.AuthProvider.Has(oidc.OrgType) {
+		errs = append(errs, o.OIDC.Validate()...)
+	}
+	if o.AuthProvider.Has(ci.OrgType) {
+		errs = append(errs, o.CI.Validate()...)
+	}
+	if o.AuthProvider.Has(eks.OrgType) {
+		errs = append(errs, o.EKS.Validate()...)
+	}
+	if o.AuthProvider.Has(htpasswd.OrgType) {
+		errs = append(errs, o.Htpasswd.Validate()...)
+	}
 
 	return errs
 }
@@ -146,6 +208,12 @@ func (o *AuthzOptions) Validate(opt *AuthOptions) []error {
 		}
 		errs = append(errs, o.Azure.Validate(opt.Azure)...)
 	}
+	if o.AuthzProvider.Has(policy.OrgType) {
+		errs = append(errs, o.Policy.Validate()...)
+	}
+	if o.AuthzProvider.Has(cel.OrgType) {
+		errs = append(errs, o.CEL.Validate()...)
+	}
 
 	return errs
 }
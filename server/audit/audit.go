@@ -0,0 +1,193 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var (
+	eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_audit_events_total",
+		Help: "Total number of audit events by kind and level",
+	}, []string{"kind", "level"})
+	eventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_audit_events_dropped_total",
+		Help: "Total number of audit events dropped because the sink buffer was full",
+	}, []string{"sink"})
+	sinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_audit_sink_errors_total",
+		Help: "Total number of failed writes of audit event batches",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsTotal, eventsDropped, sinkErrors)
+}
+
+// Auditor writes audit events to the configured sinks. Every sink has its own
+// buffer and goroutine, so a slow webhook does not delay the file sink and
+// never blocks a review.
+type Auditor struct {
+	level  Level
+	policy *Policy
+
+	lock     sync.RWMutex
+	closed   bool
+	backends []*backend
+	wg       sync.WaitGroup
+}
+
+type backend struct {
+	name      string
+	sink      Sink
+	events    chan *Event
+	batchSize int
+	maxWait   time.Duration
+}
+
+func New(opts Options) (*Auditor, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	a := &Auditor{level: level}
+	if opts.PolicyFile != "" {
+		if a.policy, err = LoadPolicyFile(opts.PolicyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range opts.Sinks {
+		b := &backend{name: name, batchSize: defaultWebhookBatchSize}
+		switch name {
+		case SinkFile:
+			b.sink = NewFileSink(opts)
+		case SinkStdout:
+			b.sink = NewStdoutSink()
+		case SinkWebhook:
+			b.sink = NewWebhookSink(opts)
+			b.batchSize = opts.WebhookBatchSize
+			b.maxWait = opts.WebhookBatchMaxWait
+		default:
+			return nil, errors.Errorf("audit sink %s is not supported", name)
+		}
+		a.addBackend(b, opts.BufferSize)
+	}
+	return a, nil
+}
+
+func (a *Auditor) addBackend(b *backend, bufferSize int) {
+	b.events = make(chan *Event, bufferSize)
+	a.backends = append(a.backends, b)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		b.run()
+	}()
+}
+
+// Log finalizes the event according to the policy and queues it for all
+// sinks. It does not block.
+func (a *Auditor) Log(ev *Event) {
+	level := a.policy.LevelFor(ev, a.level)
+	if level == LevelNone {
+		return
+	}
+	ev.finalize(level)
+	eventsTotal.WithLabelValues(string(ev.Kind), level.String()).Inc()
+
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if a.closed {
+		return
+	}
+	for _, b := range a.backends {
+		select {
+		case b.events <- ev:
+		default:
+			eventsDropped.WithLabelValues(b.name).Inc()
+		}
+	}
+}
+
+// Close flushes the buffered events and closes the sinks
+func (a *Auditor) Close() {
+	a.lock.Lock()
+	if a.closed {
+		a.lock.Unlock()
+		return
+	}
+	a.closed = true
+	for _, b := range a.backends {
+		close(b.events)
+	}
+	a.lock.Unlock()
+	a.wg.Wait()
+}
+
+func (b *backend) run() {
+	for ev := range b.events {
+		batch := []*Event{ev}
+		if b.maxWait > 0 {
+			batch = b.collect(batch, time.After(b.maxWait))
+		} else {
+			batch = b.collect(batch, nil)
+		}
+		if err := b.sink.Write(batch); err != nil {
+			sinkErrors.WithLabelValues(b.name).Inc()
+			klog.Errorf("failed to write %d audit events to %s sink: %v", len(batch), b.name, err)
+		}
+	}
+	if err := b.sink.Close(); err != nil {
+		klog.Errorf("failed to close %s audit sink: %v", b.name, err)
+	}
+}
+
+// collect adds queued events to the batch until it is full. Without a
+// timeout only the events already queued are added.
+func (b *backend) collect(batch []*Event, timeout <-chan time.Time) []*Event {
+	for len(batch) < b.batchSize {
+		if timeout == nil {
+			select {
+			case ev, ok := <-b.events:
+				if !ok {
+					return batch
+				}
+				batch = append(batch, ev)
+			default:
+				return batch
+			}
+			continue
+		}
+		select {
+		case ev, ok := <-b.events:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, ev)
+		case <-timeout:
+			return batch
+		}
+	}
+	return batch
+}
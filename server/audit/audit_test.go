@@ -0,0 +1,167 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func newTestEvent(token string) *Event {
+	ev := NewEvent(KindTokenReview, httptest.NewRequest("POST", "http://guard.test/tokenreviews", nil))
+	ev.Provider = "github"
+	ev.SetToken(token)
+	ev.SetUser(&authv1.UserInfo{
+		Username: "nahid",
+		Groups:   []string{"dev"},
+		Extra:    map[string]authv1.ExtraValue{"oid": {"1234"}},
+	})
+	ev.Decision = DecisionAllow
+	ev.Code = http.StatusOK
+	return ev
+}
+
+func TestEventFinalize(t *testing.T) {
+	ev := newTestEvent("ghp_secret")
+	ev.Decision = DecisionDeny
+	ev.Reason = "failed to load user info for token ghp_secret"
+	ev.finalize(LevelMetadata)
+
+	assert.Equal(t, "failed to load user info for token [REDACTED]", ev.Reason)
+	assert.Equal(t, []string{"dev"}, ev.User.Groups)
+	assert.Nil(t, ev.User.Extra, "extra is only recorded at request level")
+	assert.Empty(t, ev.TokenFingerprint)
+
+	data, err := json.Marshal(ev)
+	if assert.Nil(t, err) {
+		assert.NotContains(t, string(data), "ghp_secret")
+		assert.Contains(t, string(data), `"level":"Metadata"`)
+	}
+
+	ev = newTestEvent("ghp_secret")
+	ev.finalize(LevelRequest)
+	assert.Equal(t, map[string][]string{"oid": {"1234"}}, ev.User.Extra)
+	assert.Regexp(t, "^sha256:[0-9a-f]{16}$", ev.TokenFingerprint)
+}
+
+func TestAuditorFileSink(t *testing.T) {
+	opts := NewOptions()
+	opts.Sinks = []string{SinkFile}
+	opts.LogPath = filepath.Join(t.TempDir(), "audit.log")
+	a, err := New(opts)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		a.Log(newTestEvent("token"))
+	}
+	a.Close()
+	// events after close are ignored
+	a.Log(newTestEvent("token"))
+
+	f, err := os.Open(opts.LogPath)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		ev := Event{}
+		if assert.Nil(t, json.Unmarshal(scanner.Bytes(), &ev)) {
+			assert.Equal(t, "nahid", ev.User.Username)
+			assert.Equal(t, DecisionAllow, ev.Decision)
+			assert.Equal(t, LevelMetadata, ev.Level)
+		}
+		lines++
+	}
+	assert.Equal(t, 3, lines)
+}
+
+func TestAuditorWebhookSink(t *testing.T) {
+	var lock sync.Mutex
+	var batches []int
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := EventList{}
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		batches = append(batches, len(list.Items))
+		lock.Unlock()
+	}))
+	defer webhook.Close()
+
+	opts := NewOptions()
+	opts.Sinks = []string{SinkWebhook}
+	opts.WebhookURL = webhook.URL
+	opts.WebhookBatchSize = 2
+	opts.WebhookBatchMaxWait = time.Minute
+	a, err := New(opts)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		a.Log(newTestEvent("token"))
+	}
+	// the last partial batch is flushed on close
+	a.Close()
+
+	assert.Equal(t, []int{2, 2, 1}, batches)
+}
+
+func TestAuditorPolicy(t *testing.T) {
+	dir := t.TempDir()
+	policyFile := filepath.Join(dir, "policy.yaml")
+	policy := "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuditPolicy\nrules:\n- level: None\n  providers: [github]\n"
+	if err := os.WriteFile(policyFile, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewOptions()
+	opts.Sinks = []string{SinkFile}
+	opts.LogPath = filepath.Join(dir, "audit.log")
+	opts.PolicyFile = policyFile
+	a, err := New(opts)
+	if !assert.Nil(t, err) {
+		return
+	}
+	a.Log(newTestEvent("token"))
+	ev := newTestEvent("token")
+	ev.Provider = "gitlab"
+	a.Log(ev)
+	a.Close()
+
+	data, err := os.ReadFile(opts.LogPath)
+	if assert.Nil(t, err) {
+		assert.NotContains(t, string(data), `"provider":"github"`)
+		assert.Contains(t, string(data), `"provider":"gitlab"`)
+	}
+}
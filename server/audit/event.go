@@ -0,0 +1,162 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+)
+
+type Kind string
+
+const (
+	KindTokenReview         Kind = "TokenReview"
+	KindSubjectAccessReview Kind = "SubjectAccessReview"
+)
+
+type Decision string
+
+const (
+	DecisionAllow     Decision = "allow"
+	DecisionDeny      Decision = "deny"
+	DecisionNoOpinion Decision = "noopinion"
+	DecisionError     Decision = "error"
+)
+
+const redacted = "[REDACTED]"
+
+// User is the identity a token was mapped to, or the subject of a SAR
+type User struct {
+	Username string              `json:"username,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// Event is a single audit record. User extra and the token fingerprint are
+// only written when the policy selects LevelRequest.
+type Event struct {
+	Level     Level     `json:"level"`
+	AuditID   string    `json:"auditID"`
+	Timestamp time.Time `json:"timestamp"`
+	Kind      Kind      `json:"kind"`
+	// Client is the organization/common name of the client certificate
+	Client   string   `json:"client,omitempty"`
+	SourceIP string   `json:"sourceIP,omitempty"`
+	Provider string   `json:"provider,omitempty"`
+	User     User     `json:"user"`
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+	Code     int      `json:"code"`
+	// RequestID correlates the decision with the logs of the azure authz provider
+	RequestID string  `json:"requestID,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+
+	ResourceAttributes    *authzv1.ResourceAttributes    `json:"resourceAttributes,omitempty"`
+	NonResourceAttributes *authzv1.NonResourceAttributes `json:"nonResourceAttributes,omitempty"`
+	TokenFingerprint      string                         `json:"tokenFingerprint,omitempty"`
+
+	token string
+}
+
+// NewEvent starts an event for a review request received by the server
+func NewEvent(kind Kind, req *http.Request) *Event {
+	ev := &Event{
+		AuditID:   uuid.New().String(),
+		Timestamp: time.Now(),
+		Kind:      kind,
+		SourceIP:  req.RemoteAddr,
+	}
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		crt := req.TLS.PeerCertificates[0]
+		ev.Client = crt.Subject.CommonName
+		if len(crt.Subject.Organization) > 0 {
+			ev.Client = crt.Subject.Organization[0] + "/" + crt.Subject.CommonName
+		}
+	}
+	return ev
+}
+
+// SetToken records the reviewed token, so it can be removed from error
+// messages. Only a short fingerprint of the token is ever written.
+func (e *Event) SetToken(token string) {
+	if token == "" {
+		return
+	}
+	e.token = token
+	sum := sha256.Sum256([]byte(token))
+	e.TokenFingerprint = "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// SetUser records the authenticated user of a TokenReview
+func (e *Event) SetUser(info *authv1.UserInfo) {
+	if info == nil {
+		return
+	}
+	e.User = User{
+		Username: info.Username,
+		UID:      info.UID,
+		Groups:   info.Groups,
+	}
+	if len(info.Extra) > 0 {
+		e.User.Extra = make(map[string][]string, len(info.Extra))
+		for k, v := range info.Extra {
+			e.User.Extra[k] = v
+		}
+	}
+}
+
+// SetSubject records the user and attributes of a SubjectAccessReview
+func (e *Event) SetSubject(spec *authzv1.SubjectAccessReviewSpec) {
+	if spec == nil {
+		return
+	}
+	e.User = User{
+		Username: spec.User,
+		UID:      spec.UID,
+		Groups:   spec.Groups,
+	}
+	if len(spec.Extra) > 0 {
+		e.User.Extra = make(map[string][]string, len(spec.Extra))
+		for k, v := range spec.Extra {
+			e.User.Extra[k] = v
+		}
+	}
+	e.ResourceAttributes = spec.ResourceAttributes
+	e.NonResourceAttributes = spec.NonResourceAttributes
+}
+
+// finalize applies the level and removes secrets before the event is written
+func (e *Event) finalize(level Level) {
+	e.Level = level
+	e.LatencyMs = float64(time.Since(e.Timestamp).Microseconds()) / 1000
+	if e.token != "" {
+		e.Reason = strings.ReplaceAll(e.Reason, e.token, redacted)
+		e.token = ""
+	}
+	if level < LevelRequest {
+		e.User.Extra = nil
+		e.TokenFingerprint = ""
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.kubeguard.dev/guard/util/volume"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	defaultLevel               = "Metadata"
+	defaultLogMaxSizeMB        = 100
+	defaultBufferSize          = 10000
+	defaultWebhookBatchSize    = 100
+	defaultWebhookBatchMaxWait = time.Second
+	defaultWebhookTimeout      = 10 * time.Second
+)
+
+type Options struct {
+	// Sinks the audit events are written to, auditing is disabled if empty
+	Sinks []string
+
+	// Level of events not matched by a rule of the policy file
+	Level string
+
+	// PolicyFile holds rules selecting the level of events
+	PolicyFile string
+
+	// file sink, rotated by size
+	LogPath       string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	LogMaxAgeDays int
+	LogCompress   bool
+
+	// webhook sink, events are posted in batches
+	WebhookURL          string
+	WebhookBatchSize    int
+	WebhookBatchMaxWait time.Duration
+	WebhookTimeout      time.Duration
+
+	// Number of events buffered for each sink, events are dropped once the
+	// buffer is full
+	BufferSize int
+}
+
+func NewOptions() Options {
+	return Options{
+		Level:               defaultLevel,
+		LogMaxSizeMB:        defaultLogMaxSizeMB,
+		WebhookBatchSize:    defaultWebhookBatchSize,
+		WebhookBatchMaxWait: defaultWebhookBatchMaxWait,
+		WebhookTimeout:      defaultWebhookTimeout,
+		BufferSize:          defaultBufferSize,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&o.Sinks, "audit-sinks", o.Sinks, "List of sinks for audit events of token and subject access reviews. Supported sinks: file, stdout, webhook")
+	fs.StringVar(&o.Level, "audit-level", o.Level, "Level of audit events not matched by the audit policy. Supported levels: None, Metadata, Request")
+	fs.StringVar(&o.PolicyFile, "audit-policy-file", o.PolicyFile, "Path to the AuditPolicy file selecting the level of audit events")
+	fs.StringVar(&o.LogPath, "audit-log-path", o.LogPath, "Path of the audit log file used by the file sink")
+	fs.IntVar(&o.LogMaxSizeMB, "audit-log-maxsize", o.LogMaxSizeMB, "Max size in MB of the audit log file before it is rotated")
+	fs.IntVar(&o.LogMaxBackups, "audit-log-maxbackup", o.LogMaxBackups, "Max number of rotated audit log files to keep, 0 keeps all")
+	fs.IntVar(&o.LogMaxAgeDays, "audit-log-maxage", o.LogMaxAgeDays, "Max number of days to keep rotated audit log files, 0 keeps all")
+	fs.BoolVar(&o.LogCompress, "audit-log-compress", o.LogCompress, "If true, rotated audit log files are compressed with gzip")
+	fs.StringVar(&o.WebhookURL, "audit-webhook-url", o.WebhookURL, "URL the webhook sink posts batches of audit events to")
+	fs.IntVar(&o.WebhookBatchSize, "audit-webhook-batch-size", o.WebhookBatchSize, "Max number of audit events posted to the webhook in one request")
+	fs.DurationVar(&o.WebhookBatchMaxWait, "audit-webhook-batch-max-wait", o.WebhookBatchMaxWait, "Max time to wait for a batch of audit events to fill up before it is posted to the webhook")
+	fs.DurationVar(&o.WebhookTimeout, "audit-webhook-timeout", o.WebhookTimeout, "Timeout of requests to the audit webhook")
+	fs.IntVar(&o.BufferSize, "audit-buffer-size", o.BufferSize, "Number of audit events buffered for each sink, events are dropped once the buffer is full")
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	if _, err := ParseLevel(o.Level); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid audit-level"))
+	}
+	for _, s := range o.Sinks {
+		switch s {
+		case SinkFile:
+			if o.LogPath == "" {
+				errs = append(errs, errors.New("audit-log-path must be non-empty for file sink"))
+			}
+			if o.LogMaxSizeMB <= 0 {
+				errs = append(errs, errors.New("audit-log-maxsize must be positive"))
+			}
+			if o.LogMaxBackups < 0 || o.LogMaxAgeDays < 0 {
+				errs = append(errs, errors.New("audit-log-maxbackup and audit-log-maxage must be non-negative"))
+			}
+		case SinkStdout:
+		case SinkWebhook:
+			if u, err := url.Parse(o.WebhookURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, errors.New("audit-webhook-url must be a valid url for webhook sink"))
+			}
+			if o.WebhookBatchSize <= 0 {
+				errs = append(errs, errors.New("audit-webhook-batch-size must be positive"))
+			}
+			if o.WebhookBatchMaxWait <= 0 || o.WebhookTimeout <= 0 {
+				errs = append(errs, errors.New("audit-webhook-batch-max-wait and audit-webhook-timeout must be positive"))
+			}
+		default:
+			errs = append(errs, errors.Errorf("audit sink %s is not supported, must be one of file, stdout or webhook", s))
+		}
+	}
+	if o.Enabled() && o.BufferSize <= 0 {
+		errs = append(errs, errors.New("audit-buffer-size must be positive"))
+	}
+	return errs
+}
+
+func (o *Options) Enabled() bool {
+	return len(o.Sinks) > 0
+}
+
+func (o Options) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	if !o.Enabled() {
+		return nil, nil
+	}
+	args := d.Spec.Template.Spec.Containers[0].Args
+	args = append(args, fmt.Sprintf("--audit-sinks=%s", strings.Join(o.Sinks, ",")))
+	if o.Level != defaultLevel {
+		args = append(args, fmt.Sprintf("--audit-level=%s", o.Level))
+	}
+	if o.LogPath != "" {
+		args = append(args, fmt.Sprintf("--audit-log-path=%s", o.LogPath))
+		if o.LogMaxSizeMB != defaultLogMaxSizeMB {
+			args = append(args, fmt.Sprintf("--audit-log-maxsize=%d", o.LogMaxSizeMB))
+		}
+		if o.LogMaxBackups > 0 {
+			args = append(args, fmt.Sprintf("--audit-log-maxbackup=%d", o.LogMaxBackups))
+		}
+		if o.LogMaxAgeDays > 0 {
+			args = append(args, fmt.Sprintf("--audit-log-maxage=%d", o.LogMaxAgeDays))
+		}
+		if o.LogCompress {
+			args = append(args, "--audit-log-compress")
+		}
+	}
+	if o.WebhookURL != "" {
+		args = append(args, fmt.Sprintf("--audit-webhook-url=%s", o.WebhookURL))
+		if o.WebhookBatchSize != defaultWebhookBatchSize {
+			args = append(args, fmt.Sprintf("--audit-webhook-batch-size=%d", o.WebhookBatchSize))
+		}
+		if o.WebhookBatchMaxWait != defaultWebhookBatchMaxWait {
+			args = append(args, fmt.Sprintf("--audit-webhook-batch-max-wait=%v", o.WebhookBatchMaxWait))
+		}
+		if o.WebhookTimeout != defaultWebhookTimeout {
+			args = append(args, fmt.Sprintf("--audit-webhook-timeout=%v", o.WebhookTimeout))
+		}
+	}
+	if o.BufferSize != defaultBufferSize {
+		args = append(args, fmt.Sprintf("--audit-buffer-size=%d", o.BufferSize))
+	}
+
+	if o.PolicyFile != "" {
+		if _, err = LoadPolicyFile(o.PolicyFile); err != nil {
+			return nil, err
+		}
+		policy, err := os.ReadFile(o.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		cm := volume.MountConfigMap(d, "guard-audit-policy", "/etc/guard/audit", map[string]string{
+			"policy.yaml": string(policy),
+		})
+		extraObjs = append(extraObjs, cm)
+		args = append(args, "--audit-policy-file=/etc/guard/audit/policy.yaml")
+	}
+
+	d.Spec.Template.Spec.Containers[0].Args = args
+
+	return extraObjs, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	withSinks := func(f func(o *Options)) Options {
+		o := NewOptions()
+		f(&o)
+		return o
+	}
+
+	testData := []struct {
+		testName    string
+		opts        Options
+		expectedErr []error
+	}{
+		{
+			"disabled by default",
+			NewOptions(),
+			nil,
+		},
+		{
+			"file and webhook",
+			withSinks(func(o *Options) {
+				o.Sinks = []string{SinkFile, SinkWebhook}
+				o.LogPath = "/var/log/guard/audit.log"
+				o.WebhookURL = "https://audit.example.com/events"
+			}),
+			nil,
+		},
+		{
+			"missing sink settings",
+			withSinks(func(o *Options) {
+				o.Sinks = []string{SinkFile, SinkWebhook}
+				o.WebhookURL = "audit"
+			}),
+			[]error{
+				errors.New("audit-log-path must be non-empty for file sink"),
+				errors.New("audit-webhook-url must be a valid url for webhook sink"),
+			},
+		},
+		{
+			"unknown sink and level",
+			withSinks(func(o *Options) {
+				o.Sinks = []string{"syslog"}
+				o.Level = "All"
+			}),
+			[]error{
+				errors.New(`invalid audit-level: unknown audit level "All", must be one of None, Metadata or Request`),
+				errors.New("audit sink syslog is not supported, must be one of file, stdout or webhook"),
+			},
+		},
+		{
+			"no buffer",
+			withSinks(func(o *Options) {
+				o.Sinks = []string{SinkStdout}
+				o.BufferSize = 0
+			}),
+			[]error{errors.New("audit-buffer-size must be positive")},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
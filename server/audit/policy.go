@@ -0,0 +1,197 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	PolicyAPIVersion = "guard.kubeguard.dev/v1alpha1"
+	PolicyKind       = "AuditPolicy"
+)
+
+type Level int
+
+const (
+	// LevelNone drops the event
+	LevelNone Level = iota
+	// LevelMetadata records the user, provider, decision and SAR attributes
+	LevelMetadata
+	// LevelRequest also records the user extra and a token fingerprint
+	LevelRequest
+)
+
+var levelNames = map[Level]string{
+	LevelNone:     "None",
+	LevelMetadata: "Metadata",
+	LevelRequest:  "Request",
+}
+
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return LevelNone, errors.Errorf("unknown audit level %q, must be one of None, Metadata or Request", s)
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// Policy selects the level of an event with the first matching rule.
+// Events matching no rule use the default level.
+type Policy struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Rules      []Rule `json:"rules"`
+}
+
+// Rule matches events by all of its non-empty fields. Users and groups
+// ending with * match by prefix. A rule without level drops the events.
+type Rule struct {
+	Level     Level      `json:"level"`
+	Kinds     []Kind     `json:"kinds,omitempty"`
+	Providers []string   `json:"providers,omitempty"`
+	Users     []string   `json:"users,omitempty"`
+	Groups    []string   `json:"groups,omitempty"`
+	Decisions []Decision `json:"decisions,omitempty"`
+}
+
+func LoadPolicyFile(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read audit policy file %s", file)
+	}
+	return ParsePolicy(data)
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, errors.Wrap(err, "failed to parse audit policy")
+	}
+	if p.APIVersion != PolicyAPIVersion {
+		return nil, errors.Errorf("unsupported audit policy apiVersion %q, expected %s", p.APIVersion, PolicyAPIVersion)
+	}
+	if p.Kind != PolicyKind {
+		return nil, errors.Errorf("unsupported audit policy kind %q, expected %s", p.Kind, PolicyKind)
+	}
+	for i, r := range p.Rules {
+		for _, k := range r.Kinds {
+			if k != KindTokenReview && k != KindSubjectAccessReview {
+				return nil, errors.Errorf("audit policy rule %d has unknown kind %s", i, k)
+			}
+		}
+		for _, d := range r.Decisions {
+			switch d {
+			case DecisionAllow, DecisionDeny, DecisionNoOpinion, DecisionError:
+			default:
+				return nil, errors.Errorf("audit policy rule %d has unknown decision %s", i, d)
+			}
+		}
+	}
+	return p, nil
+}
+
+// LevelFor returns the level of the first rule matching the event
+func (p *Policy) LevelFor(ev *Event, defaultLevel Level) Level {
+	if p == nil {
+		return defaultLevel
+	}
+	for _, r := range p.Rules {
+		if r.matches(ev) {
+			return r.Level
+		}
+	}
+	return defaultLevel
+}
+
+func (r Rule) matches(ev *Event) bool {
+	if len(r.Kinds) > 0 && !slices.Contains(r.Kinds, ev.Kind) {
+		return false
+	}
+	if len(r.Decisions) > 0 && !slices.Contains(r.Decisions, ev.Decision) {
+		return false
+	}
+	if len(r.Providers) > 0 && !containsFold(r.Providers, ev.Provider) {
+		return false
+	}
+	if len(r.Users) > 0 && !matchAny(r.Users, ev.User.Username) {
+		return false
+	}
+	if len(r.Groups) > 0 {
+		found := false
+		for _, g := range ev.User.Groups {
+			if matchAny(r.Groups, g) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, v string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(v, prefix) {
+				return true
+			}
+		} else if p == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	testData := []struct {
+		testName    string
+		policy      string
+		expectedErr string
+	}{
+		{
+			testName: "valid",
+			policy: `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: AuditPolicy
+rules:
+- level: None
+  users: ["system:serviceaccount:kube-system:*"]
+- level: Request
+  kinds: [SubjectAccessReview]
+  decisions: [deny, error]
+`,
+		},
+		{
+			testName:    "unsupported kind",
+			policy:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: Policy\n",
+			expectedErr: `unsupported audit policy kind "Policy", expected AuditPolicy`,
+		},
+		{
+			testName:    "unknown level",
+			policy:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuditPolicy\nrules:\n- level: RequestResponse\n",
+			expectedErr: `unknown audit level "RequestResponse", must be one of None, Metadata or Request`,
+		},
+		{
+			testName:    "unknown decision",
+			policy:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuditPolicy\nrules:\n- level: None\n  decisions: [allowed]\n",
+			expectedErr: "audit policy rule 0 has unknown decision allowed",
+		},
+		{
+			testName:    "unknown field",
+			policy:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: AuditPolicy\nrules:\n- level: None\n  verbs: [get]\n",
+			expectedErr: `failed to parse audit policy: error unmarshaling JSON: while decoding JSON: json: unknown field "verbs"`,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(test.policy))
+			if test.expectedErr == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestPolicyLevelFor(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Level: LevelNone, Users: []string{"system:serviceaccount:kube-system:*"}},
+		{Level: LevelNone, Kinds: []Kind{KindSubjectAccessReview}, Decisions: []Decision{DecisionNoOpinion}},
+		{Level: LevelRequest, Providers: []string{"azure"}, Groups: []string{"admins"}},
+	}}
+
+	testData := []struct {
+		testName string
+		event    Event
+		expected Level
+	}{
+		{
+			"user prefix",
+			Event{Kind: KindTokenReview, User: User{Username: "system:serviceaccount:kube-system:coredns"}},
+			LevelNone,
+		},
+		{
+			"kind and decision",
+			Event{Kind: KindSubjectAccessReview, Decision: DecisionNoOpinion, User: User{Username: "nahid"}},
+			LevelNone,
+		},
+		{
+			"provider and group",
+			Event{Kind: KindTokenReview, Provider: "Azure", Decision: DecisionAllow, User: User{Username: "nahid", Groups: []string{"dev", "admins"}}},
+			LevelRequest,
+		},
+		{
+			"no match uses default",
+			Event{Kind: KindTokenReview, Provider: "azure", Decision: DecisionAllow, User: User{Username: "nahid", Groups: []string{"dev"}}},
+			LevelMetadata,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			assert.Equal(t, test.expected, policy.LevelFor(&test.event, LevelMetadata))
+		})
+	}
+
+	var nilPolicy *Policy
+	assert.Equal(t, LevelRequest, nilPolicy.LevelFor(&Event{}, LevelRequest))
+}
@@ -0,0 +1,144 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go.kubeguard.dev/guard/util/httpclient"
+
+	"github.com/pkg/errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	SinkFile    = "file"
+	SinkStdout  = "stdout"
+	SinkWebhook = "webhook"
+)
+
+// Sink writes batches of audit events
+type Sink interface {
+	Write(events []*Event) error
+	Close() error
+}
+
+// jsonLinesSink writes one JSON object per line
+type jsonLinesSink struct {
+	w io.WriteCloser
+}
+
+func (s *jsonLinesSink) Write(events []*Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+func (s *jsonLinesSink) Close() error {
+	return s.w.Close()
+}
+
+// NewFileSink writes events to a file rotated by size
+func NewFileSink(opts Options) Sink {
+	return &jsonLinesSink{w: &lumberjack.Logger{
+		Filename:   opts.LogPath,
+		MaxSize:    opts.LogMaxSizeMB,
+		MaxBackups: opts.LogMaxBackups,
+		MaxAge:     opts.LogMaxAgeDays,
+		Compress:   opts.LogCompress,
+	}}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func NewStdoutSink() Sink {
+	return &jsonLinesSink{w: nopCloser{os.Stdout}}
+}
+
+// EventList is the body posted to the audit webhook
+type EventList struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Items      []*Event `json:"items"`
+}
+
+type webhookSink struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+}
+
+// NewWebhookSink posts batches of events as an EventList to a URL
+func NewWebhookSink(opts Options) Sink {
+	return &webhookSink{
+		url:     opts.WebhookURL,
+		timeout: opts.WebhookTimeout,
+		client:  httpclient.DefaultHTTPClient,
+	}
+}
+
+func (s *webhookSink) Write(events []*Event) error {
+	body, err := json.Marshal(EventList{
+		APIVersion: PolicyAPIVersion,
+		Kind:       "EventList",
+		Items:      events,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send audit events")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("audit webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
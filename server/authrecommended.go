@@ -17,13 +17,20 @@ limitations under the License.
 package server
 
 import (
+	"go.kubeguard.dev/guard/auth/cache"
 	"go.kubeguard.dev/guard/auth/providers"
 	"go.kubeguard.dev/guard/auth/providers/azure"
+	"go.kubeguard.dev/guard/auth/providers/ci"
+	"go.kubeguard.dev/guard/auth/providers/eks"
 	"go.kubeguard.dev/guard/auth/providers/github"
 	"go.kubeguard.dev/guard/auth/providers/gitlab"
 	"go.kubeguard.dev/guard/auth/providers/google"
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
 	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/auth/providers/oidc"
 	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/auth/transform"
+	"go.kubeguard.dev/guard/server/audit"
 
 	"github.com/spf13/pflag"
 )
@@ -31,45 +38,76 @@ import (
 type AuthRecommendedOptions struct {
 	SecureServing SecureServingOptions
 	NTP           NTPOptions
+	Tracing       TracingOptions
+	RateLimit     RateLimitOptions
 	Github        github.Options
 	Gitlab        gitlab.Options
 	Token         token.Options
 	Google        google.Options
 	Azure         azure.Options
 	LDAP          ldap.Options
+	OIDC          oidc.Options
+	CI            ci.Options
+	EKS           eks.Options
+	Htpasswd      htpasswd.Options
 	AuthProvider  providers.AuthProviders
+	AuthnCache    cache.Options
+	Audit         audit.Options
+	Transform     transform.Options
 }
 
 func NewAuthRecommendedOptions() *AuthRecommendedOptions {
 	return &AuthRecommendedOptions{
 		SecureServing: NewSecureServingOptions(),
 		NTP:           NewNTPOptions(),
+		Tracing:       NewTracingOptions(),
+		RateLimit:     NewRateLimitOptions(),
 		Github:        github.NewOptions(),
 		Gitlab:        gitlab.NewOptions(),
 		Azure:         azure.NewOptions(),
 		Token:         token.NewOptions(),
 		Google:        google.NewOptions(),
 		LDAP:          ldap.NewOptions(),
+		OIDC:          oidc.NewOptions(),
+		CI:            ci.NewOptions(),
+		EKS:           eks.NewOptions(),
+		Htpasswd:      htpasswd.NewOptions(),
+		AuthnCache:    cache.NewOptions(),
+		Audit:         audit.NewOptions(),
+		Transform:     transform.NewOptions(),
 	}
 }
 
 func (o *AuthRecommendedOptions) AddFlags(fs *pflag.FlagSet) {
 	o.SecureServing.AddFlags(fs)
 	o.NTP.AddFlags(fs)
+	o.Tracing.AddFlags(fs)
+	o.RateLimit.AddFlags(fs)
 	o.AuthProvider.AddFlags(fs)
+	o.AuthnCache.AddFlags(fs)
+	o.Audit.AddFlags(fs)
+	o.Transform.AddFlags(fs)
 	o.Github.AddFlags(fs)
 	o.Gitlab.AddFlags(fs)
 	o.Token.AddFlags(fs)
 	o.Google.AddFlags(fs)
 	o.Azure.AddFlags(fs)
 	o.LDAP.AddFlags(fs)
+	o.OIDC.AddFlags(fs)
+	o.CI.AddFlags(fs)
+	o.EKS.AddFlags(fs)
+	o.Htpasswd.AddFlags(fs)
 }
 
 func (o *AuthRecommendedOptions) Validate() []error {
 	var errs []error
 	errs = append(errs, o.SecureServing.Validate()...)
 	errs = append(errs, o.NTP.Validate()...)
+	errs = append(errs, o.Tracing.Validate()...)
+	errs = append(errs, o.RateLimit.Validate()...)
 	errs = append(errs, o.AuthProvider.Validate()...)
+	errs = append(errs, o.AuthnCache.Validate()...)
+	errs = append(errs, o.Audit.Validate()...)
 
 	if o.AuthProvider.Has(github.OrgType) {
 		errs = append(errs, o.Github.Validate()...)
@@ -89,6 +127,18 @@ func (o *AuthRecommendedOptions) Validate() []error {
 	if o.AuthProvider.Has(ldap.OrgType) {
 		errs = append(errs, o.LDAP.Validate()...)
 	}
+	if o.AuthProvider.Has(oidc.OrgType) {
+		errs = append(errs, o.OIDC.Validate()...)
+	}
+	if o.AuthProvider.Has(ci.OrgType) {
+		errs = append(errs, o.CI.Validate()...)
+	}
+	if o.AuthProvider.Has(eks.OrgType) {
+		errs = append(errs, o.EKS.Validate()...)
+	}
+	if o.AuthProvider.Has(htpasswd.OrgType) {
+		errs = append(errs, o.Htpasswd.Validate()...)
+	}
 
 	return errs
 }
@@ -22,6 +22,10 @@ import (
 
 	"go.kubeguard.dev/guard/authz"
 	"go.kubeguard.dev/guard/authz/providers/azure"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
+	"go.kubeguard.dev/guard/server/audit"
+	azureutils "go.kubeguard.dev/guard/util/azure"
 	errutils "go.kubeguard.dev/guard/util/error"
 
 	"github.com/pkg/errors"
@@ -33,47 +37,136 @@ type Authzhandler struct {
 	AuthRecommendedOptions  *AuthRecommendedOptions
 	AuthzRecommendedOptions *AuthzRecommendedOptions
 	Store                   authz.Store
+	PolicyAuthorizer        *policy.Authorizer
+	CELAuthorizer           *cel.Authorizer
+	Auditor                 *audit.Auditor
 }
 
 func (s *Authzhandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	klog.Infof("Recieved subject access review request")
+	ev := audit.NewEvent(audit.KindSubjectAccessReview, req)
+	spec, resp, err := s.review(req, ev)
+	writeAuthzResponse(w, spec, resp, err)
+
+	if s.Auditor != nil {
+		ev.SetSubject(spec)
+		ev.Decision, ev.Code = authzDecision(resp, err)
+		if err != nil {
+			ev.Reason = err.Error()
+		} else if resp != nil {
+			ev.Reason = resp.Reason
+		}
+		s.Auditor.Log(ev)
+	}
+}
+
+// review checks a SubjectAccessReview request. The audit ID is passed to the
+// provider as request ID.
+func (s *Authzhandler) review(req *http.Request, ev *audit.Event) (*authzv1.SubjectAccessReviewSpec, *authzv1.SubjectAccessReviewStatus, error) {
 	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
-		writeAuthzResponse(w, nil, nil, errutils.WithCode(errors.New("Missing client certificate"), http.StatusBadRequest))
-		return
+		return nil, nil, errutils.WithCode(errors.New("Missing client certificate"), http.StatusBadRequest)
 	}
 	crt := req.TLS.PeerCertificates[0]
-	if len(crt.Subject.Organization) == 0 {
-		writeAuthzResponse(w, nil, nil, errutils.WithCode(errors.New("Client certificate is missing organization"), http.StatusBadRequest))
-		return
+	chain := s.AuthzRecommendedOptions.AuthzProvider.Chain
+	if len(crt.Subject.Organization) == 0 && len(chain) == 0 {
+		return nil, nil, errutils.WithCode(errors.New("Client certificate is missing organization"), http.StatusBadRequest)
+	}
+	var org string
+	if len(crt.Subject.Organization) > 0 {
+		org = crt.Subject.Organization[0]
 	}
-	org := crt.Subject.Organization[0]
+	ev.Provider = strings.ToLower(org)
 
 	data := authzv1.SubjectAccessReview{}
 	err := json.NewDecoder(req.Body).Decode(&data)
 	if err != nil {
-		writeAuthzResponse(w, nil, nil, errutils.WithCode(errors.Wrap(err, "Failed to parse request"), http.StatusBadRequest))
-		return
+		return nil, nil, errutils.WithCode(errors.Wrap(err, "Failed to parse request"), http.StatusBadRequest)
 	}
 
-	if !s.AuthzRecommendedOptions.AuthzProvider.Has(org) {
-		writeAuthzResponse(w, &data.Spec, nil, errutils.WithCode(errors.Errorf("guard does not provide service for %v", org), http.StatusBadRequest))
-		return
+	ev.RequestID = ev.AuditID
+	ctx := azureutils.WithRequestID(req.Context(), ev.RequestID)
+	if len(chain) > 0 {
+		provider, resp, err := checkAuthzChain(ctx, chain, s.AuthzRecommendedOptions.AuthzProvider.ChainErrorPolicy, &data.Spec, s.Store, func(name string) (authz.Interface, error) {
+			client, err := s.getAuthzProviderClient(name)
+			if err != nil {
+				return nil, err
+			}
+			return withAuthzTracing(client, strings.ToLower(name)), nil
+		})
+		ev.Provider = provider
+		return &data.Spec, resp, err
 	}
 
-	client, err := s.getAuthzProviderClient(org)
+	provider, found := s.authzProvider(org)
+	if !found {
+		return &data.Spec, nil, errutils.WithCode(errors.Errorf("guard does not provide service for %v", org), http.StatusBadRequest)
+	}
+
+	client, err := s.getAuthzProviderClient(provider)
 	if client == nil || err != nil {
-		writeAuthzResponse(w, &data.Spec, nil, errutils.WithCode(err, http.StatusInternalServerError))
-		return
+		return &data.Spec, nil, errutils.WithCode(err, http.StatusInternalServerError)
 	}
 
-	resp, err := client.Check(req.Context(), &data.Spec, s.Store)
-	writeAuthzResponse(w, &data.Spec, resp, err)
+	resp, err := withAuthzTracing(client, strings.ToLower(provider)).Check(ctx, &data.Spec, s.Store)
+	return &data.Spec, resp, err
+}
+
+// authzDecision maps the result of a SubjectAccessReview to an audit decision
+// and the HTTP code written by writeAuthzResponse
+func authzDecision(resp *authzv1.SubjectAccessReviewStatus, err error) (audit.Decision, int) {
+	if err != nil {
+		code := http.StatusOK
+		if v, ok := err.(errutils.HttpStatusCode); ok {
+			code = v.Code()
+		}
+		if code >= http.StatusInternalServerError {
+			return audit.DecisionError, code
+		}
+		return audit.DecisionDeny, code
+	}
+	switch {
+	case resp == nil || resp.Denied:
+		return audit.DecisionDeny, http.StatusOK
+	case resp.Allowed:
+		return audit.DecisionAllow, http.StatusOK
+	}
+	return audit.DecisionNoOpinion, http.StatusOK
+}
+
+// authzProvider returns the authorization provider for clients of org. The
+// policy and cel providers authorize users of every authentication provider,
+// the first of them configured is used if org is an authentication provider
+// but not an authorization provider itself. Other orgs are unknown.
+func (s *Authzhandler) authzProvider(org string) (string, bool) {
+	if s.AuthzRecommendedOptions.AuthzProvider.Has(org) {
+		return org, true
+	}
+	if !s.AuthRecommendedOptions.AuthProvider.Has(org) {
+		return "", false
+	}
+	for _, p := range s.AuthzRecommendedOptions.AuthzProvider.Providers {
+		switch p = strings.ToLower(p); p {
+		case policy.OrgType, cel.OrgType:
+			return p, true
+		}
+	}
+	return "", false
 }
 
 func (s *Authzhandler) getAuthzProviderClient(org string) (authz.Interface, error) {
 	switch strings.ToLower(org) {
 	case azure.OrgType:
 		return azure.New(s.AuthzRecommendedOptions.Azure, s.AuthRecommendedOptions.Azure)
+	case policy.OrgType:
+		if s.PolicyAuthorizer == nil {
+			return nil, errors.New("policy authorizer is not initialized")
+		}
+		return s.PolicyAuthorizer, nil
+	case cel.OrgType:
+		if s.CELAuthorizer == nil {
+			return nil, errors.New("cel authorizer is not initialized")
+		}
+		return s.CELAuthorizer, nil
 	}
 
 	return nil, errors.Errorf("Client is using unknown organization %s", org)
@@ -0,0 +1,58 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"go.kubeguard.dev/guard/auth/providers/github"
+	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/authz/providers/azure"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthzProvider(t *testing.T) {
+	handler := Authzhandler{
+		AuthRecommendedOptions:  NewAuthRecommendedOptions(),
+		AuthzRecommendedOptions: NewAuthzRecommendedOptions(),
+	}
+	handler.AuthRecommendedOptions.AuthProvider.Providers = []string{github.OrgType, ldap.OrgType}
+	handler.AuthzRecommendedOptions.AuthzProvider.Providers = []string{azure.OrgType, cel.OrgType, policy.OrgType}
+
+	testData := []struct {
+		testName         string
+		org              string
+		expectedProvider string
+		expectedFound    bool
+	}{
+		{"authorization provider", "Azure", "Azure", true},
+		{"authentication provider", "GitHub", cel.OrgType, true},
+		{"unknown org", "gitlab", "", false},
+		{"missing org", "", "", false},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			provider, found := handler.authzProvider(test.org)
+			assert.Equal(t, test.expectedProvider, provider)
+			assert.Equal(t, test.expectedFound, found)
+		})
+	}
+}
@@ -20,29 +20,38 @@ import (
 	authz "go.kubeguard.dev/guard/authz/providers"
 	"go.kubeguard.dev/guard/authz/providers/azure"
 	"go.kubeguard.dev/guard/authz/providers/azure/options"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
 
 	"github.com/spf13/pflag"
 )
 
 type AuthzRecommendedOptions struct {
 	Azure         options.Options
+	Policy        policy.Options
+	CEL           cel.Options
 	AuthzProvider authz.AuthzProviders
 }
 
 func NewAuthzRecommendedOptions() *AuthzRecommendedOptions {
 	return &AuthzRecommendedOptions{
-		Azure: options.NewOptions(),
+		Azure:         options.NewOptions(),
+		Policy:        policy.NewOptions(),
+		CEL:           cel.NewOptions(),
+		AuthzProvider: authz.NewAuthzProviders(),
 	}
 }
 
 func (o *AuthzRecommendedOptions) AddFlags(fs *pflag.FlagSet) {
 	o.Azure.AddFlags(fs)
+	o.Policy.AddFlags(fs)
+	o.CEL.AddFlags(fs)
 	o.AuthzProvider.AddFlags(fs)
 }
 
 func (o *AuthzRecommendedOptions) Validate(opts *AuthRecommendedOptions) []error {
 	var errs []error
-	if len(o.AuthzProvider.Providers) > 0 {
+	if len(o.AuthzProvider.Providers) > 0 || len(o.AuthzProvider.Chain) > 0 {
 		errs = append(errs, o.AuthzProvider.Validate()...)
 	}
 
@@ -50,5 +59,13 @@ func (o *AuthzRecommendedOptions) Validate(opts *AuthRecommendedOptions) []error
 		errs = append(errs, o.Azure.Validate(opts.Azure)...)
 	}
 
+	if o.AuthzProvider.Has(policy.OrgType) {
+		errs = append(errs, o.Policy.Validate()...)
+	}
+
+	if o.AuthzProvider.Has(cel.OrgType) {
+		errs = append(errs, o.CEL.Validate()...)
+	}
+
 	return errs
 }
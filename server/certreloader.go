@@ -0,0 +1,150 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	certutil "gomodules.xyz/cert"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/fsnotify"
+)
+
+// certReloader holds the serving certificate and the client CA pool, so they
+// can be replaced while the server is running
+type certReloader struct {
+	caCertFile string
+	certFile   string
+	keyFile    string
+
+	lock    sync.RWMutex
+	cert    *tls.Certificate
+	caCerts []*x509.Certificate
+	caPool  *x509.CertPool
+}
+
+func newCertReloader(opts SecureServingOptions) (*certReloader, error) {
+	r := &certReloader{
+		caCertFile: opts.CACertFile,
+		certFile:   opts.CertFile,
+		keyFile:    opts.KeyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and CA files. On error the previously
+// loaded material is kept.
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load server certificate")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to parse server certificate")
+	}
+	cert.Leaf = leaf
+
+	caCert, err := os.ReadFile(r.caCertFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read CA cert file")
+	}
+	caCerts, err := certutil.ParseCertsPEM(caCert)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse CA cert file")
+	}
+	caPool := x509.NewCertPool()
+	for _, c := range caCerts {
+		caPool.AddCert(c)
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.caCerts = caCerts
+	r.caPool = caPool
+	r.lock.Unlock()
+
+	servingCertExpiry.Set(float64(leaf.NotAfter.Unix()))
+	klog.Infof("loaded server certificate %s valid until %s", leaf.Subject.CommonName, leaf.NotAfter)
+	return nil
+}
+
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// Check returns an error if the serving certificate or a CA certificate is
+// not valid at the current time
+func (r *certReloader) Check(_ context.Context) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	now := time.Now()
+	for _, c := range append([]*x509.Certificate{r.cert.Leaf}, r.caCerts...) {
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			return errors.Errorf("certificate %s is only valid from %s until %s", c.Subject.CommonName, c.NotBefore, c.NotAfter)
+		}
+	}
+	return nil
+}
+
+func (r *certReloader) ClientCAs() *x509.CertPool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.caPool
+}
+
+// GetConfigForClient returns a func for tls.Config.GetConfigForClient that
+// serves every handshake with the current client CA pool
+func (r *certReloader) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.ClientCAs()
+		return cfg, nil
+	}
+}
+
+// Watch reloads the files when a mounted secret or configmap is updated
+func (r *certReloader) Watch(stopCh <-chan struct{}) error {
+	dirs := map[string]bool{}
+	for _, f := range []string{r.caCertFile, r.certFile, r.keyFile} {
+		dirs[filepath.Dir(f)] = true
+	}
+	for dir := range dirs {
+		w := fsnotify.Watcher{
+			WatchDir: dir,
+			Reload:   r.Reload,
+		}
+		if err := w.Run(stopCh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
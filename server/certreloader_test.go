@@ -0,0 +1,143 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gomodules.xyz/blobfs"
+	"gomodules.xyz/cert"
+	"gomodules.xyz/cert/certstore"
+)
+
+// writePKI issues a new CA and server cert pair into dir
+func writePKI(t *testing.T, dir string) (caCert []byte, serverCert *x509.Certificate) {
+	store, err := certstore.New(blobfs.NewInMemoryFS(), "/pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.InitCA(); err != nil {
+		t.Fatal(err)
+	}
+	crt, key, err := store.NewServerCertPairBytes(cert.AltNames{DNSNames: []string{"guard"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"ca.crt":  store.CACertBytes(),
+		"tls.crt": crt,
+		"tls.key": key,
+	}
+	for name, data := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	certs, err := cert.ParseCertsPEM(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.CACertBytes(), certs[0]
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	opts := SecureServingOptions{
+		CACertFile: filepath.Join(dir, "ca.crt"),
+		CertFile:   filepath.Join(dir, "tls.crt"),
+		KeyFile:    filepath.Join(dir, "tls.key"),
+	}
+
+	_, oldCert := writePKI(t, dir)
+	r, err := newCertReloader(opts)
+	if err != nil {
+		t.Fatalf("Error when loading certificates. reason: %v", err)
+	}
+
+	got, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, oldCert.Raw, got.Certificate[0])
+	}
+	assert.Nil(t, r.Check(context.Background()))
+	oldPool := r.ClientCAs()
+
+	// rotate the certificates
+	caCert, newCert := writePKI(t, dir)
+	if !assert.Nil(t, r.Reload()) {
+		return
+	}
+	got, err = r.GetCertificate(&tls.ClientHelloInfo{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, newCert.Raw, got.Certificate[0])
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12, ClientAuth: tls.VerifyClientCertIfGiven}
+	base.GetConfigForClient = r.GetConfigForClient(base)
+	cfg, err := base.GetConfigForClient(&tls.ClientHelloInfo{})
+	if assert.Nil(t, err) {
+		expected := x509.NewCertPool()
+		expected.AppendCertsFromPEM(caCert)
+		assert.True(t, expected.Equal(cfg.ClientCAs), "client CA pool must be reloaded")
+		assert.False(t, oldPool.Equal(cfg.ClientCAs))
+		assert.Nil(t, cfg.GetConfigForClient)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+	}
+
+	// a broken file keeps the previous certificates
+	if err = os.WriteFile(opts.KeyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, r.Reload())
+	got, err = r.GetCertificate(&tls.ClientHelloInfo{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, newCert.Raw, got.Certificate[0])
+	}
+}
+
+func TestCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := newCertReloader(SecureServingOptions{
+		CACertFile: filepath.Join(dir, "ca.crt"),
+		CertFile:   filepath.Join(dir, "tls.crt"),
+		KeyFile:    filepath.Join(dir, "tls.key"),
+	})
+	assert.NotNil(t, err)
+}
+
+func TestCertReloaderCheckExpired(t *testing.T) {
+	dir := t.TempDir()
+	writePKI(t, dir)
+	r, err := newCertReloader(SecureServingOptions{
+		CACertFile: filepath.Join(dir, "ca.crt"),
+		CertFile:   filepath.Join(dir, "tls.crt"),
+		KeyFile:    filepath.Join(dir, "tls.key"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.cert.Leaf.NotAfter = time.Now().Add(-time.Minute)
+	assert.NotNil(t, r.Check(context.Background()))
+}
@@ -0,0 +1,138 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/authz"
+	authzproviders "go.kubeguard.dev/guard/authz/providers"
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/klog/v2"
+)
+
+// staticTokenProvider adapts the token file authenticator, which does not
+// take a context, to auth.Interface so it can be part of the chain
+type staticTokenProvider struct {
+	*token.Authenticator
+}
+
+func (p staticTokenProvider) Check(_ context.Context, t string) (*authv1.UserInfo, error) {
+	return p.Authenticator.Check(t)
+}
+
+func (s *Server) getChainProviderClient(ctx context.Context, name, commonName string) (auth.Interface, error) {
+	if strings.EqualFold(name, token.OrgType) {
+		if s.TokenAuthenticator == nil {
+			return nil, errors.New("token authenticator is not configured")
+		}
+		return s.rateLimits.limitProvider(instrument(staticTokenProvider{s.TokenAuthenticator}, token.OrgType), token.OrgType), nil
+	}
+	client, err := s.getAuthProviderClient(ctx, name, commonName)
+	if err != nil {
+		return nil, err
+	}
+	return s.rateLimits.limitProvider(s.withCache(instrument(client, name), name, commonName), name), nil
+}
+
+// checkChain tries the providers in order. It stops at the first provider
+// that authenticates the token or definitively rejects it, see auth.Reject.
+// Otherwise the errors of all providers are reported together, with the
+// highest status code of the providers if one of them failed upstream or was
+// rate limited, so the apiserver does not take the failure for an invalid
+// token. The name of the provider that decided is returned, or empty if no
+// provider did.
+func checkChain(ctx context.Context, names []string, tokenStr string, getClient func(name string) (auth.Interface, error)) (string, *authv1.UserInfo, error) {
+	var msgs []string
+	code := http.StatusUnauthorized
+	for _, name := range names {
+		client, err := getClient(name)
+		if err == nil {
+			var resp *authv1.UserInfo
+			resp, err = client.Check(ctx, tokenStr)
+			if err == nil {
+				klog.V(7).Infof("token authenticated by %s in auth chain", name)
+				return name, resp, nil
+			}
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, err))
+		if auth.IsRejected(err) {
+			klog.V(7).Infof("token rejected by %s in auth chain", name)
+			return name, nil, errors.New(strings.Join(msgs, "; "))
+		}
+		var v errutils.HttpStatusCode
+		if errors.As(err, &v) && v.Code() > code {
+			code = v.Code()
+		}
+	}
+	err := errors.New(strings.Join(msgs, "; "))
+	if code >= http.StatusInternalServerError || code == http.StatusTooManyRequests {
+		return "", nil, errutils.WithCode(err, code)
+	}
+	return "", nil, err
+}
+
+// checkAuthzChain asks the providers in order and returns the first answer
+// that allows or denies the request. Providers without an opinion pass the
+// request on to the next provider. Errors of a provider are handled as set by
+// errorPolicy. The name of the provider that decided is returned, or empty if
+// no provider did.
+func checkAuthzChain(ctx context.Context, names []string, errorPolicy string, request *authzv1.SubjectAccessReviewSpec, store authz.Store, getClient func(name string) (authz.Interface, error)) (string, *authzv1.SubjectAccessReviewStatus, error) {
+	var msgs []string
+	for _, name := range names {
+		client, err := getClient(name)
+		var resp *authzv1.SubjectAccessReviewStatus
+		if err == nil {
+			resp, err = client.Check(ctx, request, store)
+			if err == nil && resp == nil {
+				err = errors.New("no response")
+			}
+		}
+		if err != nil {
+			switch errorPolicy {
+			case authzproviders.ChainErrorSkip:
+				klog.V(3).Infof("skipping %s in authz chain: %v", name, err)
+				msgs = append(msgs, fmt.Sprintf("%s: %v", name, err))
+				continue
+			case authzproviders.ChainErrorDeny:
+				klog.V(3).Infof("denying request after %s failed in authz chain: %v", name, err)
+				return name, &authzv1.SubjectAccessReviewStatus{Denied: true, Reason: fmt.Sprintf("%s: %v", name, err)}, nil
+			default:
+				code := http.StatusInternalServerError
+				if v, ok := err.(errutils.HttpStatusCode); ok {
+					code = v.Code()
+				}
+				return name, nil, errutils.WithCode(errors.Errorf("%s: %v", name, err), code)
+			}
+		}
+		if resp.Allowed || resp.Denied {
+			klog.V(7).Infof("request decided by %s in authz chain, allowed: %v", name, resp.Allowed)
+			return name, resp, nil
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, resp.Reason))
+	}
+	return "", &authzv1.SubjectAccessReviewStatus{Reason: strings.Join(msgs, "; ")}, nil
+}
@@ -0,0 +1,534 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/authz"
+	authzproviders "go.kubeguard.dev/guard/authz/providers"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
+	"go.kubeguard.dev/guard/server/audit"
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gomodules.xyz/blobfs"
+	"gomodules.xyz/cert"
+	"gomodules.xyz/cert/certstore"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+)
+
+type fakeProvider struct {
+	name   string
+	tokens map[string]string // token -> username
+	reject bool
+	calls  *int
+}
+
+func (f fakeProvider) UID() string {
+	return f.name
+}
+
+func (f fakeProvider) Check(_ context.Context, t string) (*authv1.UserInfo, error) {
+	*f.calls++
+	if user, ok := f.tokens[t]; ok {
+		return &authv1.UserInfo{Username: user}, nil
+	}
+	if f.reject {
+		return nil, auth.Reject(errors.New("user is disabled"))
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestCheckChain(t *testing.T) {
+	testData := []struct {
+		testName      string
+		token         string
+		expectedUser  *authv1.UserInfo
+		expectedErr   string
+		expectedCalls map[string]int
+		provider      string
+	}{
+		{
+			"first provider succeeds",
+			"token-a",
+			&authv1.UserInfo{Username: "alice"},
+			"",
+			map[string]int{"a": 1, "b": 0, "c": 0},
+			"a",
+		},
+		{
+			"later provider succeeds",
+			"token-c",
+			&authv1.UserInfo{Username: "carol"},
+			"",
+			map[string]int{"a": 1, "b": 1, "c": 1},
+			"c",
+		},
+		{
+			"definitive rejection stops the chain",
+			"token-unknown-to-b",
+			nil,
+			"a: invalid token; b: user is disabled",
+			map[string]int{"a": 1, "b": 1, "c": 0},
+			"b",
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			calls := map[string]*int{"a": new(int), "b": new(int), "c": new(int)}
+			clients := map[string]auth.Interface{
+				"a": fakeProvider{name: "a", tokens: map[string]string{"token-a": "alice"}, calls: calls["a"]},
+				"b": fakeProvider{name: "b", tokens: map[string]string{"token-b": "bob"}, reject: test.token == "token-unknown-to-b", calls: calls["b"]},
+				"c": fakeProvider{name: "c", tokens: map[string]string{"token-c": "carol"}, calls: calls["c"]},
+			}
+
+			provider, resp, err := checkChain(context.Background(), []string{"a", "b", "c"}, test.token, func(name string) (auth.Interface, error) {
+				return clients[name], nil
+			})
+			assert.Equal(t, test.provider, provider)
+			if test.expectedUser == nil {
+				if assert.NotNil(t, err) {
+					assert.EqualError(t, err, test.expectedErr)
+					assert.False(t, auth.IsRejected(err), "aggregated error must not be a rejection itself")
+				}
+				assert.Nil(t, resp)
+			} else {
+				if assert.Nil(t, err) {
+					assert.Equal(t, test.expectedUser, resp)
+				}
+			}
+			for name, n := range test.expectedCalls {
+				assert.Equal(t, n, *calls[name], "unexpected number of calls to provider %s", name)
+			}
+		})
+	}
+}
+
+func TestCheckChainAggregatesErrors(t *testing.T) {
+	provider, resp, err := checkChain(context.Background(), []string{"a", "b"}, "token", func(name string) (auth.Interface, error) {
+		if name == "a" {
+			return nil, errors.New("provider is not configured")
+		}
+		return fakeProvider{name: name, calls: new(int)}, nil
+	})
+	assert.Empty(t, provider)
+	assert.Nil(t, resp)
+	assert.EqualError(t, err, "a: provider is not configured; b: invalid token")
+}
+
+func TestCheckChainStatusCode(t *testing.T) {
+	testData := []struct {
+		testName     string
+		errs         map[string]error
+		expectedCode int
+	}{
+		{
+			"invalid tokens",
+			map[string]error{"a": errors.New("invalid token"), "b": errutils.WithCode(errors.New("bad request"), http.StatusBadRequest)},
+			0,
+		},
+		{
+			"upstream error",
+			map[string]error{"a": errutils.WithCode(errors.New("unavailable"), http.StatusServiceUnavailable), "b": errors.New("invalid token")},
+			http.StatusServiceUnavailable,
+		},
+		{
+			"highest code",
+			map[string]error{"a": errutils.WithCode(errors.New("too many requests"), http.StatusTooManyRequests), "b": errors.Wrap(errutils.WithCode(errors.New("internal error"), http.StatusInternalServerError), "b")},
+			http.StatusInternalServerError,
+		},
+		{
+			"rate limited",
+			map[string]error{"a": errutils.WithCode(errors.New("too many requests"), http.StatusTooManyRequests), "b": errors.New("invalid token")},
+			http.StatusTooManyRequests,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			_, _, err := checkChain(context.Background(), []string{"a", "b"}, "token", func(name string) (auth.Interface, error) {
+				return nil, test.errs[name]
+			})
+			if !assert.NotNil(t, err) {
+				return
+			}
+			var code errutils.HttpStatusCode
+			if test.expectedCode == 0 {
+				assert.False(t, errors.As(err, &code))
+			} else if assert.True(t, errors.As(err, &code)) {
+				assert.Equal(t, test.expectedCode, code.Code())
+			}
+		})
+	}
+}
+
+func TestServeHTTPWithChain(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token.csv")
+	if err := os.WriteFile(tokenFile, []byte(`secret,alice,1001,"dev,ops"`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := Server{
+		AuthRecommendedOptions: NewAuthRecommendedOptions(),
+	}
+	srv.AuthRecommendedOptions.AuthProvider.Providers = []string{token.OrgType, ldap.OrgType}
+	srv.AuthRecommendedOptions.AuthProvider.Chain = []string{token.OrgType, ldap.OrgType}
+	srv.AuthRecommendedOptions.Token.AuthFile = tokenFile
+	srv.AuthRecommendedOptions.LDAP.ServerAddress = "127.0.0.1"
+	srv.AuthRecommendedOptions.LDAP.ServerPort = "1"
+	srv.TokenAuthenticator = token.New(srv.AuthRecommendedOptions.Token)
+	if err := srv.TokenAuthenticator.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	auditOpts := audit.NewOptions()
+	auditOpts.Sinks = []string{audit.SinkFile}
+	auditOpts.LogPath = filepath.Join(dir, "audit.log")
+	auditor, err := audit.New(auditOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Auditor = auditor
+
+	store, err := certstore.New(blobfs.NewInMemoryFS(), "/pki", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.InitCA(); err != nil {
+		t.Fatal(err)
+	}
+	// the chain does not depend on the client cert organization
+	pemCerts, _, err := store.NewClientCertPairBytes(cert.AltNames{DNSNames: []string{"guard"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := cert.ParseCertsPEM(pemCerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		testName      string
+		token         string
+		expectedCode  int
+		authenticated bool
+	}{
+		{"token file user", "secret", http.StatusOK, true},
+		{"unknown token", "not-a-valid-token", http.StatusUnauthorized, false},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			review := new(bytes.Buffer)
+			err := json.NewEncoder(review).Encode(authv1.TokenReview{Spec: authv1.TokenReviewSpec{Token: test.token}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "http://guard.test/tokenreviews", review)
+			req.TLS = &tls.ConnectionState{PeerCertificates: clientCert}
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+			out := authv1.TokenReview{}
+			if assert.Nil(t, json.NewDecoder(resp.Body).Decode(&out)) {
+				assert.Equal(t, test.authenticated, out.Status.Authenticated)
+				if test.authenticated {
+					assert.Equal(t, "alice", out.Status.User.Username)
+					assert.Equal(t, []string{"dev", "ops"}, out.Status.User.Groups)
+				} else {
+					assert.Contains(t, out.Status.Error, "token-auth: Invalid token; ldap: ")
+				}
+			}
+		})
+	}
+
+	// every review is audited with the provider that decided
+	auditor.Close()
+	data, err := os.ReadFile(auditOpts.LogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []audit.Event
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		ev := audit.Event{}
+		if assert.Nil(t, json.Unmarshal(line, &ev)) {
+			events = append(events, ev)
+		}
+	}
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, token.OrgType, events[0].Provider)
+		assert.Equal(t, audit.DecisionAllow, events[0].Decision)
+		assert.Equal(t, "alice", events[0].User.Username)
+		assert.Equal(t, []string{"dev", "ops"}, events[0].User.Groups)
+
+		assert.Empty(t, events[1].Provider)
+		assert.Equal(t, audit.DecisionDeny, events[1].Decision)
+		assert.Equal(t, http.StatusUnauthorized, events[1].Code)
+	}
+	assert.NotContains(t, string(data), "not-a-valid-token")
+	assert.NotContains(t, string(data), "secret")
+}
+
+type fakeAuthorizer struct {
+	resp  *authzv1.SubjectAccessReviewStatus
+	err   error
+	calls *int
+}
+
+func (f fakeAuthorizer) Check(_ context.Context, _ *authzv1.SubjectAccessReviewSpec, _ authz.Store) (*authzv1.SubjectAccessReviewStatus, error) {
+	*f.calls++
+	return f.resp, f.err
+}
+
+func TestCheckAuthzChain(t *testing.T) {
+	noOpinion := &authzv1.SubjectAccessReviewStatus{Reason: "no opinion"}
+	allowed := &authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: "allowed"}
+	denied := &authzv1.SubjectAccessReviewStatus{Denied: true, Reason: "denied"}
+	failed := errutils.WithCode(errors.New("rbac is down"), http.StatusTooManyRequests)
+
+	testData := []struct {
+		testName      string
+		responses     map[string]*authzv1.SubjectAccessReviewStatus
+		errs          map[string]error
+		errorPolicy   string
+		expectedResp  *authzv1.SubjectAccessReviewStatus
+		expectedErr   string
+		expectedCode  int
+		expectedCalls map[string]int
+		provider      string
+	}{
+		{
+			"first decisive answer wins",
+			map[string]*authzv1.SubjectAccessReviewStatus{"a": noOpinion, "b": denied, "c": allowed},
+			nil,
+			authzproviders.ChainErrorFail,
+			denied,
+			"",
+			0,
+			map[string]int{"a": 1, "b": 1, "c": 0},
+			"b",
+		},
+		{
+			"no provider has an opinion",
+			map[string]*authzv1.SubjectAccessReviewStatus{"a": noOpinion, "b": noOpinion, "c": noOpinion},
+			nil,
+			authzproviders.ChainErrorFail,
+			&authzv1.SubjectAccessReviewStatus{Reason: "a: no opinion; b: no opinion; c: no opinion"},
+			"",
+			0,
+			map[string]int{"a": 1, "b": 1, "c": 1},
+			"",
+		},
+		{
+			"skip errors",
+			map[string]*authzv1.SubjectAccessReviewStatus{"a": noOpinion, "c": allowed},
+			map[string]error{"b": failed},
+			authzproviders.ChainErrorSkip,
+			allowed,
+			"",
+			0,
+			map[string]int{"a": 1, "b": 1, "c": 1},
+			"c",
+		},
+		{
+			"skip errors without decision",
+			map[string]*authzv1.SubjectAccessReviewStatus{"a": noOpinion, "c": noOpinion},
+			map[string]error{"b": failed},
+			authzproviders.ChainErrorSkip,
+			&authzv1.SubjectAccessReviewStatus{Reason: "a: no opinion; b: rbac is down; c: no opinion"},
+			"",
+			0,
+			map[string]int{"a": 1, "b": 1, "c": 1},
+			"",
+		},
+		{
+			"deny on error",
+			map[string]*authzv1.SubjectAccessReviewStatus{"a": noOpinion, "c": allowed},
+			map[string]error{"b": failed},
+			authzproviders.ChainErrorDeny,
+			&authzv1.SubjectAccessReviewStatus{Denied: true, Reason: "b: rbac is down"},
+			"",
+			0,
+			map[string]int{"a": 1, "b": 1, "c": 0},
+			"b",
+		},
+		{
+			"fail on error keeps the code",
+			map[string]*authzv1.SubjectAccessReviewStatus{"a": noOpinion, "c": allowed},
+			map[string]error{"b": failed},
+			authzproviders.ChainErrorFail,
+			nil,
+			"b: rbac is down",
+			http.StatusTooManyRequests,
+			map[string]int{"a": 1, "b": 1, "c": 0},
+			"b",
+		},
+		{
+			"fail on error without code",
+			map[string]*authzv1.SubjectAccessReviewStatus{"b": allowed},
+			map[string]error{"a": errors.New("policy is not loaded")},
+			authzproviders.ChainErrorFail,
+			nil,
+			"a: policy is not loaded",
+			http.StatusInternalServerError,
+			map[string]int{"a": 1, "b": 0, "c": 0},
+			"a",
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			calls := map[string]*int{"a": new(int), "b": new(int), "c": new(int)}
+			provider, resp, err := checkAuthzChain(context.Background(), []string{"a", "b", "c"}, test.errorPolicy, &authzv1.SubjectAccessReviewSpec{User: "nahid"}, nil, func(name string) (authz.Interface, error) {
+				return fakeAuthorizer{resp: test.responses[name], err: test.errs[name], calls: calls[name]}, nil
+			})
+			assert.Equal(t, test.provider, provider)
+			if test.expectedErr != "" {
+				if assert.NotNil(t, err) {
+					assert.EqualError(t, err, test.expectedErr)
+					if v, ok := err.(errutils.HttpStatusCode); assert.True(t, ok) {
+						assert.Equal(t, test.expectedCode, v.Code())
+					}
+				}
+				assert.Nil(t, resp)
+			} else {
+				if assert.Nil(t, err) {
+					assert.Equal(t, test.expectedResp, resp)
+				}
+			}
+			for name, n := range test.expectedCalls {
+				assert.Equal(t, n, *calls[name], "unexpected number of calls to provider %s", name)
+			}
+		})
+	}
+}
+
+func TestAuthzServeHTTPWithChain(t *testing.T) {
+	dir := t.TempDir()
+	policyFile := filepath.Join(dir, "policy.yaml")
+	err := os.WriteFile(policyFile, []byte(`
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: AuthorizationPolicy
+rules:
+- name: break-glass
+  effect: Allow
+  groups: [break-glass]
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	celFile := filepath.Join(dir, "cel.yaml")
+	err = os.WriteFile(celFile, []byte(`
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: CELAuthorizationPolicy
+rules:
+- name: no-delete
+  effect: Deny
+  expression: verb == 'delete'
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewAuthzRecommendedOptions()
+	opts.AuthzProvider.Providers = []string{policy.OrgType, cel.OrgType}
+	opts.AuthzProvider.Chain = []string{policy.OrgType, cel.OrgType}
+	opts.Policy.PolicyFile = policyFile
+	opts.CEL.PolicyFile = celFile
+	handler := Authzhandler{
+		AuthRecommendedOptions:  NewAuthRecommendedOptions(),
+		AuthzRecommendedOptions: opts,
+		PolicyAuthorizer:        policy.New(opts.Policy),
+		CELAuthorizer:           cel.New(opts.CEL),
+	}
+	if err = handler.PolicyAuthorizer.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	if err = handler.CELAuthorizer.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := certstore.New(blobfs.NewInMemoryFS(), "/pki", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.InitCA(); err != nil {
+		t.Fatal(err)
+	}
+	// the chain does not depend on the client cert organization
+	pemCerts, _, err := store.NewClientCertPairBytes(cert.AltNames{DNSNames: []string{"guard"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := cert.ParseCertsPEM(pemCerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		testName string
+		groups   []string
+		status   authzv1.SubjectAccessReviewStatus
+	}{
+		{"break-glass rule before deny", []string{"break-glass"}, authzv1.SubjectAccessReviewStatus{Allowed: true, Reason: `allow by policy rule "break-glass"`}},
+		{"falls through to cel", []string{"dev"}, authzv1.SubjectAccessReviewStatus{Denied: true, Reason: `deny by cel rule "no-delete"`}},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			review := new(bytes.Buffer)
+			err := json.NewEncoder(review).Encode(authzv1.SubjectAccessReview{Spec: authzv1.SubjectAccessReviewSpec{
+				User:               "nahid",
+				Groups:             test.groups,
+				ResourceAttributes: &authzv1.ResourceAttributes{Verb: "delete", Resource: "pods"},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "http://guard.test/subjectaccessreviews", review)
+			req.TLS = &tls.ConnectionState{PeerCertificates: clientCert}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			out := authzv1.SubjectAccessReview{}
+			if assert.Nil(t, json.NewDecoder(resp.Body).Decode(&out)) {
+				assert.Equal(t, test.status, out.Status)
+			}
+		})
+	}
+}
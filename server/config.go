@@ -0,0 +1,264 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ConfigAPIVersion = "guard.kubeguard.dev/v1alpha1"
+	ConfigKind       = "GuardConfiguration"
+
+	// ConfigFlag is the flag used to pass the configuration file, it can
+	// not be set from the configuration file itself
+	ConfigFlag = "config"
+)
+
+// GuardConfiguration is the versioned configuration file of `guard run`.
+// Every key besides apiVersion and kind is the name of a server flag.
+// Flags sharing a dot separated prefix can be nested under the prefix,
+//
+//	apiVersion: guard.kubeguard.dev/v1alpha1
+//	kind: GuardConfiguration
+//	auth-providers: [azure]
+//	azure:
+//	  tenant-id: <tenant_id>
+//	  client-secret:
+//	    valueFrom:
+//	      file: /etc/guard/auth/azure/client-secret
+//
+// is the same as --auth-providers=azure --azure.tenant-id=<tenant_id>. Secrets
+// can be read from a file or an environment variable with a valueFrom map
+// holding a single file or env key. Lists are joined with commas.
+type GuardConfiguration struct {
+	APIVersion string
+	Kind       string
+	// Flags holds the flag values keyed by flag name
+	Flags map[string]string
+}
+
+// LoadConfigFile reads a GuardConfiguration from a YAML or JSON file
+func LoadConfigFile(file string) (*GuardConfiguration, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read config file %s", file)
+	}
+	return ParseConfig(data)
+}
+
+func ParseConfig(data []byte) (*GuardConfiguration, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to parse config file")
+	}
+
+	cfg := &GuardConfiguration{Flags: map[string]string{}}
+	cfg.APIVersion, _ = raw["apiVersion"].(string)
+	cfg.Kind, _ = raw["kind"].(string)
+	delete(raw, "apiVersion")
+	delete(raw, "kind")
+
+	if cfg.APIVersion != ConfigAPIVersion {
+		return nil, errors.Errorf("unsupported config apiVersion %q, expected %s", cfg.APIVersion, ConfigAPIVersion)
+	}
+	if cfg.Kind != ConfigKind {
+		return nil, errors.Errorf("unsupported config kind %q, expected %s", cfg.Kind, ConfigKind)
+	}
+
+	if err := flattenConfig("", raw, cfg.Flags); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func flattenConfig(prefix string, in map[string]interface{}, out map[string]string) error {
+	for k, v := range in {
+		name := prefix + k
+		if m, ok := v.(map[string]interface{}); ok && !isSecretRef(m) {
+			if err := flattenConfig(name+".", m, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := out[name]; ok {
+			return errors.Errorf("%s is set more than once", name)
+		}
+		val, err := configValue(name, v)
+		if err != nil {
+			return err
+		}
+		out[name] = val
+	}
+	return nil
+}
+
+// isSecretRef reports whether m is a {valueFrom: {file|env: ...}} reference.
+// A bare file key is not a reference, flags like policy.file nest the same way.
+func isSecretRef(m map[string]interface{}) bool {
+	if len(m) != 1 {
+		return false
+	}
+	_, ok := m["valueFrom"].(map[string]interface{})
+	return ok
+}
+
+func configValue(name string, v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			s, err := configValue(name, item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		ref, _ := val["valueFrom"].(map[string]interface{})
+		if len(ref) != 1 {
+			break
+		}
+		if path, ok := ref["file"].(string); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to read %s from file", name)
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+		if key, ok := ref["env"].(string); ok {
+			data, found := os.LookupEnv(key)
+			if !found {
+				return "", errors.Errorf("failed to read %s from env, %s is not set", name, key)
+			}
+			return data, nil
+		}
+	}
+	return "", errors.Errorf("%s has unsupported value %v", name, v)
+}
+
+// Apply sets the flags from the configuration. Flags given on the command
+// line take precedence over the configuration file.
+func (c *GuardConfiguration) Apply(fs *pflag.FlagSet) error {
+	names := make([]string, 0, len(c.Flags))
+	for name := range c.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if name == ConfigFlag {
+			errs = append(errs, errors.Errorf("%s can not be set in the config file", ConfigFlag))
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			errs = append(errs, errors.Errorf("unknown config key %s", name))
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		if err := fs.Set(name, c.Flags[name]); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid value for %s", name))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// LoadConfig applies the configuration file to the server flags and
+// validates the resulting options
+func (s *Server) LoadConfig(fs *pflag.FlagSet, file string) error {
+	cfg, err := LoadConfigFile(file)
+	if err != nil {
+		return err
+	}
+	if err = cfg.Apply(fs); err != nil {
+		return err
+	}
+
+	var errs []error
+	errs = append(errs, s.AuthRecommendedOptions.Validate()...)
+	errs = append(errs, s.AuthzRecommendedOptions.Validate(s.AuthRecommendedOptions)...)
+	if len(errs) > 0 {
+		return errors.Wrap(utilerrors.NewAggregate(errs), fmt.Sprintf("invalid configuration in %s", file))
+	}
+	return nil
+}
+
+// NewConfigFromArgs converts a list of --name=value args into a
+// GuardConfiguration, nesting flags by their dot separated prefix
+func NewConfigFromArgs(args []string) ([]byte, error) {
+	flat := map[string]string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			return nil, errors.Errorf("unsupported arg %s", arg)
+		}
+		name, val, found := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !found {
+			val = "true"
+		}
+		flat[name] = val
+	}
+
+	out := map[string]interface{}{
+		"apiVersion": ConfigAPIVersion,
+		"kind":       ConfigKind,
+	}
+	for name, val := range flat {
+		parts := strings.Split(name, ".")
+		m := out
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := m[p].(map[string]interface{})
+			if !ok {
+				if _, exists := m[p]; exists {
+					// a flag with the same name as the prefix, keep the name flat
+					m = nil
+					break
+				}
+				child = map[string]interface{}{}
+				m[p] = child
+			}
+			m = child
+		}
+		if m == nil {
+			out[name] = val
+			continue
+		}
+		m[parts[len(parts)-1]] = val
+	}
+	return yaml.Marshal(out)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "client-secret")
+	if err := os.WriteFile(secretFile, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GUARD_TEST_BIND_PASSWORD", "pa55")
+
+	testData := []struct {
+		testName    string
+		config      string
+		expected    map[string]string
+		expectedErr string
+	}{
+		{
+			testName: "nested and flat keys",
+			config: `
+apiVersion: guard.kubeguard.dev/v1alpha1
+kind: GuardConfiguration
+auth-providers: [azure, ldap]
+authn-cache-success-ttl: 1m
+azure:
+  tenant-id: tenant
+  client-secret:
+    valueFrom:
+      file: ` + secretFile + `
+  use-group-uid: false
+ldap.server-port: 636
+ldap:
+  bind-password:
+    valueFrom:
+      env: GUARD_TEST_BIND_PASSWORD
+policy:
+  file: /etc/guard/authz/policy/policy.yaml
+`,
+			expected: map[string]string{
+				"auth-providers":          "azure,ldap",
+				"authn-cache-success-ttl": "1m",
+				"azure.tenant-id":         "tenant",
+				"azure.client-secret":     "s3cr3t",
+				"azure.use-group-uid":     "false",
+				"ldap.server-port":        "636",
+				"ldap.bind-password":      "pa55",
+				"policy.file":             "/etc/guard/authz/policy/policy.yaml",
+			},
+		},
+		{
+			testName:    "json",
+			config:      `{"apiVersion": "guard.kubeguard.dev/v1alpha1", "kind": "GuardConfiguration", "github": {"base-url": "https://github.example.com"}}`,
+			expected:    map[string]string{"github.base-url": "https://github.example.com"},
+			expectedErr: "",
+		},
+		{
+			testName:    "unsupported version",
+			config:      "apiVersion: guard.kubeguard.dev/v1\nkind: GuardConfiguration\n",
+			expectedErr: `unsupported config apiVersion "guard.kubeguard.dev/v1", expected guard.kubeguard.dev/v1alpha1`,
+		},
+		{
+			testName:    "unsupported kind",
+			config:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: Config\n",
+			expectedErr: `unsupported config kind "Config", expected GuardConfiguration`,
+		},
+		{
+			testName:    "duplicate key",
+			config:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: GuardConfiguration\nazure.tenant-id: a\nazure:\n  tenant-id: b\n",
+			expectedErr: "azure.tenant-id is set more than once",
+		},
+		{
+			testName:    "missing env",
+			config:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: GuardConfiguration\nazure:\n  client-secret:\n    valueFrom:\n      env: GUARD_TEST_MISSING\n",
+			expectedErr: "failed to read azure.client-secret from env, GUARD_TEST_MISSING is not set",
+		},
+		{
+			testName:    "malformed secret reference",
+			config:      "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: GuardConfiguration\nazure:\n  client-secret:\n    valueFrom:\n      secret: x\n",
+			expectedErr: "azure.client-secret has unsupported value map[valueFrom:map[secret:x]]",
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(test.config))
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, test.expected, cfg.Flags)
+			}
+		})
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	newFlags := func() (*Server, *pflag.FlagSet) {
+		srv := &Server{
+			AuthRecommendedOptions:  NewAuthRecommendedOptions(),
+			AuthzRecommendedOptions: NewAuthzRecommendedOptions(),
+		}
+		fs := pflag.NewFlagSet("run", pflag.ContinueOnError)
+		srv.AddFlags(fs)
+		return srv, fs
+	}
+
+	t.Run("command line overrides file", func(t *testing.T) {
+		srv, fs := newFlags()
+		if err := fs.Parse([]string{"--github.base-url=https://cli.example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		cfg := &GuardConfiguration{Flags: map[string]string{
+			"auth-providers":  "github,gitlab",
+			"github.base-url": "https://file.example.com",
+		}}
+		if assert.Nil(t, cfg.Apply(fs)) {
+			assert.Equal(t, []string{"github", "gitlab"}, srv.AuthRecommendedOptions.AuthProvider.Providers)
+			assert.Equal(t, "https://cli.example.com", srv.AuthRecommendedOptions.Github.BaseUrl)
+		}
+	})
+
+	t.Run("invalid keys and values", func(t *testing.T) {
+		_, fs := newFlags()
+		cfg := &GuardConfiguration{Flags: map[string]string{
+			"config":              "other.yaml",
+			"azure.unknown":       "x",
+			"gitlab.use-group-id": "yes",
+		}}
+		err := cfg.Apply(fs)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "unknown config key azure.unknown")
+			assert.Contains(t, err.Error(), "config can not be set in the config file")
+			assert.Contains(t, err.Error(), "invalid value for gitlab.use-group-id")
+		}
+	})
+
+	t.Run("validates options", func(t *testing.T) {
+		srv, fs := newFlags()
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		data := "apiVersion: guard.kubeguard.dev/v1alpha1\nkind: GuardConfiguration\nauth-providers: [azure]\n"
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		err := srv.LoadConfig(fs, file)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "invalid configuration in "+file)
+			assert.Contains(t, err.Error(), "azure.tenant-id must be non-empty")
+		}
+	})
+}
+
+func TestNewConfigFromArgs(t *testing.T) {
+	args := []string{
+		"--auth-providers=github,azure",
+		"--azure.tenant-id=tenant",
+		"--azure.use-group-uid=false",
+		"--tls-ca-file=/etc/guard/pki/ca.crt",
+		"--ldap.start-tls",
+	}
+	data, err := NewConfigFromArgs(args)
+	if !assert.Nil(t, err) {
+		return
+	}
+	cfg, err := ParseConfig(data)
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]string{
+			"auth-providers":      "github,azure",
+			"azure.tenant-id":     "tenant",
+			"azure.use-group-uid": "false",
+			"tls-ca-file":         "/etc/guard/pki/ca.crt",
+			"ldap.start-tls":      "true",
+		}, cfg.Flags)
+	}
+
+	_, err = NewConfigFromArgs([]string{"run"})
+	assert.EqualError(t, err, "unsupported arg run")
+}
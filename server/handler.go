@@ -23,11 +23,16 @@ import (
 
 	"go.kubeguard.dev/guard/auth"
 	"go.kubeguard.dev/guard/auth/providers/azure"
+	"go.kubeguard.dev/guard/auth/providers/ci"
+	"go.kubeguard.dev/guard/auth/providers/eks"
 	"go.kubeguard.dev/guard/auth/providers/github"
 	"go.kubeguard.dev/guard/auth/providers/gitlab"
 	"go.kubeguard.dev/guard/auth/providers/google"
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
 	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/auth/providers/oidc"
 	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/server/audit"
 	errutils "go.kubeguard.dev/guard/util/error"
 
 	"github.com/pkg/errors"
@@ -36,47 +41,109 @@ import (
 )
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ev := audit.NewEvent(audit.KindTokenReview, req)
+	resp, err := s.review(req, ev)
+	if err == nil && s.IdentityTransformer != nil {
+		resp, err = s.IdentityTransformer.Transform(ev.Provider, resp)
+	}
+	write(w, resp, err)
+
+	if s.Auditor != nil {
+		ev.SetUser(resp)
+		ev.Decision, ev.Code = authnDecision(err)
+		if err != nil {
+			ev.Reason = err.Error()
+		}
+		s.Auditor.Log(ev)
+	}
+}
+
+// review authenticates the token of a TokenReview request, the provider and
+// token are recorded in the audit event
+func (s *Server) review(req *http.Request, ev *audit.Event) (*authv1.UserInfo, error) {
 	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
-		write(w, nil, errutils.WithCode(errors.New("Missing client certificate"), http.StatusBadRequest))
-		return
+		return nil, errutils.WithCode(errors.New("Missing client certificate"), http.StatusBadRequest)
 	}
 	crt := req.TLS.PeerCertificates[0]
-	if len(crt.Subject.Organization) == 0 {
-		write(w, nil, errutils.WithCode(errors.New("Client certificate is missing organization"), http.StatusBadRequest))
-		return
+	chain := s.AuthRecommendedOptions.AuthProvider.Chain
+	if len(crt.Subject.Organization) == 0 && len(chain) == 0 {
+		return nil, errutils.WithCode(errors.New("Client certificate is missing organization"), http.StatusBadRequest)
+	}
+	var org string
+	if len(crt.Subject.Organization) > 0 {
+		org = crt.Subject.Organization[0]
 	}
-	org := crt.Subject.Organization[0]
 	klog.V(7).Infof("Received token review request for %s/%s", org, crt.Subject.CommonName)
 
 	data := authv1.TokenReview{}
 	err := json.NewDecoder(req.Body).Decode(&data)
 	if err != nil {
-		write(w, nil, errutils.WithCode(errors.Wrap(err, "Failed to parse request"), http.StatusBadRequest))
-		return
+		return nil, errutils.WithCode(errors.Wrap(err, "Failed to parse request"), http.StatusBadRequest)
+	}
+	ev.SetToken(data.Spec.Token)
+
+	ctx := req.Context()
+	if len(chain) > 0 {
+		provider, resp, err := checkChain(ctx, chain, data.Spec.Token, func(name string) (auth.Interface, error) {
+			return s.getChainProviderClient(ctx, name, crt.Subject.CommonName)
+		})
+		ev.Provider = provider
+		return resp, err
 	}
 
+	ev.Provider = strings.ToLower(org)
 	if !s.AuthRecommendedOptions.AuthProvider.Has(org) {
-		write(w, nil, errutils.WithCode(errors.Errorf("guard does not provide service for %v", org), http.StatusBadRequest))
-		return
+		return nil, errutils.WithCode(errors.Errorf("guard does not provide service for %v", org), http.StatusBadRequest)
 	}
 
 	if s.AuthRecommendedOptions.AuthProvider.Has(token.OrgType) && s.TokenAuthenticator != nil {
 		resp, err := s.TokenAuthenticator.Check(data.Spec.Token)
 		if err == nil {
-			write(w, resp, err)
-			return
+			ev.Provider = token.OrgType
+			return resp, nil
 		}
 	}
 
-	ctx := req.Context()
 	client, err := s.getAuthProviderClient(ctx, org, crt.Subject.CommonName)
 	if err != nil {
-		write(w, nil, err)
-		return
+		return nil, err
 	}
+	client = s.withCache(instrument(client, org), org, crt.Subject.CommonName)
 
-	resp, err := client.Check(ctx, data.Spec.Token)
-	write(w, resp, err)
+	return client.Check(ctx, data.Spec.Token)
+}
+
+// authnDecision maps the result of a token review to an audit decision and
+// the HTTP code written by write
+func authnDecision(err error) (audit.Decision, int) {
+	if err == nil {
+		return audit.DecisionAllow, http.StatusOK
+	}
+	code := http.StatusUnauthorized
+	var v errutils.HttpStatusCode
+	if errors.As(err, &v) {
+		code = v.Code()
+	}
+	if code >= http.StatusInternalServerError {
+		return audit.DecisionError, code
+	}
+	return audit.DecisionDeny, code
+}
+
+// instrument wraps client with the provider metrics and tracing, cache hits
+// are not recorded
+func instrument(client auth.Interface, provider string) auth.Interface {
+	provider = strings.ToLower(provider)
+	return withAuthTracing(auth.Instrument(client, provider), provider)
+}
+
+// withCache wraps client with the token review cache, if enabled. Results of
+// github and google depend on the org or domain taken from the common name.
+func (s *Server) withCache(client auth.Interface, org, commonName string) auth.Interface {
+	if s.AuthnCache == nil {
+		return client
+	}
+	return s.AuthnCache.Wrap(client, strings.ToLower(org)+"/"+commonName)
 }
 
 func (s *Server) getAuthProviderClient(ctx context.Context, org, commonName string) (auth.Interface, error) {
@@ -84,13 +151,34 @@ func (s *Server) getAuthProviderClient(ctx context.Context, org, commonName stri
 	case github.OrgType:
 		return github.New(s.AuthRecommendedOptions.Github, commonName), nil
 	case google.OrgType:
+		if s.GoogleProvider != nil {
+			a, err := s.GoogleProvider.Authenticator(ctx, commonName)
+			if err != nil {
+				return nil, err
+			}
+			return a, nil
+		}
 		return google.New(ctx, s.AuthRecommendedOptions.Google, commonName)
 	case gitlab.OrgType:
 		return gitlab.New(s.AuthRecommendedOptions.Gitlab), nil
 	case azure.OrgType:
 		return azure.New(ctx, s.AuthRecommendedOptions.Azure)
 	case ldap.OrgType:
+		if s.LDAPAuthenticator != nil {
+			return s.LDAPAuthenticator, nil
+		}
 		return ldap.New(s.AuthRecommendedOptions.LDAP), nil
+	case oidc.OrgType:
+		return oidc.New(ctx, s.AuthRecommendedOptions.OIDC)
+	case ci.OrgType:
+		return ci.New(s.AuthRecommendedOptions.CI)
+	case eks.OrgType:
+		return eks.New(s.AuthRecommendedOptions.EKS)
+	case htpasswd.OrgType:
+		if s.HtpasswdAuthenticator == nil {
+			return nil, errors.New("htpasswd authenticator is not initialized")
+		}
+		return s.HtpasswdAuthenticator, nil
 	}
 
 	return nil, errors.Errorf("Client is using unknown organization %s", org)
@@ -25,10 +25,14 @@ import (
 	"testing"
 
 	"go.kubeguard.dev/guard/auth/providers/azure"
+	"go.kubeguard.dev/guard/auth/providers/ci"
+	"go.kubeguard.dev/guard/auth/providers/eks"
 	"go.kubeguard.dev/guard/auth/providers/github"
 	"go.kubeguard.dev/guard/auth/providers/gitlab"
 	"go.kubeguard.dev/guard/auth/providers/google"
 	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/server/audit"
+	errutils "go.kubeguard.dev/guard/util/error"
 
 	fuzz "github.com/google/gofuzz"
 	"github.com/pkg/errors"
@@ -143,6 +147,16 @@ func TestGetAuthProviderClient(t *testing.T) {
 			ldap.OrgType,
 			nil,
 		},
+		{
+			"get CI client",
+			ci.OrgType,
+			nil,
+		},
+		{
+			"get EKS client without mapping",
+			eks.OrgType,
+			errors.New("eks mapping file is not loaded"),
+		},
 		{
 			"unknown auth providername",
 			invalideAuthProvider,
@@ -178,3 +192,25 @@ func TestGetAuthProviderClient(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthnDecision(t *testing.T) {
+	testData := []struct {
+		testName         string
+		err              error
+		expectedDecision audit.Decision
+		expectedCode     int
+	}{
+		{"allowed", nil, audit.DecisionAllow, http.StatusOK},
+		{"invalid token", errors.New("invalid token"), audit.DecisionDeny, http.StatusUnauthorized},
+		{"bad request", errutils.WithCode(errors.New("missing organization"), http.StatusBadRequest), audit.DecisionDeny, http.StatusBadRequest},
+		{"wrapped upstream error", errors.Wrap(errutils.WithCode(errors.New("graph is down"), http.StatusServiceUnavailable), "failed to get groups"), audit.DecisionError, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			decision, code := authnDecision(test.err)
+			assert.Equal(t, test.expectedDecision, decision)
+			assert.Equal(t, test.expectedCode, code)
+		})
+	}
+}
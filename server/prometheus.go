@@ -70,6 +70,11 @@ var (
 		Help: "A gauge of requests currently being served by the subjectaccessreviews handler.",
 	})
 
+	servingCertExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "serving_cert_expiry_timestamp_seconds",
+		Help: "Expiry time of the currently loaded server TLS certificate in unix seconds.",
+	})
+
 	counterAuthz = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "subjectaccessreviews_handler_requests_total",
@@ -81,5 +86,5 @@ var (
 
 func init() {
 	// Register all of the metrics in the standard registry.
-	prometheus.MustRegister(version, inFlightGauge, counter, duration, responseSize, inFlightGaugeAuthz, counterAuthz)
+	prometheus.MustRegister(version, inFlightGauge, counter, duration, responseSize, inFlightGaugeAuthz, counterAuthz, servingCertExpiry)
 }
@@ -0,0 +1,408 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+	apps "k8s.io/api/apps/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// RateLimitOptions configures the admission control of token reviews and
+// subject access reviews. Requests are limited per client, identified by the
+// organization and common name of the client certificate, and per provider,
+// identified by the organization of the client certificate.
+type RateLimitOptions struct {
+	ClientQPS         float64
+	ClientBurst       int
+	ClientMaxInflight int
+
+	ProviderQPS         float64
+	ProviderBurst       int
+	ProviderMaxInflight int
+
+	// MaxQueued is the number of requests per client or provider that may
+	// wait for a token or an in-flight slot, others are rejected at once
+	MaxQueued int
+	// QueueTimeout is the longest time a request waits before it is rejected
+	QueueTimeout time.Duration
+}
+
+func NewRateLimitOptions() RateLimitOptions {
+	return RateLimitOptions{
+		ClientBurst:   20,
+		ProviderBurst: 20,
+		MaxQueued:     50,
+		QueueTimeout:  2 * time.Second,
+	}
+}
+
+func (o *RateLimitOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.Float64Var(&o.ClientQPS, "ratelimit-client-qps", o.ClientQPS, "Requests per second allowed for each client certificate, unlimited if 0")
+	fs.IntVar(&o.ClientBurst, "ratelimit-client-burst", o.ClientBurst, "Burst of requests allowed for each client certificate")
+	fs.IntVar(&o.ClientMaxInflight, "ratelimit-client-max-inflight", o.ClientMaxInflight, "Maximum number of requests served concurrently for each client certificate, unlimited if 0")
+	fs.Float64Var(&o.ProviderQPS, "ratelimit-provider-qps", o.ProviderQPS, "Requests per second allowed for each provider, unlimited if 0")
+	fs.IntVar(&o.ProviderBurst, "ratelimit-provider-burst", o.ProviderBurst, "Burst of requests allowed for each provider")
+	fs.IntVar(&o.ProviderMaxInflight, "ratelimit-provider-max-inflight", o.ProviderMaxInflight, "Maximum number of requests served concurrently for each provider, unlimited if 0")
+	fs.IntVar(&o.MaxQueued, "ratelimit-max-queued", o.MaxQueued, "Maximum number of requests waiting for each client certificate or provider, further requests are rejected with 429")
+	fs.DurationVar(&o.QueueTimeout, "ratelimit-queue-timeout", o.QueueTimeout, "Maximum time a request waits before it is rejected with 429")
+}
+
+func (o RateLimitOptions) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	if !o.Enabled() {
+		return nil, nil
+	}
+	container := d.Spec.Template.Spec.Containers[0]
+
+	args := container.Args
+	if o.ClientQPS > 0 {
+		args = append(args, fmt.Sprintf("--ratelimit-client-qps=%v", o.ClientQPS))
+		args = append(args, fmt.Sprintf("--ratelimit-client-burst=%d", o.ClientBurst))
+	}
+	if o.ClientMaxInflight > 0 {
+		args = append(args, fmt.Sprintf("--ratelimit-client-max-inflight=%d", o.ClientMaxInflight))
+	}
+	if o.ProviderQPS > 0 {
+		args = append(args, fmt.Sprintf("--ratelimit-provider-qps=%v", o.ProviderQPS))
+		args = append(args, fmt.Sprintf("--ratelimit-provider-burst=%d", o.ProviderBurst))
+	}
+	if o.ProviderMaxInflight > 0 {
+		args = append(args, fmt.Sprintf("--ratelimit-provider-max-inflight=%d", o.ProviderMaxInflight))
+	}
+	args = append(args, fmt.Sprintf("--ratelimit-max-queued=%d", o.MaxQueued))
+	args = append(args, fmt.Sprintf("--ratelimit-queue-timeout=%v", o.QueueTimeout))
+
+	container.Args = args
+	d.Spec.Template.Spec.Containers[0] = container
+
+	return nil, nil
+}
+
+func (o *RateLimitOptions) Validate() []error {
+	var errs []error
+	if o.ClientQPS < 0 {
+		errs = append(errs, errors.New("ratelimit-client-qps must be non-negative"))
+	}
+	if o.ClientQPS > 0 && o.ClientBurst < 1 {
+		errs = append(errs, errors.New("ratelimit-client-burst must be positive"))
+	}
+	if o.ClientMaxInflight < 0 {
+		errs = append(errs, errors.New("ratelimit-client-max-inflight must be non-negative"))
+	}
+	if o.ProviderQPS < 0 {
+		errs = append(errs, errors.New("ratelimit-provider-qps must be non-negative"))
+	}
+	if o.ProviderQPS > 0 && o.ProviderBurst < 1 {
+		errs = append(errs, errors.New("ratelimit-provider-burst must be positive"))
+	}
+	if o.ProviderMaxInflight < 0 {
+		errs = append(errs, errors.New("ratelimit-provider-max-inflight must be non-negative"))
+	}
+	if o.MaxQueued < 0 {
+		errs = append(errs, errors.New("ratelimit-max-queued must be non-negative"))
+	}
+	if o.QueueTimeout < 0 {
+		errs = append(errs, errors.New("ratelimit-queue-timeout must be non-negative"))
+	}
+	return errs
+}
+
+func (o *RateLimitOptions) Enabled() bool {
+	return o.ClientQPS > 0 || o.ClientMaxInflight > 0 || o.ProviderQPS > 0 || o.ProviderMaxInflight > 0
+}
+
+var rateLimitRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ratelimit_rejected_requests_total",
+		Help: "A counter for requests rejected with 429 by the client or provider rate limits.",
+	},
+	[]string{"handler", "limiter", "reason"},
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitRejected)
+}
+
+// reasons a request is rejected by a limiter
+const (
+	rejectRate     = "rate"
+	rejectInflight = "inflight"
+	rejectQueue    = "queue_full"
+)
+
+// keyedLimiter holds a token bucket and an in-flight semaphore per key. Keys
+// are client certificates and providers, so the set of keys is small and
+// entries are never removed.
+type keyedLimiter struct {
+	qps          float64
+	burst        int
+	maxInflight  int
+	maxQueued    int
+	queueTimeout time.Duration
+
+	lock sync.Mutex
+	keys map[string]*keyLimiter
+}
+
+type keyLimiter struct {
+	bucket   *rate.Limiter
+	inflight chan struct{}
+
+	lock   sync.Mutex
+	queued int
+}
+
+func newKeyedLimiter(qps float64, burst, maxInflight, maxQueued int, queueTimeout time.Duration) *keyedLimiter {
+	if qps <= 0 && maxInflight <= 0 {
+		return nil
+	}
+	return &keyedLimiter{
+		qps:          qps,
+		burst:        burst,
+		maxInflight:  maxInflight,
+		maxQueued:    maxQueued,
+		queueTimeout: queueTimeout,
+		keys:         map[string]*keyLimiter{},
+	}
+}
+
+func (l *keyedLimiter) get(key string) *keyLimiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	k, ok := l.keys[key]
+	if !ok {
+		k = &keyLimiter{}
+		if l.qps > 0 {
+			k.bucket = rate.NewLimiter(rate.Limit(l.qps), l.burst)
+		}
+		if l.maxInflight > 0 {
+			k.inflight = make(chan struct{}, l.maxInflight)
+		}
+		l.keys[key] = k
+	}
+	return k
+}
+
+// enqueue reserves a place in the queue of waiting requests
+func (l *keyedLimiter) enqueue(k *keyLimiter) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.queued >= l.maxQueued {
+		return false
+	}
+	k.queued++
+	return true
+}
+
+func (l *keyedLimiter) dequeue(k *keyLimiter) {
+	k.lock.Lock()
+	k.queued--
+	k.lock.Unlock()
+}
+
+// admit waits for a token and an in-flight slot of key. If the request is
+// admitted, release must be called once it is served. Otherwise the reason
+// of the rejection and the time the client should wait are returned.
+func (l *keyedLimiter) admit(ctx context.Context, key string) (release func(), reason string, retryAfter time.Duration) {
+	k := l.get(key)
+
+	if k.bucket != nil {
+		r := k.bucket.Reserve()
+		if delay := r.Delay(); delay > 0 {
+			if delay > l.queueTimeout {
+				r.Cancel()
+				return nil, rejectRate, delay
+			}
+			if !l.enqueue(k) {
+				r.Cancel()
+				return nil, rejectQueue, delay
+			}
+			err := sleep(ctx, delay)
+			l.dequeue(k)
+			if err != nil {
+				r.Cancel()
+				return nil, rejectRate, delay
+			}
+		}
+	}
+
+	if k.inflight == nil {
+		return func() {}, "", 0
+	}
+	release = func() { <-k.inflight }
+	select {
+	case k.inflight <- struct{}{}:
+		return release, "", 0
+	default:
+	}
+	if !l.enqueue(k) {
+		return nil, rejectQueue, time.Second
+	}
+	defer l.dequeue(k)
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case k.inflight <- struct{}{}:
+		return release, "", 0
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil, rejectInflight, time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// admission applies the client and provider limits to the review handlers.
+// In chain mode the provider of a token review is not known up front, so the
+// provider limit is applied to each step of the chain, see limitProvider.
+type admission struct {
+	client   *keyedLimiter
+	provider *keyedLimiter
+	chain    bool
+}
+
+func newAdmission(o RateLimitOptions, chain bool) *admission {
+	return &admission{
+		client:   newKeyedLimiter(o.ClientQPS, o.ClientBurst, o.ClientMaxInflight, o.MaxQueued, o.QueueTimeout),
+		provider: newKeyedLimiter(o.ProviderQPS, o.ProviderBurst, o.ProviderMaxInflight, o.MaxQueued, o.QueueTimeout),
+		chain:    chain,
+	}
+}
+
+// providerKey returns the key of the provider limit, authn and authz
+// providers of the same organization are limited separately
+func providerKey(handler, provider string) string {
+	return handler + "/" + strings.ToLower(provider)
+}
+
+// keys returns the client and provider of a request to the handler name. The
+// provider is empty for token reviews in chain mode. Requests without a
+// client certificate are not limited, they are rejected by the handlers.
+func (a *admission) keys(name string, req *http.Request) (client, provider string, ok bool) {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return "", "", false
+	}
+	crt := req.TLS.PeerCertificates[0]
+	var org string
+	if len(crt.Subject.Organization) > 0 {
+		org = strings.ToLower(crt.Subject.Organization[0])
+	}
+	if !a.chain || name != "tokenreviews" {
+		provider = providerKey(name, org)
+	}
+	return org + "/" + crt.Subject.CommonName, provider, true
+}
+
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Handler rejects requests over the limits with 429 and a Retry-After
+// header, which the apiserver honors when retrying the webhook call. A nil
+// admission returns next.
+func (a *admission) Handler(name string, next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		client, provider, ok := a.keys(name, req)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		for _, l := range []struct {
+			name    string
+			limiter *keyedLimiter
+			key     string
+		}{
+			{"client", a.client, client},
+			{"provider", a.provider, provider},
+		} {
+			if l.limiter == nil || l.key == "" {
+				continue
+			}
+			release, reason, retryAfter := l.limiter.admit(req.Context(), l.key)
+			if release == nil {
+				rateLimitRejected.WithLabelValues(name, l.name, reason).Inc()
+				klog.V(4).Infof("rejected %s request of %s %s: %s limit exceeded", name, l.name, l.key, reason)
+				w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+				http.Error(w, fmt.Sprintf("too many requests for %s %s, retry later", l.name, l.key), http.StatusTooManyRequests)
+				return
+			}
+			defer release()
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// limitProvider applies the provider limit to the token reviews of client,
+// a provider of the auth chain. A nil admission returns client.
+func (a *admission) limitProvider(client auth.Interface, name string) auth.Interface {
+	if a == nil || a.provider == nil {
+		return client
+	}
+	return limitedProvider{Interface: client, limiter: a.provider, key: providerKey("tokenreviews", name)}
+}
+
+type limitedProvider struct {
+	auth.Interface
+	limiter *keyedLimiter
+	key     string
+}
+
+// Check fails with 429 if the provider is over its limit, so the chain moves
+// on to the next provider
+func (p limitedProvider) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	release, reason, retryAfter := p.limiter.admit(ctx, p.key)
+	if release == nil {
+		rateLimitRejected.WithLabelValues("tokenreviews", "provider", reason).Inc()
+		klog.V(4).Infof("rejected tokenreviews request of provider %s: %s limit exceeded", p.key, reason)
+		err := errors.Errorf("too many requests for provider %s, retry after %ss", p.key, retryAfterSeconds(retryAfter))
+		return nil, errutils.WithCode(err, http.StatusTooManyRequests)
+	}
+	defer release()
+	return p.Interface.Check(ctx, token)
+}
@@ -0,0 +1,292 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	errutils "go.kubeguard.dev/guard/util/error"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestRateLimitOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        RateLimitOptions
+		expectedErr []error
+	}{
+		{
+			"disabled by default",
+			NewRateLimitOptions(),
+			nil,
+		},
+		{
+			"client and provider limits",
+			RateLimitOptions{ClientQPS: 10, ClientBurst: 20, ProviderMaxInflight: 50, MaxQueued: 10, QueueTimeout: time.Second},
+			nil,
+		},
+		{
+			"negative values",
+			RateLimitOptions{ClientQPS: -1, ClientMaxInflight: -1, ProviderQPS: -1, ProviderMaxInflight: -1, MaxQueued: -1, QueueTimeout: -time.Second},
+			[]error{
+				errors.New("ratelimit-client-qps must be non-negative"),
+				errors.New("ratelimit-client-max-inflight must be non-negative"),
+				errors.New("ratelimit-provider-qps must be non-negative"),
+				errors.New("ratelimit-provider-max-inflight must be non-negative"),
+				errors.New("ratelimit-max-queued must be non-negative"),
+				errors.New("ratelimit-queue-timeout must be non-negative"),
+			},
+		},
+		{
+			"qps without burst",
+			RateLimitOptions{ClientQPS: 1, ProviderQPS: 1},
+			[]error{
+				errors.New("ratelimit-client-burst must be positive"),
+				errors.New("ratelimit-provider-burst must be positive"),
+			},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
+
+func reviewRequest(org, cn string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/tokenreviews", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+		{Subject: pkix.Name{CommonName: cn, Organization: []string{org}}},
+	}}
+	return req
+}
+
+func TestAdmissionClientRate(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ClientQPS: 0.1, ClientBurst: 2, QueueTimeout: time.Second}, false)
+	h := a.Handler("tokenreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, reviewRequest("github", "apiserver"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// the next token is 10s away, longer than the queue timeout
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, reviewRequest("github", "apiserver"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+
+	// other clients have their own bucket
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, reviewRequest("github", "other"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// requests without a client certificate are left to the handler
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tokenreviews", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdmissionRateQueue(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ProviderQPS: 20, ProviderBurst: 1, MaxQueued: 1, QueueTimeout: time.Second}, false)
+	h := a.Handler("tokenreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// the second request waits 50ms for a token
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, reviewRequest("ldap", "apiserver"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestAdmissionProviderInflight(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ProviderMaxInflight: 1, MaxQueued: 1, QueueTimeout: 50 * time.Millisecond}, false)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	h := a.Handler("tokenreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Block") != "" {
+			close(started)
+			<-unblock
+		}
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := reviewRequest("ldap", "apiserver-1")
+		req.Header.Set("Block", "true")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	// the provider is shared by all clients, the request times out in the queue
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, reviewRequest("LDAP", "apiserver-2"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// other providers are not affected
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, reviewRequest("github", "apiserver-2"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	close(unblock)
+	wg.Wait()
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, reviewRequest("ldap", "apiserver-2"))
+	assert.Equal(t, http.StatusOK, w.Code, "slot must be released")
+}
+
+func TestAdmissionQueueFull(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ClientMaxInflight: 1, QueueTimeout: time.Second}, false)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	h := a.Handler("subjectaccessreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-unblock
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), reviewRequest("azure", "apiserver"))
+	}()
+	<-started
+
+	// no request may wait, so it is rejected at once
+	start := time.Now()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, reviewRequest("azure", "apiserver"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Less(t, time.Since(start), time.Second)
+
+	close(unblock)
+	<-done
+}
+
+func TestAdmissionKeys(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ClientMaxInflight: 1}, true)
+
+	client, provider, ok := a.keys("subjectaccessreviews", reviewRequest("GitHub", "apiserver"))
+	assert.True(t, ok)
+	assert.Equal(t, "github/apiserver", client)
+	assert.Equal(t, "subjectaccessreviews/github", provider)
+
+	// in chain mode the provider limit is applied to each step of the chain
+	client, provider, ok = a.keys("tokenreviews", reviewRequest("GitHub", "apiserver"))
+	assert.True(t, ok)
+	assert.Equal(t, "github/apiserver", client)
+	assert.Empty(t, provider)
+
+	a = newAdmission(RateLimitOptions{ClientMaxInflight: 1}, false)
+	_, provider, ok = a.keys("tokenreviews", reviewRequest("GitHub", "apiserver"))
+	assert.True(t, ok)
+	assert.Equal(t, "tokenreviews/github", provider)
+}
+
+func TestAdmissionProviderPerHandler(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ProviderQPS: 0.1, ProviderBurst: 1, QueueTimeout: time.Second}, false)
+	authn := a.Handler("tokenreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	authz := a.Handler("subjectaccessreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	authn.ServeHTTP(w, reviewRequest("azure", "apiserver"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// authz reviews of the same organization have their own bucket
+	w = httptest.NewRecorder()
+	authz.ServeHTTP(w, reviewRequest("azure", "apiserver"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	authn.ServeHTTP(w, reviewRequest("azure", "apiserver"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+type checkFunc func(ctx context.Context, token string) (*authv1.UserInfo, error)
+
+func (f checkFunc) UID() string { return "" }
+
+func (f checkFunc) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	return f(ctx, token)
+}
+
+func TestAdmissionChainProvider(t *testing.T) {
+	a := newAdmission(RateLimitOptions{ProviderQPS: 0.1, ProviderBurst: 1, QueueTimeout: time.Second}, true)
+	h := a.Handler("tokenreviews", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// the handler does not know the provider of a chain
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, reviewRequest("", "apiserver"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	provider := func(name string) auth.Interface {
+		return a.limitProvider(checkFunc(func(ctx context.Context, token string) (*authv1.UserInfo, error) {
+			return &authv1.UserInfo{Username: name}, nil
+		}), name)
+	}
+	names := []string{"ldap", "github"}
+	getClient := func(name string) (auth.Interface, error) { return provider(name), nil }
+
+	name, _, err := checkChain(context.Background(), names, "token", getClient)
+	assert.NoError(t, err)
+	assert.Equal(t, "ldap", name)
+
+	// ldap is over its limit, the chain moves on to github
+	name, _, err = checkChain(context.Background(), names, "token", getClient)
+	assert.NoError(t, err)
+	assert.Equal(t, "github", name)
+
+	_, err = provider("ldap").Check(context.Background(), "token")
+	var code errutils.HttpStatusCode
+	if assert.True(t, errors.As(err, &code)) {
+		assert.Equal(t, http.StatusTooManyRequests, code.Code())
+	}
+
+	// a nil admission does not limit
+	var none *admission
+	client := checkFunc(func(ctx context.Context, token string) (*authv1.UserInfo, error) { return nil, nil })
+	assert.IsType(t, client, none.limitProvider(client, "ldap"))
+}
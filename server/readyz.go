@@ -0,0 +1,243 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.kubeguard.dev/guard/auth"
+	authazure "go.kubeguard.dev/guard/auth/providers/azure"
+	"go.kubeguard.dev/guard/auth/providers/ci"
+	"go.kubeguard.dev/guard/auth/providers/google"
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
+	"go.kubeguard.dev/guard/auth/providers/ldap"
+	"go.kubeguard.dev/guard/auth/providers/oidc"
+	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/authz/providers/azure"
+	azureutils "go.kubeguard.dev/guard/util/azure"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	readinessInterval = 30 * time.Second
+	readinessTimeout  = 10 * time.Second
+)
+
+var errNotChecked = errors.New("not checked yet")
+
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+	// upstream checks are reported but do not fail the readiness, all
+	// replicas share the upstream service and taking them out of the service
+	// would also fail the reviews of the other providers
+	upstream bool
+}
+
+// readiness runs the registered checks in the background and serves the
+// cached results on /readyz, so probes never wait for an upstream service
+type readiness struct {
+	checks  []readinessCheck
+	timeout time.Duration
+
+	lock    sync.RWMutex
+	results map[string]error
+}
+
+func newReadiness() *readiness {
+	return &readiness{
+		timeout: readinessTimeout,
+		results: map[string]error{},
+	}
+}
+
+func (r *readiness) Add(name string, check func(ctx context.Context) error) {
+	r.checks = append(r.checks, readinessCheck{name: name, check: check})
+	r.results[name] = errNotChecked
+}
+
+// AddUpstream adds a check of an upstream service, see readinessCheck
+func (r *readiness) AddUpstream(name string, check func(ctx context.Context) error) {
+	r.checks = append(r.checks, readinessCheck{name: name, check: check, upstream: true})
+	r.results[name] = errNotChecked
+}
+
+// Run refreshes the results every interval until stopCh is closed
+func (r *readiness) Run(interval time.Duration, stopCh <-chan struct{}) {
+	go wait.Until(r.Refresh, interval, stopCh)
+}
+
+// Refresh runs all checks in parallel
+func (r *readiness) Refresh() {
+	var wg sync.WaitGroup
+	for _, c := range r.checks {
+		wg.Add(1)
+		go func(c readinessCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			defer cancel()
+			err := c.check(ctx)
+
+			r.lock.Lock()
+			prev := r.results[c.name]
+			r.results[c.name] = err
+			r.lock.Unlock()
+
+			if err != nil && (prev == nil || prev == errNotChecked) {
+				klog.Errorf("readiness check %s failed: %v", c.name, err)
+			} else if err == nil && prev != nil && prev != errNotChecked {
+				klog.Infof("readiness check %s passed", c.name)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// ServeHTTP reports the results in the style of the kube-apiserver health
+// checks. Checks can be skipped with ?exclude=<name>, ?verbose lists every
+// check. Failure reasons are withheld and logged instead. Failed upstream
+// checks are listed without failing the readiness.
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	excluded := sets.New[string](req.URL.Query()["exclude"]...)
+	_, verbose := req.URL.Query()["verbose"]
+
+	r.lock.RLock()
+	var out bytes.Buffer
+	failed := false
+	for _, c := range r.checks {
+		if excluded.Has(c.name) {
+			_, _ = fmt.Fprintf(&out, "[+]%s excluded: ok\n", c.name)
+			continue
+		}
+		if err := r.results[c.name]; err != nil {
+			if c.upstream {
+				_, _ = fmt.Fprintf(&out, "[-]%s failed: reason withheld, upstream check ignored\n", c.name)
+				continue
+			}
+			failed = true
+			if err == errNotChecked {
+				_, _ = fmt.Fprintf(&out, "[-]%s failed: %v\n", c.name, err)
+			} else {
+				_, _ = fmt.Fprintf(&out, "[-]%s failed: reason withheld\n", c.name)
+			}
+			continue
+		}
+		_, _ = fmt.Fprintf(&out, "[+]%s ok\n", c.name)
+	}
+	r.lock.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("x-content-type-options", "nosniff")
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+		out.WriteString("readyz check failed\n")
+		_, _ = w.Write(out.Bytes())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if !verbose {
+		_, _ = w.Write([]byte("ok"))
+		return
+	}
+	out.WriteString("readyz check passed\n")
+	_, _ = w.Write(out.Bytes())
+}
+
+// newReadiness registers the checks of the serving certificate, the token
+// file and every configured provider. Checks of the upstream services of the
+// authentication providers do not fail the readiness.
+func (s *Server) newReadiness(certs *certReloader, authzhandler *Authzhandler) *readiness {
+	r := newReadiness()
+	r.Add("serving-cert", certs.Check)
+
+	if s.TokenAuthenticator != nil {
+		r.Add("token-file", func(_ context.Context) error {
+			return s.TokenAuthenticator.Ready()
+		})
+	}
+
+	for _, name := range s.AuthRecommendedOptions.AuthProvider.Providers {
+		name := strings.ToLower(name)
+		if name == token.OrgType {
+			continue
+		}
+		if name == htpasswd.OrgType {
+			if s.HtpasswdAuthenticator != nil {
+				r.Add("authn-"+name, s.HtpasswdAuthenticator.Ready)
+			}
+			continue
+		}
+		if check := s.authProviderReadiness(name); check != nil {
+			r.AddUpstream("authn-"+name, check)
+		}
+	}
+
+	for _, name := range s.AuthzRecommendedOptions.AuthzProvider.Providers {
+		name := strings.ToLower(name)
+		r.Add("authz-"+name, func(ctx context.Context) error {
+			client, err := authzhandler.getAuthzProviderClient(name)
+			if err != nil {
+				return err
+			}
+			if c, ok := client.(auth.ReadinessChecker); ok {
+				return c.Ready(ctx)
+			}
+			return nil
+		})
+	}
+
+	if s.AuthzRecommendedOptions.AuthzProvider.Has(azure.OrgType) && s.AuthzRecommendedOptions.Azure.DiscoverResources {
+		r.Add("azure-discovery", func(_ context.Context) error {
+			if len(azureutils.DeepCopyOperationsMap()) == 0 {
+				return errors.New("no Azure operations discovered")
+			}
+			return nil
+		})
+	}
+	return r
+}
+
+// authProviderReadiness returns the check of the upstream service of the
+// authentication provider name, or nil if it has none. The checks only need
+// the options of a provider, unlike the clients built per review.
+func (s *Server) authProviderReadiness(name string) func(ctx context.Context) error {
+	switch name {
+	case authazure.OrgType:
+		return s.AuthRecommendedOptions.Azure.Ready
+	case google.OrgType:
+		return s.AuthRecommendedOptions.Google.Ready
+	case oidc.OrgType:
+		return s.AuthRecommendedOptions.OIDC.Ready
+	case ci.OrgType:
+		return s.AuthRecommendedOptions.CI.Ready
+	case ldap.OrgType:
+		if s.LDAPAuthenticator != nil {
+			return s.LDAPAuthenticator.Ready
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	ldapErr := errors.New("connection refused")
+	r := newReadiness()
+	r.Add("serving-cert", func(_ context.Context) error { return nil })
+	r.Add("authn-ldap", func(_ context.Context) error { return ldapErr })
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	// not ready before the first refresh
+	w := get("/readyz")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "[-]serving-cert failed: not checked yet\n[-]authn-ldap failed: not checked yet\nreadyz check failed\n", w.Body.String())
+
+	r.Refresh()
+	w = get("/readyz")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "[+]serving-cert ok\n[-]authn-ldap failed: reason withheld\nreadyz check failed\n", w.Body.String())
+
+	w = get("/readyz?exclude=authn-ldap")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+
+	w = get("/readyz?verbose&exclude=authn-ldap")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[+]serving-cert ok\n[+]authn-ldap excluded: ok\nreadyz check passed\n", w.Body.String())
+
+	ldapErr = nil
+	r.Refresh()
+	w = get("/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	r := newReadiness()
+	r.timeout = 0
+	r.Add("authn-azure", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	r.Refresh()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?verbose", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestReadinessUpstream(t *testing.T) {
+	r := newReadiness()
+	r.Add("serving-cert", func(_ context.Context) error { return nil })
+	r.AddUpstream("authn-ldap", func(_ context.Context) error { return errors.New("connection refused") })
+	r.Refresh()
+
+	// a degraded upstream service does not take the replica out of service
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?verbose", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[+]serving-cert ok\n[-]authn-ldap failed: reason withheld, upstream check ignored\nreadyz check passed\n", w.Body.String())
+}
+
+func TestAuthProviderReadiness(t *testing.T) {
+	s := Server{AuthRecommendedOptions: NewAuthRecommendedOptions()}
+
+	// the checks do not build clients, so they are created without network
+	for _, name := range []string{"azure", "google", "oidc", "ci"} {
+		assert.NotNil(t, s.authProviderReadiness(name), name)
+	}
+	for _, name := range []string{"github", "gitlab", "eks", "ldap"} {
+		assert.Nil(t, s.authProviderReadiness(name), name)
+	}
+}
@@ -19,21 +19,27 @@ package server
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"net/http"
 	_ "net/http/pprof"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
+	"go.kubeguard.dev/guard/auth/cache"
+	"go.kubeguard.dev/guard/auth/providers/google"
+	"go.kubeguard.dev/guard/auth/providers/htpasswd"
+	"go.kubeguard.dev/guard/auth/providers/ldap"
 	"go.kubeguard.dev/guard/auth/providers/token"
+	"go.kubeguard.dev/guard/auth/transform"
 	"go.kubeguard.dev/guard/authz/providers/azure"
 	"go.kubeguard.dev/guard/authz/providers/azure/data"
+	"go.kubeguard.dev/guard/authz/providers/cel"
+	"go.kubeguard.dev/guard/authz/providers/policy"
+	"go.kubeguard.dev/guard/server/audit"
 	azureutils "go.kubeguard.dev/guard/util/azure"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
@@ -42,9 +48,12 @@ import (
 	v "gomodules.xyz/x/version"
 	"k8s.io/klog/v2"
 	"kmodules.xyz/client-go/meta"
-	"kmodules.xyz/client-go/tools/fsnotify"
 )
 
+// shutdownTimeout bounds the graceful shutdown of the server, it is below the
+// default termination grace period of 30s of a pod
+const shutdownTimeout = 25 * time.Second
+
 // loggerWithSkipPaths returns a logger middleware that skips logging for specified paths.
 func loggerWithSkipPaths(skipPaths ...string) func(http.Handler) http.Handler {
 	skip := make(map[string]struct{}, len(skipPaths))
@@ -66,8 +75,19 @@ type Server struct {
 	AuthRecommendedOptions  *AuthRecommendedOptions
 	AuthzRecommendedOptions *AuthzRecommendedOptions
 	TokenAuthenticator      *token.Authenticator
+	HtpasswdAuthenticator   *htpasswd.Authenticator
+	LDAPAuthenticator       *ldap.Authenticator
+	GoogleProvider          *google.Provider
+	IdentityTransformer     *transform.Transformer
+	PolicyAuthorizer        *policy.Authorizer
+	CELAuthorizer           *cel.Authorizer
+	AuthnCache              *cache.Cache
+	Auditor                 *audit.Auditor
 	WriteTimeout            time.Duration
 	ReadTimeout             time.Duration
+
+	// rateLimits applies the provider limit to the steps of the auth chain
+	rateLimits *admission
 }
 
 func (s *Server) AddFlags(fs *pflag.FlagSet) {
@@ -97,24 +117,42 @@ func (s Server) ListenAndServe() {
 		}()
 	}
 
+	// files mounted from secrets are reloaded when the secret is updated. On
+	// SIGTERM the server is shut down gracefully, see serve.
+	var stopCh <-chan struct{}
+	if meta.PossiblyInCluster() {
+		stopCh = signals.SetupSignalHandler()
+	}
+	// closers release the dependents of the handlers after the server is shut
+	// down
+	var closers []func()
+
 	if s.AuthRecommendedOptions.Token.AuthFile != "" {
 		s.TokenAuthenticator = token.New(s.AuthRecommendedOptions.Token)
+		configureFile(s.TokenAuthenticator, stopCh)
+	}
 
-		err := s.TokenAuthenticator.Configure()
-		if err != nil {
-			klog.Fatalln(err)
-		}
-		if meta.PossiblyInCluster() {
-			w := fsnotify.Watcher{
-				WatchDir: filepath.Dir(s.AuthRecommendedOptions.Token.AuthFile),
-				Reload: func() error {
-					return s.TokenAuthenticator.Configure()
-				},
-			}
-			stopCh := signals.SetupSignalHandler()
-			err = w.Run(stopCh)
-			if err != nil {
-				klog.Fatal(err)
+	if s.AuthRecommendedOptions.AuthProvider.Has(htpasswd.OrgType) {
+		s.HtpasswdAuthenticator = htpasswd.New(s.AuthRecommendedOptions.Htpasswd)
+		configureFile(s.HtpasswdAuthenticator, stopCh)
+	}
+
+	if s.AuthzRecommendedOptions.AuthzProvider.Has(policy.OrgType) {
+		s.PolicyAuthorizer = policy.New(s.AuthzRecommendedOptions.Policy)
+		configureFile(s.PolicyAuthorizer, stopCh)
+	}
+
+	if s.AuthzRecommendedOptions.AuthzProvider.Has(cel.OrgType) {
+		s.CELAuthorizer = cel.New(s.AuthzRecommendedOptions.CEL)
+		configureFile(s.CELAuthorizer, stopCh)
+	}
+
+	if s.AuthRecommendedOptions.Transform.Enabled() {
+		s.IdentityTransformer = transform.New(s.AuthRecommendedOptions.Transform)
+		configureFile(s.IdentityTransformer, stopCh)
+		for _, name := range s.IdentityTransformer.Providers() {
+			if name != transform.AnyProvider && !s.AuthRecommendedOptions.AuthProvider.Has(name) {
+				klog.Warningf("identity transformation for provider %s is not used, it is not listed in auth-providers", name)
 			}
 		}
 	}
@@ -123,9 +161,69 @@ func (s Server) ListenAndServe() {
 	if err := s.AuthRecommendedOptions.LDAP.Configure(); err != nil {
 		klog.Fatal(err)
 	}
+	if s.AuthRecommendedOptions.AuthProvider.Has(ldap.OrgType) {
+		// kept across token reviews for the connection pool and the health
+		// state of the ldap servers
+		if s.AuthRecommendedOptions.LDAP.PoolSize > 0 {
+			klog.Infof("Initializing ldap connection pool: size=%d, idle timeout=%v", s.AuthRecommendedOptions.LDAP.PoolSize, s.AuthRecommendedOptions.LDAP.PoolIdleTimeout)
+		}
+		s.LDAPAuthenticator = ldap.NewPooled(s.AuthRecommendedOptions.LDAP)
+		closers = append(closers, s.LDAPAuthenticator.Close)
+	}
+	if err := s.AuthRecommendedOptions.Github.Configure(); err != nil {
+		klog.Fatal(err)
+	}
 	if err := s.AuthRecommendedOptions.Google.Configure(); err != nil {
 		klog.Fatal(err)
 	}
+	if s.AuthRecommendedOptions.AuthProvider.Has(google.OrgType) {
+		// kept across token reviews for the signing keys, the directory
+		// client and the group cache
+		var err error
+		s.GoogleProvider, err = google.NewProvider(s.AuthRecommendedOptions.Google)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		closers = append(closers, s.GoogleProvider.Close)
+	}
+	if err := s.AuthRecommendedOptions.OIDC.Configure(); err != nil {
+		klog.Fatal(err)
+	}
+	if err := s.AuthRecommendedOptions.EKS.Configure(); err != nil {
+		klog.Fatal(err)
+	}
+
+	if s.AuthRecommendedOptions.AuthnCache.Enabled() {
+		var err error
+		klog.Infof("Initializing authentication cache: size=%dMB, success ttl=%v, failure ttl=%v", s.AuthRecommendedOptions.AuthnCache.SizeMB, s.AuthRecommendedOptions.AuthnCache.SuccessTTL, s.AuthRecommendedOptions.AuthnCache.FailureTTL)
+		s.AuthnCache, err = cache.New(s.AuthRecommendedOptions.AuthnCache)
+		if err != nil {
+			klog.Fatalf("Error in initializing authentication cache. Error:%s", err.Error())
+		}
+	}
+
+	if s.AuthRecommendedOptions.Tracing.Enabled() {
+		klog.Infof("Initializing tracing: endpoint=%s, sampling ratio=%v", s.AuthRecommendedOptions.Tracing.OTLPEndpoint, s.AuthRecommendedOptions.Tracing.SamplingRatio)
+		shutdown, err := setupTracing(context.Background(), s.AuthRecommendedOptions.Tracing)
+		if err != nil {
+			klog.Fatalf("Error in initializing tracing. Error:%s", err.Error())
+		}
+		closers = append(closers, func() {
+			if err := shutdown(context.Background()); err != nil {
+				klog.Errorf("failed to flush traces: %v", err)
+			}
+		})
+	}
+
+	if s.AuthRecommendedOptions.Audit.Enabled() {
+		var err error
+		klog.Infof("Initializing audit log: sinks=%v, level=%s", s.AuthRecommendedOptions.Audit.Sinks, s.AuthRecommendedOptions.Audit.Level)
+		s.Auditor, err = audit.New(s.AuthRecommendedOptions.Audit)
+		if err != nil {
+			klog.Fatalf("Error in initializing audit log. Error:%s", err.Error())
+		}
+		closers = append(closers, s.Auditor.Close)
+	}
 
 	/*
 		Ref:
@@ -134,14 +232,14 @@ func (s Server) ListenAndServe() {
 		 - http://www.bite-code.com/2015/06/25/tls-mutual-auth-in-golang/
 		 - http://www.hydrogen18.com/blog/your-own-pki-tls-golang.html
 	*/
-	caCert, err := os.ReadFile(s.AuthRecommendedOptions.SecureServing.CACertFile)
+	certs, err := newCertReloader(s.AuthRecommendedOptions.SecureServing)
 	if err != nil {
 		klog.Fatal(err)
 	}
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(caCert)
-	if !ok {
-		klog.Fatal("Failed to add CA cert in CertPool for guard server")
+	if stopCh != nil {
+		if err = certs.Watch(stopCh); err != nil {
+			klog.Fatal(err)
+		}
 	}
 
 	tlsConfig := &tls.Config{
@@ -157,15 +255,27 @@ func (s Server) ListenAndServe() {
 			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 		},
 		// ClientAuth: tls.VerifyClientCertIfGiven needed to pass healthz check
-		ClientAuth: tls.VerifyClientCertIfGiven,
-		ClientCAs:  caCertPool,
-		NextProtos: []string{"h2", "http/1.1"},
+		ClientAuth:     tls.VerifyClientCertIfGiven,
+		ClientCAs:      certs.ClientCAs(),
+		GetCertificate: certs.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
 	}
+	// the client CA pool is picked per handshake, so a reloaded CA takes effect
+	tlsConfig.GetConfigForClient = certs.GetConfigForClient(tlsConfig)
 
 	m := chi.NewRouter()
 	m.Use(middleware.RealIP)
 	m.Use(loggerWithSkipPaths("/healthz", "/metrics", "/readyz"))
 	m.Use(middleware.Recoverer)
+	if s.AuthRecommendedOptions.Tracing.Enabled() {
+		m.Use(tracingMiddleware)
+	}
+
+	var rateLimits *admission
+	if s.AuthRecommendedOptions.RateLimit.Enabled() {
+		rateLimits = newAdmission(s.AuthRecommendedOptions.RateLimit, len(s.AuthRecommendedOptions.AuthProvider.Chain) > 0)
+	}
+	s.rateLimits = rateLimits
 
 	// Instrument the handlers with all the metrics, injecting the "handler" label by currying.
 	// ref:
@@ -174,7 +284,7 @@ func (s Server) ListenAndServe() {
 	handler := promhttp.InstrumentHandlerInFlight(inFlightGauge,
 		promhttp.InstrumentHandlerDuration(duration.MustCurryWith(prometheus.Labels{"handler": "tokenreviews"}),
 			promhttp.InstrumentHandlerCounter(counter,
-				promhttp.InstrumentHandlerResponseSize(responseSize.MustCurryWith(prometheus.Labels{"handler": "tokenreviews"}), &s),
+				promhttp.InstrumentHandlerResponseSize(responseSize.MustCurryWith(prometheus.Labels{"handler": "tokenreviews"}), rateLimits.Handler("tokenreviews", &s)),
 			),
 		),
 	)
@@ -194,33 +304,21 @@ func (s Server) ListenAndServe() {
 	authzhandler := Authzhandler{
 		AuthRecommendedOptions:  s.AuthRecommendedOptions,
 		AuthzRecommendedOptions: s.AuthzRecommendedOptions,
+		PolicyAuthorizer:        s.PolicyAuthorizer,
+		CELAuthorizer:           s.CELAuthorizer,
+		Auditor:                 s.Auditor,
 	}
 
-	m.Get("/readyz", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if len(s.AuthzRecommendedOptions.AuthzProvider.Providers) > 0 && s.AuthzRecommendedOptions.AuthzProvider.Has(azure.OrgType) && s.AuthzRecommendedOptions.Azure.DiscoverResources {
-			storedOperationsMap := azureutils.DeepCopyOperationsMap()
-			if len(storedOperationsMap) > 0 {
-				w.WriteHeader(200)
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-		} else {
-			w.WriteHeader(200)
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("x-content-type-options", "nosniff")
-		err := json.NewEncoder(w).Encode(v.Version)
-		if err != nil {
-			klog.Fatal(err)
-		}
-	}))
+	ready := s.newReadiness(certs, &authzhandler)
+	ready.Run(readinessInterval, stopCh)
+	m.Get("/readyz", ready.ServeHTTP)
 
 	klog.Infoln("setting up authz providers")
 	if len(s.AuthzRecommendedOptions.AuthzProvider.Providers) > 0 {
 		authzPromHandler := promhttp.InstrumentHandlerInFlight(inFlightGaugeAuthz,
 			promhttp.InstrumentHandlerDuration(duration.MustCurryWith(prometheus.Labels{"handler": "subjectaccessreviews"}),
 				promhttp.InstrumentHandlerCounter(counterAuthz,
-					promhttp.InstrumentHandlerResponseSize(responseSize.MustCurryWith(prometheus.Labels{"handler": "subjectaccessreview"}), &authzhandler),
+					promhttp.InstrumentHandlerResponseSize(responseSize.MustCurryWith(prometheus.Labels{"handler": "subjectaccessreview"}), rateLimits.Handler("subjectaccessreviews", &authzhandler)),
 				),
 			),
 		)
@@ -285,5 +383,52 @@ func (s Server) ListenAndServe() {
 		Handler:      m,
 		TLSConfig:    tlsConfig,
 	}
-	klog.Fatalln(srv.ListenAndServeTLS(s.AuthRecommendedOptions.SecureServing.CertFile, s.AuthRecommendedOptions.SecureServing.KeyFile))
+	// certificates are served by tlsConfig.GetCertificate
+	serve(srv, func() error { return srv.ListenAndServeTLS("", "") }, stopCh, closers)
+}
+
+// serve runs srv with listen until stopCh is closed. Then srv stops accepting
+// connections and finishes the reviews in flight, before closers release the
+// dependents of the handlers, e.g. flush the audit log.
+func serve(srv *http.Server, listen func() error, stopCh <-chan struct{}, closers []func()) {
+	shutdown := make(chan struct{})
+	if stopCh != nil {
+		go func() {
+			defer close(shutdown)
+			<-stopCh
+			klog.Infoln("shutting down server")
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := srv.Shutdown(ctx); err != nil {
+				klog.Errorf("failed to shut down server: %v", err)
+			}
+		}()
+	}
+
+	if err := listen(); !errors.Is(err, http.ErrServerClosed) {
+		klog.Fatalln(err)
+	}
+	<-shutdown
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i]()
+	}
+}
+
+// reloadable is a provider configured from files, e.g. a policy file
+type reloadable interface {
+	Configure() error
+	Watch(stopCh <-chan struct{}) error
+}
+
+// configureFile loads the files of r. In cluster, they are reloaded when the
+// secret or config map they are mounted from is updated.
+func configureFile(r reloadable, stopCh <-chan struct{}) {
+	if err := r.Configure(); err != nil {
+		klog.Fatalln(err)
+	}
+	if meta.PossiblyInCluster() {
+		if err := r.Watch(stopCh); err != nil {
+			klog.Fatal(err)
+		}
+	}
 }
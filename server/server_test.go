@@ -17,10 +17,12 @@ limitations under the License.
 package server
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/stretchr/testify/assert"
@@ -165,3 +167,51 @@ func TestLoggerWithSkipPathsPreservesHandler(t *testing.T) {
 	assert.Equal(t, expectedHeaderValue, rec.Header().Get(expectedHeader))
 	assert.Equal(t, expectedBody, rec.Body.String())
 }
+
+func TestServeShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	var closed atomic.Bool
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		// dependents like the auditor are still open while reviews are in flight
+		assert.False(t, closed.Load())
+		w.WriteHeader(http.StatusOK)
+	})}
+
+	stopCh := make(chan struct{})
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		serve(srv, func() error { return srv.Serve(ln) }, stopCh, []func(){func() { closed.Store(true) }})
+	}()
+
+	resp := make(chan int)
+	go func() {
+		r, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			resp <- 0
+			return
+		}
+		_ = r.Body.Close()
+		resp <- r.StatusCode
+	}()
+	<-started
+	close(stopCh)
+
+	select {
+	case <-served:
+		t.Fatal("server must wait for the review in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.False(t, closed.Load())
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-resp)
+	<-served
+	assert.True(t, closed.Load())
+}
@@ -0,0 +1,200 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.kubeguard.dev/guard/auth"
+	"go.kubeguard.dev/guard/authz"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	v "gomodules.xyz/x/version"
+	apps "k8s.io/api/apps/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const tracerName = "go.kubeguard.dev/guard/server"
+
+type TracingOptions struct {
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector, tracing is disabled if empty
+	OTLPEndpoint string
+
+	// SamplingRatio of traces started by guard. Requests from the apiserver
+	// carrying a traceparent header follow the sampling decision of the apiserver.
+	SamplingRatio float64
+
+	ServiceName string
+}
+
+func NewTracingOptions() TracingOptions {
+	return TracingOptions{
+		SamplingRatio: 0.01,
+		ServiceName:   "guard",
+	}
+}
+
+func (o *TracingOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.OTLPEndpoint, "tracing-otlp-endpoint", o.OTLPEndpoint, "URL of the OTLP/HTTP endpoint traces are exported to, e.g. http://otel-collector:4318. Tracing is disabled if empty")
+	fs.Float64Var(&o.SamplingRatio, "tracing-sampling-ratio", o.SamplingRatio, "Ratio of requests without a sampled traceparent header that are traced, between 0 and 1")
+	fs.StringVar(&o.ServiceName, "tracing-service-name", o.ServiceName, "Service name reported with the traces")
+}
+
+func (o TracingOptions) Apply(d *apps.Deployment) (extraObjs []runtime.Object, err error) {
+	if !o.Enabled() {
+		return nil, nil
+	}
+	container := d.Spec.Template.Spec.Containers[0]
+
+	args := container.Args
+	args = append(args, fmt.Sprintf("--tracing-otlp-endpoint=%s", o.OTLPEndpoint))
+	args = append(args, fmt.Sprintf("--tracing-sampling-ratio=%v", o.SamplingRatio))
+	args = append(args, fmt.Sprintf("--tracing-service-name=%s", o.ServiceName))
+
+	container.Args = args
+	d.Spec.Template.Spec.Containers[0] = container
+
+	return nil, nil
+}
+
+func (o *TracingOptions) Validate() []error {
+	var errs []error
+	if o.OTLPEndpoint != "" {
+		if u, err := url.Parse(o.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("tracing-otlp-endpoint must be a valid http or https url"))
+		}
+	}
+	if o.SamplingRatio < 0 || o.SamplingRatio > 1 {
+		errs = append(errs, errors.New("tracing-sampling-ratio must be between 0 and 1"))
+	}
+	return errs
+}
+
+func (o *TracingOptions) Enabled() bool {
+	return o.OTLPEndpoint != ""
+}
+
+// setupTracing registers the global tracer provider and the W3C trace
+// context propagator. The returned func flushes the pending spans.
+func setupTracing(ctx context.Context, o TracingOptions) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(o.OTLPEndpoint))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create otlp trace exporter")
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(o.ServiceName),
+		semconv.ServiceVersion(v.Version.Version),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create trace resource")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SamplingRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// tracingMiddleware starts a server span for every request, continuing the
+// trace of the traceparent header sent by the apiserver
+func tracingMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "guard",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/healthz", "/readyz", "/metrics":
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// tracedAuthClient records a span for each token review of a provider
+type tracedAuthClient struct {
+	auth.Interface
+	provider string
+}
+
+func withAuthTracing(client auth.Interface, provider string) auth.Interface {
+	return tracedAuthClient{Interface: client, provider: provider}
+}
+
+func (c tracedAuthClient) Check(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "authenticate", trace.WithAttributes(
+		attribute.String("guard.provider", c.provider),
+	))
+	defer span.End()
+
+	resp, err := c.Interface.Check(ctx, token)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	} else if resp != nil {
+		span.SetAttributes(attribute.Int("guard.groups", len(resp.Groups)))
+	}
+	return resp, err
+}
+
+// tracedAuthzClient records a span for each subject access review of a provider
+type tracedAuthzClient struct {
+	authz.Interface
+	provider string
+}
+
+func withAuthzTracing(client authz.Interface, provider string) authz.Interface {
+	return tracedAuthzClient{Interface: client, provider: provider}
+}
+
+func (c tracedAuthzClient) Check(ctx context.Context, request *authzv1.SubjectAccessReviewSpec, store authz.Store) (*authzv1.SubjectAccessReviewStatus, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "authorize", trace.WithAttributes(
+		attribute.String("guard.provider", c.provider),
+	))
+	defer span.End()
+
+	resp, err := c.Interface.Check(ctx, request, store)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	} else if resp != nil {
+		span.SetAttributes(
+			attribute.Bool("guard.allowed", resp.Allowed),
+			attribute.Bool("guard.denied", resp.Denied),
+		)
+	}
+	return resp, err
+}
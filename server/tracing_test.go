@@ -0,0 +1,143 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.kubeguard.dev/guard/authz"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	authzv1 "k8s.io/api/authorization/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestTracingOptionsValidate(t *testing.T) {
+	testData := []struct {
+		testName    string
+		opts        TracingOptions
+		expectedErr []error
+	}{
+		{
+			"disabled by default",
+			NewTracingOptions(),
+			nil,
+		},
+		{
+			"otlp endpoint",
+			TracingOptions{OTLPEndpoint: "http://otel-collector:4318", SamplingRatio: 1},
+			nil,
+		},
+		{
+			"invalid endpoint and ratio",
+			TracingOptions{OTLPEndpoint: "otel-collector:4318", SamplingRatio: 2},
+			[]error{
+				errors.New("tracing-otlp-endpoint must be a valid http or https url"),
+				errors.New("tracing-sampling-ratio must be between 0 and 1"),
+			},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.testName, func(t *testing.T) {
+			errs := test.opts.Validate()
+			if test.expectedErr == nil {
+				assert.Nil(t, errs)
+			} else {
+				if assert.NotNil(t, errs, "errors expected") {
+					assert.EqualError(t, utilerrors.NewAggregate(errs), utilerrors.NewAggregate(test.expectedErr).Error())
+				}
+			}
+		})
+	}
+}
+
+func TestTracingPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevTP, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	p := fakeProvider{name: "github", tokens: map[string]string{"token": "nahid"}, calls: new(int)}
+	handler := tracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tokenreviews" {
+			return
+		}
+		_, _ = withAuthTracing(p, "github").Check(r.Context(), "token")
+		_, _ = withAuthTracing(p, "github").Check(r.Context(), "invalid")
+	}))
+
+	// the trace is continued from the traceparent header of the apiserver
+	req := httptest.NewRequest("POST", "https://guard.test/tokenreviews", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// health checks are not traced
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "https://guard.test/healthz", nil))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	server := spans[2]
+	assert.Equal(t, "POST /tokenreviews", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+
+	for _, span := range spans[:2] {
+		assert.Equal(t, "authenticate", span.Name())
+		assert.Equal(t, server.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "invalid token", spans[1].Status().Description)
+}
+
+type fakeAuthzProvider struct{}
+
+func (fakeAuthzProvider) Check(_ context.Context, _ *authzv1.SubjectAccessReviewSpec, _ authz.Store) (*authzv1.SubjectAccessReviewStatus, error) {
+	return &authzv1.SubjectAccessReviewStatus{Allowed: true}, nil
+}
+
+func TestTracedAuthzClient(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	_, _ = withAuthzTracing(fakeAuthzProvider{}, "azure").Check(context.Background(), nil, nil)
+	if spans := recorder.Ended(); assert.Len(t, spans, 1) {
+		assert.Equal(t, "authorize", spans[0].Name())
+		assert.Contains(t, spans[0].Attributes(), attribute.Bool("guard.allowed", true))
+	}
+}
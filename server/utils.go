@@ -47,7 +47,8 @@ func write(w http.ResponseWriter, info *auth.UserInfo, err error) {
 
 	if err != nil {
 		code := http.StatusUnauthorized
-		if v, ok := err.(errutils.HttpStatusCode); ok {
+		var v errutils.HttpStatusCode
+		if errors.As(err, &v) {
 			code = v.Code()
 		}
 		printStackTrace(err)
@@ -35,6 +35,8 @@ import (
 	"github.com/hashicorp/go-retryablehttp"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/oauth2"
 	v "gomodules.xyz/x/version"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -555,6 +557,15 @@ func MakeRetryableHttpClient(ctx context.Context, retryCount int) retryablehttp.
 		CheckRetry:   retryablehttp.DefaultRetryPolicy,
 		Backoff:      retryablehttp.DefaultBackoff,
 		Logger:       &contextAwareLogger{ctx: ctx},
+		// every attempt gets its own client span from the transport, mark the
+		// retries on the span of the caller
+		RequestLogHook: func(_ retryablehttp.Logger, req *http.Request, attempt int) {
+			if attempt > 0 {
+				trace.SpanFromContext(req.Context()).AddEvent("retry", trace.WithAttributes(
+					attribute.Int("http.request.resend_count", attempt),
+				))
+			}
+		},
 	}
 }
 
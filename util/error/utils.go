@@ -42,6 +42,7 @@ type withCode struct {
 
 func (w *withCode) Error() string { return w.cause.Error() }
 func (w *withCode) Cause() error  { return w.cause }
+func (w *withCode) Unwrap() error { return w.cause }
 func (w *withCode) Code() int     { return w.code }
 
 type HttpStatusCode interface {
@@ -34,10 +34,8 @@ func HijackDefaultHTTPClientTransportWithSelfSignedTLS() {
 	hijackOnce.Do(func() {
 		ts := httptest.NewTLSServer(http.NotFoundHandler())
 		if tt, ok := ts.Client().Transport.(*http.Transport); ok {
-			if httpClientTransport, ok := httpclient.DefaultHTTPClient.Transport.(*http.Transport); ok {
-				// Copy the TLS config from the test server to the checkAccess HTTP client
-				httpClientTransport.TLSClientConfig = tt.TLSClientConfig
-			}
+			// Copy the TLS config from the test server to the checkAccess HTTP client
+			httpclient.DefaultTransport.TLSClientConfig = tt.TLSClientConfig
 		}
 	})
 }
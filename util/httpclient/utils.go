@@ -17,6 +17,7 @@ limitations under the License.
 package httpclient
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
@@ -24,12 +25,16 @@ import (
 	"strconv"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/net/http2"
 	"k8s.io/klog/v2"
 )
 
 var (
-	DefaultHTTPClient             *http.Client
+	DefaultHTTPClient *http.Client
+	// DefaultTransport is the transport of DefaultHTTPClient before it is
+	// instrumented with tracing
+	DefaultTransport              *http.Transport
 	http2TransportPingEnabled     bool
 	http2TransportReadIdleTimeout time.Duration
 	http2TransportPingTimeout     time.Duration
@@ -84,17 +89,64 @@ func init() {
 			http2Transport.ReadIdleTimeout = http2TransportReadIdleTimeout
 			// if there's no response to the ping within the timeout, the connection will be closed
 			http2Transport.PingTimeout = http2TransportPingTimeout
+			DefaultTransport = tr2
 			DefaultHTTPClient = &http.Client{
-				Transport: tr2,
+				Transport: Instrument(tr2),
 			}
 			return
 		}
 	}
+	DefaultTransport = defaultTransport
 	DefaultHTTPClient = &http.Client{
-		Transport: defaultTransport,
+		Transport: Instrument(defaultTransport),
 	}
 }
 
+// Instrument records a client span for each request sent through rt and
+// propagates the trace context to the server. Spans are only exported once
+// the server enables tracing.
+func Instrument(rt http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(rt)
+}
+
+// InstrumentWithoutQuery instruments rt like Instrument, but the query is
+// removed from the url recorded in the span. It must be used for requests
+// carrying credentials in the query, e.g. presigned urls.
+func InstrumentWithoutQuery(rt http.RoundTripper) http.RoundTripper {
+	return &stripQuery{next: otelhttp.NewTransport(&restoreQuery{next: rt})}
+}
+
+type rawQueryKey struct{}
+
+// stripQuery hides the query from the instrumentation, restoreQuery puts it
+// back before the request is sent
+type stripQuery struct {
+	next http.RoundTripper
+}
+
+func (t *stripQuery) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.RawQuery == "" {
+		return t.next.RoundTrip(req)
+	}
+	r := req.Clone(context.WithValue(req.Context(), rawQueryKey{}, req.URL.RawQuery))
+	r.URL.RawQuery = ""
+	return t.next.RoundTrip(r)
+}
+
+type restoreQuery struct {
+	next http.RoundTripper
+}
+
+func (t *restoreQuery) RoundTrip(req *http.Request) (*http.Response, error) {
+	rawQuery, ok := req.Context().Value(rawQueryKey{}).(string)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	r := req.Clone(req.Context())
+	r.URL.RawQuery = rawQuery
+	return t.next.RoundTrip(r)
+}
+
 // Getter functions to access the read-only variables
 func IsHTTP2TransportPingEnabled() bool {
 	return http2TransportPingEnabled
@@ -105,9 +105,9 @@ func TestHTTPClientInitialization(t *testing.T) {
 func TestDefaultHTTPClient(t *testing.T) {
 	assert.NotNil(t, DefaultHTTPClient)
 	assert.IsType(t, &http.Client{}, DefaultHTTPClient)
-	assert.Equal(t, 100, DefaultHTTPClient.Transport.(*http.Transport).MaxIdleConns)
-	assert.Equal(t, 100, DefaultHTTPClient.Transport.(*http.Transport).MaxIdleConnsPerHost)
-	assert.Equal(t, 90*time.Second, DefaultHTTPClient.Transport.(*http.Transport).IdleConnTimeout)
-	assert.Equal(t, 10*time.Second, DefaultHTTPClient.Transport.(*http.Transport).TLSHandshakeTimeout)
-	assert.Equal(t, 1*time.Second, DefaultHTTPClient.Transport.(*http.Transport).ExpectContinueTimeout)
+	assert.Equal(t, 100, DefaultTransport.MaxIdleConns)
+	assert.Equal(t, 100, DefaultTransport.MaxIdleConnsPerHost)
+	assert.Equal(t, 90*time.Second, DefaultTransport.IdleConnTimeout)
+	assert.Equal(t, 10*time.Second, DefaultTransport.TLSHandshakeTimeout)
+	assert.Equal(t, 1*time.Second, DefaultTransport.ExpectContinueTimeout)
 }
@@ -0,0 +1,103 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"kmodules.xyz/client-go/tools/fsnotify"
+)
+
+// File holds the content loaded from one or more files, e.g. a policy file
+// and the rules compiled from it. If a reload fails, the previously loaded
+// content is kept but Ready reports the error until the files are fixed.
+type File[T any] struct {
+	name  string
+	files []string
+	load  func() (T, error)
+
+	lock    sync.RWMutex
+	value   T
+	loaded  bool
+	loadErr error
+}
+
+// NewFile returns a File loaded with load. name describes the first of files
+// in errors, the files are watched by Watch.
+func NewFile[T any](name string, load func() (T, error), files ...string) *File[T] {
+	return &File[T]{
+		name:  name,
+		files: files,
+		load:  load,
+	}
+}
+
+// Load loads the files. On error the previously loaded content is kept.
+func (f *File[T]) Load() error {
+	value, err := f.load()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.loadErr = err
+	if err != nil {
+		return err
+	}
+	f.value, f.loaded = value, true
+	return nil
+}
+
+// Get returns the loaded content, false if the files were never loaded
+func (f *File[T]) Get() (T, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.value, f.loaded
+}
+
+// Ready checks the last load succeeded
+func (f *File[T]) Ready() error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if f.loadErr != nil {
+		return errors.Wrapf(f.loadErr, "failed to load %s %s", f.name, f.files[0])
+	}
+	return nil
+}
+
+// Watch reloads the files when they are updated in their mounted secret or
+// config map, until stopCh is closed
+func (f *File[T]) Watch(stopCh <-chan struct{}) error {
+	dirs := map[string]bool{}
+	for _, file := range f.files {
+		dir := filepath.Dir(file)
+		if file == "" || dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		w := fsnotify.Watcher{
+			WatchDir: dir,
+			Reload:   f.Load,
+		}
+		if err := w.Run(stopCh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
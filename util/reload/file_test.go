@@ -0,0 +1,76 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	f := NewFile("policy file", func() (string, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if len(data) == 0 {
+			return "", errors.New("empty policy")
+		}
+		return string(data), nil
+	}, file)
+
+	// not loaded yet
+	_, loaded := f.Get()
+	assert.False(t, loaded)
+	assert.NotNil(t, f.Load())
+	_, loaded = f.Get()
+	assert.False(t, loaded)
+
+	if err := os.WriteFile(file, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, f.Load())
+	assert.Nil(t, f.Ready())
+	value, loaded := f.Get()
+	assert.True(t, loaded)
+	assert.Equal(t, "v1", value)
+
+	// a broken file keeps the loaded value, but is reported
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, f.Load())
+	if err := f.Ready(); assert.NotNil(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "failed to load policy file "+file))
+	}
+	value, _ = f.Get()
+	assert.Equal(t, "v1", value)
+
+	if err := os.WriteFile(file, []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, f.Load())
+	assert.Nil(t, f.Ready())
+	value, _ = f.Get()
+	assert.Equal(t, "v2", value)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright The Guard Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"gomodules.xyz/pointer"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MountConfigMap returns a config map named name with data and mounts it at
+// dir into the first container of d
+func MountConfigMap(d *apps.Deployment, name, dir string, data map[string]string) *core.ConfigMap {
+	cm := &core.ConfigMap{
+		ObjectMeta: objectMeta(d, name),
+		Data:       data,
+	}
+	mount(d, name, dir, core.VolumeSource{
+		ConfigMap: &core.ConfigMapVolumeSource{
+			LocalObjectReference: core.LocalObjectReference{Name: name},
+			DefaultMode:          pointer.Int32P(0o444),
+		},
+	})
+	return cm
+}
+
+// MountSecret returns a secret named name with data and mounts it at dir
+// into the first container of d
+func MountSecret(d *apps.Deployment, name, dir string, data map[string][]byte) *core.Secret {
+	secret := &core.Secret{
+		ObjectMeta: objectMeta(d, name),
+		Data:       data,
+	}
+	mount(d, name, dir, core.VolumeSource{
+		Secret: &core.SecretVolumeSource{
+			SecretName:  name,
+			DefaultMode: pointer.Int32P(0o444),
+		},
+	})
+	return secret
+}
+
+func objectMeta(d *apps.Deployment, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: d.Namespace,
+		Labels:    d.Labels,
+	}
+}
+
+func mount(d *apps.Deployment, name, dir string, source core.VolumeSource) {
+	container := &d.Spec.Template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+		Name:      name,
+		MountPath: dir,
+	})
+	d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, core.Volume{
+		Name:         name,
+		VolumeSource: source,
+	})
+}